@@ -81,6 +81,84 @@ const (
 	Swap ALUOp = 0xd0
 )
 
+// signedOffset is the Offset of signed division and modulo.
+const signedOffset = 1
+
+// Signed turns a division or modulo into its signed counterpart.
+//
+// Requires ISA v4. Returns an instruction with InvalidOpCode for
+// other operations.
+func (ins Instruction) Signed() Instruction {
+	ins.Offset = signedOffset
+	if !ins.IsSigned() {
+		return Instruction{OpCode: InvalidOpCode}
+	}
+	return ins
+}
+
+// IsSigned returns true if ins is a signed division or modulo.
+func (ins Instruction) IsSigned() bool {
+	op := ins.OpCode
+	if cls := op.Class(); cls != ALUClass && cls != ALU64Class {
+		return false
+	}
+
+	aop := op.ALUOp()
+	return (aop == Div || aop == Mod) && ins.Offset == signedOffset
+}
+
+// MovSX emits `dst = src`, sign extending the lower size bytes of src.
+//
+// Requires ISA v4. Returns an instruction with InvalidOpCode for DWord.
+func MovSX(dst, src Register, size Size) Instruction {
+	return movSX(Mov.Reg(dst, src), size)
+}
+
+// MovSX32 emits `dst = src`, sign extending the lower size bytes of src
+// and zeroing the upper 32 bit of dst.
+//
+// Requires ISA v4. Returns an instruction with InvalidOpCode for Word
+// and DWord.
+func MovSX32(dst, src Register, size Size) Instruction {
+	return movSX(Mov.Reg32(dst, src), size)
+}
+
+func movSX(ins Instruction, size Size) Instruction {
+	if size == InvalidSize || size == DWord {
+		return Instruction{OpCode: InvalidOpCode}
+	}
+
+	ins.Offset = int16(size.Sizeof() * 8)
+	if ins.SignExtension() != size {
+		return Instruction{OpCode: InvalidOpCode}
+	}
+	return ins
+}
+
+// SignExtension returns the size of the part of src which a sign
+// extending move copies into dst. Returns InvalidSize for other
+// instructions.
+func (ins Instruction) SignExtension() Size {
+	op := ins.OpCode
+	cls := op.Class()
+	if (cls != ALUClass && cls != ALU64Class) || op.ALUOp() != Mov || op.Source() != RegSource {
+		return InvalidSize
+	}
+
+	switch ins.Offset {
+	case 8:
+		return Byte
+	case 16:
+		return Half
+	case 32:
+		// There is no 32 bit move which sign extends a word.
+		if cls == ALU64Class {
+			return Word
+		}
+	}
+	return InvalidSize
+}
+
 // HostTo converts from host to another endianness.
 func HostTo(endian Endianness, dst Register, size Size) Instruction {
 	var imm int64
@@ -102,6 +180,17 @@ func HostTo(endian Endianness, dst Register, size Size) Instruction {
 	}
 }
 
+// BSwap unconditionally reverses the order of bytes in dst.
+//
+// Requires ISA v4.
+func BSwap(dst Register, size Size) Instruction {
+	ins := HostTo(LE, dst, size)
+	if ins.OpCode != InvalidOpCode {
+		ins.OpCode = OpCode(ALU64Class).SetALUOp(Swap)
+	}
+	return ins
+}
+
 // Op returns the OpCode for an ALU operation with a given source.
 func (op ALUOp) Op(source Source) OpCode {
 	return OpCode(ALU64Class).SetALUOp(op).SetSource(source)
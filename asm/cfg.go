@@ -0,0 +1,298 @@
+package asm
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Block is a basic block: a sequence of instructions which is
+// only entered at the start and only left at the end.
+//
+// bpf-to-bpf calls don't terminate a block.
+type Block struct {
+	// Start is the index of the first instruction in the block,
+	// End is one past the index of the last instruction.
+	Start, End int
+	// Function is the entry block of the function containing this block.
+	Function *Block
+
+	Successors   []*Block
+	Predecessors []*Block
+	// Entry blocks of functions called from this block.
+	Calls []*Block
+}
+
+func (b *Block) String() string {
+	return fmt.Sprintf("block %d-%d", b.Start, b.End-1)
+}
+
+// Edge is a transfer of control flow between two instructions.
+type Edge struct {
+	From, To int
+}
+
+// CFG is the control flow graph of a program.
+type CFG struct {
+	// Blocks ordered by their position in the instructions.
+	Blocks []*Block
+	// Entry blocks of the program and all functions called
+	// via bpf-to-bpf calls, ordered by position.
+	Functions []*Block
+
+	insns Instructions
+	// Blocks ending by falling off the end of their function.
+	fallThroughs []*Block
+}
+
+// CFG computes the control flow graph of insns.
+//
+// The first instruction is the entry point of the program.
+func (insns Instructions) CFG() (*CFG, error) {
+	if len(insns) == 0 {
+		return nil, errors.New("no instructions")
+	}
+
+	targets, err := insns.Targets()
+	if err != nil {
+		return nil, err
+	}
+
+	leaders := map[int]bool{0: true}
+	entries := map[int]bool{0: true}
+	for i, ins := range insns {
+		if targets[i] == -1 {
+			if ins.OpCode.JumpOp() == Exit && ins.OpCode.Class() == JumpClass {
+				leaders[i+1] = true
+			}
+			continue
+		}
+
+		leaders[targets[i]] = true
+		if ins.OpCode.JumpOp() == Call {
+			entries[targets[i]] = true
+		} else {
+			leaders[i+1] = true
+		}
+	}
+
+	cfg := &CFG{insns: insns}
+	byStart := make(map[int]*Block)
+	for i := range insns {
+		if !leaders[i] {
+			continue
+		}
+
+		if n := len(cfg.Blocks); n > 0 {
+			cfg.Blocks[n-1].End = i
+		}
+
+		block := &Block{Start: i}
+		cfg.Blocks = append(cfg.Blocks, block)
+		byStart[i] = block
+
+		if entries[i] {
+			cfg.Functions = append(cfg.Functions, block)
+		}
+		block.Function = cfg.Functions[len(cfg.Functions)-1]
+	}
+	cfg.Blocks[len(cfg.Blocks)-1].End = len(insns)
+
+	link := func(from, to *Block) {
+		from.Successors = append(from.Successors, to)
+		to.Predecessors = append(to.Predecessors, from)
+	}
+
+	for _, block := range cfg.Blocks {
+		for i := block.Start; i < block.End; i++ {
+			if insns[i].OpCode.Class() == JumpClass && insns[i].OpCode.JumpOp() == Call && targets[i] != -1 {
+				block.Calls = append(block.Calls, byStart[targets[i]])
+			}
+		}
+
+		last := block.End - 1
+		op := insns[last].OpCode
+		isJump := op.Class().isJump() && op.JumpOp() != Call
+
+		if isJump && op.JumpOp() == Exit {
+			continue
+		}
+
+		if isJump {
+			link(block, byStart[targets[last]])
+			if op.JumpOp() == Ja {
+				continue
+			}
+		}
+
+		next := byStart[block.End]
+		if next == nil || next.Function != block.Function {
+			cfg.fallThroughs = append(cfg.fallThroughs, block)
+			continue
+		}
+
+		if !isJump || next != block.Successors[0] {
+			link(block, next)
+		}
+	}
+
+	return cfg, nil
+}
+
+// Unreachable returns the indices of all instructions which can't
+// be reached from the entry point of the program.
+func (cfg *CFG) Unreachable() []int {
+	seen := make(map[*Block]bool)
+	stack := []*Block{cfg.Blocks[0]}
+	for len(stack) > 0 {
+		block := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if seen[block] {
+			continue
+		}
+		seen[block] = true
+
+		stack = append(stack, block.Successors...)
+		stack = append(stack, block.Calls...)
+	}
+
+	var unreachable []int
+	for _, block := range cfg.Blocks {
+		if seen[block] {
+			continue
+		}
+
+		for i := block.Start; i < block.End; i++ {
+			unreachable = append(unreachable, i)
+		}
+	}
+	return unreachable
+}
+
+// BackEdges returns all jumps which form a loop.
+//
+// Kernels before 5.3 reject programs containing them.
+func (cfg *CFG) BackEdges() []Edge {
+	const (
+		unvisited = iota
+		active
+		done
+	)
+
+	var (
+		state = make(map[*Block]int)
+		edges []Edge
+		visit func(*Block)
+	)
+
+	visit = func(block *Block) {
+		state[block] = active
+		for _, succ := range block.Successors {
+			switch state[succ] {
+			case unvisited:
+				visit(succ)
+			case active:
+				edges = append(edges, Edge{block.End - 1, succ.Start})
+			}
+		}
+		state[block] = done
+	}
+
+	for _, fn := range cfg.Functions {
+		visit(fn)
+	}
+
+	// Blocks which aren't reachable from a function entry can
+	// still contain loops.
+	for _, block := range cfg.Blocks {
+		if state[block] == unvisited {
+			visit(block)
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].From < edges[j].From
+	})
+	return edges
+}
+
+// MissingExits returns the indices of instructions after which
+// execution runs off the end of a function.
+func (cfg *CFG) MissingExits() []int {
+	var indices []int
+	for _, block := range cfg.fallThroughs {
+		indices = append(indices, block.End-1)
+	}
+	return indices
+}
+
+// Block returns the block containing the instruction at index i,
+// or nil.
+func (cfg *CFG) Block(i int) *Block {
+	n := sort.Search(len(cfg.Blocks), func(j int) bool {
+		return cfg.Blocks[j].End > i
+	})
+	if n == len(cfg.Blocks) || i < cfg.Blocks[n].Start {
+		return nil
+	}
+	return cfg.Blocks[n]
+}
+
+// WriteDOT writes the graph in the DOT language used by graphviz.
+//
+// Jumps are drawn as solid edges, bpf-to-bpf calls as dashed ones.
+func (cfg *CFG) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph cfg {\n")
+	b.WriteString("\tnode [shape=box fontname=monospace];\n")
+
+	name := func(block *Block) string {
+		return fmt.Sprintf("b%d", block.Start)
+	}
+
+	for _, fn := range cfg.Functions {
+		label := cfg.insns[fn.Start].Symbol
+		if label == "" {
+			label = fmt.Sprintf("function at %d", fn.Start)
+		}
+
+		fmt.Fprintf(&b, "\tsubgraph cluster_%s {\n", name(fn))
+		fmt.Fprintf(&b, "\t\tlabel=%q;\n", label)
+		for _, block := range cfg.Blocks {
+			if block.Function != fn {
+				continue
+			}
+
+			var text strings.Builder
+			for i := block.Start; i < block.End; i++ {
+				if sym := cfg.insns[i].Symbol; sym != "" {
+					fmt.Fprintf(&text, "%s:\\l", sym)
+				}
+				fmt.Fprintf(&text, "%d: %s\\l", i, dotEscape(fmt.Sprint(cfg.insns[i])))
+			}
+			fmt.Fprintf(&b, "\t\t%s [label=\"%s\"];\n", name(block), text.String())
+		}
+		b.WriteString("\t}\n")
+	}
+
+	for _, block := range cfg.Blocks {
+		for _, succ := range block.Successors {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", name(block), name(succ))
+		}
+		for _, callee := range block.Calls {
+			fmt.Fprintf(&b, "\t%s -> %s [style=dashed];\n", name(block), name(callee))
+		}
+	}
+
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,93 @@
+package asm
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCFG(t *testing.T) {
+	insns := Instructions{
+		Mov.Imm(R0, 0),             // 0
+		JEq.Imm(R1, 0, "skip"),     // 1
+		Call.Label("fn"),           // 2
+		Ja.Label("out"),            // 3
+		Mov.Imm(R0, 1),             // 4: unreachable
+		Mov.Imm(R0, 2).Sym("skip"), // 5
+		Return().Sym("out"),        // 6
+		Mov.Imm(R0, 0).Sym("fn"),   // 7
+		Add.Imm(R0, 1).Sym("loop"), // 8
+		JLT.Imm(R0, 10, "loop"),    // 9
+		Mov.Imm(R1, 0),             // 10: falls off the end
+	}
+
+	cfg, err := insns.CFG()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var starts []int
+	for _, block := range cfg.Blocks {
+		starts = append(starts, block.Start)
+	}
+	if want := []int{0, 2, 4, 5, 6, 7, 8, 10}; !reflect.DeepEqual(starts, want) {
+		t.Errorf("Expected blocks at %v, got %v", want, starts)
+	}
+
+	if len(cfg.Functions) != 2 || cfg.Functions[1].Start != 7 {
+		t.Errorf("Expected functions at 0 and 7, got %v", cfg.Functions)
+	}
+
+	if b := cfg.Block(9); b.Start != 8 || b.Function.Start != 7 {
+		t.Errorf("Instruction 9 is in %v of function %v", b, b.Function)
+	}
+
+	if b := cfg.Block(2); len(b.Calls) != 1 || b.Calls[0].Start != 7 {
+		t.Errorf("Missing call edge from %v", b)
+	}
+
+	if b := cfg.Block(6); len(b.Predecessors) != 2 || b.Predecessors[0].Start != 2 {
+		t.Errorf("Wrong predecessors for %v: %v", b, b.Predecessors)
+	}
+
+	if have := cfg.Unreachable(); !reflect.DeepEqual(have, []int{4}) {
+		t.Error("Expected instruction 4 to be unreachable, got", have)
+	}
+
+	if have := cfg.BackEdges(); !reflect.DeepEqual(have, []Edge{{9, 8}}) {
+		t.Error("Expected back edge from 9 to 8, got", have)
+	}
+
+	if have := cfg.MissingExits(); !reflect.DeepEqual(have, []int{10}) {
+		t.Error("Expected missing exit after 10, got", have)
+	}
+
+	var dot bytes.Buffer
+	if err := cfg.WriteDOT(&dot); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"b8 -> b8;", "b2 -> b7 [style=dashed];", `label="fn"`} {
+		if !strings.Contains(dot.String(), want) {
+			t.Errorf("DOT output doesn't contain %q:\n%s", want, dot.String())
+		}
+	}
+}
+
+func TestCFGMissingExitBeforeFunction(t *testing.T) {
+	insns := Instructions{
+		Call.Label("fn"),
+		Mov.Imm(R0, 0),
+		Return().Sym("fn"),
+	}
+
+	cfg, err := insns.CFG()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have := cfg.MissingExits(); !reflect.DeepEqual(have, []int{1}) {
+		t.Error("Expected missing exit after 1, got", have)
+	}
+}
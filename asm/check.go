@@ -0,0 +1,499 @@
+package asm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//go:generate stringer -output check_string.go -type=ValueKind
+
+// ValueKind is the kind of value held by a register.
+type ValueKind uint8
+
+const (
+	// Uninitialized registers must not be read.
+	Uninitialized ValueKind = iota
+	// Unknown is an initialized value of undetermined kind.
+	Unknown
+	// Scalar is a plain number.
+	Scalar
+	// PointerToContext is the program context passed in R1.
+	PointerToContext
+	// PointerToStack points into the stack of the current function.
+	PointerToStack
+	// PointerToMap is a map, as loaded by LoadMapPtr.
+	PointerToMap
+	// PointerToMapValue points at a value in a map.
+	PointerToMapValue
+	// PointerToMapValueOrNull is the result of a map lookup which
+	// hasn't been checked for NULL.
+	PointerToMapValueOrNull
+	// PointerToPacket points into packet data.
+	PointerToPacket
+	// PointerToPacketEnd points at the end of packet data.
+	PointerToPacketEnd
+)
+
+// isPointer returns true if the value can be dereferenced.
+func (vk ValueKind) isPointer() bool {
+	switch vk {
+	case PointerToContext, PointerToStack, PointerToMapValue, PointerToPacket:
+		return true
+	default:
+		return false
+	}
+}
+
+// maxStackSize is the number of bytes of stack available to a function.
+const maxStackSize = 512
+
+// CheckOptions control the analysis performed by Check.
+type CheckOptions struct {
+	// ContextPointers maps offsets into the context to the kind of
+	// pointer loaded from there, for example PointerToPacket for
+	// the data field of struct xdp_md.
+	ContextPointers map[int16]ValueKind
+}
+
+// Finding is a problem detected by Check.
+type Finding struct {
+	// Index of the offending instruction.
+	Index   int
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("instruction %d: %s", f.Index, f.Message)
+}
+
+// CheckResult is the outcome of Check.
+type CheckResult struct {
+	// StackDepth is the largest number of bytes of stack used by
+	// any single function, relative to R10.
+	StackDepth int
+	// Findings ordered by instruction.
+	Findings []Finding
+}
+
+// Err returns an error summarising all findings, or nil.
+func (cr *CheckResult) Err() error {
+	if len(cr.Findings) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, 0, len(cr.Findings))
+	for _, f := range cr.Findings {
+		msgs = append(msgs, f.String())
+	}
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+// Check runs a static analysis of the program, which catches
+// some mistakes before the kernel verifier does.
+//
+// It tracks which registers are initialized and what kind of value
+// they hold, and reports reads of uninitialized registers, out of
+// bounds stack accesses and helper calls with wrong argument kinds.
+//
+// The analysis is conservative: a program without findings may
+// still be rejected by the verifier.
+func (insns Instructions) Check(opts CheckOptions) (*CheckResult, error) {
+	cfg, err := insns.CFG()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &checker{
+		insns:  insns,
+		cfg:    cfg,
+		opts:   opts,
+		in:     make(map[*Block]*checkState),
+		depths: make(map[*Block]int),
+	}
+	c.run()
+
+	result := &CheckResult{}
+	seen := make(map[Finding]bool)
+	for _, f := range c.findings {
+		if !seen[f] {
+			result.Findings = append(result.Findings, f)
+			seen[f] = true
+		}
+	}
+	sort.SliceStable(result.Findings, func(i, j int) bool {
+		return result.Findings[i].Index < result.Findings[j].Index
+	})
+
+	for _, depth := range c.depths {
+		if depth > result.StackDepth {
+			result.StackDepth = depth
+		}
+	}
+
+	return result, nil
+}
+
+type regState struct {
+	kind ValueKind
+	// Offset relative to R10 if kind is PointerToStack
+	// and known is true.
+	off   int64
+	known bool
+}
+
+func (rs regState) join(other regState) regState {
+	if rs == other {
+		return rs
+	}
+
+	a, b := rs.kind, other.kind
+	switch {
+	case a == Uninitialized || b == Uninitialized:
+		return regState{kind: Uninitialized}
+
+	case a == b:
+		return regState{kind: a}
+
+	case isMaybeNull(a) && isMaybeNull(b):
+		// A NULL check merging back into the same path.
+		return regState{kind: PointerToMapValueOrNull}
+
+	default:
+		return regState{kind: Unknown}
+	}
+}
+
+func isMaybeNull(vk ValueKind) bool {
+	return vk == Scalar || vk == PointerToMapValue || vk == PointerToMapValueOrNull
+}
+
+type checkState [R10 + 1]regState
+
+func (cs *checkState) join(other *checkState) checkState {
+	var result checkState
+	for i := range cs {
+		result[i] = cs[i].join(other[i])
+	}
+	return result
+}
+
+type checker struct {
+	insns    Instructions
+	cfg      *CFG
+	opts     CheckOptions
+	in       map[*Block]*checkState
+	depths   map[*Block]int
+	findings []Finding
+	// Findings are only recorded once the analysis has converged.
+	report bool
+}
+
+func (c *checker) run() {
+	var work []*Block
+	for i, fn := range c.cfg.Functions {
+		var entry checkState
+		if i == 0 {
+			entry[R1] = regState{kind: PointerToContext}
+		} else {
+			// Arguments to bpf-to-bpf calls.
+			for r := R1; r <= R5; r++ {
+				entry[r] = regState{kind: Unknown}
+			}
+		}
+		entry[R10] = regState{kind: PointerToStack, known: true}
+
+		c.in[fn] = &entry
+		work = append(work, fn)
+	}
+
+	for len(work) > 0 {
+		block := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		out := c.transfer(block, *c.in[block])
+		for _, succ := range block.Successors {
+			state := c.refine(block, succ, out)
+
+			prev := c.in[succ]
+			if prev == nil {
+				c.in[succ] = &state
+				work = append(work, succ)
+				continue
+			}
+
+			if joined := prev.join(&state); joined != *prev {
+				*prev = joined
+				work = append(work, succ)
+			}
+		}
+	}
+
+	c.report = true
+	for _, block := range c.cfg.Blocks {
+		if state := c.in[block]; state != nil {
+			c.transfer(block, *state)
+		}
+	}
+}
+
+// refine narrows the state on the edge from block to succ, based
+// on NULL checks.
+func (c *checker) refine(block, succ *Block, state checkState) checkState {
+	last := c.insns[block.End-1]
+	op := last.OpCode
+	if op.Class() != JumpClass || op.Source() != ImmSource || last.Constant != 0 {
+		return state
+	}
+
+	jop := op.JumpOp()
+	if (jop != JEq && jop != JNE) || state[last.Dst].kind != PointerToMapValueOrNull {
+		return state
+	}
+
+	// Jumps to the next instruction only have a single successor.
+	if len(block.Successors) != 2 {
+		return state
+	}
+
+	// The jump target is always the first successor.
+	taken := succ == block.Successors[0]
+	isNull := taken == (jop == JEq)
+	if isNull {
+		state[last.Dst] = regState{kind: Scalar}
+	} else {
+		state[last.Dst] = regState{kind: PointerToMapValue}
+	}
+	return state
+}
+
+func (c *checker) transfer(block *Block, state checkState) checkState {
+	for i := block.Start; i < block.End; i++ {
+		c.step(block, &state, i)
+	}
+	return state
+}
+
+func (c *checker) reportf(i int, format string, args ...interface{}) {
+	if c.report {
+		c.findings = append(c.findings, Finding{i, fmt.Sprintf(format, args...)})
+	}
+}
+
+func (c *checker) step(block *Block, st *checkState, i int) {
+	ins := c.insns[i]
+	op := ins.OpCode
+
+	read := func(r Register) regState {
+		if r > R10 {
+			c.reportf(i, "invalid register %s", r)
+			return regState{kind: Unknown}
+		}
+		if st[r].kind == Uninitialized {
+			c.reportf(i, "read of uninitialized register %s", r)
+		}
+		return st[r]
+	}
+
+	write := func(r Register, rs regState) {
+		if r >= R10 {
+			c.reportf(i, "write to read-only register %s", r)
+			return
+		}
+		st[r] = rs
+	}
+
+	clobber := func() {
+		for r := R1; r <= R5; r++ {
+			st[r] = regState{}
+		}
+	}
+
+	switch op.Class() {
+	case ALUClass, ALU64Class:
+		c.alu(st, ins, read, write)
+
+	case JumpClass, Jump32Class:
+		switch jop := op.JumpOp(); jop {
+		case Exit:
+			read(R0)
+
+		case Call:
+			if ins.Src == R1 {
+				write(R0, regState{kind: Unknown})
+			} else {
+				write(R0, c.helper(st, i, BuiltinFunc(ins.Constant), read))
+			}
+			clobber()
+
+		case Ja:
+
+		default:
+			read(ins.Dst)
+			if op.Source() == RegSource {
+				read(ins.Src)
+			}
+		}
+
+	case LdClass:
+		switch op.Mode() {
+		case ImmMode:
+			switch ins.Src {
+			case R1:
+				write(ins.Dst, regState{kind: PointerToMap})
+			case R2:
+				write(ins.Dst, regState{kind: PointerToMapValue})
+			default:
+				write(ins.Dst, regState{kind: Scalar})
+			}
+
+		case AbsMode, IndMode:
+			if ctx := read(R6); ctx.kind != PointerToContext && ctx.kind != Unknown {
+				c.reportf(i, "packet access requires context in r6, have %s", ctx.kind)
+			}
+			if op.Mode() == IndMode {
+				read(ins.Src)
+			}
+			clobber()
+			write(R0, regState{kind: Scalar})
+		}
+
+	case LdXClass:
+		ptr := c.access(block, st, i, ins.Src, ins.Offset, op.Size(), read)
+
+		result := regState{kind: Scalar}
+		switch ptr.kind {
+		case PointerToContext:
+			if kind, ok := c.opts.ContextPointers[ins.Offset]; ok && op.Size() == Word {
+				result.kind = kind
+			}
+		case PointerToStack, Unknown:
+			// Spilled registers aren't tracked.
+			result.kind = Unknown
+		}
+		write(ins.Dst, result)
+
+	case StClass, StXClass:
+		if op.Class() == StXClass {
+			read(ins.Src)
+		}
+		c.access(block, st, i, ins.Dst, ins.Offset, op.Size(), read)
+
+		switch aop := ins.AtomicOp(); {
+		case aop == CmpXchg:
+			read(R0)
+			write(R0, regState{kind: Scalar})
+		case aop.Fetch():
+			write(ins.Src, regState{kind: Scalar})
+		}
+	}
+}
+
+func (c *checker) alu(st *checkState, ins Instruction, read func(Register) regState, write func(Register, regState)) {
+	op := ins.OpCode
+	is64 := op.Class() == ALU64Class
+
+	switch aluOp := op.ALUOp(); aluOp {
+	case Mov:
+		if op.Source() == ImmSource {
+			write(ins.Dst, regState{kind: Scalar})
+			return
+		}
+
+		src := read(ins.Src)
+		if (!is64 || ins.Offset != 0) && src.kind != Uninitialized {
+			src = regState{kind: Scalar}
+		}
+		write(ins.Dst, src)
+
+	case Neg, Swap:
+		read(ins.Dst)
+		write(ins.Dst, regState{kind: Scalar})
+
+	default:
+		dst := read(ins.Dst)
+		src := regState{kind: Scalar}
+		if op.Source() == RegSource {
+			src = read(ins.Src)
+		}
+
+		result := regState{kind: Scalar}
+		switch {
+		case dst.kind == Uninitialized || dst.kind == Unknown:
+			result = regState{kind: dst.kind}
+
+		case !is64 || (aluOp != Add && aluOp != Sub):
+
+		case (dst.kind.isPointer() || dst.kind == PointerToPacketEnd) && src.kind == Scalar:
+			result = dst
+			if op.Source() != ImmSource {
+				result.known = false
+			} else if aluOp == Add {
+				result.off += ins.Constant
+			} else {
+				result.off -= ins.Constant
+			}
+
+		case aluOp == Add && dst.kind == Scalar && src.kind.isPointer():
+			result = regState{kind: src.kind}
+
+		case src.kind == Unknown:
+			result = regState{kind: Unknown}
+		}
+		write(ins.Dst, result)
+	}
+}
+
+// access checks a memory access via base, and returns the state
+// of base.
+func (c *checker) access(block *Block, st *checkState, i int, base Register, off int16, size Size, read func(Register) regState) regState {
+	ptr := read(base)
+
+	switch ptr.kind {
+	case Scalar, PointerToMap, PointerToPacketEnd:
+		c.reportf(i, "invalid memory access via %s (%s)", base, ptr.kind)
+
+	case PointerToMapValueOrNull:
+		c.reportf(i, "memory access via %s, which may be NULL", base)
+
+	case PointerToStack:
+		if !ptr.known {
+			break
+		}
+
+		start := ptr.off + int64(off)
+		end := start + int64(size.Sizeof())
+		if start < -maxStackSize || end > 0 {
+			c.reportf(i, "stack access at offset %d is out of bounds", start)
+			break
+		}
+
+		fn := block.Function
+		if depth := int(-start); depth > c.depths[fn] {
+			c.depths[fn] = depth
+		}
+	}
+
+	return ptr
+}
+
+func (c *checker) helper(st *checkState, i int, fn BuiltinFunc, read func(Register) regState) regState {
+	info, ok := fn.Info()
+	if !ok {
+		return regState{kind: Scalar}
+	}
+
+	for n, want := range info.Args {
+		reg := R1 + Register(n)
+		if have := read(reg).kind; !want.accepts(have) {
+			c.reportf(i, "%s: argument %d (%s) should be %s, have %s", fn, n+1, reg, want.description(), have)
+		}
+	}
+
+	if info.Return == Uninitialized {
+		return regState{}
+	}
+	return regState{kind: info.Return}
+}
@@ -0,0 +1,152 @@
+package asm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	insns := Instructions{
+		StoreImm(RFP, -4, 0, Word),    // 0
+		LoadMapPtr(R1, 0),             // 1
+		Mov.Reg(R2, RFP),              // 2
+		Add.Imm(R2, -4),               // 3
+		MapLookupElement.Call(),       // 4
+		JEq.Imm(R0, 0, "exit"),        // 5
+		LoadMem(R1, R0, 0, DWord),     // 6
+		StoreMem(RFP, -16, R1, DWord), // 7
+		Mov.Imm(R0, 0).Sym("exit"),    // 8
+		Return(),                      // 9
+	}
+
+	result, err := insns.Check(CheckOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := result.Err(); err != nil {
+		t.Error("Valid program has findings:", err)
+	}
+
+	if result.StackDepth != 16 {
+		t.Error("Expected stack depth 16, got", result.StackDepth)
+	}
+}
+
+func TestCheckFindings(t *testing.T) {
+	testcases := []struct {
+		name  string
+		insns Instructions
+		index int
+		msg   string
+	}{
+		{
+			"uninitialized register",
+			Instructions{Mov.Reg(R0, R2), Return()},
+			0, "uninitialized register r2",
+		},
+		{
+			"stack out of bounds",
+			Instructions{StoreImm(RFP, -520, 0, DWord), Mov.Imm(R0, 0), Return()},
+			0, "out of bounds",
+		},
+		{
+			"stack above frame pointer",
+			Instructions{Mov.Reg(R1, RFP), StoreImm(R1, 0, 0, Word), Mov.Imm(R0, 0), Return()},
+			1, "out of bounds",
+		},
+		{
+			"write to frame pointer",
+			Instructions{Mov.Imm(RFP, 0), Mov.Imm(R0, 0), Return()},
+			0, "read-only register rfp",
+		},
+		{
+			"missing null check",
+			Instructions{
+				StoreImm(RFP, -4, 0, Word),
+				LoadMapPtr(R1, 0),
+				Mov.Reg(R2, RFP),
+				Add.Imm(R2, -4),
+				MapLookupElement.Call(),
+				LoadMem(R0, R0, 0, Word),
+				Return(),
+			},
+			5, "may be NULL",
+		},
+		{
+			"wrong helper argument",
+			Instructions{
+				Mov.Imm(R1, 0),
+				Mov.Reg(R2, RFP),
+				MapLookupElement.Call(),
+				Mov.Imm(R0, 0),
+				Return(),
+			},
+			2, "argument 1 (r1) should be a map, have Scalar",
+		},
+		{
+			"uninitialized helper argument",
+			Instructions{
+				LoadMapPtr(R1, 0),
+				MapLookupElement.Call(),
+				Mov.Imm(R0, 0),
+				Return(),
+			},
+			1, "argument 2 (r2) should be a non-NULL pointer, have Uninitialized",
+		},
+		{
+			"clobbered argument",
+			Instructions{
+				Mov.Reg(R6, R1),
+				KtimeGetNS.Call(),
+				Mov.Reg(R0, R1),
+				Return(),
+			},
+			2, "uninitialized register r1",
+		},
+		{
+			"uninitialized return value",
+			Instructions{Mov.Imm(R1, 0), Return()},
+			1, "uninitialized register r0",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := tc.insns.Check(CheckOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, f := range result.Findings {
+				if f.Index == tc.index && strings.Contains(f.Message, tc.msg) {
+					return
+				}
+			}
+			t.Errorf("Expected finding %q at %d, got %v", tc.msg, tc.index, result.Findings)
+		})
+	}
+}
+
+func TestCheckPacketPointers(t *testing.T) {
+	insns := Instructions{
+		LoadMem(R2, R1, 0, Word),
+		LoadMem(R3, R1, 4, Word),
+		LoadMem(R0, R3, 0, Byte),
+		Return(),
+	}
+
+	result, err := insns.Check(CheckOptions{
+		ContextPointers: map[int16]ValueKind{
+			0: PointerToPacket,
+			4: PointerToPacketEnd,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Findings) != 1 || result.Findings[0].Index != 2 {
+		t.Error("Expected access via packet end to be reported, got", result.Findings)
+	}
+}
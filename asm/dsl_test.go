@@ -24,6 +24,22 @@ func TestDSL(t *testing.T) {
 		{"Add.Imm32", Add.Imm32(R1, 22), Instruction{
 			OpCode: 0x04, Dst: R1, Constant: 22,
 		}},
+		{"Div.Reg.Signed", Div.Reg(R1, R2).Signed(), Instruction{OpCode: 0x3f, Dst: R1, Src: R2, Offset: 1}},
+		{"Mod.Imm32.Signed", Mod.Imm32(R1, 3).Signed(), Instruction{OpCode: 0x94, Dst: R1, Offset: 1, Constant: 3}},
+		{"Add.Reg.Signed", Add.Reg(R1, R2).Signed(), Instruction{OpCode: InvalidOpCode}},
+		{"MovSX", MovSX(R1, R2, Word), Instruction{OpCode: 0xbf, Dst: R1, Src: R2, Offset: 32}},
+		{"MovSX32", MovSX32(R1, R2, Half), Instruction{OpCode: 0xbc, Dst: R1, Src: R2, Offset: 16}},
+		{"MovSX.DWord", MovSX(R1, R2, DWord), Instruction{OpCode: InvalidOpCode}},
+		{"MovSX32.Word", MovSX32(R1, R2, Word), Instruction{OpCode: InvalidOpCode}},
+		{"BSwap", BSwap(R1, Word), Instruction{OpCode: 0xd7, Dst: R1, Constant: 32}},
+		{"LoadMemSX", LoadMemSX(R1, R2, -2, Half), Instruction{OpCode: 0x89, Dst: R1, Src: R2, Offset: -2}},
+		{"LongJump", LongJump("foo"), Instruction{OpCode: 0x06, Constant: -1, Reference: "foo"}},
+		{"JEq.Imm32", JEq.Imm32(R1, 22, "foo"), Instruction{
+			OpCode: 0x16, Dst: R1, Offset: -1, Constant: 22, Reference: "foo",
+		}},
+		{"JSGT.Reg32", JSGT.Reg32(R1, R2, "foo"), Instruction{
+			OpCode: 0x6e, Dst: R1, Src: R2, Offset: -1, Reference: "foo",
+		}},
 	}
 
 	for _, tc := range testcases {
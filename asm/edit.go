@@ -0,0 +1,250 @@
+package asm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// LabelJumps converts jumps and bpf-to-bpf calls which use a numeric
+// offset into references to a symbol.
+//
+// Targets without a symbol receive a generated one, which is derived
+// from the symbol of the first instruction. Jumps which already use
+// a Reference are left alone, even if the symbol is not part of insns.
+//
+// Labelled instructions stay valid when instructions are added or
+// removed, see Insert, Replace and Remove. insns is left unchanged if
+// a jump can't be labelled.
+func (insns Instructions) LabelJumps() error {
+	symbols, err := insns.SymbolOffsets()
+	if err != nil {
+		return err
+	}
+
+	var prefix string
+	if len(insns) > 0 {
+		prefix = insns[0].Symbol
+	}
+
+	labelled := append(Instructions(nil), insns...)
+	positions, indices := insns.positions()
+	next := 0
+	for i := range labelled {
+		ins := &labelled[i]
+
+		offset, ok := ins.branchOffset()
+		if !ok || offset == -1 {
+			continue
+		}
+
+		target, ok := indices[positions[i]+1+int(offset)]
+		if !ok {
+			return errors.Errorf("instruction %d: invalid offset %d", i, offset)
+		}
+
+		if labelled[target].Symbol == "" {
+			var name string
+			for {
+				name = fmt.Sprintf("%s.L%d", prefix, next)
+				next++
+				if _, ok := symbols[name]; !ok {
+					break
+				}
+			}
+
+			labelled[target].Symbol = name
+			symbols[name] = target
+		}
+
+		ins.setBranchReference(labelled[target].Symbol)
+	}
+
+	copy(insns, labelled)
+	return nil
+}
+
+// UnlabelJumps reverses LabelJumps. It converts jumps which refer to a
+// symbol in insns back into numeric offsets, and removes the symbols
+// in labels.
+//
+// bpf-to-bpf calls keep their reference unless it is one of labels,
+// since that is how calls to other functions are expressed.
+//
+// insns is left unchanged if a jump can't be converted.
+func (insns Instructions) UnlabelJumps(labels map[string]bool) error {
+	offsets, err := insns.SymbolOffsets()
+	if err != nil {
+		return err
+	}
+
+	unlabelled := append(Instructions(nil), insns...)
+	positions, _ := insns.positions()
+	for i := range unlabelled {
+		ins := &unlabelled[i]
+
+		if offset, ok := ins.branchOffset(); !ok || offset != -1 {
+			continue
+		}
+
+		target, ok := offsets[ins.Reference]
+		switch {
+		case ins.OpCode.JumpOp() == Call && !labels[ins.Reference]:
+			continue
+		case !ok && labels[ins.Reference]:
+			return errors.Errorf("instruction %d: reference to missing symbol %s", i, ins.Reference)
+		case !ok:
+			continue
+		}
+
+		if err := ins.setBranchOffset(positions[target] - positions[i] - 1); err != nil {
+			return errors.Wrapf(err, "instruction %d", i)
+		}
+	}
+
+	for i := range unlabelled {
+		if labels[unlabelled[i].Symbol] {
+			unlabelled[i].Symbol = ""
+		}
+	}
+
+	copy(insns, unlabelled)
+	return nil
+}
+
+func (ins *Instruction) setBranchReference(symbol string) {
+	ins.Reference = symbol
+	if ins.OpCode.JumpOp() == Call || ins.OpCode == longJumpOp {
+		ins.Constant = -1
+	} else {
+		ins.Offset = -1
+	}
+}
+
+func (ins *Instruction) setBranchOffset(offset int) error {
+	if ins.OpCode.JumpOp() == Call || ins.OpCode == longJumpOp {
+		if offset < math.MinInt32 || offset > math.MaxInt32 {
+			return errors.Errorf("offset %d is out of range", offset)
+		}
+		ins.Constant = int64(offset)
+	} else {
+		if offset < math.MinInt16 || offset > math.MaxInt16 {
+			return errors.Errorf("offset %d is out of range", offset)
+		}
+		ins.Offset = int16(offset)
+	}
+
+	ins.Reference = ""
+	return nil
+}
+
+// Insert adds instructions before index.
+//
+// Jumps and calls which targeted the instruction at index now target
+// the first inserted instruction. All other jumps keep their target.
+// Jumps in new which use a numeric offset are interpreted relative to
+// their final position.
+func (insns *Instructions) Insert(index int, new ...Instruction) error {
+	if index < 0 || index > len(*insns) {
+		return errors.Errorf("index %d is out of range", index)
+	}
+
+	if index == len(*insns) || len(new) == 0 {
+		return insns.splice(index, index, new)
+	}
+
+	// Re-inserting the instruction at index after new moves its
+	// symbol to the start of new. The labels are only kept if the
+	// insertion succeeds.
+	labelled := append(Instructions(nil), *insns...)
+	if err := labelled.LabelJumps(); err != nil {
+		return err
+	}
+	moved := labelled[index]
+	moved.Symbol = ""
+
+	if err := labelled.splice(index, index+1, append(append(Instructions(nil), new...), moved)); err != nil {
+		return err
+	}
+
+	*insns = labelled
+	return nil
+}
+
+// Replace substitutes the instructions in the range [start, end) with new.
+//
+// Jumps and calls which targeted a replaced instruction now target the
+// first instruction of new, or the instruction following the range if
+// new is empty. All other jumps keep their target.
+// Jumps in new which use a numeric offset are interpreted relative to
+// their final position.
+func (insns *Instructions) Replace(start, end int, new ...Instruction) error {
+	if start < 0 || end < start || end > len(*insns) {
+		return errors.Errorf("range [%d, %d) is out of bounds", start, end)
+	}
+
+	return insns.splice(start, end, new)
+}
+
+// Remove deletes the instructions in the range [start, end).
+//
+// Jumps and calls which targeted a removed instruction now target the
+// instruction following the range.
+func (insns *Instructions) Remove(start, end int) error {
+	return insns.Replace(start, end)
+}
+
+// splice replaces the range [start, end) with new. insns is only
+// modified if splice succeeds.
+func (insns *Instructions) splice(start, end int, new Instructions) error {
+	old := append(Instructions(nil), *insns...)
+	if err := old.LabelJumps(); err != nil {
+		return err
+	}
+
+	result := make(Instructions, 0, len(old)-(end-start)+len(new))
+	result = append(result, old[:start]...)
+	result = append(result, new...)
+	result = append(result, old[end:]...)
+
+	// The instruction at start takes over the symbols of all
+	// removed instructions.
+	var (
+		renames = make(map[string]string)
+		dropped = make(map[string]bool)
+	)
+	for _, ins := range old[start:end] {
+		switch {
+		case ins.Symbol == "":
+		case start == len(result):
+			dropped[ins.Symbol] = true
+		case result[start].Symbol == "":
+			result[start].Symbol = ins.Symbol
+		case result[start].Symbol != ins.Symbol:
+			renames[ins.Symbol] = result[start].Symbol
+		}
+	}
+
+	for i := range result {
+		ins := &result[i]
+		if offset, ok := ins.branchOffset(); !ok || offset != -1 {
+			continue
+		}
+
+		if dropped[ins.Reference] {
+			return errors.Errorf("instruction %d: target %s is removed", i, ins.Reference)
+		}
+
+		if name, ok := renames[ins.Reference]; ok {
+			ins.Reference = name
+		}
+	}
+
+	if err := result.LabelJumps(); err != nil {
+		return err
+	}
+
+	*insns = result
+	return nil
+}
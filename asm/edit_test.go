@@ -0,0 +1,151 @@
+package asm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// decode round trips insns through the kernel format, which replaces
+// references with numeric offsets.
+func decode(t *testing.T, insns Instructions) Instructions {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := insns.Marshal(&buf, binary.LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Instructions
+	if _, err := decoded.Unmarshal(&buf, binary.LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+// checkTargets asserts that the instruction at each index in jumps
+// transfers control to an instruction with the given opcode and constant.
+func checkTargets(t *testing.T, insns Instructions, jumps map[int]Instruction) {
+	t.Helper()
+
+	targets, err := decode(t, insns).Targets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range jumps {
+		have := insns[targets[i]]
+		if have.OpCode != want.OpCode || have.Constant != want.Constant {
+			t.Errorf("Instruction %d: expected target %v, got %v\n%v", i, want, have, insns)
+		}
+	}
+}
+
+func TestLabelJumps(t *testing.T) {
+	insns := decode(t, Instructions{
+		Mov.Imm(R0, 0).Sym("entry"),
+		JEq.Imm(R1, 0, "exit"),
+		LoadImm(R0, 1, DWord),
+		Call.Label("fn"),
+		Return().Sym("exit"),
+		Mov.Imm(R0, 2).Sym("fn"),
+		Return(),
+	})
+	insns[0].Symbol = "entry"
+
+	if err := insns.LabelJumps(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ins := insns[1]; ins.Offset != -1 || ins.Reference != insns[4].Symbol {
+		t.Error("Jump isn't labelled:", ins)
+	}
+	if ins := insns[3]; ins.Constant != -1 || ins.Reference != insns[5].Symbol {
+		t.Error("Call isn't labelled:", ins)
+	}
+	if sym := insns[4].Symbol; sym != "entry.L0" {
+		t.Error("Expected generated symbol entry.L0, got", sym)
+	}
+
+	if err := insns.UnlabelJumps(map[string]bool{"entry.L0": true}); err != nil {
+		t.Fatal(err)
+	}
+	if ins := insns[1]; ins.Offset != 3 || ins.Reference != "" {
+		t.Error("Jump isn't unlabelled:", ins)
+	}
+	if insns[4].Symbol != "" {
+		t.Error("Generated symbol isn't removed")
+	}
+	if ins := insns[3]; ins.Constant != -1 || ins.Reference != insns[5].Symbol {
+		t.Error("Call to other symbol is unlabelled:", ins)
+	}
+
+	// A jump out of bounds leaves all instructions alone.
+	jump := JEq.Imm(R1, 0, "")
+	jump.Offset = 100
+	invalid := append(append(Instructions(nil), insns...), jump)
+	want := append(Instructions(nil), invalid...)
+	if err := invalid.LabelJumps(); err == nil {
+		t.Fatal("Labelling an invalid jump doesn't return an error")
+	}
+	if !reflect.DeepEqual(invalid, want) {
+		t.Error("LabelJumps modifies instructions on error")
+	}
+}
+
+func TestInsertRemoveReplace(t *testing.T) {
+	var (
+		exit  = Return()
+		fn    = Mov.Imm(R0, 2)
+		extra = Mov.Imm(R3, 3)
+	)
+
+	insns := decode(t, Instructions{
+		JEq.Imm(R1, 0, "exit"),
+		LoadImm(R0, 1, DWord),
+		Call.Label("fn"),
+		exit.Sym("exit"),
+		fn.Sym("fn"),
+		Return(),
+	})
+
+	// Shift the jump target and the function.
+	if err := insns.Insert(1, Mov.Imm(R2, 0), Mov.Imm(R2, 1)); err != nil {
+		t.Fatal(err)
+	}
+	checkTargets(t, insns, map[int]Instruction{0: exit, 4: fn})
+
+	// Jumps to the instruction at the insertion point run the new code.
+	if err := insns.Insert(5, extra); err != nil {
+		t.Fatal(err)
+	}
+	checkTargets(t, insns, map[int]Instruction{0: extra, 4: fn})
+
+	// Jumps to removed instructions continue after them.
+	if err := insns.Remove(5, 6); err != nil {
+		t.Fatal(err)
+	}
+	checkTargets(t, insns, map[int]Instruction{0: exit, 4: fn})
+
+	if err := insns.Remove(1, 4); err != nil {
+		t.Fatal(err)
+	}
+	checkTargets(t, insns, map[int]Instruction{0: exit, 1: fn})
+
+	// Numeric offsets in new instructions are relative to their final position.
+	skip := JEq.Imm(R1, 1, "")
+	skip.Offset = 1
+	if err := insns.Replace(0, 1, skip, extra); err != nil {
+		t.Fatal(err)
+	}
+	checkTargets(t, insns, map[int]Instruction{0: Call.Label(""), 2: fn})
+
+	want := append(Instructions(nil), insns...)
+	if err := insns.Remove(len(insns)-2, len(insns)); err == nil {
+		t.Error("Removing a called function at the end doesn't return an error")
+	}
+	if !reflect.DeepEqual(insns, want) {
+		t.Error("Remove modifies instructions on error")
+	}
+}
@@ -140,6 +140,14 @@ const (
 	// @size: size of data
 	// Return: 0 on success or negative error
 	PerfEventOutput
+	// SKBLoadBytes - int bpf_skb_load_bytes(skb, offset, to, len)
+	// load bytes from the packet
+	// @skb: pointer to skb
+	// @offset: offset within packet from skb->data
+	// @to: pointer to buffer
+	// @len: number of bytes to copy
+	// Return: 0 on success or negative error
+	SKBLoadBytes
 	// GetStackID - int bpf_get_stackid(ctx, map, flags)
 	// walk user or kernel stack and return id
 	// @ctx: struct pt_regs*
@@ -318,6 +326,324 @@ const (
 	// @flags: reserved for future use
 	// Return: 0 on success or negative error code
 	SKBAdjustRoom
+	// RedirectMap - long bpf_redirect_map(struct bpf_map *map, u32 key, u64 flags)
+	RedirectMap
+	// SkRedirectMap - long bpf_sk_redirect_map(struct sk_buff *skb, struct bpf_map *map, u32 key, u64 flags)
+	SkRedirectMap
+	// SockMapUpdate - long bpf_sock_map_update(struct bpf_sock_ops *skops, struct bpf_map *map, void *key, u64 flags)
+	SockMapUpdate
+	// XDPAdjustMeta - long bpf_xdp_adjust_meta(struct xdp_buff *xdp_md, int delta)
+	XDPAdjustMeta
+	// PerfEventReadValue - long bpf_perf_event_read_value(struct bpf_map *map, u64 flags, struct bpf_perf_event_value *buf, u32 buf_size)
+	PerfEventReadValue
+	// PerfProgReadValue - long bpf_perf_prog_read_value(struct bpf_perf_event_data *ctx, struct bpf_perf_event_value *buf, u32 buf_size)
+	PerfProgReadValue
+	// GetSockOpt - long bpf_getsockopt(void *bpf_socket, int level, int optname, void *optval, int optlen)
+	GetSockOpt
+	// OverrideReturn - long bpf_override_return(struct pt_regs *regs, u64 rc)
+	OverrideReturn
+	// SockOpsCBFlagsSet - long bpf_sock_ops_cb_flags_set(struct bpf_sock_ops *bpf_sock, int argval)
+	SockOpsCBFlagsSet
+	// MsgRedirectMap - long bpf_msg_redirect_map(struct sk_msg_buff *msg, struct bpf_map *map, u32 key, u64 flags)
+	MsgRedirectMap
+	// MsgApplyBytes - long bpf_msg_apply_bytes(struct sk_msg_buff *msg, u32 bytes)
+	MsgApplyBytes
+	// MsgCorkBytes - long bpf_msg_cork_bytes(struct sk_msg_buff *msg, u32 bytes)
+	MsgCorkBytes
+	// MsgPullData - long bpf_msg_pull_data(struct sk_msg_buff *msg, u32 start, u32 end, u64 flags)
+	MsgPullData
+	// Bind - long bpf_bind(struct bpf_sock_addr *ctx, struct sockaddr *addr, int addr_len)
+	Bind
+	// XDPAdjustTail - long bpf_xdp_adjust_tail(struct xdp_buff *xdp_md, int delta)
+	XDPAdjustTail
+	// SKBGetXFRMState - long bpf_skb_get_xfrm_state(struct sk_buff *skb, u32 index, struct bpf_xfrm_state *xfrm_state, u32 size, u64 flags)
+	SKBGetXFRMState
+	// GetStack - long bpf_get_stack(void *ctx, void *buf, u32 size, u64 flags)
+	GetStack
+	// SKBLoadBytesRelative - long bpf_skb_load_bytes_relative(const void *skb, u32 offset, void *to, u32 len, u32 start_header)
+	SKBLoadBytesRelative
+	// FIBLookup - long bpf_fib_lookup(void *ctx, struct bpf_fib_lookup *params, int plen, u32 flags)
+	FIBLookup
+	// SockHashUpdate - long bpf_sock_hash_update(struct bpf_sock_ops *skops, struct bpf_map *map, void *key, u64 flags)
+	SockHashUpdate
+	// MsgRedirectHash - long bpf_msg_redirect_hash(struct sk_msg_buff *msg, struct bpf_map *map, void *key, u64 flags)
+	MsgRedirectHash
+	// SkRedirectHash - long bpf_sk_redirect_hash(struct sk_buff *skb, struct bpf_map *map, void *key, u64 flags)
+	SkRedirectHash
+	// LWTPushEncap - long bpf_lwt_push_encap(struct sk_buff *skb, u32 type, void *hdr, u32 len)
+	LWTPushEncap
+	// LWTSeg6StoreBytes - long bpf_lwt_seg6_store_bytes(struct sk_buff *skb, u32 offset, const void *from, u32 len)
+	LWTSeg6StoreBytes
+	// LWTSeg6AdjustSRH - long bpf_lwt_seg6_adjust_srh(struct sk_buff *skb, u32 offset, s32 delta)
+	LWTSeg6AdjustSRH
+	// LWTSeg6Action - long bpf_lwt_seg6_action(struct sk_buff *skb, u32 action, void *param, u32 param_len)
+	LWTSeg6Action
+	// RCRepeat - long bpf_rc_repeat(void *ctx)
+	RCRepeat
+	// RCKeydown - long bpf_rc_keydown(void *ctx, u32 protocol, u64 scancode, u32 toggle)
+	RCKeydown
+	// SKBCGroupID - u64 bpf_skb_cgroup_id(struct sk_buff *skb)
+	SKBCGroupID
+	// GetCurrentCGroupID - u64 bpf_get_current_cgroup_id(void)
+	GetCurrentCGroupID
+	// GetLocalStorage - void *bpf_get_local_storage(void *map, u64 flags)
+	GetLocalStorage
+	// SkSelectReuseport - long bpf_sk_select_reuseport(struct sk_reuseport_md *reuse, struct bpf_map *map, void *key, u64 flags)
+	SkSelectReuseport
+	// SKBAncestorCGroupID - u64 bpf_skb_ancestor_cgroup_id(struct sk_buff *skb, int ancestor_level)
+	SKBAncestorCGroupID
+	// SkLookupTCP - struct bpf_sock *bpf_sk_lookup_tcp(void *ctx, struct bpf_sock_tuple *tuple, u32 tuple_size, u64 netns, u64 flags)
+	SkLookupTCP
+	// SkLookupUDP - struct bpf_sock *bpf_sk_lookup_udp(void *ctx, struct bpf_sock_tuple *tuple, u32 tuple_size, u64 netns, u64 flags)
+	SkLookupUDP
+	// SkRelease - long bpf_sk_release(void *sock)
+	SkRelease
+	// MapPushElement - long bpf_map_push_elem(struct bpf_map *map, const void *value, u64 flags)
+	MapPushElement
+	// MapPopElement - long bpf_map_pop_elem(struct bpf_map *map, void *value)
+	MapPopElement
+	// MapPeekElement - long bpf_map_peek_elem(struct bpf_map *map, void *value)
+	MapPeekElement
+	// MsgPushData - long bpf_msg_push_data(struct sk_msg_buff *msg, u32 start, u32 len, u64 flags)
+	MsgPushData
+	// MsgPopData - long bpf_msg_pop_data(struct sk_msg_buff *msg, u32 start, u32 len, u64 flags)
+	MsgPopData
+	// RCPointerRel - long bpf_rc_pointer_rel(void *ctx, s32 rel_x, s32 rel_y)
+	RCPointerRel
+	// SpinLock - long bpf_spin_lock(struct bpf_spin_lock *lock)
+	SpinLock
+	// SpinUnlock - long bpf_spin_unlock(struct bpf_spin_lock *lock)
+	SpinUnlock
+	// SkFullsock - struct bpf_sock *bpf_sk_fullsock(struct bpf_sock *sk)
+	SkFullsock
+	// TCPSock - struct bpf_tcp_sock *bpf_tcp_sock(struct bpf_sock *sk)
+	TCPSock
+	// SKBECNSetCE - long bpf_skb_ecn_set_ce(struct sk_buff *skb)
+	SKBECNSetCE
+	// GetListenerSock - struct bpf_sock *bpf_get_listener_sock(struct bpf_sock *sk)
+	GetListenerSock
+	// SkcLookupTCP - struct bpf_sock *bpf_skc_lookup_tcp(void *ctx, struct bpf_sock_tuple *tuple, u32 tuple_size, u64 netns, u64 flags)
+	SkcLookupTCP
+	// TCPCheckSyncookie - long bpf_tcp_check_syncookie(void *sk, void *iph, u32 iph_len, struct tcphdr *th, u32 th_len)
+	TCPCheckSyncookie
+	// SysctlGetName - long bpf_sysctl_get_name(struct bpf_sysctl *ctx, char *buf, size_t buf_len, u64 flags)
+	SysctlGetName
+	// SysctlGetCurrentValue - long bpf_sysctl_get_current_value(struct bpf_sysctl *ctx, char *buf, size_t buf_len)
+	SysctlGetCurrentValue
+	// SysctlGetNewValue - long bpf_sysctl_get_new_value(struct bpf_sysctl *ctx, char *buf, size_t buf_len)
+	SysctlGetNewValue
+	// SysctlSetNewValue - long bpf_sysctl_set_new_value(struct bpf_sysctl *ctx, const char *buf, size_t buf_len)
+	SysctlSetNewValue
+	// Strtol - long bpf_strtol(const char *buf, size_t buf_len, u64 flags, long *res)
+	Strtol
+	// Strtoul - long bpf_strtoul(const char *buf, size_t buf_len, u64 flags, unsigned long *res)
+	Strtoul
+	// SkStorageGet - void *bpf_sk_storage_get(struct bpf_map *map, void *sk, void *value, u64 flags)
+	SkStorageGet
+	// SkStorageDelete - long bpf_sk_storage_delete(struct bpf_map *map, void *sk)
+	SkStorageDelete
+	// SendSignal - long bpf_send_signal(u32 sig)
+	SendSignal
+	// TCPGenSyncookie - s64 bpf_tcp_gen_syncookie(void *sk, void *iph, u32 iph_len, struct tcphdr *th, u32 th_len)
+	TCPGenSyncookie
+	// SKBOutput - long bpf_skb_output(void *ctx, struct bpf_map *map, u64 flags, void *data, u64 size)
+	SKBOutput
+	// ProbeReadUser - long bpf_probe_read_user(void *dst, u32 size, const void *unsafe_ptr)
+	ProbeReadUser
+	// ProbeReadKernel - long bpf_probe_read_kernel(void *dst, u32 size, const void *unsafe_ptr)
+	ProbeReadKernel
+	// ProbeReadUserStr - long bpf_probe_read_user_str(void *dst, u32 size, const void *unsafe_ptr)
+	ProbeReadUserStr
+	// ProbeReadKernelStr - long bpf_probe_read_kernel_str(void *dst, u32 size, const void *unsafe_ptr)
+	ProbeReadKernelStr
+	// TCPSendAck - long bpf_tcp_send_ack(void *tp, u32 rcv_nxt)
+	TCPSendAck
+	// SendSignalThread - long bpf_send_signal_thread(u32 sig)
+	SendSignalThread
+	// Jiffies64 - u64 bpf_jiffies64(void)
+	Jiffies64
+	// ReadBranchRecords - long bpf_read_branch_records(struct bpf_perf_event_data *ctx, void *buf, u32 size, u64 flags)
+	ReadBranchRecords
+	// GetNSCurrentPIDTGID - long bpf_get_ns_current_pid_tgid(u64 dev, u64 ino, struct bpf_pidns_info *nsdata, u32 size)
+	GetNSCurrentPIDTGID
+	// XDPOutput - long bpf_xdp_output(void *ctx, struct bpf_map *map, u64 flags, void *data, u64 size)
+	XDPOutput
+	// GetNetNSCookie - u64 bpf_get_netns_cookie(void *ctx)
+	GetNetNSCookie
+	// GetCurrentAncestorCGroupID - u64 bpf_get_current_ancestor_cgroup_id(int ancestor_level)
+	GetCurrentAncestorCGroupID
+	// SkAssign - long bpf_sk_assign(struct bpf_sk_lookup *ctx, struct bpf_sock *sk, u64 flags)
+	SkAssign
+	// KtimeGetBootNS - u64 bpf_ktime_get_boot_ns(void)
+	KtimeGetBootNS
+	// SeqPrintf - long bpf_seq_printf(struct seq_file *m, const char *fmt, u32 fmt_size, const void *data, u32 data_len)
+	SeqPrintf
+	// SeqWrite - long bpf_seq_write(struct seq_file *m, const void *data, u32 len)
+	SeqWrite
+	// SkCGroupID - u64 bpf_sk_cgroup_id(void *sk)
+	SkCGroupID
+	// SkAncestorCGroupID - u64 bpf_sk_ancestor_cgroup_id(void *sk, int ancestor_level)
+	SkAncestorCGroupID
+	// RingbufOutput - long bpf_ringbuf_output(void *ringbuf, void *data, u64 size, u64 flags)
+	RingbufOutput
+	// RingbufReserve - void *bpf_ringbuf_reserve(void *ringbuf, u64 size, u64 flags)
+	RingbufReserve
+	// RingbufSubmit - void bpf_ringbuf_submit(void *data, u64 flags)
+	RingbufSubmit
+	// RingbufDiscard - void bpf_ringbuf_discard(void *data, u64 flags)
+	RingbufDiscard
+	// RingbufQuery - u64 bpf_ringbuf_query(void *ringbuf, u64 flags)
+	RingbufQuery
+	// CSUMLevel - long bpf_csum_level(struct sk_buff *skb, u64 level)
+	CSUMLevel
+	// SkcToTCP6Sock - struct tcp6_sock *bpf_skc_to_tcp6_sock(void *sk)
+	SkcToTCP6Sock
+	// SkcToTCPSock - struct tcp_sock *bpf_skc_to_tcp_sock(void *sk)
+	SkcToTCPSock
+	// SkcToTCPTimewaitSock - struct tcp_timewait_sock *bpf_skc_to_tcp_timewait_sock(void *sk)
+	SkcToTCPTimewaitSock
+	// SkcToTCPRequestSock - struct tcp_request_sock *bpf_skc_to_tcp_request_sock(void *sk)
+	SkcToTCPRequestSock
+	// SkcToUDP6Sock - struct udp6_sock *bpf_skc_to_udp6_sock(void *sk)
+	SkcToUDP6Sock
+	// GetTaskStack - long bpf_get_task_stack(struct task_struct *task, void *buf, u32 size, u64 flags)
+	GetTaskStack
+	// LoadHdrOpt - long bpf_load_hdr_opt(struct bpf_sock_ops *skops, void *searchby_res, u32 len, u64 flags)
+	LoadHdrOpt
+	// StoreHdrOpt - long bpf_store_hdr_opt(struct bpf_sock_ops *skops, const void *from, u32 len, u64 flags)
+	StoreHdrOpt
+	// ReserveHdrOpt - long bpf_reserve_hdr_opt(struct bpf_sock_ops *skops, u32 len, u64 flags)
+	ReserveHdrOpt
+	// InodeStorageGet - void *bpf_inode_storage_get(struct bpf_map *map, void *inode, void *value, u64 flags)
+	InodeStorageGet
+	// InodeStorageDelete - int bpf_inode_storage_delete(struct bpf_map *map, void *inode)
+	InodeStorageDelete
+	// DPath - long bpf_d_path(struct path *path, char *buf, u32 sz)
+	DPath
+	// CopyFromUser - long bpf_copy_from_user(void *dst, u32 size, const void *user_ptr)
+	CopyFromUser
+	// SnprintfBTF - long bpf_snprintf_btf(char *str, u32 str_size, struct btf_ptr *ptr, u32 btf_ptr_size, u64 flags)
+	SnprintfBTF
+	// SeqPrintfBTF - long bpf_seq_printf_btf(struct seq_file *m, struct btf_ptr *ptr, u32 ptr_size, u64 flags)
+	SeqPrintfBTF
+	// SKBCGroupClassID - u64 bpf_skb_cgroup_classid(struct sk_buff *skb)
+	SKBCGroupClassID
+	// RedirectNeigh - long bpf_redirect_neigh(u32 ifindex, struct bpf_redir_neigh *params, int plen, u64 flags)
+	RedirectNeigh
+	// PerCPUPtr - void *bpf_per_cpu_ptr(const void *percpu_ptr, u32 cpu)
+	PerCPUPtr
+	// ThisCPUPtr - void *bpf_this_cpu_ptr(const void *percpu_ptr)
+	ThisCPUPtr
+	// RedirectPeer - long bpf_redirect_peer(u32 ifindex, u64 flags)
+	RedirectPeer
+	// TaskStorageGet - void *bpf_task_storage_get(struct bpf_map *map, struct task_struct *task, void *value, u64 flags)
+	TaskStorageGet
+	// TaskStorageDelete - long bpf_task_storage_delete(struct bpf_map *map, struct task_struct *task)
+	TaskStorageDelete
+	// GetCurrentTaskBTF - struct task_struct *bpf_get_current_task_btf(void)
+	GetCurrentTaskBTF
+	// BprmOptsSet - long bpf_bprm_opts_set(struct linux_binprm *bprm, u64 flags)
+	BprmOptsSet
+	// KtimeGetCoarseNS - u64 bpf_ktime_get_coarse_ns(void)
+	KtimeGetCoarseNS
+	// IMAInodeHash - long bpf_ima_inode_hash(struct inode *inode, void *dst, u32 size)
+	IMAInodeHash
+	// SockFromFile - struct socket *bpf_sock_from_file(struct file *file)
+	SockFromFile
+	// CheckMTU - long bpf_check_mtu(void *ctx, u32 ifindex, u32 *mtu_len, s32 len_diff, u64 flags)
+	CheckMTU
+	// ForEachMapElement - long bpf_for_each_map_elem(struct bpf_map *map, void *callback_fn, void *callback_ctx, u64 flags)
+	ForEachMapElement
+	// Snprintf - long bpf_snprintf(char *str, u32 str_size, const char *fmt, u64 *data, u32 data_len)
+	Snprintf
+	// SysBPF - long bpf_sys_bpf(u32 cmd, void *attr, u32 attr_size)
+	SysBPF
+	// BTFFindByNameKind - long bpf_btf_find_by_name_kind(char *name, int name_sz, u32 kind, int flags)
+	BTFFindByNameKind
+	// SysClose - long bpf_sys_close(u32 fd)
+	SysClose
+	// TimerInit - long bpf_timer_init(struct bpf_timer *timer, struct bpf_map *map, u64 flags)
+	TimerInit
+	// TimerSetCallback - long bpf_timer_set_callback(struct bpf_timer *timer, void *callback_fn)
+	TimerSetCallback
+	// TimerStart - long bpf_timer_start(struct bpf_timer *timer, u64 nsecs, u64 flags)
+	TimerStart
+	// TimerCancel - long bpf_timer_cancel(struct bpf_timer *timer)
+	TimerCancel
+	// GetFuncIP - u64 bpf_get_func_ip(void *ctx)
+	GetFuncIP
+	// GetAttachCookie - u64 bpf_get_attach_cookie(void *ctx)
+	GetAttachCookie
+	// TaskPTRegs - long bpf_task_pt_regs(struct task_struct *task)
+	TaskPTRegs
+	// GetBranchSnapshot - long bpf_get_branch_snapshot(void *entries, u32 size, u64 flags)
+	GetBranchSnapshot
+	// TraceVprintk - long bpf_trace_vprintk(const char *fmt, u32 fmt_size, const void *data, u32 data_len)
+	TraceVprintk
+	// SkcToUnixSock - struct unix_sock *bpf_skc_to_unix_sock(void *sk)
+	SkcToUnixSock
+	// KallsymsLookupName - long bpf_kallsyms_lookup_name(const char *name, int name_sz, int flags, u64 *res)
+	KallsymsLookupName
+	// FindVMA - long bpf_find_vma(struct task_struct *task, u64 addr, void *callback_fn, void *callback_ctx, u64 flags)
+	FindVMA
+	// Loop - long bpf_loop(u32 nr_loops, void *callback_fn, void *callback_ctx, u64 flags)
+	Loop
+	// Strncmp - long bpf_strncmp(const char *s1, u32 s1_sz, const char *s2)
+	Strncmp
+	// GetFuncArg - long bpf_get_func_arg(void *ctx, u32 n, u64 *value)
+	GetFuncArg
+	// GetFuncRet - long bpf_get_func_ret(void *ctx, u64 *value)
+	GetFuncRet
+	// GetFuncArgCnt - long bpf_get_func_arg_cnt(void *ctx)
+	GetFuncArgCnt
+	// GetRetval - int bpf_get_retval(void)
+	GetRetval
+	// SetRetval - int bpf_set_retval(int retval)
+	SetRetval
+	// XDPGetBuffLen - u64 bpf_xdp_get_buff_len(struct xdp_buff *xdp_md)
+	XDPGetBuffLen
+	// XDPLoadBytes - long bpf_xdp_load_bytes(struct xdp_buff *xdp_md, u32 offset, void *buf, u32 len)
+	XDPLoadBytes
+	// XDPStoreBytes - long bpf_xdp_store_bytes(struct xdp_buff *xdp_md, u32 offset, void *buf, u32 len)
+	XDPStoreBytes
+	// CopyFromUserTask - long bpf_copy_from_user_task(void *dst, u32 size, const void *user_ptr, struct task_struct *tsk, u64 flags)
+	CopyFromUserTask
+	// SKBSetTstamp - long bpf_skb_set_tstamp(struct sk_buff *skb, u64 tstamp, u32 tstamp_type)
+	SKBSetTstamp
+	// IMAFileHash - long bpf_ima_file_hash(struct file *file, void *dst, u32 size)
+	IMAFileHash
+	// KptrXchg - void *bpf_kptr_xchg(void *map_value, void *ptr)
+	KptrXchg
+	// MapLookupPerCPUElement - void *bpf_map_lookup_percpu_elem(struct bpf_map *map, const void *key, u32 cpu)
+	MapLookupPerCPUElement
+	// SkcToMPTCPSock - struct mptcp_sock *bpf_skc_to_mptcp_sock(void *sk)
+	SkcToMPTCPSock
+	// DynptrFromMem - long bpf_dynptr_from_mem(void *data, u32 size, u64 flags, struct bpf_dynptr *ptr)
+	DynptrFromMem
+	// RingbufReserveDynptr - long bpf_ringbuf_reserve_dynptr(void *ringbuf, u32 size, u64 flags, struct bpf_dynptr *ptr)
+	RingbufReserveDynptr
+	// RingbufSubmitDynptr - void bpf_ringbuf_submit_dynptr(struct bpf_dynptr *ptr, u64 flags)
+	RingbufSubmitDynptr
+	// RingbufDiscardDynptr - void bpf_ringbuf_discard_dynptr(struct bpf_dynptr *ptr, u64 flags)
+	RingbufDiscardDynptr
+	// DynptrRead - long bpf_dynptr_read(void *dst, u32 len, struct bpf_dynptr *src, u32 offset, u64 flags)
+	DynptrRead
+	// DynptrWrite - long bpf_dynptr_write(struct bpf_dynptr *dst, u32 offset, void *src, u32 len, u64 flags)
+	DynptrWrite
+	// DynptrData - void *bpf_dynptr_data(struct bpf_dynptr *ptr, u32 offset, u32 len)
+	DynptrData
+	// TCPRawGenSyncookieIPv4 - s64 bpf_tcp_raw_gen_syncookie_ipv4(struct iphdr *iph, struct tcphdr *th, u32 th_len)
+	TCPRawGenSyncookieIPv4
+	// TCPRawGenSyncookieIPv6 - s64 bpf_tcp_raw_gen_syncookie_ipv6(struct ipv6hdr *iph, struct tcphdr *th, u32 th_len)
+	TCPRawGenSyncookieIPv6
+	// TCPRawCheckSyncookieIPv4 - long bpf_tcp_raw_check_syncookie_ipv4(struct iphdr *iph, struct tcphdr *th)
+	TCPRawCheckSyncookieIPv4
+	// TCPRawCheckSyncookieIPv6 - long bpf_tcp_raw_check_syncookie_ipv6(struct ipv6hdr *iph, struct tcphdr *th)
+	TCPRawCheckSyncookieIPv6
+	// KtimeGetTAINS - u64 bpf_ktime_get_tai_ns(void)
+	KtimeGetTAINS
+	// UserRingbufDrain - long bpf_user_ringbuf_drain(struct bpf_map *map, void *callback_fn, void *ctx, u64 flags)
+	UserRingbufDrain
 )
 
 // Call emits a function call.
@@ -0,0 +1,304 @@
+package asm
+
+//go:generate stringer -output func_info_string.go -type=ArgKind
+
+// ArgKind describes what a helper expects in an argument register.
+type ArgKind uint8
+
+// Valid argument kinds.
+const (
+	// ArgAny accepts any initialized value.
+	ArgAny ArgKind = iota
+	// ArgScalar is an integer, flags or a size.
+	ArgScalar
+	// ArgPointer is a pointer to memory, which may be NULL.
+	ArgPointer
+	// ArgMemory is a pointer to memory which must not be NULL,
+	// like a map key or value.
+	ArgMemory
+	// ArgContext is the context passed to the program.
+	ArgContext
+	// ArgMap is a pointer to a map, usually loaded via LoadMapPtr.
+	ArgMap
+)
+
+// accepts returns true if a value of the given kind may be passed
+// in an argument of this kind.
+//
+// Pointers into the map itself or the end of a packet are never
+// valid memory. Uninitialized values are never accepted, unknown
+// values always are.
+func (ak ArgKind) accepts(kind ValueKind) bool {
+	switch kind {
+	case Uninitialized:
+		return false
+	case Unknown:
+		return true
+	}
+
+	switch ak {
+	case ArgScalar:
+		return kind == Scalar
+	case ArgPointer:
+		return kind != PointerToMap && kind != PointerToPacketEnd
+	case ArgMemory:
+		return kind.isPointer() && kind != PointerToMap && kind != PointerToPacketEnd
+	case ArgContext:
+		return kind == PointerToContext
+	case ArgMap:
+		return kind == PointerToMap
+	default:
+		return true
+	}
+}
+
+func (ak ArgKind) description() string {
+	switch ak {
+	case ArgScalar:
+		return "a scalar"
+	case ArgPointer:
+		return "a pointer"
+	case ArgMemory:
+		return "a non-NULL pointer"
+	case ArgContext:
+		return "the context"
+	case ArgMap:
+		return "a map"
+	default:
+		return "anything"
+	}
+}
+
+// FuncInfo describes the signature of a built-in function.
+type FuncInfo struct {
+	// Args lists the expected contents of R1 to R5.
+	Args []ArgKind
+	// Return is the kind of value left in R0. Uninitialized
+	// means that the function doesn't return anything.
+	Return ValueKind
+	// GPLOnly functions may only be called from programs with a
+	// GPL compatible license.
+	GPLOnly bool
+}
+
+// Info returns the signature of a built-in function.
+//
+// Returns false if the function is not known.
+func (fn BuiltinFunc) Info() (FuncInfo, bool) {
+	info, ok := funcInfos[fn]
+	return info, ok
+}
+
+// funcInfos is derived from the helper definitions in the kernel's
+// include/uapi/linux/bpf.h.
+var funcInfos = map[BuiltinFunc]FuncInfo{
+	MapLookupElement:           {Args: []ArgKind{ArgMap, ArgMemory}, Return: PointerToMapValueOrNull},
+	MapUpdateElement:           {Args: []ArgKind{ArgMap, ArgMemory, ArgMemory, ArgScalar}, Return: Scalar},
+	MapDeleteElement:           {Args: []ArgKind{ArgMap, ArgMemory}, Return: Scalar},
+	ProbeRead:                  {Args: []ArgKind{ArgPointer, ArgScalar, ArgPointer}, Return: Scalar, GPLOnly: true},
+	KtimeGetNS:                 {Return: Scalar},
+	TracePrintk:                {Args: []ArgKind{ArgPointer, ArgScalar, ArgAny, ArgAny, ArgAny}, Return: Scalar, GPLOnly: true},
+	GetPRandomu32:              {Return: Scalar},
+	GetSMPProcessorID:          {Return: Scalar},
+	SKBStoreBytes:              {Args: []ArgKind{ArgContext, ArgScalar, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar},
+	CSUMReplaceL3:              {Args: []ArgKind{ArgContext, ArgScalar, ArgScalar, ArgScalar, ArgScalar}, Return: Scalar},
+	CSUMReplaceL4:              {Args: []ArgKind{ArgContext, ArgScalar, ArgScalar, ArgScalar, ArgScalar}, Return: Scalar},
+	TailCall:                   {Args: []ArgKind{ArgContext, ArgMap, ArgScalar}, Return: Scalar},
+	CloneRedirect:              {Args: []ArgKind{ArgContext, ArgScalar, ArgScalar}, Return: Scalar},
+	GetCurrentPIDTGID:          {Return: Scalar},
+	GetCurrentUIDGID:           {Return: Scalar},
+	GetCurrentComm:             {Args: []ArgKind{ArgPointer, ArgScalar}, Return: Scalar},
+	GetCGroupClassID:           {Args: []ArgKind{ArgContext}, Return: Scalar},
+	SKBVlanPush:                {Args: []ArgKind{ArgContext, ArgScalar, ArgScalar}, Return: Scalar},
+	SKBVlanPop:                 {Args: []ArgKind{ArgContext}, Return: Scalar},
+	SKBGetTunnelKey:            {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar},
+	SKBSetTunnelKey:            {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar},
+	PerfEventRead:              {Args: []ArgKind{ArgMap, ArgScalar}, Return: Scalar, GPLOnly: true},
+	Redirect:                   {Args: []ArgKind{ArgScalar, ArgScalar}, Return: Scalar},
+	GetRouteRealm:              {Args: []ArgKind{ArgContext}, Return: Scalar},
+	PerfEventOutput:            {Args: []ArgKind{ArgContext, ArgMap, ArgScalar, ArgPointer, ArgScalar}, Return: Scalar, GPLOnly: true},
+	SKBLoadBytes:               {Args: []ArgKind{ArgContext, ArgScalar, ArgPointer, ArgScalar}, Return: Scalar},
+	GetStackID:                 {Args: []ArgKind{ArgContext, ArgMap, ArgScalar}, Return: Scalar, GPLOnly: true},
+	CsumDiff:                   {Args: []ArgKind{ArgPointer, ArgScalar, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar},
+	SKBGetTunnelOpt:            {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar}, Return: Scalar},
+	SKBSetTunnelOpt:            {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar}, Return: Scalar},
+	SKBChangeProto:             {Args: []ArgKind{ArgContext, ArgScalar, ArgScalar}, Return: Scalar},
+	SKBChangeType:              {Args: []ArgKind{ArgContext, ArgScalar}, Return: Scalar},
+	SKBUnderCGroup:             {Args: []ArgKind{ArgContext, ArgMap, ArgScalar}, Return: Scalar},
+	GetHashRecalc:              {Args: []ArgKind{ArgContext}, Return: Scalar},
+	GetCurrentTask:             {Return: Scalar, GPLOnly: true},
+	ProbeWriteUser:             {Args: []ArgKind{ArgPointer, ArgPointer, ArgScalar}, Return: Scalar, GPLOnly: true},
+	CurrentTaskUnderCGroup:     {Args: []ArgKind{ArgMap, ArgScalar}, Return: Scalar},
+	SKBChangeTail:              {Args: []ArgKind{ArgContext, ArgScalar, ArgScalar}, Return: Scalar},
+	SKBPullData:                {Args: []ArgKind{ArgContext, ArgScalar}, Return: Scalar},
+	CSUMUpdate:                 {Args: []ArgKind{ArgContext, ArgScalar}, Return: Scalar},
+	SetHashInvalid:             {Args: []ArgKind{ArgContext}, Return: Uninitialized},
+	GetNUMANodeID:              {Return: Scalar},
+	SKBChangeHead:              {Args: []ArgKind{ArgContext, ArgScalar, ArgScalar}, Return: Scalar},
+	XDPAdjustHead:              {Args: []ArgKind{ArgContext, ArgScalar}, Return: Scalar},
+	ProbeReadStr:               {Args: []ArgKind{ArgPointer, ArgScalar, ArgPointer}, Return: Scalar, GPLOnly: true},
+	GetSocketCookie:            {Args: []ArgKind{ArgPointer}, Return: Scalar},
+	GetSocketUID:               {Args: []ArgKind{ArgContext}, Return: Scalar},
+	SetHash:                    {Args: []ArgKind{ArgContext, ArgScalar}, Return: Scalar},
+	SetSockOpt:                 {Args: []ArgKind{ArgPointer, ArgScalar, ArgScalar, ArgPointer, ArgScalar}, Return: Scalar},
+	SKBAdjustRoom:              {Args: []ArgKind{ArgContext, ArgScalar, ArgScalar, ArgScalar}, Return: Scalar},
+	RedirectMap:                {Args: []ArgKind{ArgMap, ArgScalar, ArgScalar}, Return: Scalar},
+	SkRedirectMap:              {Args: []ArgKind{ArgContext, ArgMap, ArgScalar, ArgScalar}, Return: Scalar},
+	SockMapUpdate:              {Args: []ArgKind{ArgContext, ArgMap, ArgMemory, ArgScalar}, Return: Scalar},
+	XDPAdjustMeta:              {Args: []ArgKind{ArgContext, ArgScalar}, Return: Scalar},
+	PerfEventReadValue:         {Args: []ArgKind{ArgMap, ArgScalar, ArgPointer, ArgScalar}, Return: Scalar, GPLOnly: true},
+	PerfProgReadValue:          {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar}, Return: Scalar, GPLOnly: true},
+	GetSockOpt:                 {Args: []ArgKind{ArgPointer, ArgScalar, ArgScalar, ArgPointer, ArgScalar}, Return: Scalar},
+	OverrideReturn:             {Args: []ArgKind{ArgContext, ArgScalar}, Return: Scalar, GPLOnly: true},
+	SockOpsCBFlagsSet:          {Args: []ArgKind{ArgContext, ArgScalar}, Return: Scalar},
+	MsgRedirectMap:             {Args: []ArgKind{ArgContext, ArgMap, ArgScalar, ArgScalar}, Return: Scalar},
+	MsgApplyBytes:              {Args: []ArgKind{ArgContext, ArgScalar}, Return: Scalar},
+	MsgCorkBytes:               {Args: []ArgKind{ArgContext, ArgScalar}, Return: Scalar},
+	MsgPullData:                {Args: []ArgKind{ArgContext, ArgScalar, ArgScalar, ArgScalar}, Return: Scalar},
+	Bind:                       {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar}, Return: Scalar},
+	XDPAdjustTail:              {Args: []ArgKind{ArgContext, ArgScalar}, Return: Scalar},
+	SKBGetXFRMState:            {Args: []ArgKind{ArgContext, ArgScalar, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar},
+	GetStack:                   {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar, GPLOnly: true},
+	SKBLoadBytesRelative:       {Args: []ArgKind{ArgContext, ArgScalar, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar},
+	FIBLookup:                  {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar},
+	SockHashUpdate:             {Args: []ArgKind{ArgContext, ArgMap, ArgMemory, ArgScalar}, Return: Scalar},
+	MsgRedirectHash:            {Args: []ArgKind{ArgContext, ArgMap, ArgMemory, ArgScalar}, Return: Scalar},
+	SkRedirectHash:             {Args: []ArgKind{ArgContext, ArgMap, ArgMemory, ArgScalar}, Return: Scalar},
+	LWTPushEncap:               {Args: []ArgKind{ArgContext, ArgScalar, ArgPointer, ArgScalar}, Return: Scalar},
+	LWTSeg6StoreBytes:          {Args: []ArgKind{ArgContext, ArgScalar, ArgPointer, ArgScalar}, Return: Scalar},
+	LWTSeg6AdjustSRH:           {Args: []ArgKind{ArgContext, ArgScalar, ArgScalar}, Return: Scalar},
+	LWTSeg6Action:              {Args: []ArgKind{ArgContext, ArgScalar, ArgPointer, ArgScalar}, Return: Scalar},
+	RCRepeat:                   {Args: []ArgKind{ArgContext}, Return: Scalar},
+	RCKeydown:                  {Args: []ArgKind{ArgContext, ArgScalar, ArgScalar, ArgScalar}, Return: Scalar},
+	SKBCGroupID:                {Args: []ArgKind{ArgContext}, Return: Scalar},
+	GetCurrentCGroupID:         {Return: Scalar},
+	GetLocalStorage:            {Args: []ArgKind{ArgMap, ArgScalar}, Return: PointerToMapValue},
+	SkSelectReuseport:          {Args: []ArgKind{ArgContext, ArgMap, ArgMemory, ArgScalar}, Return: Scalar},
+	SKBAncestorCGroupID:        {Args: []ArgKind{ArgContext, ArgScalar}, Return: Scalar},
+	SkLookupTCP:                {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar, ArgScalar, ArgScalar}, Return: Scalar},
+	SkLookupUDP:                {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar, ArgScalar, ArgScalar}, Return: Scalar},
+	SkRelease:                  {Args: []ArgKind{ArgPointer}, Return: Scalar},
+	MapPushElement:             {Args: []ArgKind{ArgMap, ArgMemory, ArgScalar}, Return: Scalar},
+	MapPopElement:              {Args: []ArgKind{ArgMap, ArgMemory}, Return: Scalar},
+	MapPeekElement:             {Args: []ArgKind{ArgMap, ArgMemory}, Return: Scalar},
+	MsgPushData:                {Args: []ArgKind{ArgContext, ArgScalar, ArgScalar, ArgScalar}, Return: Scalar},
+	MsgPopData:                 {Args: []ArgKind{ArgContext, ArgScalar, ArgScalar, ArgScalar}, Return: Scalar},
+	RCPointerRel:               {Args: []ArgKind{ArgContext, ArgScalar, ArgScalar}, Return: Scalar},
+	SpinLock:                   {Args: []ArgKind{ArgPointer}, Return: Scalar},
+	SpinUnlock:                 {Args: []ArgKind{ArgPointer}, Return: Scalar},
+	SkFullsock:                 {Args: []ArgKind{ArgPointer}, Return: Scalar},
+	TCPSock:                    {Args: []ArgKind{ArgPointer}, Return: Scalar},
+	SKBECNSetCE:                {Args: []ArgKind{ArgContext}, Return: Scalar},
+	GetListenerSock:            {Args: []ArgKind{ArgPointer}, Return: Scalar},
+	SkcLookupTCP:               {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar, ArgScalar, ArgScalar}, Return: Scalar},
+	TCPCheckSyncookie:          {Args: []ArgKind{ArgPointer, ArgPointer, ArgScalar, ArgPointer, ArgScalar}, Return: Scalar},
+	SysctlGetName:              {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar},
+	SysctlGetCurrentValue:      {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar}, Return: Scalar},
+	SysctlGetNewValue:          {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar}, Return: Scalar},
+	SysctlSetNewValue:          {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar}, Return: Scalar},
+	Strtol:                     {Args: []ArgKind{ArgPointer, ArgScalar, ArgScalar, ArgPointer}, Return: Scalar},
+	Strtoul:                    {Args: []ArgKind{ArgPointer, ArgScalar, ArgScalar, ArgPointer}, Return: Scalar},
+	SkStorageGet:               {Args: []ArgKind{ArgMap, ArgPointer, ArgMemory, ArgScalar}, Return: PointerToMapValueOrNull},
+	SkStorageDelete:            {Args: []ArgKind{ArgMap, ArgPointer}, Return: Scalar},
+	SendSignal:                 {Args: []ArgKind{ArgScalar}, Return: Scalar},
+	TCPGenSyncookie:            {Args: []ArgKind{ArgPointer, ArgPointer, ArgScalar, ArgPointer, ArgScalar}, Return: Scalar},
+	SKBOutput:                  {Args: []ArgKind{ArgContext, ArgMap, ArgScalar, ArgPointer, ArgScalar}, Return: Scalar, GPLOnly: true},
+	ProbeReadUser:              {Args: []ArgKind{ArgPointer, ArgScalar, ArgPointer}, Return: Scalar, GPLOnly: true},
+	ProbeReadKernel:            {Args: []ArgKind{ArgPointer, ArgScalar, ArgPointer}, Return: Scalar, GPLOnly: true},
+	ProbeReadUserStr:           {Args: []ArgKind{ArgPointer, ArgScalar, ArgPointer}, Return: Scalar, GPLOnly: true},
+	ProbeReadKernelStr:         {Args: []ArgKind{ArgPointer, ArgScalar, ArgPointer}, Return: Scalar, GPLOnly: true},
+	TCPSendAck:                 {Args: []ArgKind{ArgPointer, ArgScalar}, Return: Scalar},
+	SendSignalThread:           {Args: []ArgKind{ArgScalar}, Return: Scalar},
+	Jiffies64:                  {Return: Scalar},
+	ReadBranchRecords:          {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar, GPLOnly: true},
+	GetNSCurrentPIDTGID:        {Args: []ArgKind{ArgScalar, ArgScalar, ArgPointer, ArgScalar}, Return: Scalar},
+	XDPOutput:                  {Args: []ArgKind{ArgContext, ArgMap, ArgScalar, ArgPointer, ArgScalar}, Return: Scalar, GPLOnly: true},
+	GetNetNSCookie:             {Args: []ArgKind{ArgContext}, Return: Scalar},
+	GetCurrentAncestorCGroupID: {Args: []ArgKind{ArgScalar}, Return: Scalar},
+	SkAssign:                   {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar}, Return: Scalar},
+	KtimeGetBootNS:             {Return: Scalar},
+	SeqPrintf:                  {Args: []ArgKind{ArgPointer, ArgPointer, ArgScalar, ArgPointer, ArgScalar}, Return: Scalar, GPLOnly: true},
+	SeqWrite:                   {Args: []ArgKind{ArgPointer, ArgPointer, ArgScalar}, Return: Scalar, GPLOnly: true},
+	SkCGroupID:                 {Args: []ArgKind{ArgPointer}, Return: Scalar},
+	SkAncestorCGroupID:         {Args: []ArgKind{ArgPointer, ArgScalar}, Return: Scalar},
+	RingbufOutput:              {Args: []ArgKind{ArgPointer, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar},
+	RingbufReserve:             {Args: []ArgKind{ArgPointer, ArgScalar, ArgScalar}, Return: Unknown},
+	RingbufSubmit:              {Args: []ArgKind{ArgPointer, ArgScalar}, Return: Uninitialized},
+	RingbufDiscard:             {Args: []ArgKind{ArgPointer, ArgScalar}, Return: Uninitialized},
+	RingbufQuery:               {Args: []ArgKind{ArgPointer, ArgScalar}, Return: Scalar},
+	CSUMLevel:                  {Args: []ArgKind{ArgContext, ArgScalar}, Return: Scalar},
+	SkcToTCP6Sock:              {Args: []ArgKind{ArgPointer}, Return: Unknown},
+	SkcToTCPSock:               {Args: []ArgKind{ArgPointer}, Return: Unknown},
+	SkcToTCPTimewaitSock:       {Args: []ArgKind{ArgPointer}, Return: Unknown},
+	SkcToTCPRequestSock:        {Args: []ArgKind{ArgPointer}, Return: Unknown},
+	SkcToUDP6Sock:              {Args: []ArgKind{ArgPointer}, Return: Unknown},
+	GetTaskStack:               {Args: []ArgKind{ArgPointer, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar},
+	LoadHdrOpt:                 {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar},
+	StoreHdrOpt:                {Args: []ArgKind{ArgContext, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar},
+	ReserveHdrOpt:              {Args: []ArgKind{ArgContext, ArgScalar, ArgScalar}, Return: Scalar},
+	InodeStorageGet:            {Args: []ArgKind{ArgMap, ArgPointer, ArgMemory, ArgScalar}, Return: PointerToMapValueOrNull},
+	InodeStorageDelete:         {Args: []ArgKind{ArgMap, ArgPointer}, Return: Scalar},
+	DPath:                      {Args: []ArgKind{ArgPointer, ArgPointer, ArgScalar}, Return: Scalar},
+	CopyFromUser:               {Args: []ArgKind{ArgPointer, ArgScalar, ArgPointer}, Return: Scalar},
+	SnprintfBTF:                {Args: []ArgKind{ArgPointer, ArgScalar, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar},
+	SeqPrintfBTF:               {Args: []ArgKind{ArgPointer, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar, GPLOnly: true},
+	SKBCGroupClassID:           {Args: []ArgKind{ArgContext}, Return: Scalar},
+	RedirectNeigh:              {Args: []ArgKind{ArgScalar, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar},
+	PerCPUPtr:                  {Args: []ArgKind{ArgPointer, ArgScalar}, Return: Unknown},
+	ThisCPUPtr:                 {Args: []ArgKind{ArgPointer}, Return: Unknown},
+	RedirectPeer:               {Args: []ArgKind{ArgScalar, ArgScalar}, Return: Scalar},
+	TaskStorageGet:             {Args: []ArgKind{ArgMap, ArgPointer, ArgMemory, ArgScalar}, Return: PointerToMapValueOrNull},
+	TaskStorageDelete:          {Args: []ArgKind{ArgMap, ArgPointer}, Return: Scalar},
+	GetCurrentTaskBTF:          {Return: Unknown, GPLOnly: true},
+	BprmOptsSet:                {Args: []ArgKind{ArgPointer, ArgScalar}, Return: Scalar},
+	KtimeGetCoarseNS:           {Return: Scalar},
+	IMAInodeHash:               {Args: []ArgKind{ArgPointer, ArgPointer, ArgScalar}, Return: Scalar},
+	SockFromFile:               {Args: []ArgKind{ArgPointer}, Return: Unknown},
+	CheckMTU:                   {Args: []ArgKind{ArgContext, ArgScalar, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar},
+	ForEachMapElement:          {Args: []ArgKind{ArgMap, ArgPointer, ArgPointer, ArgScalar}, Return: Scalar},
+	Snprintf:                   {Args: []ArgKind{ArgPointer, ArgScalar, ArgPointer, ArgPointer, ArgScalar}, Return: Scalar, GPLOnly: true},
+	SysBPF:                     {Args: []ArgKind{ArgScalar, ArgPointer, ArgScalar}, Return: Scalar},
+	BTFFindByNameKind:          {Args: []ArgKind{ArgPointer, ArgScalar, ArgScalar, ArgScalar}, Return: Scalar},
+	SysClose:                   {Args: []ArgKind{ArgScalar}, Return: Scalar},
+	TimerInit:                  {Args: []ArgKind{ArgPointer, ArgMap, ArgScalar}, Return: Scalar, GPLOnly: true},
+	TimerSetCallback:           {Args: []ArgKind{ArgPointer, ArgPointer}, Return: Scalar, GPLOnly: true},
+	TimerStart:                 {Args: []ArgKind{ArgPointer, ArgScalar, ArgScalar}, Return: Scalar, GPLOnly: true},
+	TimerCancel:                {Args: []ArgKind{ArgPointer}, Return: Scalar, GPLOnly: true},
+	GetFuncIP:                  {Args: []ArgKind{ArgContext}, Return: Scalar},
+	GetAttachCookie:            {Args: []ArgKind{ArgContext}, Return: Scalar},
+	TaskPTRegs:                 {Args: []ArgKind{ArgPointer}, Return: Scalar, GPLOnly: true},
+	GetBranchSnapshot:          {Args: []ArgKind{ArgPointer, ArgScalar, ArgScalar}, Return: Scalar, GPLOnly: true},
+	TraceVprintk:               {Args: []ArgKind{ArgPointer, ArgScalar, ArgPointer, ArgScalar}, Return: Scalar, GPLOnly: true},
+	SkcToUnixSock:              {Args: []ArgKind{ArgPointer}, Return: Unknown},
+	KallsymsLookupName:         {Args: []ArgKind{ArgPointer, ArgScalar, ArgScalar, ArgPointer}, Return: Scalar},
+	FindVMA:                    {Args: []ArgKind{ArgPointer, ArgScalar, ArgPointer, ArgPointer, ArgScalar}, Return: Scalar},
+	Loop:                       {Args: []ArgKind{ArgScalar, ArgPointer, ArgPointer, ArgScalar}, Return: Scalar},
+	Strncmp:                    {Args: []ArgKind{ArgPointer, ArgScalar, ArgPointer}, Return: Scalar},
+	GetFuncArg:                 {Args: []ArgKind{ArgContext, ArgScalar, ArgPointer}, Return: Scalar},
+	GetFuncRet:                 {Args: []ArgKind{ArgContext, ArgPointer}, Return: Scalar},
+	GetFuncArgCnt:              {Args: []ArgKind{ArgContext}, Return: Scalar},
+	GetRetval:                  {Return: Scalar},
+	SetRetval:                  {Args: []ArgKind{ArgScalar}, Return: Scalar},
+	XDPGetBuffLen:              {Args: []ArgKind{ArgContext}, Return: Scalar},
+	XDPLoadBytes:               {Args: []ArgKind{ArgContext, ArgScalar, ArgPointer, ArgScalar}, Return: Scalar},
+	XDPStoreBytes:              {Args: []ArgKind{ArgContext, ArgScalar, ArgPointer, ArgScalar}, Return: Scalar},
+	CopyFromUserTask:           {Args: []ArgKind{ArgPointer, ArgScalar, ArgPointer, ArgPointer, ArgScalar}, Return: Scalar, GPLOnly: true},
+	SKBSetTstamp:               {Args: []ArgKind{ArgContext, ArgScalar, ArgScalar}, Return: Scalar},
+	IMAFileHash:                {Args: []ArgKind{ArgPointer, ArgPointer, ArgScalar}, Return: Scalar},
+	KptrXchg:                   {Args: []ArgKind{ArgPointer, ArgPointer}, Return: Unknown},
+	MapLookupPerCPUElement:     {Args: []ArgKind{ArgMap, ArgMemory, ArgScalar}, Return: PointerToMapValueOrNull},
+	SkcToMPTCPSock:             {Args: []ArgKind{ArgPointer}, Return: Unknown},
+	DynptrFromMem:              {Args: []ArgKind{ArgPointer, ArgScalar, ArgScalar, ArgPointer}, Return: Scalar},
+	RingbufReserveDynptr:       {Args: []ArgKind{ArgPointer, ArgScalar, ArgScalar, ArgPointer}, Return: Scalar},
+	RingbufSubmitDynptr:        {Args: []ArgKind{ArgPointer, ArgScalar}, Return: Uninitialized},
+	RingbufDiscardDynptr:       {Args: []ArgKind{ArgPointer, ArgScalar}, Return: Uninitialized},
+	DynptrRead:                 {Args: []ArgKind{ArgPointer, ArgScalar, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar},
+	DynptrWrite:                {Args: []ArgKind{ArgPointer, ArgScalar, ArgPointer, ArgScalar, ArgScalar}, Return: Scalar},
+	DynptrData:                 {Args: []ArgKind{ArgPointer, ArgScalar, ArgScalar}, Return: Unknown},
+	TCPRawGenSyncookieIPv4:     {Args: []ArgKind{ArgPointer, ArgPointer, ArgScalar}, Return: Scalar},
+	TCPRawGenSyncookieIPv6:     {Args: []ArgKind{ArgPointer, ArgPointer, ArgScalar}, Return: Scalar},
+	TCPRawCheckSyncookieIPv4:   {Args: []ArgKind{ArgPointer, ArgPointer}, Return: Scalar},
+	TCPRawCheckSyncookieIPv6:   {Args: []ArgKind{ArgPointer, ArgPointer}, Return: Scalar},
+	KtimeGetTAINS:              {Return: Scalar},
+	UserRingbufDrain:           {Args: []ArgKind{ArgMap, ArgPointer, ArgContext, ArgScalar}, Return: Scalar},
+}
@@ -0,0 +1,31 @@
+package asm
+
+import "testing"
+
+func TestBuiltinFuncInfo(t *testing.T) {
+	// Helper IDs are part of the kernel ABI.
+	if SKBAdjustRoom != 50 || UserRingbufDrain != 209 {
+		t.Fatal("Helper numbering doesn't match the kernel")
+	}
+
+	for fn := MapLookupElement; fn <= UserRingbufDrain; fn++ {
+		info, ok := fn.Info()
+		if !ok {
+			t.Errorf("%s has no info", fn)
+			continue
+		}
+		if len(info.Args) > 5 {
+			t.Errorf("%s has %d arguments", fn, len(info.Args))
+		}
+	}
+
+	info, _ := ProbeRead.Info()
+	if !info.GPLOnly {
+		t.Error("ProbeRead should be GPL-only")
+	}
+
+	info, _ = MapLookupElement.Info()
+	if info.Return != PointerToMapValueOrNull {
+		t.Error("MapLookupElement should return a map value or NULL, got", info.Return)
+	}
+}
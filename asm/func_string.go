@@ -4,9 +4,9 @@ package asm
 
 import "strconv"
 
-const _BuiltinFunc_name = "MapLookupElementMapUpdateElementMapDeleteElementProbeReadKtimeGetNSTracePrintkGetPRandomu32GetSMPProcessorIDSKBStoreBytesCSUMReplaceL3CSUMReplaceL4TailCallCloneRedirectGetCurrentPIDTGIDGetCurrentUIDGIDGetCurrentCommGetCGroupClassIDSKBVlanPushSKBVlanPopSKBGetTunnelKeySKBSetTunnelKeyPerfEventReadRedirectGetRouteRealmPerfEventOutputGetStackIDCsumDiffSKBGetTunnelOptSKBSetTunnelOptSKBChangeProtoSKBChangeTypeSKBUnderCGroupGetHashRecalcGetCurrentTaskProbeWriteUserCurrentTaskUnderCGroupSKBChangeTailSKBPullDataCSUMUpdateSetHashInvalidGetNUMANodeIDSKBChangeHeadXDPAdjustHeadProbeReadStrGetSocketCookieGetSocketUIDSetHashSetSockOptSKBAdjustRoom"
+const _BuiltinFunc_name = "MapLookupElementMapUpdateElementMapDeleteElementProbeReadKtimeGetNSTracePrintkGetPRandomu32GetSMPProcessorIDSKBStoreBytesCSUMReplaceL3CSUMReplaceL4TailCallCloneRedirectGetCurrentPIDTGIDGetCurrentUIDGIDGetCurrentCommGetCGroupClassIDSKBVlanPushSKBVlanPopSKBGetTunnelKeySKBSetTunnelKeyPerfEventReadRedirectGetRouteRealmPerfEventOutputSKBLoadBytesGetStackIDCsumDiffSKBGetTunnelOptSKBSetTunnelOptSKBChangeProtoSKBChangeTypeSKBUnderCGroupGetHashRecalcGetCurrentTaskProbeWriteUserCurrentTaskUnderCGroupSKBChangeTailSKBPullDataCSUMUpdateSetHashInvalidGetNUMANodeIDSKBChangeHeadXDPAdjustHeadProbeReadStrGetSocketCookieGetSocketUIDSetHashSetSockOptSKBAdjustRoomRedirectMapSkRedirectMapSockMapUpdateXDPAdjustMetaPerfEventReadValuePerfProgReadValueGetSockOptOverrideReturnSockOpsCBFlagsSetMsgRedirectMapMsgApplyBytesMsgCorkBytesMsgPullDataBindXDPAdjustTailSKBGetXFRMStateGetStackSKBLoadBytesRelativeFIBLookupSockHashUpdateMsgRedirectHashSkRedirectHashLWTPushEncapLWTSeg6StoreBytesLWTSeg6AdjustSRHLWTSeg6ActionRCRepeatRCKeydownSKBCGroupIDGetCurrentCGroupIDGetLocalStorageSkSelectReuseportSKBAncestorCGroupIDSkLookupTCPSkLookupUDPSkReleaseMapPushElementMapPopElementMapPeekElementMsgPushDataMsgPopDataRCPointerRelSpinLockSpinUnlockSkFullsockTCPSockSKBECNSetCEGetListenerSockSkcLookupTCPTCPCheckSyncookieSysctlGetNameSysctlGetCurrentValueSysctlGetNewValueSysctlSetNewValueStrtolStrtoulSkStorageGetSkStorageDeleteSendSignalTCPGenSyncookieSKBOutputProbeReadUserProbeReadKernelProbeReadUserStrProbeReadKernelStrTCPSendAckSendSignalThreadJiffies64ReadBranchRecordsGetNSCurrentPIDTGIDXDPOutputGetNetNSCookieGetCurrentAncestorCGroupIDSkAssignKtimeGetBootNSSeqPrintfSeqWriteSkCGroupIDSkAncestorCGroupIDRingbufOutputRingbufReserveRingbufSubmitRingbufDiscardRingbufQueryCSUMLevelSkcToTCP6SockSkcToTCPSockSkcToTCPTimewaitSockSkcToTCPRequestSockSkcToUDP6SockGetTaskStackLoadHdrOptStoreHdrOptReserveHdrOptInodeStorageGetInodeStorageDeleteDPathCopyFromUserSnprintfBTFSeqPrintfBTFSKBCGroupClassIDRedirectNeighPerCPUPtrThisCPUPtrRedirectPeerTaskStorageGetTaskStorageDeleteGetCurrentTaskBTFBprmOptsSetKtimeGetCoarseNSIMAInodeHashSockFromFileCheckMTUForEachMapElementSnprintfSysBPFBTFFindByNameKindSysCloseTimerInitTimerSetCallbackTimerStartTimerCancelGetFuncIPGetAttachCookieTaskPTRegsGetBranchSnapshotTraceVprintkSkcToUnixSockKallsymsLookupNameFindVMALoopStrncmpGetFuncArgGetFuncRetGetFuncArgCntGetRetvalSetRetvalXDPGetBuffLenXDPLoadBytesXDPStoreBytesCopyFromUserTaskSKBSetTstampIMAFileHashKptrXchgMapLookupPerCPUElementSkcToMPTCPSockDynptrFromMemRingbufReserveDynptrRingbufSubmitDynptrRingbufDiscardDynptrDynptrReadDynptrWriteDynptrDataTCPRawGenSyncookieIPv4TCPRawGenSyncookieIPv6TCPRawCheckSyncookieIPv4TCPRawCheckSyncookieIPv6KtimeGetTAINSUserRingbufDrain"
 
-var _BuiltinFunc_index = [...]uint16{0, 16, 32, 48, 57, 67, 78, 91, 108, 121, 134, 147, 155, 168, 185, 201, 215, 231, 242, 252, 267, 282, 295, 303, 316, 331, 341, 349, 364, 379, 393, 406, 420, 433, 447, 461, 483, 496, 507, 517, 531, 544, 557, 570, 582, 597, 609, 616, 626, 639}
+var _BuiltinFunc_index = [...]uint16{0, 16, 32, 48, 57, 67, 78, 91, 108, 121, 134, 147, 155, 168, 185, 201, 215, 231, 242, 252, 267, 282, 295, 303, 316, 331, 343, 353, 361, 376, 391, 405, 418, 432, 445, 459, 473, 495, 508, 519, 529, 543, 556, 569, 582, 594, 609, 621, 628, 638, 651, 662, 675, 688, 701, 719, 736, 746, 760, 777, 791, 804, 816, 827, 831, 844, 859, 867, 887, 896, 910, 925, 939, 951, 968, 984, 997, 1005, 1014, 1025, 1043, 1058, 1075, 1094, 1105, 1116, 1125, 1139, 1152, 1166, 1177, 1187, 1199, 1207, 1217, 1227, 1234, 1245, 1260, 1272, 1289, 1302, 1323, 1340, 1357, 1363, 1370, 1382, 1397, 1407, 1422, 1431, 1444, 1459, 1475, 1493, 1503, 1519, 1528, 1545, 1564, 1573, 1587, 1613, 1621, 1635, 1644, 1652, 1662, 1680, 1693, 1707, 1720, 1734, 1746, 1755, 1768, 1780, 1800, 1819, 1832, 1844, 1854, 1865, 1878, 1893, 1911, 1916, 1928, 1939, 1951, 1967, 1980, 1989, 1999, 2011, 2025, 2042, 2059, 2070, 2086, 2098, 2110, 2118, 2135, 2143, 2149, 2166, 2174, 2183, 2199, 2209, 2220, 2229, 2244, 2254, 2271, 2283, 2296, 2314, 2321, 2325, 2332, 2342, 2352, 2365, 2374, 2383, 2396, 2408, 2421, 2437, 2449, 2460, 2468, 2490, 2504, 2517, 2537, 2556, 2576, 2586, 2597, 2607, 2629, 2651, 2675, 2699, 2712, 2728}
 
 func (i BuiltinFunc) String() string {
 	i -= 1
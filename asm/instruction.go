@@ -1,8 +1,11 @@
 package asm
 
 import (
+	"bytes"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"math"
 	"strings"
@@ -22,6 +25,10 @@ type Instruction struct {
 	Constant  int64
 	Reference string
 	Symbol    string
+
+	// Source is the line of source code the instruction was
+	// generated from, or nil if it is unknown.
+	Source *SourceLine
 }
 
 // Sym creates a symbol.
@@ -45,25 +52,33 @@ func (ins Instruction) Format(f fmt.State, c rune) {
 	}
 
 	// Omit trailing space for Exit
-	if op.JumpOp() == Exit {
+	if op.Class() == JumpClass && op.JumpOp() == Exit {
 		fmt.Fprint(f, op)
 		return
 	}
 
-	fmt.Fprintf(f, "%v ", op)
+	fmt.Fprintf(f, "%s ", ins.mnemonic())
 	switch cls := op.Class(); cls {
 	case LdClass, LdXClass, StClass, StXClass:
 		switch op.Mode() {
 		case ImmMode:
-			fmt.Fprintf(f, "dst: %s imm: %d", ins.Dst, ins.Constant)
+			if ins.Src != R0 {
+				// Pseudo instructions, like loading a map fd.
+				fmt.Fprintf(f, "dst: %s src: %s imm: %d", ins.Dst, ins.Src, ins.Constant)
+			} else {
+				fmt.Fprintf(f, "dst: %s imm: %d", ins.Dst, ins.Constant)
+			}
 		case AbsMode:
 			fmt.Fprintf(f, "imm: %d", ins.Constant)
 		case IndMode:
 			fmt.Fprintf(f, "dst: %s src: %s imm: %d", ins.Dst, ins.Src, ins.Constant)
-		case MemMode:
+		case MemMode, MemSXMode:
 			fmt.Fprintf(f, "dst: %s src: %s off: %d imm: %d", ins.Dst, ins.Src, ins.Offset, ins.Constant)
 		case XAddMode:
-			fmt.Fprintf(f, "dst: %s src: %s", ins.Dst, ins.Src)
+			if ins.Constant != int64(AddAtomic) {
+				fmt.Fprintf(f, "%s ", AtomicOp(ins.Constant))
+			}
+			fmt.Fprintf(f, "dst: %s src: %s off: %d", ins.Dst, ins.Src, ins.Offset)
 		}
 
 	case ALU64Class, ALUClass:
@@ -74,7 +89,11 @@ func (ins Instruction) Format(f fmt.State, c rune) {
 			fmt.Fprintf(f, "src: %s", ins.Src)
 		}
 
-	case JumpClass:
+		if ins.Offset != 0 && !ins.IsSigned() && ins.SignExtension() == InvalidSize {
+			fmt.Fprintf(f, " off: %d", ins.Offset)
+		}
+
+	case JumpClass, Jump32Class:
 		switch jop := op.JumpOp(); jop {
 		case Call:
 			if ins.Src == R1 {
@@ -99,6 +118,19 @@ func (ins Instruction) Format(f fmt.State, c rune) {
 	}
 }
 
+// mnemonic returns the name of the operation, which includes ALU
+// operations encoded in the offset.
+func (ins Instruction) mnemonic() string {
+	name := ins.OpCode.String()
+	switch size := ins.SignExtension(); {
+	case ins.IsSigned():
+		name = "S" + name
+	case size != InvalidSize:
+		name = strings.Replace(name, "Mov", "MovSX"+size.suffix(), 1)
+	}
+	return name
+}
+
 // Instructions is an eBPF program.
 type Instructions []Instruction
 
@@ -142,6 +174,87 @@ func (insns Instructions) ReferenceOffsets() map[string][]int {
 	return offsets
 }
 
+// Targets returns the index of the instruction that each jump or
+// bpf-to-bpf call transfers control to, and -1 for all other
+// instructions.
+//
+// Jumps with an Offset of -1 and calls with a Constant of -1 are
+// resolved via their Reference, everything else by offset.
+func (insns Instructions) Targets() ([]int, error) {
+	symbols, err := insns.SymbolOffsets()
+	if err != nil {
+		return nil, err
+	}
+
+	positions, indices := insns.positions()
+
+	targets := make([]int, len(insns))
+	for i, ins := range insns {
+		targets[i] = -1
+
+		offset, ok := ins.branchOffset()
+		if !ok {
+			continue
+		}
+
+		if offset == -1 {
+			target, ok := symbols[ins.Reference]
+			if !ok {
+				return nil, errors.Errorf("instruction %d: reference to missing symbol %s", i, ins.Reference)
+			}
+			targets[i] = target
+			continue
+		}
+
+		target, ok := indices[positions[i]+1+int(offset)]
+		if !ok {
+			return nil, errors.Errorf("instruction %d: invalid offset %d", i, offset)
+		}
+		targets[i] = target
+	}
+
+	return targets, nil
+}
+
+// positions returns the marshalled position of each instruction, and
+// the index of the instruction at each position.
+//
+// Offsets are relative to the marshalled position of an instruction,
+// which differs from its index due to 64 bit loads.
+func (insns Instructions) positions() ([]int, map[int]int) {
+	var (
+		positions = make([]int, len(insns))
+		indices   = make(map[int]int)
+		pos       = 0
+	)
+	for i, ins := range insns {
+		positions[i] = pos
+		indices[pos] = i
+		pos += ins.OpCode.marshalledInstructions()
+	}
+	return positions, indices
+}
+
+// branchOffset returns the offset of a jump or bpf-to-bpf call, and
+// false for all other instructions. An offset of -1 means that the
+// target is given by Reference.
+func (ins Instruction) branchOffset() (int64, bool) {
+	if !ins.OpCode.Class().isJump() {
+		return 0, false
+	}
+
+	switch jop := ins.OpCode.JumpOp(); {
+	case jop == Exit:
+		return 0, false
+	case jop == Call && ins.Src != R1:
+		return 0, false
+	case jop == Call, ins.OpCode == longJumpOp:
+		return ins.Constant, true
+	default:
+		return int64(ins.Offset), true
+	}
+}
+
 func (insns Instructions) marshalledOffsets() (map[string]int, error) {
 	symbols := make(map[string]int)
 
@@ -210,11 +323,18 @@ func (insns Instructions) Format(f fmt.State, c rune) {
 	}
 	offsetWidth := int(math.Ceil(math.Log10(float64(highestOffset))))
 
-	offset := 0
+	var (
+		offset = 0
+		source *SourceLine
+	)
 	for _, ins := range insns {
 		if ins.Symbol != "" {
 			fmt.Fprintf(f, "%s%s:\n", symIndent, ins.Symbol)
 		}
+		if src := ins.Source; src != nil && src.Text != "" && (source == nil || src.FileName != source.FileName || src.Line != source.Line) {
+			fmt.Fprintf(f, "%s; %s\n", indent, strings.TrimSpace(ins.Source.Text))
+		}
+		source = ins.Source
 		fmt.Fprintf(f, "%s%*d: %v\n", indent, offsetWidth, offset, ins)
 		offset += ins.OpCode.marshalledInstructions()
 	}
@@ -222,6 +342,44 @@ func (insns Instructions) Format(f fmt.State, c rune) {
 	return
 }
 
+// Tag calculates the kernel tag for a series of instructions.
+//
+// The tag is a hash of the marshalled instructions, with map file
+// descriptors set to zero. Only loads which have been rewritten to refer
+// to a map are treated as map loads, any other reference is hashed as
+// the constant it currently holds.
+//
+// The kernel uses SHA-1 as the hash, and SHA-256 as of Linux 6.18.
+// See bpf_prog_calc_tag.
+func (insns Instructions) Tag(bo binary.ByteOrder, h hash.Hash) (string, error) {
+	loadImmDW := LoadImmOp(DWord)
+
+	stable := make(Instructions, len(insns))
+	for i, ins := range insns {
+		if ins.OpCode == loadImmDW && (ins.Src == pseudoMapFD || ins.Src == pseudoMapValue) {
+			ins.Constant = 0
+		}
+		stable[i] = ins
+	}
+
+	var buf bytes.Buffer
+	if err := stable.Marshal(&buf, bo); err != nil {
+		return "", err
+	}
+
+	h.Reset()
+	h.Write(buf.Bytes())
+	return hex.EncodeToString(h.Sum(nil)[:tagSize]), nil
+}
+
+const (
+	pseudoMapFD    = R1 // BPF_PSEUDO_MAP_FD
+	pseudoMapValue = R2 // BPF_PSEUDO_MAP_VALUE
+
+	// Size of a program tag in bytes.
+	tagSize = 8
+)
+
 // Marshal encodes a BPF program into the kernel format.
 func (insns Instructions) Marshal(w io.Writer, bo binary.ByteOrder) error {
 	loadImmDW := LoadImmOp(DWord)
@@ -245,6 +403,15 @@ func (insns Instructions) Marshal(w io.Writer, bo binary.ByteOrder) error {
 			// Encode least significant 32bit first for 64bit operations.
 			cons = int32(uint32(ins.Constant))
 
+		case ins.OpCode == longJumpOp && ins.Constant == -1:
+			// Rewrite long jump to label
+			offset, ok := absoluteOffsets[ins.Reference]
+			if !ok {
+				return errors.Errorf("instruction %d: reference to missing symbol %s", i, ins.Reference)
+			}
+
+			cons = int32(offset - num - 1)
+
 		case ins.OpCode.JumpOp() == Call && ins.Constant == -1:
 			// Rewrite bpf to bpf call
 			offset, ok := absoluteOffsets[ins.Reference]
@@ -254,7 +421,7 @@ func (insns Instructions) Marshal(w io.Writer, bo binary.ByteOrder) error {
 
 			cons = int32(offset - num - 1)
 
-		case ins.OpCode.Class() == JumpClass && ins.Offset == -1:
+		case ins.OpCode.Class().isJump() && ins.Offset == -1:
 			// Rewrite jump to label
 			offset, ok := absoluteOffsets[ins.Reference]
 			if !ok {
@@ -331,6 +498,10 @@ func (insns *Instructions) Unmarshal(r io.Reader, bo binary.ByteOrder) (map[uint
 			cons = int64(uint64(uint32(ins2.Constant))<<32 | uint64(uint32(ins.Constant)))
 		}
 
+		if ins.OpCode.Class() == StXClass && ins.OpCode.Mode() == XAddMode && !AtomicOp(ins.Constant).Valid() {
+			return nil, errors.Errorf("instruction at offset %x: unknown atomic operation %#x", offset, uint32(ins.Constant))
+		}
+
 		*insns = append(*insns, Instruction{
 			OpCode:   ins.OpCode,
 			Dst:      ins.Registers.Dst(),
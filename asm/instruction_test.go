@@ -2,6 +2,8 @@ package asm
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
@@ -102,3 +104,159 @@ func ExampleInstructions_Format() {
 	// 	1: LdImmDW dst: r0 imm: 42
 	// 	3: Exit
 }
+
+func TestAtomics(t *testing.T) {
+	insns := Instructions{
+		XAdd(R1, R2, Word),
+		FetchAnd.Mem(R1, R2, DWord),
+		CmpXchg.Mem(R1, R2, DWord),
+	}
+
+	var buf bytes.Buffer
+	if err := insns.Marshal(&buf, binary.LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+
+	// *(u64 *)(r1 + 0) = cmpxchg(r1, r0, r2)
+	want := []byte{0xdb, 0x21, 0x00, 0x00, 0xf1, 0x00, 0x00, 0x00}
+	if have := buf.Bytes()[16:]; !bytes.Equal(have, want) {
+		t.Errorf("Expected CmpXchg to encode as %x, got %x", want, have)
+	}
+
+	var have Instructions
+	if _, err := have.Unmarshal(&buf, binary.LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, ins := range have {
+		if ins != insns[i] {
+			t.Errorf("Instruction %d: have %v, want %v", i, ins, insns[i])
+		}
+	}
+
+	if op := have[1].AtomicOp(); op != FetchAnd || !op.Fetch() {
+		t.Error("Expected FetchAnd, got", op)
+	}
+
+	if op := Mov.Imm(R0, 0).AtomicOp(); op != InvalidAtomic {
+		t.Error("Expected InvalidAtomic for non atomic instruction, got", op)
+	}
+
+	for op, name := range map[AtomicOp]string{
+		AddAtomic: "AddAtomic",
+		OrAtomic:  "OrAtomic",
+		AndAtomic: "AndAtomic",
+		XorAtomic: "XorAtomic",
+		FetchAdd:  "FetchAdd",
+		FetchOr:   "FetchOr",
+		FetchAnd:  "FetchAnd",
+		FetchXor:  "FetchXor",
+		Xchg:      "Xchg",
+		CmpXchg:   "CmpXchg",
+	} {
+		if have := op.String(); have != name {
+			t.Errorf("Expected %s, got %s", name, have)
+		}
+
+		want := "StXXAddDW " + name + " dst: r1 src: r2 off: 0"
+		if op == AddAtomic {
+			want = "StXXAddDW dst: r1 src: r2 off: 0"
+		}
+		if have := fmt.Sprint(op.Mem(R1, R2, DWord)); have != want {
+			t.Errorf("Expected %q, got %q", want, have)
+		}
+	}
+
+	invalid := []byte{0xdb, 0x21, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}
+	if _, err := have.Unmarshal(bytes.NewReader(invalid), binary.LittleEndian); err == nil {
+		t.Error("Unmarshal accepts unknown atomic operation")
+	}
+}
+
+func TestLongJump(t *testing.T) {
+	insns := Instructions{
+		LongJump("exit"),
+		LoadImm(R0, 0, DWord),
+		Return().Sym("exit"),
+	}
+
+	var buf bytes.Buffer
+	if err := insns.Marshal(&buf, binary.LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+
+	var have Instructions
+	if _, err := have.Unmarshal(&buf, binary.LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := have[0].Constant; c != 2 {
+		t.Error("Expected long jump to have offset 2, got", c)
+	}
+
+	targets, err := have.Targets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if targets[0] != 2 {
+		t.Error("Expected long jump to target instruction 2, got", targets[0])
+	}
+}
+
+func TestTag(t *testing.T) {
+	insns := Instructions{
+		Mov.Imm(R0, 0),
+		Return(),
+	}
+
+	tag, err := insns.Tag(binary.LittleEndian, sha1.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag != "a04f5eef06a7f555" {
+		t.Error("Unexpected tag", tag)
+	}
+
+	withMap := func(load Instruction) string {
+		t.Helper()
+
+		tag, err := Instructions{load, Mov.Imm(R0, 0), Return()}.Tag(binary.LittleEndian, sha256.New())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tag
+	}
+
+	unresolved := LoadImm(R1, 0, DWord)
+	unresolved.Reference = "map"
+
+	want := withMap(LoadMapPtr(R1, 3))
+	if withMap(LoadMapPtr(R1, 4)) != want {
+		t.Error("Tag depends on map fd")
+	}
+	if withMap(unresolved) != withMap(LoadImm(R1, 0, DWord)) {
+		t.Error("Tag of unresolved reference doesn't match its constant")
+	}
+	if withMap(LoadImm(R1, 3, DWord)) == want {
+		t.Error("Tag doesn't depend on 64 bit immediates")
+	}
+}
+
+func TestFormatSource(t *testing.T) {
+	line := &SourceLine{FileName: "prog.c", Line: 3, Column: 9, Text: "\treturn 0;"}
+	insns := Instructions{
+		Mov.Imm(R0, 0),
+		Return(),
+	}
+	insns[0].Source = line
+	insns[1].Source = &SourceLine{FileName: "prog.c", Line: 3, Column: 2, Text: "\treturn 0;"}
+
+	want := "\t; return 0;\n\t0: MovImm dst: r0 imm: 0\n\t1: Exit\n"
+	if have := fmt.Sprintf("%v", insns); have != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, have)
+	}
+
+	if have := line.String(); have != "prog.c:3:9 (return 0;)" {
+		t.Error("Unexpected string for source line:", have)
+	}
+}
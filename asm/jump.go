@@ -60,14 +60,30 @@ func (op JumpOp) Op(source Source) OpCode {
 	return OpCode(JumpClass).SetJumpOp(op).SetSource(source)
 }
 
+// Op32 returns the OpCode for a given jump source, comparing
+// only the lower 32 bit of the operands.
+func (op JumpOp) Op32(source Source) OpCode {
+	return OpCode(Jump32Class).SetJumpOp(op).SetSource(source)
+}
+
 // Imm compares dst to value, and adjusts PC by offset if the condition is fulfilled.
 func (op JumpOp) Imm(dst Register, value int32, label string) Instruction {
+	return op.imm(JumpClass, dst, value, label)
+}
+
+// Imm32 compares the lower 32 bit of dst to value, and adjusts PC
+// by offset if the condition is fulfilled.
+func (op JumpOp) Imm32(dst Register, value int32, label string) Instruction {
+	return op.imm(Jump32Class, dst, value, label)
+}
+
+func (op JumpOp) imm(class Class, dst Register, value int32, label string) Instruction {
 	if op == Exit || op == Call || op == Ja {
 		return Instruction{OpCode: InvalidOpCode}
 	}
 
 	return Instruction{
-		OpCode:    OpCode(JumpClass).SetJumpOp(op).SetSource(ImmSource),
+		OpCode:    OpCode(class).SetJumpOp(op).SetSource(ImmSource),
 		Dst:       dst,
 		Offset:    -1,
 		Constant:  int64(value),
@@ -77,12 +93,22 @@ func (op JumpOp) Imm(dst Register, value int32, label string) Instruction {
 
 // Reg compares dst to src, and adjusts PC by offset if the condition is fulfilled.
 func (op JumpOp) Reg(dst, src Register, label string) Instruction {
+	return op.reg(JumpClass, dst, src, label)
+}
+
+// Reg32 compares the lower 32 bit of dst and src, and adjusts PC
+// by offset if the condition is fulfilled.
+func (op JumpOp) Reg32(dst, src Register, label string) Instruction {
+	return op.reg(Jump32Class, dst, src, label)
+}
+
+func (op JumpOp) reg(class Class, dst, src Register, label string) Instruction {
 	if op == Exit || op == Call || op == Ja {
 		return Instruction{OpCode: InvalidOpCode}
 	}
 
 	return Instruction{
-		OpCode:    OpCode(JumpClass).SetJumpOp(op).SetSource(RegSource),
+		OpCode:    OpCode(class).SetJumpOp(op).SetSource(RegSource),
 		Dst:       dst,
 		Src:       src,
 		Offset:    -1,
@@ -90,6 +116,21 @@ func (op JumpOp) Reg(dst, src Register, label string) Instruction {
 	}
 }
 
+// LongJump adjusts PC to the address of the label. The offset is
+// stored in Constant instead of Offset, which allows jumps beyond
+// 32k instructions.
+//
+// Requires ISA v4.
+func LongJump(label string) Instruction {
+	return Instruction{
+		OpCode:    longJumpOp,
+		Constant:  -1,
+		Reference: label,
+	}
+}
+
+var longJumpOp = OpCode(Jump32Class).SetJumpOp(Ja)
+
 // Label adjusts PC to the address of the label.
 func (op JumpOp) Label(label string) Instruction {
 	if op == Call {
@@ -1,6 +1,6 @@
 package asm
 
-//go:generate stringer -output load_store_string.go -type=Mode,Size
+//go:generate stringer -output load_store_string.go -type=Mode,Size,AtomicOp
 
 // Mode for load and store operations
 //
@@ -24,7 +24,10 @@ const (
 	IndMode Mode = 0x40
 	// MemMode - load from memory
 	MemMode Mode = 0x60
-	// XAddMode - add atomically across processors.
+	// MemSXMode - load from memory and sign extend, requires ISA v4
+	MemSXMode Mode = 0x80
+	// XAddMode - atomic operations across processors. The
+	// operation is encoded in the constant, see AtomicOp.
 	XAddMode Mode = 0xc0
 )
 
@@ -52,6 +55,22 @@ const (
 	Byte Size = 0x10
 )
 
+// suffix returns the abbreviation of s used in mnemonics.
+func (s Size) suffix() string {
+	switch s {
+	case DWord:
+		return "DW"
+	case Word:
+		return "W"
+	case Half:
+		return "H"
+	case Byte:
+		return "B"
+	default:
+		return ""
+	}
+}
+
 // Sizeof returns the size in bytes.
 func (s Size) Sizeof() int {
 	switch s {
@@ -83,6 +102,24 @@ func LoadMem(dst, src Register, offset int16, size Size) Instruction {
 	}
 }
 
+// LoadMemSXOp returns the OpCode to load a value of given size from
+// memory and sign extend it to 64 bit.
+func LoadMemSXOp(size Size) OpCode {
+	return OpCode(LdXClass).SetMode(MemSXMode).SetSize(size)
+}
+
+// LoadMemSX emits `dst = *(signed size *)(src + offset)`.
+//
+// Requires ISA v4.
+func LoadMemSX(dst, src Register, offset int16, size Size) Instruction {
+	return Instruction{
+		OpCode: LoadMemSXOp(size),
+		Dst:    dst,
+		Src:    src,
+		Offset: offset,
+	}
+}
+
 // LoadImmOp returns the OpCode to load an immediate of given size.
 //
 // As of kernel 4.20, only DWord size is accepted.
@@ -170,16 +207,95 @@ func StoreImm(dst Register, offset int16, value int64, size Size) Instruction {
 	}
 }
 
-// XAddOp returns the OpCode to atomically add a register to a value in memory.
+// XAddOp returns the OpCode for atomic operations on a value in memory.
 func XAddOp(size Size) OpCode {
 	return OpCode(StXClass).SetMode(XAddMode).SetSize(size)
 }
 
 // XAdd atomically adds src to *dst.
 func XAdd(dst, src Register, size Size) Instruction {
+	return AddAtomic.Mem(dst, src, size)
+}
+
+// AtomicOp is the operation performed by an XAddMode instruction,
+// stored in its constant.
+//
+//    msb              lsb
+//    +-----------+----+-+
+//    |  ???????  | OP |f|
+//    +-----------+----+-+
+//
+// Only Word and DWord sizes are supported.
+type AtomicOp uint32
+
+// atomicFetch is untyped, so that stringer doesn't pick it up as a
+// name for FetchAdd.
+const atomicFetch = 0x01
+
+const (
+	// InvalidAtomic is returned by getters when invoked
+	// on non atomic instructions
+	InvalidAtomic AtomicOp = 0xffffffff
+	// AddAtomic - *dst += src
+	AddAtomic AtomicOp = AtomicOp(Add)
+	// OrAtomic - *dst |= src
+	OrAtomic AtomicOp = AtomicOp(Or)
+	// AndAtomic - *dst &= src
+	AndAtomic AtomicOp = AtomicOp(And)
+	// XorAtomic - *dst ^= src
+	XorAtomic AtomicOp = AtomicOp(Xor)
+	// FetchAdd - src = atomic_fetch_add(dst, src)
+	FetchAdd AtomicOp = AddAtomic | atomicFetch
+	// FetchOr - src = atomic_fetch_or(dst, src)
+	FetchOr AtomicOp = OrAtomic | atomicFetch
+	// FetchAnd - src = atomic_fetch_and(dst, src)
+	FetchAnd AtomicOp = AndAtomic | atomicFetch
+	// FetchXor - src = atomic_fetch_xor(dst, src)
+	FetchXor AtomicOp = XorAtomic | atomicFetch
+	// Xchg - src = atomic_xchg(dst, src)
+	Xchg AtomicOp = 0xe0 | atomicFetch
+	// CmpXchg - r0 = atomic_cmpxchg(dst, r0, src)
+	CmpXchg AtomicOp = 0xf0 | atomicFetch
+)
+
+// Fetch returns true if the operation writes the previous
+// value of the memory back into a register.
+func (op AtomicOp) Fetch() bool {
+	return op != InvalidAtomic && op&atomicFetch != 0
+}
+
+// Valid returns true if the kernel defines the operation.
+func (op AtomicOp) Valid() bool {
+	switch op {
+	case AddAtomic, OrAtomic, AndAtomic, XorAtomic,
+		FetchAdd, FetchOr, FetchAnd, FetchXor, Xchg, CmpXchg:
+		return true
+	default:
+		return false
+	}
+}
+
+// Mem emits an atomic operation on *(size *)dst using src.
+//
+// CmpXchg additionally compares against and writes to R0.
+func (op AtomicOp) Mem(dst, src Register, size Size) Instruction {
+	if !op.Valid() {
+		return Instruction{OpCode: InvalidOpCode}
+	}
+
 	return Instruction{
-		OpCode: XAddOp(size),
-		Dst:    dst,
-		Src:    src,
+		OpCode:   XAddOp(size),
+		Dst:      dst,
+		Src:      src,
+		Constant: int64(op),
+	}
+}
+
+// AtomicOp returns the atomic operation of an instruction, or
+// InvalidAtomic if it isn't an atomic instruction.
+func (ins Instruction) AtomicOp() AtomicOp {
+	if ins.OpCode.Class() != StXClass || ins.OpCode.Mode() != XAddMode {
+		return InvalidAtomic
 	}
+	return AtomicOp(ins.Constant)
 }
@@ -38,6 +38,8 @@ const (
 	ALUClass Class = 0x04
 	// JumpClass jump operators
 	JumpClass Class = 0x05
+	// Jump32Class jump operators comparing the lower 32 bit
+	Jump32Class Class = 0x06
 	// ALU64Class arithmetic in 64 bit mode
 	ALU64Class Class = 0x07
 )
@@ -46,13 +48,18 @@ func (cls Class) encoding() encoding {
 	switch cls {
 	case LdClass, LdXClass, StClass, StXClass:
 		return loadOrStore
-	case ALU64Class, ALUClass, JumpClass:
+	case ALU64Class, ALUClass, JumpClass, Jump32Class:
 		return jumpOrALU
 	default:
 		return unknownEncoding
 	}
 }
 
+// isJump returns true for both 64 and 32 bit jumps.
+func (cls Class) isJump() bool {
+	return cls == JumpClass || cls == Jump32Class
+}
+
 // OpCode is a packed eBPF opcode.
 //
 // Its encoding is defined by a Class value:
@@ -173,7 +180,7 @@ func (op OpCode) SetALUOp(alu ALUOp) OpCode {
 //
 // Returns InvalidOpCode if op is of the wrong class.
 func (op OpCode) SetJumpOp(jump JumpOp) OpCode {
-	if op.Class() != JumpClass || !valid(OpCode(jump), jumpMask) {
+	if !op.Class().isJump() || !valid(OpCode(jump), jumpMask) {
 		return InvalidOpCode
 	}
 	return (op & ^jumpMask) | OpCode(jump)
@@ -189,18 +196,15 @@ func (op OpCode) String() string {
 		mode := op.Mode()
 		f.WriteString(strings.TrimSuffix(mode.String(), "Mode"))
 
-		switch op.Size() {
-		case DWord:
-			f.WriteString("DW")
-		case Word:
-			f.WriteString("W")
-		case Half:
-			f.WriteString("H")
-		case Byte:
-			f.WriteString("B")
-		}
+		f.WriteString(op.Size().suffix())
 
 	case ALU64Class, ALUClass:
+		if op.ALUOp() == Swap && class == ALU64Class {
+			// Width for BSwap is controlled by Constant
+			f.WriteString("BSwap")
+			break
+		}
+
 		f.WriteString(op.ALUOp().String())
 
 		if op.ALUOp() == Swap {
@@ -214,14 +218,18 @@ func (op OpCode) String() string {
 			f.WriteString(strings.TrimSuffix(op.Source().String(), "Source"))
 		}
 
-	case JumpClass:
+	case JumpClass, Jump32Class:
 		f.WriteString(op.JumpOp().String())
+		if class == Jump32Class {
+			f.WriteString("32")
+		}
+
 		if jop := op.JumpOp(); jop != Exit && jop != Call {
 			f.WriteString(strings.TrimSuffix(op.Source().String(), "Source"))
 		}
 
 	default:
-		fmt.Fprintf(&f, "%#x", op)
+		fmt.Fprintf(&f, "%#x", uint8(op))
 	}
 
 	return f.String()
@@ -0,0 +1,396 @@
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseError is returned by Parse if the input is malformed.
+type ParseError struct {
+	// Line and Column are 1-based.
+	Line, Column int
+	Msg          string
+}
+
+func (pe *ParseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", pe.Line, pe.Column, pe.Msg)
+}
+
+// Parse reads a textual eBPF program.
+//
+// The syntax is the one emitted by Instructions.Format: one
+// instruction per line, made up of the mnemonic returned by
+// OpCode.String and its operands.
+//
+//    my_func:
+//        0: LdXMemW dst: r0 src: r1 off: 0 imm: 0
+//        1: JEqImm dst: r0 off: -1 imm: 0 <exit>
+//        2: Call MapLookupElement
+//    exit:
+//        3: Exit
+//
+// Instruction offsets are optional and ignored. A line consisting
+// of an identifier followed by a colon assigns a symbol to the
+// next instruction. A name in angle brackets sets the Reference
+// of an instruction. Jumps which have a Reference but no explicit
+// offset are resolved when marshaling. Everything after a ';' is
+// treated as a comment.
+func Parse(r io.Reader) (Instructions, error) {
+	var (
+		insns   Instructions
+		symbol  string
+		lineNum int
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNum++
+
+		line := scanner.Text()
+		if i := strings.IndexByte(line, ';'); i != -1 {
+			line = line[:i]
+		}
+
+		toks, err := tokenize(line, lineNum)
+		if err != nil {
+			return nil, err
+		}
+
+		// Leading "label:" or "offset:"
+		for len(toks) > 0 && toks[0].isKey() {
+			label := toks[0]
+			name := strings.TrimSuffix(label.text, ":")
+			toks = toks[1:]
+
+			if _, err := strconv.ParseUint(name, 10, 64); err == nil {
+				// Instruction offset, as emitted by Instructions.Format.
+				continue
+			}
+
+			if symbol != "" {
+				return nil, &ParseError{lineNum, label.column, fmt.Sprintf("symbol %s is followed by another symbol", symbol)}
+			}
+			symbol = name
+		}
+
+		if len(toks) == 0 {
+			continue
+		}
+
+		ins, err := parseInstruction(toks, lineNum)
+		if err != nil {
+			return nil, err
+		}
+
+		ins.Symbol = symbol
+		symbol = ""
+		insns = append(insns, ins)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if symbol != "" {
+		return nil, &ParseError{lineNum + 1, 1, fmt.Sprintf("symbol %s is not followed by an instruction", symbol)}
+	}
+
+	return insns, nil
+}
+
+type token struct {
+	text   string
+	column int
+}
+
+func (t token) isKey() bool {
+	return len(t.text) > 1 && strings.HasSuffix(t.text, ":")
+}
+
+func (t token) isReference() bool {
+	return strings.HasPrefix(t.text, "<")
+}
+
+func tokenize(line string, lineNum int) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(line); {
+		if unicode.IsSpace(rune(line[i])) {
+			i++
+			continue
+		}
+
+		start := i
+		if line[i] == '<' {
+			end := strings.IndexByte(line[i:], '>')
+			if end == -1 {
+				return nil, &ParseError{lineNum, i + 1, "unterminated reference"}
+			}
+			i += end + 1
+			toks = append(toks, token{line[start:i], start + 1})
+			continue
+		}
+
+		for i < len(line) && !unicode.IsSpace(rune(line[i])) && line[i] != '<' {
+			i++
+			if line[i-1] == ':' {
+				break
+			}
+		}
+		toks = append(toks, token{line[start:i], start + 1})
+	}
+	return toks, nil
+}
+
+func parseInstruction(toks []token, lineNum int) (Instruction, error) {
+	errorf := func(tok token, format string, args ...interface{}) error {
+		return &ParseError{lineNum, tok.column, fmt.Sprintf(format, args...)}
+	}
+
+	mnemonic := toks[0]
+	ins, ok := parseMnemonic(mnemonic.text)
+	if !ok {
+		return Instruction{}, errorf(mnemonic, "unknown mnemonic %s", mnemonic.text)
+	}
+
+	op := ins.OpCode
+	toks = toks[1:]
+
+	isCall := op.Class() == JumpClass && op.JumpOp() == Call
+	if isCall && len(toks) > 0 && !toks[0].isKey() && !toks[0].isReference() {
+		target := toks[0]
+		toks = toks[1:]
+
+		if n, err := strconv.ParseInt(target.text, 0, 32); err == nil {
+			// bpf-to-bpf call
+			ins.Src = R1
+			ins.Constant = n
+		} else if fn, ok := parseBuiltinFunc(target.text); ok {
+			ins.Constant = int64(fn)
+		} else {
+			return Instruction{}, errorf(target, "unknown function %s", target.text)
+		}
+	}
+
+	isAtomic := op.Class() == StXClass && op.Mode() == XAddMode
+	if isAtomic && len(toks) > 0 && !toks[0].isKey() && !toks[0].isReference() {
+		name := toks[0]
+		toks = toks[1:]
+
+		aop, ok := parseAtomicOp(name.text)
+		if !ok {
+			return Instruction{}, errorf(name, "unknown atomic operation %s", name.text)
+		}
+		ins.Constant = int64(aop)
+	}
+
+	var haveOffset, haveConstant bool
+	for len(toks) > 0 {
+		tok := toks[0]
+		toks = toks[1:]
+
+		if tok.isReference() {
+			if ins.Reference != "" {
+				return Instruction{}, errorf(tok, "multiple references")
+			}
+			ins.Reference = strings.TrimSuffix(strings.TrimPrefix(tok.text, "<"), ">")
+			if ins.Reference == "" {
+				return Instruction{}, errorf(tok, "empty reference")
+			}
+			continue
+		}
+
+		if !tok.isKey() {
+			return Instruction{}, errorf(tok, "expected operand, got %s", tok.text)
+		}
+
+		if len(toks) == 0 || toks[0].isKey() || toks[0].isReference() {
+			return Instruction{}, errorf(tok, "missing value for %s", tok.text)
+		}
+		value := toks[0]
+		toks = toks[1:]
+
+		switch tok.text {
+		case "dst:", "src:":
+			reg, ok := parseRegister(value.text)
+			if !ok {
+				return Instruction{}, errorf(value, "invalid register %s", value.text)
+			}
+			if tok.text == "dst:" {
+				ins.Dst = reg
+			} else {
+				ins.Src = reg
+			}
+
+		case "off:":
+			n, err := strconv.ParseInt(value.text, 0, 16)
+			if err != nil {
+				return Instruction{}, errorf(value, "invalid offset %s", value.text)
+			}
+			ins.Offset = int16(n)
+			haveOffset = true
+
+		case "imm:":
+			n, err := parseConstant(value.text)
+			if err != nil {
+				return Instruction{}, errorf(value, "invalid immediate %s", value.text)
+			}
+			ins.Constant = n
+			haveConstant = true
+
+		default:
+			return Instruction{}, errorf(tok, "unknown operand %s", tok.text)
+		}
+	}
+
+	if ins.Reference != "" {
+		switch {
+		case isCall && ins.Src == R0 && !haveConstant && ins.Constant == 0:
+			// "Call <label>"
+			ins.Src = R1
+			ins.Constant = -1
+
+		case op == longJumpOp && !haveConstant:
+			ins.Constant = -1
+
+		case op.Class().isJump() && !isCall && !haveOffset:
+			ins.Offset = -1
+		}
+	}
+
+	return ins, nil
+}
+
+// mnemonics maps the output of Instruction.mnemonic back to an
+// OpCode and, for some ALU operations, an Offset.
+var mnemonics = func() map[string]Instruction {
+	m := make(map[string]Instruction)
+	add := func(ins Instruction) {
+		name := ins.mnemonic()
+		if strings.ContainsAny(name, "()") || strings.HasPrefix(name, "0x") {
+			return
+		}
+
+		// Different encodings may share a mnemonic, for example
+		// the unused source bit of Exit. Prefer the canonical
+		// (lower) encoding.
+		if _, ok := m[name]; !ok {
+			m[name] = ins
+		}
+	}
+
+	for i := 0; i <= 0xff; i++ {
+		op := OpCode(i)
+		if op == InvalidOpCode {
+			continue
+		}
+
+		add(Instruction{OpCode: op})
+
+		// ALU operations which are encoded in the offset.
+		for _, off := range []int16{signedOffset, 8, 16, 32} {
+			ins := Instruction{OpCode: op, Offset: off}
+			if ins.IsSigned() || ins.SignExtension() != InvalidSize {
+				add(ins)
+			}
+		}
+	}
+	return m
+}()
+
+func parseMnemonic(name string) (Instruction, bool) {
+	if ins, ok := mnemonics[name]; ok {
+		return ins, true
+	}
+
+	// Allow raw opcodes, as emitted for unknown classes.
+	if strings.HasPrefix(name, "0x") {
+		n, err := strconv.ParseUint(name, 0, 8)
+		return Instruction{OpCode: OpCode(n)}, err == nil
+	}
+
+	return Instruction{}, false
+}
+
+// builtinFuncs maps the output of BuiltinFunc.String back to a BuiltinFunc.
+var builtinFuncs = func() map[string]BuiltinFunc {
+	m := make(map[string]BuiltinFunc)
+	for fn := BuiltinFunc(1); ; fn++ {
+		name := fn.String()
+		if strings.HasPrefix(name, "BuiltinFunc(") {
+			return m
+		}
+		m[name] = fn
+	}
+}()
+
+func parseBuiltinFunc(name string) (BuiltinFunc, bool) {
+	if fn, ok := builtinFuncs[name]; ok {
+		return fn, true
+	}
+
+	if strings.HasPrefix(name, "BuiltinFunc(") && strings.HasSuffix(name, ")") {
+		n, err := strconv.ParseInt(name[len("BuiltinFunc("):len(name)-1], 10, 32)
+		return BuiltinFunc(n), err == nil
+	}
+
+	return 0, false
+}
+
+// atomicOps maps the output of AtomicOp.String back to an AtomicOp.
+var atomicOps = func() map[string]AtomicOp {
+	m := make(map[string]AtomicOp)
+	for _, op := range []AtomicOp{
+		AddAtomic, OrAtomic, AndAtomic, XorAtomic,
+		FetchAdd, FetchOr, FetchAnd, FetchXor, Xchg, CmpXchg,
+	} {
+		m[op.String()] = op
+	}
+	return m
+}()
+
+func parseAtomicOp(name string) (AtomicOp, bool) {
+	if op, ok := atomicOps[name]; ok {
+		return op, true
+	}
+
+	if strings.HasPrefix(name, "AtomicOp(") && strings.HasSuffix(name, ")") {
+		n, err := strconv.ParseUint(name[len("AtomicOp("):len(name)-1], 10, 32)
+		return AtomicOp(n), err == nil
+	}
+
+	return 0, false
+}
+
+func parseRegister(name string) (Register, bool) {
+	if name == "rfp" {
+		return RFP, true
+	}
+
+	if !strings.HasPrefix(name, "r") {
+		return 0, false
+	}
+
+	n, err := strconv.ParseUint(name[1:], 10, 8)
+	if err != nil || n > uint64(R10) {
+		return 0, false
+	}
+	return Register(n), true
+}
+
+func parseConstant(value string) (int64, error) {
+	n, err := strconv.ParseInt(value, 0, 64)
+	if err == nil {
+		return n, nil
+	}
+
+	// Allow unsigned 64 bit immediates, for example for LdImmDW.
+	u, uerr := strconv.ParseUint(value, 0, 64)
+	if uerr != nil {
+		return 0, err
+	}
+	return int64(u), nil
+}
@@ -0,0 +1,165 @@
+package asm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	insns := Instructions{
+		LoadMem(R0, R1, 4, Word).Sym("entry"),
+		LoadMapPtr(R1, 0),
+		StoreImm(RFP, -8, 0, DWord),
+		StoreMem(RFP, -4, R0, Half),
+		XAdd(R1, R2, Word),
+		FetchXor.Mem(R1, R2, DWord),
+		CmpXchg.Mem(R3, R4, Word),
+		LoadAbs(12, Half),
+		LoadInd(R0, R3, 2, Byte),
+		LoadImm(R2, -1<<40, DWord),
+		Add.Imm(R1, 22),
+		Sub.Reg(R2, R3),
+		Mov.Imm32(R4, -1),
+		Xor.Reg32(R5, R6),
+		Neg.Imm(R7, 0),
+		Mod.Imm(R7, 3),
+		Div.Reg(R1, R2).Signed(),
+		Mod.Imm32(R3, -3).Signed(),
+		MovSX(R4, R5, Byte),
+		MovSX(R6, R7, Word),
+		MovSX32(R6, R7, Half),
+		BSwap(R1, DWord),
+		LoadMemSX(R2, R3, -4, Word),
+		LongJump("out"),
+		HostTo(BE, R1, Half),
+		JEq.Imm(R0, 0, "out"),
+		JSGT.Reg(R1, R2, "out"),
+		JNE.Imm32(R0, -1, "out"),
+		JLT.Reg32(R3, R4, "out"),
+		Ja.Label("out"),
+		MapLookupElement.Call(),
+		Call.Label("entry"),
+		Mov.Imm(R0, 0).Sym("out"),
+		Return(),
+	}
+	insns[1].Reference = "hash_map"
+
+	text := fmt.Sprint(insns)
+	parsed, err := Parse(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(parsed, insns) {
+		t.Log("Input:\n", insns)
+		t.Log("Parsed:\n", parsed)
+		t.Fatal("Parsed instructions don't match input")
+	}
+
+	var want, have bytes.Buffer
+	if err := insns.Marshal(&want, binary.LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+	if err := parsed.Marshal(&have, binary.LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want.Bytes(), have.Bytes()) {
+		t.Error("Marshaled programs don't match")
+	}
+}
+
+func TestParseHandwritten(t *testing.T) {
+	const text = `
+; Comments and blank lines are ignored
+main: MovImm dst: r0 imm: 0
+	JEqImm dst: r1 imm: 0x10 <done>
+	Call <helper>
+done:
+	Exit
+
+helper:
+	Call KtimeGetNS
+	Exit
+`
+
+	insns, err := Parse(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Instructions{
+		Mov.Imm(R0, 0).Sym("main"),
+		JEq.Imm(R1, 16, "done"),
+		Call.Label("helper"),
+		Return().Sym("done"),
+		KtimeGetNS.Call().Sym("helper"),
+		Return(),
+	}
+
+	if !reflect.DeepEqual(insns, want) {
+		t.Errorf("Have:\n%v\nWant:\n%v", insns, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testcases := []struct {
+		text         string
+		line, column int
+	}{
+		{"Foo", 1, 1},
+		{"Exit\n  AddImm dst: r11", 2, 15},
+		{"AddImm dst: r1 imm: foo", 1, 21},
+		{"AddImm dst: r1 imm:", 1, 16},
+		{"AddImm dst: r1 bar: 1", 1, 16},
+		{"JaImm off: 0 <foo", 1, 14},
+		{"Call NoSuchHelper", 1, 6},
+		{"MovSXWReg32 dst: r1 src: r2", 1, 1},
+		{"MovSXBImm dst: r1 imm: 1", 1, 1},
+		{"MovSXHImm32 dst: r1 imm: 1", 1, 1},
+		{"Exit\nfoo:", 3, 1},
+	}
+
+	for _, tc := range testcases {
+		_, err := Parse(strings.NewReader(tc.text))
+		if err == nil {
+			t.Errorf("%q: expected an error", tc.text)
+			continue
+		}
+
+		pe, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("%q: expected ParseError, got %T", tc.text, err)
+			continue
+		}
+
+		if pe.Line != tc.line || pe.Column != tc.column {
+			t.Errorf("%q: expected error at %d:%d, got %v", tc.text, tc.line, tc.column, err)
+		}
+	}
+}
+
+func ExampleParse() {
+	insns, err := Parse(strings.NewReader(`
+		LdXMemW dst: r0 src: r1 off: 0 imm: 0
+		JEqImm dst: r0 imm: 0 <out>
+		Call KtimeGetNS
+	out:
+		Exit
+	`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Print(insns)
+
+	// Output: 0: LdXMemW dst: r0 src: r1 off: 0 imm: 0
+	// 	1: JEqImm dst: r0 off: -1 imm: 0 <out>
+	// 	2: Call KtimeGetNS
+	// out:
+	// 	3: Exit
+}
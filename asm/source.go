@@ -0,0 +1,32 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SourceLine identifies a line of the source code a program was
+// compiled from.
+type SourceLine struct {
+	FileName string
+	// Line and Column start at one. Column is zero if it is unknown.
+	Line   uint32
+	Column uint32
+	// Text is the content of the line, or empty if the compiler
+	// didn't have access to the source.
+	Text string
+}
+
+// String returns the location in the form file:line:column, followed
+// by the text of the line if it is known.
+func (sl *SourceLine) String() string {
+	loc := fmt.Sprintf("%s:%d", sl.FileName, sl.Line)
+	if sl.Column > 0 {
+		loc += fmt.Sprintf(":%d", sl.Column)
+	}
+
+	if sl.Text == "" {
+		return loc
+	}
+	return fmt.Sprintf("%s (%s)", loc, strings.TrimSpace(sl.Text))
+}
@@ -0,0 +1,426 @@
+// Package btf handles data encoded according to the BPF Type Format.
+//
+// The canonical documentation lives in the Linux kernel repository and is
+// available at https://www.kernel.org/doc/html/latest/bpf/btf.html
+package btf
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned if BTF or a type can't be found.
+var ErrNotFound = errors.New("not found")
+
+// Spec represents decoded BTF.
+type Spec struct {
+	// Types indexed by TypeID.
+	types []Type
+
+	// TypeIDs indexed by Type.
+	typeIDs map[Type]TypeID
+
+	// Types indexed by their name, excluding anonymous types.
+	namedTypes map[string][]Type
+
+	// The string table, which is shared with .BTF.ext.
+	strings stringTable
+
+	// Contents of .BTF.ext, or nil if there was none.
+	ext *extInfo
+
+	// Funcs indexed by the symbol of their function, for functions
+	// which were renamed while linking. See Merge.
+	funcs map[string]*Func
+
+	byteOrder binary.ByteOrder
+}
+
+// elfSymbol identifies a symbol in an ELF section.
+type elfSymbol struct {
+	section string
+	name    string
+}
+
+// LoadSpecFromReader reads BTF from the .BTF section of an ELF.
+//
+// Returns ErrNotFound if the ELF doesn't contain BTF.
+func LoadSpecFromReader(rd io.ReaderAt) (*Spec, error) {
+	file, err := elf.NewFile(rd)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var (
+		btfSection, btfExtSection *elf.Section
+		sectionSizes              = make(map[string]uint32)
+	)
+
+	for _, sec := range file.Sections {
+		switch sec.Name {
+		case ".BTF":
+			btfSection = sec
+		case ".BTF.ext":
+			btfExtSection = sec
+		default:
+			if sec.Type != elf.SHT_PROGBITS && sec.Type != elf.SHT_NOBITS {
+				break
+			}
+
+			if sec.Size > 0xffffffff {
+				return nil, errors.Errorf("section %s is too large", sec.Name)
+			}
+
+			sectionSizes[sec.Name] = uint32(sec.Size)
+		}
+	}
+
+	if btfSection == nil {
+		return nil, ErrNotFound
+	}
+
+	symbols, err := file.Symbols()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read symbols")
+	}
+
+	variableOffsets := make(map[elfSymbol]uint32)
+	for _, symbol := range symbols {
+		if idx := symbol.Section; idx >= elf.SHN_LORESERVE && idx <= elf.SHN_HIRESERVE {
+			// Ignore things like SHN_ABS
+			continue
+		}
+
+		if int(symbol.Section) >= len(file.Sections) {
+			return nil, errors.Errorf("symbol %s: invalid section %d", symbol.Name, symbol.Section)
+		}
+
+		if symbol.Value > 0xffffffff {
+			return nil, errors.Errorf("symbol %s: value exceeds 32 bits", symbol.Name)
+		}
+
+		secName := file.Sections[symbol.Section].Name
+		variableOffsets[elfSymbol{secName, symbol.Name}] = uint32(symbol.Value)
+	}
+
+	spec, err := loadRawSpec(btfSection.Open(), file.ByteOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	spec.fixupDatasec(sectionSizes, variableOffsets)
+
+	if btfExtSection != nil {
+		spec.ext, err = loadExtInfo(btfExtSection.Open(), file.ByteOrder, spec.strings, spec.types)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't read BTF.ext")
+		}
+	}
+
+	return spec, nil
+}
+
+// LoadRawSpec reads BTF which isn't embedded in an ELF, as found in
+// /sys/kernel/btf/vmlinux for example.
+func LoadRawSpec(r io.Reader, bo binary.ByteOrder) (*Spec, error) {
+	return loadRawSpec(r, bo)
+}
+
+var kernelBTF struct {
+	sync.Mutex
+	spec *Spec
+}
+
+// LoadKernelSpec returns the BTF describing the running kernel.
+//
+// The result is cached and shared between callers, and must not be
+// modified. Returns ErrNotFound if the kernel doesn't expose BTF.
+func LoadKernelSpec() (*Spec, error) {
+	kernelBTF.Lock()
+	defer kernelBTF.Unlock()
+
+	if kernelBTF.spec != nil {
+		return kernelBTF.spec, nil
+	}
+
+	fh, err := os.Open("/sys/kernel/btf/vmlinux")
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read kernel BTF")
+	}
+	defer fh.Close()
+
+	spec, err := loadRawSpecGuessByteOrder(fh)
+	if err != nil {
+		return nil, errors.Wrap(err, "kernel BTF")
+	}
+
+	kernelBTF.spec = spec
+	return spec, nil
+}
+
+// LoadSpec reads BTF from a file, which is either an ELF with a .BTF
+// section or raw BTF as found in /sys/kernel/btf/vmlinux.
+func LoadSpec(file string) (*Spec, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	magic := make([]byte, len(elf.ELFMAG))
+	if _, err := io.ReadFull(fh, magic); err != nil {
+		return nil, errors.Wrapf(err, "%s: can't read magic", file)
+	}
+
+	if string(magic) == elf.ELFMAG {
+		return LoadSpecFromReader(fh)
+	}
+
+	if _, err := fh.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return loadRawSpecGuessByteOrder(fh)
+}
+
+// loadRawSpecGuessByteOrder reads raw BTF, and determines its byte order
+// from the magic number.
+func loadRawSpecGuessByteOrder(r io.Reader) (*Spec, error) {
+	rd := bufio.NewReader(r)
+	magic, err := rd.Peek(2)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read magic")
+	}
+
+	var bo binary.ByteOrder = binary.LittleEndian
+	if binary.BigEndian.Uint16(magic) == btfMagic {
+		bo = binary.BigEndian
+	}
+
+	return loadRawSpec(rd, bo)
+}
+
+func loadRawSpec(r io.Reader, bo binary.ByteOrder) (*Spec, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read BTF")
+	}
+
+	var header btfHeader
+	if err := binary.Read(bytes.NewReader(buf), bo, &header); err != nil {
+		return nil, errors.Wrap(err, "can't read header")
+	}
+
+	if header.Magic != btfMagic {
+		return nil, errors.Errorf("incorrect magic value %v", header.Magic)
+	}
+
+	if header.Version != btfVersion {
+		return nil, errors.Errorf("unexpected version %v", header.Version)
+	}
+
+	if header.Flags != 0 {
+		return nil, errors.Errorf("unsupported flags %v", header.Flags)
+	}
+
+	section := func(name string, off, length uint32) ([]byte, error) {
+		start := uint64(header.HdrLen) + uint64(off)
+		end := start + uint64(length)
+		if end > uint64(len(buf)) {
+			return nil, errors.Errorf("%s section exceeds the BTF blob", name)
+		}
+		return buf[start:end], nil
+	}
+
+	rawStrings, err := section("string", header.StringOff, header.StringLen)
+	if err != nil {
+		return nil, err
+	}
+
+	strings, err := readStringTable(bytes.NewReader(rawStrings))
+	if err != nil {
+		return nil, err
+	}
+
+	rawTypesBuf, err := section("type", header.TypeOff, header.TypeLen)
+	if err != nil {
+		return nil, err
+	}
+
+	rawTypes, err := readTypes(bytes.NewReader(rawTypesBuf), bo)
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := inflateRawTypes(rawTypes, strings)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &Spec{
+		types:      types,
+		typeIDs:    make(map[Type]TypeID, len(types)),
+		namedTypes: make(map[string][]Type),
+		strings:    strings,
+		byteOrder:  bo,
+	}
+
+	for i, typ := range types {
+		spec.typeIDs[typ] = TypeID(i)
+
+		if name := typ.TypeName(); name != "" {
+			spec.namedTypes[name] = append(spec.namedTypes[name], typ)
+		}
+	}
+
+	return spec, nil
+}
+
+// fixupDatasec fills in the size of Datasecs and the offsets of their
+// variables, which compilers leave at zero in object files.
+func (s *Spec) fixupDatasec(sectionSizes map[string]uint32, variableOffsets map[elfSymbol]uint32) {
+	for _, typ := range s.types {
+		ds, ok := typ.(*Datasec)
+		if !ok {
+			continue
+		}
+
+		if size, ok := sectionSizes[ds.Name]; ok {
+			ds.Size = size
+		}
+
+		for i := range ds.Vars {
+			v, ok := ds.Vars[i].Type.(*Var)
+			if !ok {
+				continue
+			}
+
+			if offset, ok := variableOffsets[elfSymbol{ds.Name, v.Name}]; ok {
+				ds.Vars[i].Offset = offset
+			}
+		}
+	}
+}
+
+// ByteOrder returns the byte order the BTF was encoded with.
+func (s *Spec) ByteOrder() binary.ByteOrder {
+	return s.byteOrder
+}
+
+// TypeByID returns the Type with the given ID.
+//
+// Returns ErrNotFound if the ID doesn't exist.
+func (s *Spec) TypeByID(id TypeID) (Type, error) {
+	if int(id) >= len(s.types) {
+		return nil, errors.Wrapf(ErrNotFound, "type id %d", id)
+	}
+	return s.types[id], nil
+}
+
+// TypeID returns the ID of a Type.
+//
+// Returns ErrNotFound if the Type isn't part of the Spec.
+func (s *Spec) TypeID(typ Type) (TypeID, error) {
+	id, ok := s.typeIDs[typ]
+	if !ok {
+		return 0, errors.Wrapf(ErrNotFound, "type %T %s", typ, typ.TypeName())
+	}
+	return id, nil
+}
+
+// TypesByName returns all types with the given name.
+//
+// Returns ErrNotFound if no type has the name.
+func (s *Spec) TypesByName(name string) ([]Type, error) {
+	types := s.namedTypes[name]
+	if len(types) == 0 {
+		return nil, errors.Wrapf(ErrNotFound, "type name %s", name)
+	}
+	return types, nil
+}
+
+// Datasec returns the Datasec with the given name.
+//
+// Returns ErrNotFound if there is no such Datasec.
+func (s *Spec) Datasec(name string) (*Datasec, error) {
+	for _, typ := range s.namedTypes[name] {
+		if ds, ok := typ.(*Datasec); ok {
+			return ds, nil
+		}
+	}
+	return nil, errors.Wrapf(ErrNotFound, "datasec %s", name)
+}
+
+// Merge combines the types of several specs, like a linker combines
+// the BTF of the objects it links.
+//
+// funcs maps the symbol of a function to the Func which describes it.
+// ProgramInfo prefers it over looking up a Func by name, which allows
+// functions to be renamed, and several specs to define a static
+// function of the same name. Each Func must be part of one of the
+// specs.
+//
+// The result shares its types with specs, and doesn't contain
+// .BTF.ext.
+func Merge(specs []*Spec, funcs map[string]*Func) (*Spec, error) {
+	if len(specs) == 0 {
+		return nil, errors.New("no specs to merge")
+	}
+
+	merged := &Spec{
+		typeIDs:    make(map[Type]TypeID),
+		namedTypes: make(map[string][]Type),
+		funcs:      make(map[string]*Func, len(funcs)),
+		byteOrder:  specs[0].byteOrder,
+	}
+
+	for i, spec := range specs {
+		if spec.byteOrder != merged.byteOrder {
+			return nil, errors.Errorf("spec #%d: byte order %v doesn't match %v", i, spec.byteOrder, merged.byteOrder)
+		}
+
+		for id, typ := range spec.types {
+			if _, ok := merged.typeIDs[typ]; ok {
+				continue
+			}
+
+			if id == 0 {
+				// Every spec has its own Void, which all
+				// share the first TypeID.
+				if len(merged.types) == 0 {
+					merged.types = append(merged.types, typ)
+				}
+				merged.typeIDs[typ] = 0
+				continue
+			}
+
+			merged.typeIDs[typ] = TypeID(len(merged.types))
+			merged.types = append(merged.types, typ)
+
+			if name := typ.TypeName(); name != "" {
+				merged.namedTypes[name] = append(merged.namedTypes[name], typ)
+			}
+		}
+	}
+
+	for name, fn := range funcs {
+		if _, ok := merged.typeIDs[fn]; !ok {
+			return nil, errors.Errorf("function %s: Func %s isn't part of any spec", name, fn.Name)
+		}
+		merged.funcs[name] = fn
+	}
+
+	return merged, nil
+}
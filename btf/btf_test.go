@@ -0,0 +1,137 @@
+package btf
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestLoadSpecFromElf(t *testing.T) {
+	fh, err := os.Open("../testdata/loader-clang-8.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	spec, err := LoadSpecFromReader(fh)
+	if err != nil {
+		t.Fatal("Can't load BTF:", err)
+	}
+
+	types, err := spec.TypesByName("map")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def, ok := types[0].(*Struct)
+	if !ok {
+		t.Fatalf("Expected map to be a *Struct, got %T", types[0])
+	}
+
+	if len(def.Members) != 7 {
+		t.Error("Expected 7 members in struct map, got", len(def.Members))
+	}
+
+	if size, err := Sizeof(def); err != nil {
+		t.Error("Can't compute size of struct map:", err)
+	} else if size != int(def.Size) {
+		t.Errorf("Sizeof returns %d instead of %d", size, def.Size)
+	}
+
+	id, err := spec.TypeID(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if typ, err := spec.TypeByID(id); err != nil {
+		t.Error(err)
+	} else if typ != def {
+		t.Error("TypeByID doesn't return the same type as TypeID")
+	}
+
+	fns, err := spec.TypesByName("xdp_prog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fn, ok := fns[0].(*Func)
+	if !ok {
+		t.Fatalf("Expected xdp_prog to be a *Func, got %T", fns[0])
+	}
+
+	if _, ok := fn.Type.(*FuncProto); !ok {
+		t.Errorf("Expected xdp_prog to have a *FuncProto, got %T", fn.Type)
+	}
+
+	if _, err := spec.TypesByName("does_not_exist"); errors.Cause(err) != ErrNotFound {
+		t.Error("Expected ErrNotFound for missing type, got", err)
+	}
+}
+
+func TestLoadSpecFromElfWithoutBTF(t *testing.T) {
+	fh, err := os.Open("../testdata/loader-clang-6.0.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	if _, err := LoadSpecFromReader(fh); err != ErrNotFound {
+		t.Error("Expected ErrNotFound, got", err)
+	}
+}
+
+func TestLoadKernelSpec(t *testing.T) {
+	spec, err := LoadKernelSpec()
+	if err == ErrNotFound {
+		t.Skip("Kernel doesn't expose BTF")
+	}
+	if err != nil {
+		t.Fatal("Can't load kernel BTF:", err)
+	}
+
+	types, err := spec.TypesByName("sk_buff")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, typ := range types {
+		if skb, ok := typ.(*Struct); ok {
+			if skb.Size == 0 || len(skb.Members) == 0 {
+				t.Error("struct sk_buff is empty")
+			}
+			return
+		}
+	}
+	t.Error("Kernel BTF doesn't contain struct sk_buff")
+}
+
+func TestDatasecOffsets(t *testing.T) {
+	fh, err := os.Open("../testdata/btf_map.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	spec, err := LoadSpecFromReader(fh)
+	if err != nil {
+		t.Fatal("Can't load BTF:", err)
+	}
+
+	maps, err := spec.Datasec(".maps")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if maps.Size != 104 {
+		t.Error("Expected size 104, got", maps.Size)
+	}
+
+	offsets := map[string]uint32{"hash_map": 0, "array_map": 40, "array_of_hash_map": 80}
+	for _, vs := range maps.Vars {
+		v := vs.Type.(*Var)
+		if offset := offsets[v.Name]; vs.Offset != offset {
+			t.Errorf("Expected %s at offset %d, got %d", v.Name, offset, vs.Offset)
+		}
+	}
+}
@@ -0,0 +1,742 @@
+package btf
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/newtools/ebpf/asm"
+
+	"github.com/pkg/errors"
+)
+
+//go:generate stringer -output core_string.go -type=coreKind
+
+// Code in this file is derived from libbpf, which is available under a
+// BSD 2-Clause license.
+
+// coreKind is the type of a CO-RE relocation, see enum bpf_core_relo_kind.
+type coreKind uint32
+
+const (
+	reloFieldByteOffset coreKind = iota
+	reloFieldByteSize
+	reloFieldExists
+	reloFieldSigned
+	reloFieldLShiftU64
+	reloFieldRShiftU64
+	reloTypeIDLocal
+	reloTypeIDTarget
+	reloTypeExists
+	reloTypeSize
+	reloEnumvalExists
+	reloEnumvalValue
+)
+
+// poisonHelper is the helper call which replaces instructions whose
+// relocation can't be satisfied. Any program which executes it is
+// rejected by the verifier. The value is the same as libbpf uses.
+const poisonHelper = asm.BuiltinFunc(0xbad2310)
+
+// errImpossibleRelocation is returned if a candidate doesn't match
+// the local type.
+var errImpossibleRelocation = errors.New("impossible relocation")
+
+// HasCORERelocations returns true if the instructions in an ELF section
+// require CO-RE relocation.
+func (s *Spec) HasCORERelocations(section string) bool {
+	return s.ext != nil && len(s.ext.coreRelos[section]) > 0
+}
+
+// CORERelocate applies the CO-RE relocations of an ELF section to insns,
+// using the types in target.
+//
+// offsets maps the byte offset of each instruction in the section to its
+// index in insns. Relocations which can't be satisfied by target replace
+// the instruction with an invalid helper call, so that the verifier
+// rejects the program if the instruction is reachable.
+func (s *Spec) CORERelocate(section string, insns asm.Instructions, offsets map[uint64]int, target *Spec) error {
+	if !s.HasCORERelocations(section) {
+		return nil
+	}
+
+	if target == nil {
+		return errors.New("CO-RE relocation requires target BTF")
+	}
+
+	for _, relo := range s.ext.coreRelos[section] {
+		idx, ok := offsets[uint64(relo.insnOff)]
+		if !ok {
+			return errors.Errorf("CO-RE relocation: invalid instruction offset %d", relo.insnOff)
+		}
+
+		fixup, err := coreCalculateFixup(s, relo, target)
+		if err != nil {
+			return errors.Wrapf(err, "instruction %d: %s", idx, relo.kind)
+		}
+
+		if err := fixup.apply(&insns[idx]); err != nil {
+			return errors.Wrapf(err, "instruction %d: %s", idx, relo.kind)
+		}
+	}
+
+	return nil
+}
+
+// coreAccessor is a list of member or array indices, starting at a
+// local type.
+type coreAccessor []int
+
+func parseCOREAccessor(accessor string) (coreAccessor, error) {
+	if accessor == "" {
+		return nil, errors.New("empty accessor")
+	}
+
+	parts := strings.Split(accessor, ":")
+	result := make(coreAccessor, 0, len(parts))
+	for _, part := range parts {
+		// 31 bits to avoid overflowing int on 32 bit platforms.
+		index, err := strconv.ParseUint(part, 10, 31)
+		if err != nil {
+			return nil, errors.Wrap(err, "accessor index")
+		}
+		result = append(result, int(index))
+	}
+
+	return result, nil
+}
+
+// coreFixup is the result of a CO-RE relocation for a specific target.
+type coreFixup struct {
+	kind   coreKind
+	local  uint64
+	target uint64
+	// The size of the field in the local and target type, if the
+	// instruction accesses it directly and its size may be adjusted.
+	localSize, targetSize uint32
+	// Set if the relocation can't be satisfied by the target.
+	poison bool
+}
+
+func (f coreFixup) apply(ins *asm.Instruction) error {
+	if f.poison {
+		poison := poisonHelper.Call()
+		poison.Symbol = ins.Symbol
+		*ins = poison
+		return nil
+	}
+
+	switch class := ins.OpCode.Class(); {
+	case ins.OpCode == asm.LoadImmOp(asm.DWord):
+		if uint64(ins.Constant) != f.local {
+			return errors.Errorf("expected constant %d, found %d", f.local, ins.Constant)
+		}
+		ins.Constant = int64(f.target)
+
+	case (class == asm.ALUClass || class == asm.ALU64Class) && ins.OpCode.Source() == asm.ImmSource:
+		if uint64(ins.Constant) != f.local {
+			return errors.Errorf("expected constant %d, found %d", f.local, ins.Constant)
+		}
+		if f.target > math.MaxInt32 {
+			return errors.Errorf("value %d doesn't fit into a 32 bit constant", f.target)
+		}
+		ins.Constant = int64(f.target)
+
+	case class == asm.LdXClass || class == asm.StClass || class == asm.StXClass:
+		if f.kind != reloFieldByteOffset {
+			return errors.Errorf("can't apply to %v", ins.OpCode)
+		}
+		if uint64(ins.Offset) != f.local {
+			return errors.Errorf("expected offset %d, found %d", f.local, ins.Offset)
+		}
+		if f.target > math.MaxInt16 {
+			return errors.Errorf("offset %d doesn't fit into 16 bits", f.target)
+		}
+		ins.Offset = int16(f.target)
+
+		if f.localSize == f.targetSize {
+			break
+		}
+
+		if ins.OpCode.Size().Sizeof() != int(f.localSize) {
+			return errors.Errorf("access size %d doesn't match field size %d", ins.OpCode.Size().Sizeof(), f.localSize)
+		}
+
+		size, ok := sizeFromBytes(f.targetSize)
+		if !ok {
+			return errors.Errorf("can't adjust access to field of size %d", f.targetSize)
+		}
+		ins.OpCode = ins.OpCode.SetSize(size)
+
+	default:
+		return errors.Errorf("can't apply to %v", ins.OpCode)
+	}
+
+	return nil
+}
+
+func sizeFromBytes(n uint32) (asm.Size, bool) {
+	for _, size := range []asm.Size{asm.Byte, asm.Half, asm.Word, asm.DWord} {
+		if uint32(size.Sizeof()) == n {
+			return size, true
+		}
+	}
+	return asm.InvalidSize, false
+}
+
+// coreCalculateFixup finds the target types matching a relocation and
+// computes the fixup.
+func coreCalculateFixup(local *Spec, relo coreRelo, target *Spec) (coreFixup, error) {
+	localType, err := local.TypeByID(relo.typeID)
+	if err != nil {
+		return coreFixup{}, err
+	}
+
+	if relo.kind == reloTypeIDLocal {
+		return coreFixup{kind: relo.kind, local: uint64(relo.typeID), target: uint64(relo.typeID)}, nil
+	}
+
+	name := essentialName(localType.TypeName())
+	if name == "" {
+		return coreFixup{}, errors.Errorf("relocation for anonymous type %T", localType)
+	}
+
+	var result *coreFixup
+	for _, candidate := range target.namedTypes[name] {
+		if reflect.TypeOf(candidate) != reflect.TypeOf(localType) {
+			continue
+		}
+
+		fixup, err := coreCalculateFixupForCandidate(local, localType, relo, target, candidate)
+		if err == errImpossibleRelocation {
+			continue
+		}
+		if err != nil {
+			return coreFixup{}, errors.Wrapf(err, "target %s", candidate.TypeName())
+		}
+
+		if result == nil {
+			result = &fixup
+			continue
+		}
+
+		if result.target != fixup.target || result.targetSize != fixup.targetSize {
+			return coreFixup{}, errors.Errorf("ambiguous candidates for %s", name)
+		}
+	}
+
+	if result != nil {
+		return *result, nil
+	}
+
+	// Use the local type as a target to find out which value the
+	// compiler emitted.
+	fixup, err := coreCalculateFixupForCandidate(local, localType, relo, local, localType)
+	if err != nil {
+		return coreFixup{}, errors.Wrap(err, "local type")
+	}
+
+	switch relo.kind {
+	case reloFieldExists, reloTypeExists, reloEnumvalExists:
+		return coreFixup{kind: relo.kind, local: fixup.local, target: 0}, nil
+	}
+
+	return coreFixup{kind: relo.kind, local: fixup.local, poison: true}, nil
+}
+
+func coreCalculateFixupForCandidate(local *Spec, localType Type, relo coreRelo, target *Spec, targetType Type) (coreFixup, error) {
+	fixup := coreFixup{kind: relo.kind}
+
+	switch relo.kind {
+	case reloTypeIDTarget, reloTypeExists, reloTypeSize:
+		if len(relo.accessor) != 1 || relo.accessor[0] != 0 {
+			return coreFixup{}, errors.Errorf("unexpected accessor %v", relo.accessor)
+		}
+
+		if !coreAreTypesCompatible(localType, targetType) {
+			return coreFixup{}, errImpossibleRelocation
+		}
+
+		switch relo.kind {
+		case reloTypeIDTarget:
+			id, err := target.TypeID(targetType)
+			if err != nil {
+				return coreFixup{}, err
+			}
+			fixup.local = uint64(relo.typeID)
+			fixup.target = uint64(id)
+
+		case reloTypeExists:
+			fixup.local = 1
+			fixup.target = 1
+
+		case reloTypeSize:
+			localSize, err := Sizeof(localType)
+			if err != nil {
+				return coreFixup{}, err
+			}
+
+			targetSize, err := Sizeof(targetType)
+			if err != nil {
+				return coreFixup{}, err
+			}
+
+			fixup.local = uint64(localSize)
+			fixup.target = uint64(targetSize)
+		}
+
+	case reloEnumvalExists, reloEnumvalValue:
+		localEnum, ok := localType.(*Enum)
+		if !ok {
+			return coreFixup{}, errors.Errorf("enum relocation for %T", localType)
+		}
+
+		if len(relo.accessor) != 1 || relo.accessor[0] >= len(localEnum.Values) {
+			return coreFixup{}, errors.Errorf("invalid accessor %v for enum %s", relo.accessor, localEnum.Name)
+		}
+
+		localValue := localEnum.Values[relo.accessor[0]]
+		targetValue, ok := coreFindEnumValue(targetType.(*Enum), localValue.Name)
+		if !ok {
+			return coreFixup{}, errImpossibleRelocation
+		}
+
+		switch relo.kind {
+		case reloEnumvalExists:
+			fixup.local = 1
+			fixup.target = 1
+
+		case reloEnumvalValue:
+			fixup.local = localValue.Value
+			fixup.target = targetValue.Value
+		}
+
+	case reloFieldByteOffset, reloFieldByteSize, reloFieldExists, reloFieldSigned, reloFieldLShiftU64, reloFieldRShiftU64:
+		localField, targetField, err := coreFindField(localType, relo.accessor, targetType)
+		if err != nil {
+			return coreFixup{}, err
+		}
+
+		fixup.local, err = localField.value(relo.kind, local.byteOrder)
+		if err != nil {
+			return coreFixup{}, errors.Wrap(err, "local field")
+		}
+
+		fixup.target, err = targetField.value(relo.kind, target.byteOrder)
+		if err != nil {
+			return coreFixup{}, errors.Wrap(err, "target field")
+		}
+
+		if relo.kind == reloFieldByteOffset && localField.bitfieldSize == 0 && targetField.bitfieldSize == 0 {
+			fixup.localSize, fixup.targetSize, err = coreFieldSizes(localField, targetField)
+			if err != nil {
+				return coreFixup{}, err
+			}
+		}
+
+	default:
+		return coreFixup{}, errors.Errorf("unsupported relocation kind %v", relo.kind)
+	}
+
+	return fixup, nil
+}
+
+// coreFieldSizes returns the sizes of two matching fields.
+//
+// Differing sizes are only allowed if accesses to the field can be
+// adjusted without changing the meaning of the value.
+func coreFieldSizes(local, target coreField) (uint32, uint32, error) {
+	localSize, err := Sizeof(local.Type)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	targetSize, err := Sizeof(target.Type)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if localSize == targetSize {
+		return uint32(localSize), uint32(targetSize), nil
+	}
+
+	switch v := UnderlyingType(target.Type).(type) {
+	case *Int:
+		if v.Encoding&Signed != 0 {
+			return 0, 0, errors.New("can't adjust size of signed field")
+		}
+	case *Enum:
+		if v.Signed {
+			return 0, 0, errors.New("can't adjust size of signed field")
+		}
+	case *Pointer:
+	default:
+		return 0, 0, errors.Errorf("can't adjust size of %T field", v)
+	}
+
+	return uint32(localSize), uint32(targetSize), nil
+}
+
+func coreFindEnumValue(enum *Enum, name string) (EnumValue, bool) {
+	name = essentialName(name)
+	for _, value := range enum.Values {
+		if essentialName(value.Name) == name {
+			return value, true
+		}
+	}
+	return EnumValue{}, false
+}
+
+// coreField is a member of a type, found by following an accessor.
+type coreField struct {
+	Type Type
+	// The offset from the start of the root type, in bits.
+	offset       uint32
+	bitfieldSize uint32
+}
+
+// value computes the result of a field relocation, see
+// bpf_core_calc_field_relo in libbpf.
+func (f coreField) value(kind coreKind, bo binary.ByteOrder) (uint64, error) {
+	if kind == reloFieldExists {
+		return 1, nil
+	}
+
+	if kind == reloFieldSigned {
+		switch v := UnderlyingType(f.Type).(type) {
+		case *Int:
+			if v.Encoding&Signed != 0 {
+				return 1, nil
+			}
+			return 0, nil
+		case *Enum:
+			if v.Signed {
+				return 1, nil
+			}
+			return 0, nil
+		default:
+			return 0, nil
+		}
+	}
+
+	size, err := Sizeof(f.Type)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		bitOffset  = uint64(f.offset)
+		byteSize   = uint64(size)
+		bitSize    = uint64(f.bitfieldSize)
+		byteOffset uint64
+	)
+
+	if bitSize == 0 {
+		if bitOffset%8 != 0 {
+			return 0, errors.New("field isn't byte aligned")
+		}
+		bitSize = byteSize * 8
+		byteOffset = bitOffset / 8
+	} else {
+		// Find the smallest load which contains the whole bitfield.
+		if byteSize == 0 {
+			return 0, errors.New("bitfield of zero sized type")
+		}
+
+		byteOffset = bitOffset / 8 / byteSize * byteSize
+		for bitOffset+bitSize-byteOffset*8 > byteSize*8 {
+			if byteSize >= 8 {
+				return 0, errors.New("bitfield doesn't fit into 8 bytes")
+			}
+			byteSize *= 2
+			byteOffset = bitOffset / 8 / byteSize * byteSize
+		}
+	}
+
+	switch kind {
+	case reloFieldByteOffset:
+		return byteOffset, nil
+
+	case reloFieldByteSize:
+		return byteSize, nil
+
+	case reloFieldLShiftU64:
+		if bo == binary.LittleEndian {
+			return 64 - (bitOffset + bitSize - byteOffset*8), nil
+		}
+		return (8-byteSize)*8 + (bitOffset - byteOffset*8), nil
+
+	case reloFieldRShiftU64:
+		return 64 - bitSize, nil
+
+	default:
+		return 0, errors.Errorf("invalid kind %v", kind)
+	}
+}
+
+// coreFindField follows an accessor through the local type, and finds
+// the members with the same names in the target type.
+//
+// Anonymous members of the local type are skipped, since they may be
+// laid out differently in the target.
+func coreFindField(localT Type, localAcc coreAccessor, targetT Type) (coreField, coreField, error) {
+	local := coreField{Type: localT}
+	target := coreField{Type: targetT}
+
+	// The first index is into the root type, as if it was an array.
+	localSize, err := Sizeof(localT)
+	if err != nil {
+		return coreField{}, coreField{}, err
+	}
+
+	targetSize, err := Sizeof(targetT)
+	if err != nil {
+		return coreField{}, coreField{}, err
+	}
+
+	if err := local.adjustOffset(localAcc[0] * localSize * 8); err != nil {
+		return coreField{}, coreField{}, err
+	}
+	if err := target.adjustOffset(localAcc[0] * targetSize * 8); err != nil {
+		return coreField{}, coreField{}, err
+	}
+
+	if !coreAreMembersCompatible(local.Type, target.Type) {
+		return coreField{}, coreField{}, errImpossibleRelocation
+	}
+
+	for i, acc := range localAcc[1:] {
+		switch localType := UnderlyingType(local.Type).(type) {
+		case *Struct, *Union:
+			localMembers := compositeMembers(localType)
+			if acc >= len(localMembers) {
+				return coreField{}, coreField{}, errors.Errorf("invalid accessor %d for %s", acc, localType.TypeName())
+			}
+
+			localMember := localMembers[acc]
+			local = coreField{
+				localMember.Type,
+				local.offset + localMember.Offset,
+				localMember.BitfieldSize,
+			}
+
+			if localMember.Name == "" {
+				// Anonymous members are found in the target by the
+				// name of the next member.
+				if i == len(localAcc)-2 {
+					return coreField{}, coreField{}, errors.New("relocation of anonymous member")
+				}
+				continue
+			}
+
+			targetMember, offset, ok := coreFindMember(UnderlyingType(target.Type), localMember.Name)
+			if !ok {
+				return coreField{}, coreField{}, errImpossibleRelocation
+			}
+
+			target = coreField{
+				targetMember.Type,
+				target.offset + offset,
+				targetMember.BitfieldSize,
+			}
+
+			if !coreAreMembersCompatible(local.Type, target.Type) {
+				return coreField{}, coreField{}, errImpossibleRelocation
+			}
+
+		case *Array:
+			targetType, ok := UnderlyingType(target.Type).(*Array)
+			if !ok {
+				return coreField{}, coreField{}, errImpossibleRelocation
+			}
+
+			// Flexible arrays have no elements, but may still be
+			// accessed.
+			if targetType.Nelems > 0 && acc >= int(targetType.Nelems) {
+				return coreField{}, coreField{}, errImpossibleRelocation
+			}
+
+			localSize, err := Sizeof(localType.Type)
+			if err != nil {
+				return coreField{}, coreField{}, err
+			}
+
+			targetSize, err := Sizeof(targetType.Type)
+			if err != nil {
+				return coreField{}, coreField{}, err
+			}
+
+			local = coreField{Type: localType.Type, offset: local.offset}
+			if err := local.adjustOffset(acc * localSize * 8); err != nil {
+				return coreField{}, coreField{}, err
+			}
+
+			target = coreField{Type: targetType.Type, offset: target.offset}
+			if err := target.adjustOffset(acc * targetSize * 8); err != nil {
+				return coreField{}, coreField{}, err
+			}
+
+			if !coreAreMembersCompatible(local.Type, target.Type) {
+				return coreField{}, coreField{}, errImpossibleRelocation
+			}
+
+		default:
+			return coreField{}, coreField{}, errors.Errorf("can't follow accessor into %T", localType)
+		}
+	}
+
+	return local, target, nil
+}
+
+func (f *coreField) adjustOffset(bits int) error {
+	offset := uint64(f.offset) + uint64(bits)
+	if offset > math.MaxUint32 {
+		return errors.New("offset exceeds 32 bits")
+	}
+	f.offset = uint32(offset)
+	return nil
+}
+
+func compositeMembers(typ Type) []Member {
+	switch v := typ.(type) {
+	case *Struct:
+		return v.Members
+	case *Union:
+		return v.Members
+	default:
+		return nil
+	}
+}
+
+// coreFindMember finds a member by name, including members of anonymous
+// structs and unions.
+//
+// Returns the member and its offset in bits.
+func coreFindMember(typ Type, name string) (Member, uint32, bool) {
+	type pending struct {
+		members []Member
+		offset  uint32
+		depth   int
+	}
+
+	queue := []pending{{compositeMembers(typ), 0, 0}}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, member := range current.members {
+			if member.Name == name {
+				return member, current.offset + member.Offset, true
+			}
+
+			if member.Name != "" || current.depth >= maxTypeDepth {
+				continue
+			}
+
+			if members := compositeMembers(UnderlyingType(member.Type)); members != nil {
+				queue = append(queue, pending{members, current.offset + member.Offset, current.depth + 1})
+			}
+		}
+	}
+
+	return Member{}, 0, false
+}
+
+// coreAreTypesCompatible checks whether a local and a target type are
+// the same, ignoring differences in members and flavours.
+func coreAreTypesCompatible(localType, targetType Type) bool {
+	for i := 0; i < maxTypeDepth; i++ {
+		localType, targetType = UnderlyingType(localType), UnderlyingType(targetType)
+		if reflect.TypeOf(localType) != reflect.TypeOf(targetType) {
+			return false
+		}
+
+		switch lv := localType.(type) {
+		case *Void, *Struct, *Union, *Enum, *Fwd, *Float:
+			return true
+
+		case *Int:
+			tv := targetType.(*Int)
+			return lv.Offset == 0 && tv.Offset == 0
+
+		case *Pointer:
+			localType, targetType = lv.Target, targetType.(*Pointer).Target
+
+		case *Array:
+			localType, targetType = lv.Type, targetType.(*Array).Type
+
+		case *FuncProto:
+			tv := targetType.(*FuncProto)
+			if len(lv.Params) != len(tv.Params) {
+				return false
+			}
+
+			for i := range lv.Params {
+				if !coreAreTypesCompatible(lv.Params[i].Type, tv.Params[i].Type) {
+					return false
+				}
+			}
+
+			localType, targetType = lv.Return, tv.Return
+
+		default:
+			return false
+		}
+	}
+
+	return false
+}
+
+// coreAreMembersCompatible checks whether a local and a target member
+// can be used interchangeably.
+func coreAreMembersCompatible(localType, targetType Type) bool {
+	localType, targetType = UnderlyingType(localType), UnderlyingType(targetType)
+
+	doNamesMatch := func(a, b string) bool {
+		if a == "" || b == "" {
+			// Anonymous types are matched by their members.
+			return true
+		}
+		return essentialName(a) == essentialName(b)
+	}
+
+	switch lv := localType.(type) {
+	case *Struct, *Union:
+		if reflect.TypeOf(localType) != reflect.TypeOf(targetType) {
+			return false
+		}
+		return doNamesMatch(lv.TypeName(), targetType.TypeName())
+
+	case *Enum:
+		_, ok := targetType.(*Enum)
+		return ok
+
+	case *Int:
+		tv, ok := targetType.(*Int)
+		return ok && lv.Offset == 0 && tv.Offset == 0
+
+	case *Pointer, *Float:
+		return reflect.TypeOf(localType) == reflect.TypeOf(targetType)
+
+	case *Array:
+		tv, ok := targetType.(*Array)
+		if !ok {
+			return false
+		}
+		return coreAreMembersCompatible(lv.Type, tv.Type)
+
+	default:
+		return false
+	}
+}
+
+// essentialName strips a flavour suffix like ___v1 from a name.
+func essentialName(name string) string {
+	lastIdx := strings.LastIndex(name, "___")
+	if lastIdx > 0 {
+		return name[:lastIdx]
+	}
+	return name
+}
@@ -0,0 +1,36 @@
+package btf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCOREAccessor(t *testing.T) {
+	acc, err := parseCOREAccessor("0:1:12")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(acc, coreAccessor{0, 1, 12}) {
+		t.Error("Unexpected accessor", acc)
+	}
+
+	for _, invalid := range []string{"", "0:", "a", "-1"} {
+		if _, err := parseCOREAccessor(invalid); err == nil {
+			t.Errorf("Accessor %q doesn't return an error", invalid)
+		}
+	}
+}
+
+func TestEssentialName(t *testing.T) {
+	for name, want := range map[string]string{
+		"task_struct":          "task_struct",
+		"task_struct___old":    "task_struct",
+		"task_struct___v1___2": "task_struct___v1",
+		"___foo":               "___foo",
+	} {
+		if have := essentialName(name); have != want {
+			t.Errorf("essentialName(%q) returns %q instead of %q", name, have, want)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package btf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/newtools/ebpf/asm"
+
+	"github.com/pkg/errors"
+)
+
+// btfExtHeader is found at the start of the .BTF.ext section.
+type btfExtHeader struct {
+	Magic   uint16
+	Version uint8
+	Flags   uint8
+	HdrLen  uint32
+
+	FuncInfoOff uint32
+	FuncInfoLen uint32
+	LineInfoOff uint32
+	LineInfoLen uint32
+}
+
+// btfExtCOREHeader follows btfExtHeader in newer versions of the format.
+type btfExtCOREHeader struct {
+	COREReloOff uint32
+	COREReloLen uint32
+}
+
+// btfExtInfoSec is the header of the records for a single ELF section.
+type btfExtInfoSec struct {
+	SecNameOff uint32
+	NumInfo    uint32
+}
+
+// bpfFuncInfo is equivalent to struct bpf_func_info.
+type bpfFuncInfo struct {
+	InsnOff uint32
+	TypeID  TypeID
+}
+
+// bpfLineInfo is equivalent to struct bpf_line_info.
+type bpfLineInfo struct {
+	InsnOff     uint32
+	FileNameOff uint32
+	LineOff     uint32
+	LineCol     uint32
+}
+
+// The line number and column are packed into bpfLineInfo.LineCol.
+const (
+	bpfLineShift = 10
+	bpfColumnMax = 1<<bpfLineShift - 1
+)
+
+// funcInfo is a decoded bpfFuncInfo.
+type funcInfo struct {
+	// The offset of the first instruction of the function in the
+	// ELF section, in bytes.
+	insnOff uint32
+	fn      *Func
+}
+
+// lineInfo is a decoded bpfLineInfo.
+type lineInfo struct {
+	// The offset of the instruction in the ELF section, in bytes.
+	insnOff uint32
+	line    asm.SourceLine
+}
+
+// bpfCORERelo is equivalent to struct bpf_core_relo.
+type bpfCORERelo struct {
+	InsnOff      uint32
+	TypeID       TypeID
+	AccessStrOff uint32
+	Kind         coreKind
+}
+
+// coreRelo is a decoded bpfCORERelo.
+type coreRelo struct {
+	// The offset of the instruction in the ELF section, in bytes.
+	insnOff  uint32
+	typeID   TypeID
+	accessor coreAccessor
+	kind     coreKind
+}
+
+// extInfo contains the contents of .BTF.ext, indexed by ELF section name.
+type extInfo struct {
+	funcInfos map[string][]funcInfo
+	lineInfos map[string][]lineInfo
+	coreRelos map[string][]coreRelo
+}
+
+func loadExtInfo(r io.Reader, bo binary.ByteOrder, strings stringTable, types []Type) (*extInfo, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read BTF.ext")
+	}
+
+	rd := bytes.NewReader(buf)
+
+	var header btfExtHeader
+	if err := binary.Read(rd, bo, &header); err != nil {
+		return nil, errors.Wrap(err, "can't read header")
+	}
+
+	if header.Magic != btfMagic {
+		return nil, errors.Errorf("incorrect magic value %v", header.Magic)
+	}
+
+	if header.Version != btfVersion {
+		return nil, errors.Errorf("unexpected version %v", header.Version)
+	}
+
+	if header.Flags != 0 {
+		return nil, errors.Errorf("unsupported flags %v", header.Flags)
+	}
+
+	if int64(header.HdrLen) < int64(binary.Size(&header)) {
+		return nil, errors.Errorf("header is too short")
+	}
+
+	var coreHeader btfExtCOREHeader
+	if int64(header.HdrLen) >= int64(binary.Size(&header)+binary.Size(&coreHeader)) {
+		if err := binary.Read(rd, bo, &coreHeader); err != nil {
+			return nil, errors.Wrap(err, "can't read CO-RE header")
+		}
+	}
+
+	section := func(name string, off, length uint32) ([]byte, error) {
+		start := uint64(header.HdrLen) + uint64(off)
+		end := start + uint64(length)
+		if end > uint64(len(buf)) {
+			return nil, errors.Errorf("%s section exceeds BTF.ext", name)
+		}
+		return buf[start:end], nil
+	}
+
+	info := &extInfo{
+		funcInfos: make(map[string][]funcInfo),
+		lineInfos: make(map[string][]lineInfo),
+		coreRelos: make(map[string][]coreRelo),
+	}
+
+	if header.FuncInfoLen > 0 {
+		funcBuf, err := section("func info", header.FuncInfoOff, header.FuncInfoLen)
+		if err != nil {
+			return nil, err
+		}
+
+		err = parseExtInfoSec(funcBuf, bo, strings, binary.Size(bpfFuncInfo{}), func(secName string, rec []byte) error {
+			var fi bpfFuncInfo
+			if err := binary.Read(bytes.NewReader(rec), bo, &fi); err != nil {
+				return err
+			}
+
+			if int(fi.TypeID) >= len(types) {
+				return errors.Errorf("invalid type id %d", fi.TypeID)
+			}
+
+			fn, ok := types[fi.TypeID].(*Func)
+			if !ok {
+				return errors.Errorf("type id %d is %T, not a function", fi.TypeID, types[fi.TypeID])
+			}
+
+			info.funcInfos[secName] = append(info.funcInfos[secName], funcInfo{fi.InsnOff, fn})
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "func info")
+		}
+	}
+
+	if header.LineInfoLen > 0 {
+		lineBuf, err := section("line info", header.LineInfoOff, header.LineInfoLen)
+		if err != nil {
+			return nil, err
+		}
+
+		err = parseExtInfoSec(lineBuf, bo, strings, binary.Size(bpfLineInfo{}), func(secName string, rec []byte) error {
+			var li bpfLineInfo
+			if err := binary.Read(bytes.NewReader(rec), bo, &li); err != nil {
+				return err
+			}
+
+			fileName, err := strings.Lookup(li.FileNameOff)
+			if err != nil {
+				return errors.Wrap(err, "file name")
+			}
+
+			text, err := strings.Lookup(li.LineOff)
+			if err != nil {
+				return errors.Wrap(err, "line")
+			}
+
+			info.lineInfos[secName] = append(info.lineInfos[secName], lineInfo{
+				li.InsnOff,
+				asm.SourceLine{
+					FileName: fileName,
+					Line:     li.LineCol >> bpfLineShift,
+					Column:   li.LineCol & bpfColumnMax,
+					Text:     text,
+				},
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "line info")
+		}
+	}
+
+	if coreHeader.COREReloLen > 0 {
+		coreBuf, err := section("CO-RE relocation", coreHeader.COREReloOff, coreHeader.COREReloLen)
+		if err != nil {
+			return nil, err
+		}
+
+		err = parseExtInfoSec(coreBuf, bo, strings, binary.Size(bpfCORERelo{}), func(secName string, rec []byte) error {
+			var relo bpfCORERelo
+			if err := binary.Read(bytes.NewReader(rec), bo, &relo); err != nil {
+				return err
+			}
+
+			accessorStr, err := strings.Lookup(relo.AccessStrOff)
+			if err != nil {
+				return err
+			}
+
+			accessor, err := parseCOREAccessor(accessorStr)
+			if err != nil {
+				return errors.Wrapf(err, "accessor %q", accessorStr)
+			}
+
+			info.coreRelos[secName] = append(info.coreRelos[secName], coreRelo{
+				relo.InsnOff,
+				relo.TypeID,
+				accessor,
+				relo.Kind,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "CO-RE relocations")
+		}
+	}
+
+	return info, nil
+}
+
+// parseExtInfoSec calls fn for each record in a sub-section of .BTF.ext.
+//
+// Records may be larger than minRecSize if they were written by a newer
+// compiler, in which case the excess is passed to fn as well.
+func parseExtInfoSec(buf []byte, bo binary.ByteOrder, strings stringTable, minRecSize int, fn func(secName string, rec []byte) error) error {
+	rd := bytes.NewReader(buf)
+
+	var recordSize uint32
+	if err := binary.Read(rd, bo, &recordSize); err != nil {
+		return errors.Wrap(err, "can't read record size")
+	}
+
+	if int64(recordSize) < int64(minRecSize) {
+		return errors.Errorf("record size %d is too small", recordSize)
+	}
+
+	for rd.Len() > 0 {
+		var infoHeader btfExtInfoSec
+		if err := binary.Read(rd, bo, &infoHeader); err != nil {
+			return errors.Wrap(err, "can't read info header")
+		}
+
+		secName, err := strings.Lookup(infoHeader.SecNameOff)
+		if err != nil {
+			return errors.Wrap(err, "can't get section name")
+		}
+
+		if uint64(infoHeader.NumInfo)*uint64(recordSize) > uint64(rd.Len()) {
+			return errors.Errorf("section %s: records exceed the buffer", secName)
+		}
+
+		for i := uint32(0); i < infoHeader.NumInfo; i++ {
+			rec := make([]byte, recordSize)
+			if _, err := io.ReadFull(rd, rec); err != nil {
+				return err
+			}
+
+			if err := fn(secName, rec); err != nil {
+				return errors.Wrapf(err, "section %s: record %d", secName, i)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,258 @@
+package btf
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// marshalOptions control how types are encoded.
+type marshalOptions struct {
+	// Replace linkage the kernel doesn't accept, like libbpf does for
+	// extern variables and functions.
+	sanitizeLinkage bool
+}
+
+// marshal encodes the Spec in the wire format, including the header.
+//
+// Names are added to strings, which must contain any other strings
+// that are going to refer to the result.
+func (s *Spec) marshal(bo binary.ByteOrder, strings *stringTableBuilder, opts marshalOptions) ([]byte, error) {
+	var types bytes.Buffer
+	for id, typ := range s.types {
+		if id == 0 {
+			// Void is implicit.
+			continue
+		}
+
+		if err := s.marshalType(&types, bo, strings, typ, opts); err != nil {
+			return nil, errors.Wrapf(err, "type id %d", id)
+		}
+	}
+
+	header := btfHeader{
+		Magic:     btfMagic,
+		Version:   btfVersion,
+		TypeOff:   0,
+		TypeLen:   uint32(types.Len()),
+		StringOff: uint32(types.Len()),
+		StringLen: uint32(len(strings.table)),
+	}
+	header.HdrLen = uint32(binary.Size(&header))
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, bo, &header); err != nil {
+		return nil, err
+	}
+	buf.Write(types.Bytes())
+	buf.Write(strings.table)
+	return buf.Bytes(), nil
+}
+
+func (s *Spec) marshalType(w *bytes.Buffer, bo binary.ByteOrder, strings *stringTableBuilder, typ Type, opts marshalOptions) error {
+	var err error
+	id := func(typ Type) uint32 {
+		tid, idErr := s.TypeID(typ)
+		if err == nil {
+			err = idErr
+		}
+		return uint32(tid)
+	}
+	name := func(str string) uint32 {
+		off, addErr := strings.Add(str)
+		if err == nil {
+			err = addErr
+		}
+		return off
+	}
+	vlen := func(raw *btfType, n int) {
+		if n > int(mask(btfTypeVlenLen)) && err == nil {
+			err = errors.Errorf("%d items exceed the maximum", n)
+		}
+		raw.SetVlen(n)
+	}
+
+	var (
+		raw  btfType
+		data interface{}
+	)
+
+	switch v := typ.(type) {
+	case *Int:
+		raw.SetKind(kindInt)
+		raw.NameOff = name(v.Name)
+		raw.SizeType = v.Size
+		encoding := uint32(v.Encoding)<<btfIntEncodingShift |
+			v.Offset<<btfIntOffsetShift |
+			uint32(v.Bits)<<btfIntBitsShift
+		data = &encoding
+
+	case *Pointer:
+		raw.SetKind(kindPointer)
+		raw.SizeType = id(v.Target)
+
+	case *Array:
+		raw.SetKind(kindArray)
+		data = &btfArray{TypeID(id(v.Type)), TypeID(id(v.Index)), v.Nelems}
+
+	case *Struct:
+		raw.SetKind(kindStruct)
+		raw.NameOff = name(v.Name)
+		raw.SizeType = v.Size
+		vlen(&raw, len(v.Members))
+		data = marshalMembers(&raw, v.Members, id, name)
+
+	case *Union:
+		raw.SetKind(kindUnion)
+		raw.NameOff = name(v.Name)
+		raw.SizeType = v.Size
+		vlen(&raw, len(v.Members))
+		data = marshalMembers(&raw, v.Members, id, name)
+
+	case *Enum:
+		raw.NameOff = name(v.Name)
+		raw.SizeType = v.Size
+		raw.SetKindFlag(v.Signed)
+		vlen(&raw, len(v.Values))
+
+		if v.Size == 8 {
+			raw.SetKind(kindEnum64)
+			values := make([]btfEnum64, 0, len(v.Values))
+			for _, value := range v.Values {
+				values = append(values, btfEnum64{name(value.Name), uint32(value.Value), uint32(value.Value >> 32)})
+			}
+			data = values
+			break
+		}
+
+		raw.SetKind(kindEnum)
+		values := make([]btfEnum, 0, len(v.Values))
+		for _, value := range v.Values {
+			values = append(values, btfEnum{name(value.Name), int32(value.Value)})
+		}
+		data = values
+
+	case *Fwd:
+		raw.SetKind(kindForward)
+		raw.NameOff = name(v.Name)
+		raw.SetKindFlag(v.Kind == FwdUnion)
+
+	case *Typedef:
+		raw.SetKind(kindTypedef)
+		raw.NameOff = name(v.Name)
+		raw.SizeType = id(v.Type)
+
+	case *Volatile:
+		raw.SetKind(kindVolatile)
+		raw.SizeType = id(v.Type)
+
+	case *Const:
+		raw.SetKind(kindConst)
+		raw.SizeType = id(v.Type)
+
+	case *Restrict:
+		raw.SetKind(kindRestrict)
+		raw.SizeType = id(v.Type)
+
+	case *TypeTag:
+		raw.SetKind(kindTypeTag)
+		raw.NameOff = name(v.Value)
+		raw.SizeType = id(v.Type)
+
+	case *Func:
+		linkage := v.Linkage
+		if opts.sanitizeLinkage && linkage == ExternFunc {
+			linkage = GlobalFunc
+		}
+
+		raw.SetKind(kindFunc)
+		raw.NameOff = name(v.Name)
+		raw.SetLinkage(int(linkage))
+		raw.SizeType = id(v.Type)
+
+	case *FuncProto:
+		raw.SetKind(kindFuncProto)
+		raw.SizeType = id(v.Return)
+		vlen(&raw, len(v.Params))
+		params := make([]btfParam, 0, len(v.Params))
+		for _, param := range v.Params {
+			params = append(params, btfParam{name(param.Name), TypeID(id(param.Type))})
+		}
+		data = params
+
+	case *Var:
+		linkage := v.Linkage
+		if opts.sanitizeLinkage && linkage == ExternVar {
+			linkage = GlobalVar
+		}
+
+		raw.SetKind(kindVar)
+		raw.NameOff = name(v.Name)
+		raw.SizeType = id(v.Type)
+		data = &btfVariable{uint32(linkage)}
+
+	case *Datasec:
+		raw.SetKind(kindDatasec)
+		raw.NameOff = name(v.Name)
+		raw.SizeType = v.Size
+		vlen(&raw, len(v.Vars))
+		vars := make([]btfVarSecinfo, 0, len(v.Vars))
+		for _, vs := range v.Vars {
+			vars = append(vars, btfVarSecinfo{TypeID(id(vs.Type)), vs.Offset, vs.Size})
+		}
+		data = vars
+
+	case *Float:
+		raw.SetKind(kindFloat)
+		raw.NameOff = name(v.Name)
+		raw.SizeType = v.Size
+
+	case *DeclTag:
+		raw.SetKind(kindDeclTag)
+		raw.NameOff = name(v.Value)
+		raw.SizeType = id(v.Type)
+		data = &btfDeclTag{int32(v.Index)}
+
+	default:
+		return errors.Errorf("can't marshal %T", typ)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, bo, &raw); err != nil {
+		return err
+	}
+
+	if data == nil {
+		return nil
+	}
+
+	return binary.Write(w, bo, data)
+}
+
+// marshalMembers encodes the members of a Struct or Union, and sets the
+// kind flag of raw if any of them is a bitfield.
+func marshalMembers(raw *btfType, members []Member, id func(Type) uint32, name func(string) uint32) []btfMember {
+	for _, member := range members {
+		if member.BitfieldSize > 0 {
+			raw.SetKindFlag(true)
+			break
+		}
+	}
+
+	btfMembers := make([]btfMember, 0, len(members))
+	for _, member := range members {
+		offset := member.Offset
+		if raw.KindFlag() {
+			// The offset contains the size of a bitfield in its
+			// upper 8 bits.
+			offset = member.BitfieldSize<<24 | member.Offset&0xffffff
+		}
+
+		btfMembers = append(btfMembers, btfMember{name(member.Name), TypeID(id(member.Type)), offset})
+	}
+	return btfMembers
+}
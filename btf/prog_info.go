@@ -0,0 +1,203 @@
+package btf
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/newtools/ebpf/asm"
+
+	"github.com/pkg/errors"
+)
+
+// Sizes of the records in ProgramInfo.
+const (
+	FuncInfoSize = 8
+	LineInfoSize = 16
+)
+
+// ProgramInfo is the type information of a program in the format
+// expected by BPF_PROG_LOAD.
+type ProgramInfo struct {
+	// BTF is suitable for BPF_BTF_LOAD, and is referred to by
+	// FuncInfo and LineInfo.
+	BTF []byte
+	// FuncInfo contains a struct bpf_func_info for each function of
+	// the program.
+	FuncInfo []byte
+	// LineInfo contains a struct bpf_line_info for each instruction
+	// which starts a new line of source code. It is empty if the
+	// Source of the first instruction of a function is missing, since
+	// the kernel rejects such line info.
+	LineInfo []byte
+}
+
+// AssignLineInfo sets the Source of instructions in an ELF section from
+// its line info.
+//
+// offsets maps the byte offset of each instruction in the section to its
+// index in insns. Instructions without line info belong to the same line
+// as the instruction before them. Returns an error if the func info of
+// the section doesn't agree with the symbols in insns.
+func (s *Spec) AssignLineInfo(section string, insns asm.Instructions, offsets map[uint64]int) error {
+	if s.ext == nil {
+		return nil
+	}
+
+	for _, fi := range s.ext.funcInfos[section] {
+		idx, ok := offsets[uint64(fi.insnOff)]
+		if !ok {
+			return errors.Errorf("func info: invalid instruction offset %d", fi.insnOff)
+		}
+
+		if insns[idx].Symbol != fi.fn.Name {
+			return errors.Errorf("func info: function %s doesn't start at instruction %d", fi.fn.Name, idx)
+		}
+	}
+
+	lines := s.ext.lineInfos[section]
+	if len(lines) == 0 {
+		return nil
+	}
+
+	for _, li := range lines {
+		idx, ok := offsets[uint64(li.insnOff)]
+		if !ok {
+			return errors.Errorf("line info: invalid instruction offset %d", li.insnOff)
+		}
+
+		line := li.line
+		insns[idx].Source = &line
+	}
+
+	var current *asm.SourceLine
+	for i := range insns {
+		if insns[i].Source == nil {
+			insns[i].Source = current
+		}
+		current = insns[i].Source
+	}
+
+	return nil
+}
+
+// ProgramInfo encodes the Spec and generates func and line info for
+// insns, using the given byte order.
+//
+// The program and every target of a bpf-to-bpf call must start with a
+// Symbol which matches the name of a Func in the Spec, or which was
+// given to Merge. Returns ErrNotFound if that isn't the case.
+func (s *Spec) ProgramInfo(insns asm.Instructions, bo binary.ByteOrder) (*ProgramInfo, error) {
+	if len(insns) == 0 {
+		return nil, errors.New("no instructions")
+	}
+
+	targets, err := insns.Targets()
+	if err != nil {
+		return nil, err
+	}
+
+	functions := map[int]bool{0: true}
+	for i, target := range targets {
+		if target != -1 && insns[i].OpCode.JumpOp() == asm.Call {
+			functions[target] = true
+		}
+	}
+
+	var (
+		loadImmDW          = asm.LoadImmOp(asm.DWord)
+		strings            = newStringTableBuilder(s.strings)
+		funcInfo, lineInfo bytes.Buffer
+		lastLine           *asm.SourceLine
+		missingLines       bool
+		offset             uint32
+	)
+
+	for i, ins := range insns {
+		if functions[i] {
+			fn, err := s.funcByName(ins.Symbol)
+			if err != nil {
+				return nil, errors.Wrapf(err, "instruction %d", i)
+			}
+
+			if err := binary.Write(&funcInfo, bo, bpfFuncInfo{offset, s.typeIDs[fn]}); err != nil {
+				return nil, err
+			}
+
+			// The kernel requires line info at the start of each function.
+			missingLines = missingLines || ins.Source == nil
+			lastLine = nil
+		}
+
+		if line := ins.Source; line != nil && (lastLine == nil || *line != *lastLine) {
+			fileNameOff, err := strings.Add(line.FileName)
+			if err != nil {
+				return nil, err
+			}
+
+			lineOff, err := strings.Add(line.Text)
+			if err != nil {
+				return nil, err
+			}
+
+			column := line.Column
+			if column > bpfColumnMax {
+				column = bpfColumnMax
+			}
+
+			li := bpfLineInfo{offset, fileNameOff, lineOff, line.Line<<bpfLineShift | column}
+			if err := binary.Write(&lineInfo, bo, &li); err != nil {
+				return nil, err
+			}
+
+			lastLine = line
+		}
+
+		offset++
+		if ins.OpCode == loadImmDW {
+			offset++
+		}
+	}
+
+	raw, err := s.marshal(bo, strings, marshalOptions{sanitizeLinkage: true})
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ProgramInfo{
+		BTF:      raw,
+		FuncInfo: funcInfo.Bytes(),
+	}
+
+	if !missingLines {
+		info.LineInfo = lineInfo.Bytes()
+	}
+
+	return info, nil
+}
+
+// funcByName returns the Func of the function with the given name,
+// which is either the Func given to Merge or the only Func of that name.
+func (s *Spec) funcByName(name string) (*Func, error) {
+	if fn := s.funcs[name]; fn != nil {
+		return fn, nil
+	}
+
+	var fn *Func
+	for _, typ := range s.namedTypes[name] {
+		candidate, ok := typ.(*Func)
+		if !ok {
+			continue
+		}
+
+		if fn != nil {
+			return nil, errors.Errorf("function %s is ambiguous", name)
+		}
+		fn = candidate
+	}
+
+	if fn == nil {
+		return nil, errors.Wrapf(ErrNotFound, "function %q", name)
+	}
+
+	return fn, nil
+}
@@ -0,0 +1,193 @@
+package btf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/newtools/ebpf/asm"
+	"github.com/pkg/errors"
+)
+
+func TestProgramInfo(t *testing.T) {
+	fh, err := os.Open("../testdata/line_info.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	spec, err := LoadSpecFromReader(fh)
+	if err != nil {
+		t.Fatal("Can't load BTF:", err)
+	}
+
+	insns := asm.Instructions{
+		asm.LoadMem(asm.R1, asm.R1, 0, asm.Word).Sym("line_info"),
+		asm.Call.Label("add"),
+		asm.Return(),
+		asm.Mov.Reg(asm.R0, asm.R1).Sym("add"),
+		asm.Add.Imm(asm.R0, 28),
+		asm.Return(),
+	}
+
+	offsets := map[uint64]int{0: 0, 8: 1, 16: 2}
+	if err := spec.AssignLineInfo("socket", insns[:3], offsets); err != nil {
+		t.Fatal("Can't assign line info:", err)
+	}
+
+	for i, ins := range insns[:3] {
+		src := ins.Source
+		if src == nil {
+			t.Errorf("Instruction %d has no source", i)
+			continue
+		}
+
+		if src.FileName != "testdata/line_info.c" || src.Line != 14 || src.Text != "\treturn add(skb->len, 28);" {
+			t.Errorf("Instruction %d has source %v instead of line 14", i, src)
+		}
+	}
+
+	wrongSymbol := asm.Instructions{insns[0].Sym("foo"), insns[1], insns[2]}
+	if err := spec.AssignLineInfo("socket", wrongSymbol, offsets); err == nil {
+		t.Error("AssignLineInfo accepts func info which doesn't match the symbols")
+	}
+
+	info, err := spec.ProgramInfo(insns, binary.LittleEndian)
+	if err != nil {
+		t.Fatal("Can't generate program info:", err)
+	}
+
+	have, err := loadRawSpec(bytes.NewReader(info.BTF), binary.LittleEndian)
+	if err != nil {
+		t.Fatal("Can't parse marshalled BTF:", err)
+	}
+
+	if !reflect.DeepEqual(have.types, spec.types) {
+		t.Error("Marshalled BTF doesn't match the original types")
+	}
+
+	var funcInfos []bpfFuncInfo
+	for rd := bytes.NewReader(info.FuncInfo); rd.Len() > 0; {
+		var fi bpfFuncInfo
+		if err := binary.Read(rd, binary.LittleEndian, &fi); err != nil {
+			t.Fatal(err)
+		}
+		funcInfos = append(funcInfos, fi)
+	}
+
+	if len(funcInfos) != 2 || funcInfos[0].InsnOff != 0 || funcInfos[1].InsnOff != 3 {
+		t.Fatal("Expected func info for instructions 0 and 3, got", funcInfos)
+	}
+
+	for i, name := range []string{"line_info", "add"} {
+		if fn, ok := have.types[funcInfos[i].TypeID].(*Func); !ok || fn.Name != name {
+			t.Errorf("Expected func info %d to refer to %s, got %v", i, name, have.types[funcInfos[i].TypeID])
+		}
+	}
+
+	if len(info.LineInfo) != 0 {
+		t.Error("Expected no line info, since add has no source")
+	}
+
+	insns[3].Source = &asm.SourceLine{FileName: "line_info.c", Line: 9, Text: "\treturn a + b;"}
+	info, err = spec.ProgramInfo(insns, binary.LittleEndian)
+	if err != nil {
+		t.Fatal("Can't generate program info:", err)
+	}
+
+	if len(info.LineInfo) < 2*LineInfoSize {
+		t.Fatal("Expected at least two line info records, got", len(info.LineInfo)/LineInfoSize)
+	}
+
+	var li bpfLineInfo
+	if err := binary.Read(bytes.NewReader(info.LineInfo[len(info.LineInfo)-LineInfoSize:]), binary.LittleEndian, &li); err != nil {
+		t.Fatal(err)
+	}
+
+	have, err = loadRawSpec(bytes.NewReader(info.BTF), binary.LittleEndian)
+	if err != nil {
+		t.Fatal("Can't parse marshalled BTF:", err)
+	}
+
+	if text, err := have.strings.Lookup(li.LineOff); err != nil || text != "\treturn a + b;" {
+		t.Errorf("Expected text of line 9, got %q (%v)", text, err)
+	}
+
+	if li.InsnOff != 3 || li.LineCol>>bpfLineShift != 9 {
+		t.Errorf("Expected line 9 at instruction 3, got %d at %d", li.LineCol>>bpfLineShift, li.InsnOff)
+	}
+
+	insns[0].Symbol = "missing"
+	if _, err := spec.ProgramInfo(insns, binary.LittleEndian); errors.Cause(err) != ErrNotFound {
+		t.Error("Expected ErrNotFound for a missing function, got", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	var specs []*Spec
+	for i := 0; i < 2; i++ {
+		spec, err := LoadSpec("../testdata/line_info.elf")
+		if err != nil {
+			t.Fatal("Can't load BTF:", err)
+		}
+		specs = append(specs, spec)
+	}
+
+	lineInfo, err := specs[0].funcByName("line_info")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add, err := specs[1].funcByName("add")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := Merge(specs, map[string]*Func{"line_info": lineInfo, "add.1": add})
+	if err != nil {
+		t.Fatal("Can't merge specs:", err)
+	}
+
+	if _, err := merged.funcByName("add"); err == nil {
+		t.Error("Expected add to be ambiguous")
+	}
+
+	if have, want := len(merged.types), 2*len(specs[0].types)-1; have != want {
+		t.Errorf("Expected %d types, got %d", want, have)
+	}
+
+	insns := asm.Instructions{
+		asm.Call.Label("add.1").Sym("line_info"),
+		asm.Return(),
+		asm.Mov.Reg(asm.R0, asm.R1).Sym("add.1"),
+		asm.Return(),
+	}
+
+	info, err := merged.ProgramInfo(insns, binary.LittleEndian)
+	if err != nil {
+		t.Fatal("Can't generate program info:", err)
+	}
+
+	have, err := loadRawSpec(bytes.NewReader(info.BTF), binary.LittleEndian)
+	if err != nil {
+		t.Fatal("Can't parse marshalled BTF:", err)
+	}
+
+	var fi bpfFuncInfo
+	if err := binary.Read(bytes.NewReader(info.FuncInfo[FuncInfoSize:]), binary.LittleEndian, &fi); err != nil {
+		t.Fatal(err)
+	}
+
+	if fi.TypeID != merged.typeIDs[add] {
+		t.Errorf("Expected func info to refer to type %d, got %d", merged.typeIDs[add], fi.TypeID)
+	}
+	if fn, ok := have.types[fi.TypeID].(*Func); !ok || fn.Name != "add" {
+		t.Error("Expected func info to refer to add, got", have.types[fi.TypeID])
+	}
+
+	if _, err := Merge(specs[:1], map[string]*Func{"add": add}); err == nil {
+		t.Error("Merge accepts a Func which isn't part of the specs")
+	}
+}
@@ -0,0 +1,104 @@
+package btf
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// stringTable contains the NUL terminated names of types.
+type stringTable []byte
+
+func readStringTable(r io.Reader) (stringTable, error) {
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read string table")
+	}
+
+	if len(contents) < 1 {
+		return nil, errors.New("string table is empty")
+	}
+
+	if contents[0] != '\x00' {
+		return nil, errors.New("first item in string table is non-empty")
+	}
+
+	if contents[len(contents)-1] != '\x00' {
+		return nil, errors.New("string table isn't null terminated")
+	}
+
+	return stringTable(contents), nil
+}
+
+// Lookup returns the string starting at offset.
+func (st stringTable) Lookup(offset uint32) (string, error) {
+	if int64(offset) >= int64(len(st)) {
+		return "", errors.Errorf("offset %d is out of bounds", offset)
+	}
+
+	str := st[offset:]
+	end := bytes.IndexByte(str, '\x00')
+	return string(str[:end]), nil
+}
+
+// stringTableBuilder extends a stringTable, reusing the offsets of
+// strings which are already present.
+type stringTableBuilder struct {
+	table   []byte
+	offsets map[string]uint32
+}
+
+func newStringTableBuilder(st stringTable) *stringTableBuilder {
+	stb := &stringTableBuilder{
+		table:   append([]byte(nil), st...),
+		offsets: make(map[string]uint32),
+	}
+
+	if len(stb.table) == 0 {
+		stb.table = []byte{0}
+	}
+
+	for off := 0; off < len(st); {
+		end := bytes.IndexByte(st[off:], 0)
+		if end == -1 {
+			break
+		}
+
+		str := string(st[off : off+end])
+		if _, ok := stb.offsets[str]; !ok {
+			stb.offsets[str] = uint32(off)
+		}
+		off += end + 1
+	}
+
+	if _, ok := stb.offsets[""]; !ok {
+		stb.offsets[""] = 0
+	}
+
+	return stb
+}
+
+// Add returns the offset of str, appending it to the table if necessary.
+func (stb *stringTableBuilder) Add(str string) (uint32, error) {
+	if off, ok := stb.offsets[str]; ok {
+		return off, nil
+	}
+
+	if strings.IndexByte(str, 0) != -1 {
+		return 0, errors.Errorf("string %q contains NUL", str)
+	}
+
+	if uint64(len(stb.table))+uint64(len(str)) >= math.MaxUint32 {
+		return 0, errors.New("string table is too large")
+	}
+
+	off := uint32(len(stb.table))
+	stb.table = append(stb.table, str...)
+	stb.table = append(stb.table, 0)
+	stb.offsets[str] = off
+	return off, nil
+}
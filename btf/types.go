@@ -0,0 +1,604 @@
+package btf
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// maxTypeDepth limits how many typedefs, qualifiers and arrays are
+// followed before giving up. This protects against cyclic types.
+const maxTypeDepth = 32
+
+// TypeID identifies a type in a BTF section.
+type TypeID uint32
+
+// Type represents a type described by BTF.
+type Type interface {
+	// TypeName returns the name of the type, or an empty string
+	// for anonymous types.
+	TypeName() string
+
+	// walk calls fn with a pointer to each type directly referenced
+	// by this type.
+	walk(fn func(*Type))
+}
+
+// Void is the unit type of BTF.
+type Void struct{}
+
+func (v *Void) TypeName() string    { return "" }
+func (v *Void) walk(fn func(*Type)) {}
+
+// IntEncoding describes how an Int is interpreted.
+type IntEncoding byte
+
+// Valid IntEncodings, which may be combined.
+const (
+	Signed IntEncoding = 1 << iota
+	Char
+	Bool
+)
+
+// Int is an integer of a given length.
+type Int struct {
+	Name string
+
+	// The size of the integer in bytes.
+	Size     uint32
+	Encoding IntEncoding
+	// Offset is the starting bit offset of the value.
+	Offset uint32
+	// Bits is the number of bits used to represent the value.
+	Bits byte
+}
+
+func (i *Int) TypeName() string    { return i.Name }
+func (i *Int) walk(fn func(*Type)) {}
+
+// Pointer is a pointer to another type.
+type Pointer struct {
+	Target Type
+}
+
+func (p *Pointer) TypeName() string    { return "" }
+func (p *Pointer) walk(fn func(*Type)) { fn(&p.Target) }
+
+// Array is an array with a fixed number of elements.
+type Array struct {
+	Index  Type
+	Type   Type
+	Nelems uint32
+}
+
+func (arr *Array) TypeName() string { return "" }
+
+func (arr *Array) walk(fn func(*Type)) {
+	fn(&arr.Index)
+	fn(&arr.Type)
+}
+
+// Struct is a compound type of consecutive members.
+type Struct struct {
+	Name string
+	// The size of the struct including padding, in bytes
+	Size    uint32
+	Members []Member
+}
+
+func (s *Struct) TypeName() string { return s.Name }
+
+func (s *Struct) walk(fn func(*Type)) {
+	for i := range s.Members {
+		fn(&s.Members[i].Type)
+	}
+}
+
+// Union is a compound type where members occupy the same memory.
+type Union struct {
+	Name string
+	// The size of the union including padding, in bytes.
+	Size    uint32
+	Members []Member
+}
+
+func (u *Union) TypeName() string { return u.Name }
+
+func (u *Union) walk(fn func(*Type)) {
+	for i := range u.Members {
+		fn(&u.Members[i].Type)
+	}
+}
+
+// Member is part of a Struct or Union.
+//
+// It is not a valid Type.
+type Member struct {
+	Name string
+	Type Type
+	// Offset is the bit offset of this member.
+	Offset uint32
+	// BitfieldSize is the size of a bitfield in bits, or zero if
+	// the member isn't a bitfield.
+	BitfieldSize uint32
+}
+
+// Enum lists possible values.
+type Enum struct {
+	Name string
+	// Size of the enum value in bytes.
+	Size   uint32
+	Signed bool
+	Values []EnumValue
+}
+
+func (e *Enum) TypeName() string    { return e.Name }
+func (e *Enum) walk(fn func(*Type)) {}
+
+// EnumValue is part of an Enum.
+//
+// It is not a valid Type.
+type EnumValue struct {
+	Name  string
+	Value uint64
+}
+
+// FwdKind is the type of forward declaration.
+type FwdKind int
+
+// Valid types of forward declaration.
+const (
+	FwdStruct FwdKind = iota
+	FwdUnion
+)
+
+// Fwd is a forward declaration of a Struct or Union.
+type Fwd struct {
+	Name string
+	Kind FwdKind
+}
+
+func (f *Fwd) TypeName() string    { return f.Name }
+func (f *Fwd) walk(fn func(*Type)) {}
+
+// Typedef is an alias of a Type.
+type Typedef struct {
+	Name string
+	Type Type
+}
+
+func (td *Typedef) TypeName() string    { return td.Name }
+func (td *Typedef) walk(fn func(*Type)) { fn(&td.Type) }
+
+// Volatile is a qualifier.
+type Volatile struct {
+	Type Type
+}
+
+func (v *Volatile) TypeName() string    { return "" }
+func (v *Volatile) walk(fn func(*Type)) { fn(&v.Type) }
+
+// Const is a qualifier.
+type Const struct {
+	Type Type
+}
+
+func (c *Const) TypeName() string    { return "" }
+func (c *Const) walk(fn func(*Type)) { fn(&c.Type) }
+
+// Restrict is a qualifier.
+type Restrict struct {
+	Type Type
+}
+
+func (r *Restrict) TypeName() string    { return "" }
+func (r *Restrict) walk(fn func(*Type)) { fn(&r.Type) }
+
+// TypeTag associates an attribute with a pointer target.
+type TypeTag struct {
+	Value string
+	Type  Type
+}
+
+func (tt *TypeTag) TypeName() string    { return "" }
+func (tt *TypeTag) walk(fn func(*Type)) { fn(&tt.Type) }
+
+// Func is a function definition.
+type Func struct {
+	Name    string
+	Type    Type
+	Linkage FuncLinkage
+}
+
+func (f *Func) TypeName() string    { return f.Name }
+func (f *Func) walk(fn func(*Type)) { fn(&f.Type) }
+
+// FuncProto is a function declaration.
+type FuncProto struct {
+	Return Type
+	Params []FuncParam
+}
+
+func (fp *FuncProto) TypeName() string { return "" }
+
+func (fp *FuncProto) walk(fn func(*Type)) {
+	fn(&fp.Return)
+	for i := range fp.Params {
+		fn(&fp.Params[i].Type)
+	}
+}
+
+// FuncParam is a parameter of a FuncProto.
+//
+// It is not a valid Type.
+type FuncParam struct {
+	Name string
+	Type Type
+}
+
+// Var is a global variable.
+type Var struct {
+	Name    string
+	Type    Type
+	Linkage VarLinkage
+}
+
+func (v *Var) TypeName() string    { return v.Name }
+func (v *Var) walk(fn func(*Type)) { fn(&v.Type) }
+
+// Datasec is a global program section containing data.
+type Datasec struct {
+	Name string
+	Size uint32
+	Vars []VarSecinfo
+}
+
+func (ds *Datasec) TypeName() string { return ds.Name }
+
+func (ds *Datasec) walk(fn func(*Type)) {
+	for i := range ds.Vars {
+		fn(&ds.Vars[i].Type)
+	}
+}
+
+// VarSecinfo describes a variable in a Datasec.
+//
+// It is not a valid Type.
+type VarSecinfo struct {
+	Type   Type
+	Offset uint32
+	Size   uint32
+}
+
+// Float is a floating point number.
+type Float struct {
+	Name string
+	// The size of the float in bytes.
+	Size uint32
+}
+
+func (f *Float) TypeName() string    { return f.Name }
+func (f *Float) walk(fn func(*Type)) {}
+
+// DeclTag associates an attribute with a declaration.
+type DeclTag struct {
+	Type  Type
+	Value string
+	// The index of the member or parameter the tag applies to, or
+	// -1 if it applies to Type itself.
+	Index int
+}
+
+func (dt *DeclTag) TypeName() string    { return "" }
+func (dt *DeclTag) walk(fn func(*Type)) { fn(&dt.Type) }
+
+// UnderlyingType skips typedefs and qualifiers.
+//
+// Returns the last type it encountered if the chain is too long.
+func UnderlyingType(typ Type) Type {
+	for i := 0; i < maxTypeDepth; i++ {
+		switch v := typ.(type) {
+		case *Typedef:
+			typ = v.Type
+		case *Volatile:
+			typ = v.Type
+		case *Const:
+			typ = v.Type
+		case *Restrict:
+			typ = v.Type
+		case *TypeTag:
+			typ = v.Type
+		default:
+			return typ
+		}
+	}
+	return typ
+}
+
+// pointerSize is the size of a pointer in eBPF, independent of the host.
+const pointerSize = 8
+
+// Sizeof returns the size of a type in bytes.
+//
+// Returns an error if the size can't be computed.
+func Sizeof(typ Type) (int, error) {
+	var (
+		n    = int64(1)
+		elem int64
+	)
+
+	for i := 0; i < maxTypeDepth; i++ {
+		switch v := UnderlyingType(typ).(type) {
+		case *Array:
+			if n > 0 && int64(v.Nelems) > math.MaxInt64/n {
+				return 0, errors.New("overflow")
+			}
+
+			// Arrays may be of zero length, which allows
+			// n to be zero as well.
+			n *= int64(v.Nelems)
+			typ = v.Type
+			continue
+
+		case *Pointer:
+			elem = pointerSize
+		case *Int:
+			elem = int64(v.Size)
+		case *Struct:
+			elem = int64(v.Size)
+		case *Union:
+			elem = int64(v.Size)
+		case *Enum:
+			elem = int64(v.Size)
+		case *Datasec:
+			elem = int64(v.Size)
+		case *Float:
+			elem = int64(v.Size)
+		case *Var:
+			typ = v.Type
+			continue
+
+		default:
+			return 0, errors.Errorf("unsized type %T", typ)
+		}
+
+		if n > 0 && elem > math.MaxInt64/n {
+			return 0, errors.New("overflow")
+		}
+
+		size := n * elem
+		if int64(int(size)) != size {
+			return 0, errors.New("overflow")
+		}
+
+		return int(size), nil
+	}
+
+	return 0, errors.New("exceeded type depth")
+}
+
+// inflateRawTypes converts the wire format into a graph of Types.
+//
+// The Type at index i has TypeID i, and the first Type is always Void.
+func inflateRawTypes(rawTypes []rawType, rawStrings stringTable) ([]Type, error) {
+	type fixupDef struct {
+		id  TypeID
+		typ *Type
+	}
+
+	var (
+		types  = make([]Type, 0, len(rawTypes)+1)
+		fixups []fixupDef
+	)
+
+	fixup := func(id TypeID, typ *Type) {
+		if int(id) < len(types) {
+			*typ = types[id]
+			return
+		}
+		fixups = append(fixups, fixupDef{id, typ})
+	}
+
+	types = append(types, &Void{})
+
+	for i, raw := range rawTypes {
+		var (
+			id  = TypeID(i + 1)
+			typ Type
+		)
+
+		name, err := rawStrings.Lookup(raw.NameOff)
+		if err != nil {
+			return nil, errors.Wrapf(err, "type id %d: get name", id)
+		}
+
+		switch raw.Kind() {
+		case kindInt:
+			encoding := *raw.data.(*uint32)
+			typ = &Int{
+				Name:     name,
+				Size:     raw.Size(),
+				Encoding: IntEncoding((encoding >> btfIntEncodingShift) & mask(btfIntEncodingLen)),
+				Offset:   (encoding >> btfIntOffsetShift) & mask(btfIntOffsetLen),
+				Bits:     byte((encoding >> btfIntBitsShift) & mask(btfIntBitsLen)),
+			}
+
+		case kindPointer:
+			ptr := &Pointer{}
+			fixup(raw.Type(), &ptr.Target)
+			typ = ptr
+
+		case kindArray:
+			btfArr := raw.data.(*btfArray)
+			arr := &Array{Nelems: btfArr.Nelems}
+			fixup(btfArr.IndexType, &arr.Index)
+			fixup(btfArr.Type, &arr.Type)
+			typ = arr
+
+		case kindStruct, kindUnion:
+			members, err := convertMembers(raw, rawStrings)
+			if err != nil {
+				return nil, errors.Wrapf(err, "type id %d", id)
+			}
+
+			for i, btfMember := range raw.data.([]btfMember) {
+				fixup(btfMember.Type, &members[i].Type)
+			}
+
+			if raw.Kind() == kindStruct {
+				typ = &Struct{name, raw.Size(), members}
+			} else {
+				typ = &Union{name, raw.Size(), members}
+			}
+
+		case kindEnum:
+			var values []EnumValue
+			for _, btfVal := range raw.data.([]btfEnum) {
+				valName, err := rawStrings.Lookup(btfVal.NameOff)
+				if err != nil {
+					return nil, errors.Wrapf(err, "type id %d: get enum value name", id)
+				}
+
+				value := uint64(uint32(btfVal.Val))
+				if raw.KindFlag() {
+					// Sign extend values of signed enums.
+					value = uint64(int64(btfVal.Val))
+				}
+				values = append(values, EnumValue{valName, value})
+			}
+			typ = &Enum{name, raw.Size(), raw.KindFlag(), values}
+
+		case kindEnum64:
+			var values []EnumValue
+			for _, btfVal := range raw.data.([]btfEnum64) {
+				valName, err := rawStrings.Lookup(btfVal.NameOff)
+				if err != nil {
+					return nil, errors.Wrapf(err, "type id %d: get enum value name", id)
+				}
+
+				value := uint64(btfVal.ValHi32)<<32 | uint64(btfVal.ValLo32)
+				values = append(values, EnumValue{valName, value})
+			}
+			typ = &Enum{name, raw.Size(), raw.KindFlag(), values}
+
+		case kindForward:
+			kind := FwdStruct
+			if raw.KindFlag() {
+				kind = FwdUnion
+			}
+			typ = &Fwd{name, kind}
+
+		case kindTypedef:
+			typedef := &Typedef{Name: name}
+			fixup(raw.Type(), &typedef.Type)
+			typ = typedef
+
+		case kindVolatile:
+			volatile := &Volatile{}
+			fixup(raw.Type(), &volatile.Type)
+			typ = volatile
+
+		case kindConst:
+			cnst := &Const{}
+			fixup(raw.Type(), &cnst.Type)
+			typ = cnst
+
+		case kindRestrict:
+			restrict := &Restrict{}
+			fixup(raw.Type(), &restrict.Type)
+			typ = restrict
+
+		case kindTypeTag:
+			tag := &TypeTag{Value: name}
+			fixup(raw.Type(), &tag.Type)
+			typ = tag
+
+		case kindFunc:
+			fn := &Func{Name: name, Linkage: FuncLinkage(raw.Linkage())}
+			fixup(raw.Type(), &fn.Type)
+			typ = fn
+
+		case kindFuncProto:
+			rawParams := raw.data.([]btfParam)
+			params := make([]FuncParam, 0, len(rawParams))
+			for _, param := range rawParams {
+				paramName, err := rawStrings.Lookup(param.NameOff)
+				if err != nil {
+					return nil, errors.Wrapf(err, "type id %d: get param name", id)
+				}
+				params = append(params, FuncParam{Name: paramName})
+			}
+			for i := range params {
+				fixup(rawParams[i].Type, &params[i].Type)
+			}
+
+			fp := &FuncProto{Params: params}
+			fixup(raw.Type(), &fp.Return)
+			typ = fp
+
+		case kindVar:
+			variable := raw.data.(*btfVariable)
+			v := &Var{Name: name, Linkage: VarLinkage(variable.Linkage)}
+			fixup(raw.Type(), &v.Type)
+			typ = v
+
+		case kindDatasec:
+			btfVars := raw.data.([]btfVarSecinfo)
+			vars := make([]VarSecinfo, 0, len(btfVars))
+			for _, btfVar := range btfVars {
+				vars = append(vars, VarSecinfo{
+					Offset: btfVar.Offset,
+					Size:   btfVar.Size,
+				})
+			}
+			for i := range vars {
+				fixup(btfVars[i].Type, &vars[i].Type)
+			}
+			typ = &Datasec{name, raw.Size(), vars}
+
+		case kindFloat:
+			typ = &Float{name, raw.Size()}
+
+		case kindDeclTag:
+			tag := &DeclTag{Value: name, Index: int(raw.data.(*btfDeclTag).ComponentIdx)}
+			fixup(raw.Type(), &tag.Type)
+			typ = tag
+
+		default:
+			return nil, errors.Errorf("type id %d: unknown kind: %v", id, raw.Kind())
+		}
+
+		types = append(types, typ)
+	}
+
+	for _, fixup := range fixups {
+		if int(fixup.id) >= len(types) {
+			return nil, errors.Errorf("reference to invalid type id: %d", fixup.id)
+		}
+
+		*fixup.typ = types[fixup.id]
+	}
+
+	return types, nil
+}
+
+func convertMembers(raw rawType, rawStrings stringTable) ([]Member, error) {
+	btfMembers := raw.data.([]btfMember)
+	members := make([]Member, 0, len(btfMembers))
+	for _, btfMember := range btfMembers {
+		name, err := rawStrings.Lookup(btfMember.NameOff)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't get name for member")
+		}
+
+		member := Member{Name: name, Offset: btfMember.Offset}
+		if raw.KindFlag() {
+			// The offset contains the size of a bitfield in its
+			// upper 8 bits.
+			member.BitfieldSize = btfMember.Offset >> 24
+			member.Offset &= 0xffffff
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
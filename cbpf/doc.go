@@ -0,0 +1,18 @@
+// Package cbpf translates classic BPF filters into eBPF.
+//
+// Classic BPF is used by socket filters, seccomp and tools like
+// tcpdump. The translated instructions are suitable for a SocketFilter
+// ProgramSpec, and can be combined with maps and helpers like any
+// other eBPF program.
+//
+// Filters can be taken from golang.org/x/net/bpf by converting each
+// bpf.RawInstruction into an Instruction, or from the output of
+// tcpdump -dd, which is a valid Go composite literal:
+//
+//	filter := []cbpf.Instruction{
+//	    { 0x28, 0, 0, 0x0000000c },
+//	    { 0x15, 0, 1, 0x00000800 },
+//	    { 0x6, 0, 0, 0x00040000 },
+//	    { 0x6, 0, 0, 0x00000000 },
+//	}
+package cbpf
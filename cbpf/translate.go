@@ -0,0 +1,496 @@
+package cbpf
+
+import (
+	"math"
+
+	"github.com/newtools/ebpf/asm"
+
+	"github.com/pkg/errors"
+)
+
+// Instruction is a classic BPF instruction.
+//
+// It has the same layout as struct sock_filter and
+// golang.org/x/net/bpf.RawInstruction.
+type Instruction struct {
+	Op uint16
+	Jt uint8
+	Jf uint8
+	K  uint32
+}
+
+// Classic BPF encoding, see include/uapi/linux/filter.h.
+const (
+	classMask = 0x07
+	classLd   = 0x00
+	classLdX  = 0x01
+	classSt   = 0x02
+	classStX  = 0x03
+	classALU  = 0x04
+	classJmp  = 0x05
+	classRet  = 0x06
+	classMisc = 0x07
+
+	sizeMask = 0x18
+	sizeW    = 0x00
+	sizeH    = 0x08
+	sizeB    = 0x10
+
+	modeMask = 0xe0
+	modeImm  = 0x00
+	modeAbs  = 0x20
+	modeInd  = 0x40
+	modeMem  = 0x60
+	modeLen  = 0x80
+	modeMsh  = 0xa0
+
+	opMask  = 0xf0
+	srcMask = 0x08
+	srcK    = 0x00
+	srcX    = 0x08
+
+	rvalMask = 0x18
+	rvalK    = 0x00
+	rvalX    = 0x08
+	rvalA    = 0x10
+
+	miscMask = 0xf8
+	miscTAX  = 0x00
+	miscTXA  = 0x80
+
+	// Number of 32 bit words of scratch memory.
+	memWords = 16
+)
+
+// Ancillary data is loaded via an absolute offset from skfAdOff.
+const (
+	skfAdOff            = -0x1000
+	skfAdProtocol       = 0
+	skfAdPktType        = 4
+	skfAdIfIndex        = 8
+	skfAdNlAttr         = 12
+	skfAdNlAttrNest     = 16
+	skfAdMark           = 20
+	skfAdQueue          = 24
+	skfAdHaType         = 28
+	skfAdRxHash         = 32
+	skfAdCPU            = 36
+	skfAdALUXorX        = 40
+	skfAdVlanTag        = 44
+	skfAdVlanTagPresent = 48
+	skfAdPayOffset      = 52
+	skfAdRandom         = 56
+	skfAdVlanTPID       = 60
+)
+
+// Offsets into struct __sk_buff.
+const (
+	skbLen          = 0
+	skbPktType      = 4
+	skbMark         = 8
+	skbQueueMapping = 12
+	skbProtocol     = 16
+	skbVlanPresent  = 20
+	skbVlanTCI      = 24
+	skbVlanProto    = 28
+	skbIfIndex      = 40
+	skbHash         = 68
+)
+
+// Registers used by translated programs.
+//
+// A must be R0, since that is where LoadAbs and LoadInd place their
+// result. X and the temporary register are callee saved, so they
+// survive LoadAbs, LoadInd and helper calls.
+const (
+	regA   = asm.R0
+	regX   = asm.R7
+	regTmp = asm.R8
+	regCtx = asm.R6
+)
+
+// Translate converts a classic BPF filter into eBPF.
+//
+// The resulting program expects a struct __sk_buff as its context.
+// Scratch memory is placed on the stack. Loads from the packet via
+// LoadAbs and LoadInd behave like their classic counterparts: an
+// out of bounds access terminates the program with a return value
+// of zero.
+func Translate(filter []Instruction) (asm.Instructions, error) {
+	if len(filter) == 0 {
+		return nil, errors.New("empty filter")
+	}
+
+	if last := filter[len(filter)-1]; last.Op&classMask != classRet {
+		return nil, errors.New("filter doesn't end with a return")
+	}
+
+	t := translator{
+		insns: asm.Instructions{
+			asm.Mov.Reg(regCtx, asm.R1),
+			asm.Mov.Imm32(regA, 0),
+			asm.Mov.Imm32(regX, 0),
+		},
+		starts: make([]int, len(filter)),
+	}
+
+	for i, ins := range filter {
+		t.starts[i] = len(t.insns)
+		if err := t.translate(i, ins, len(filter)); err != nil {
+			return nil, errors.Wrapf(err, "instruction %d", i)
+		}
+	}
+
+	for _, fix := range t.fixups {
+		offset := t.starts[fix.target] - fix.index - 1
+		if offset > math.MaxInt16 {
+			return nil, errors.Errorf("instruction %d: jump offset %d is too large", fix.source, offset)
+		}
+		t.insns[fix.index].Offset = int16(offset)
+	}
+
+	return t.insns, nil
+}
+
+// fixup is a jump which is resolved once all instructions are translated.
+type fixup struct {
+	source int
+	index  int
+	target int
+}
+
+type translator struct {
+	insns  asm.Instructions
+	starts []int
+	fixups []fixup
+}
+
+func (t *translator) emit(insns ...asm.Instruction) {
+	t.insns = append(t.insns, insns...)
+}
+
+func (t *translator) translate(i int, ins Instruction, length int) error {
+	switch ins.Op & classMask {
+	case classLd:
+		return t.load(ins)
+
+	case classLdX:
+		return t.loadX(ins)
+
+	case classSt, classStX:
+		off, err := scratch(ins.K)
+		if err != nil {
+			return err
+		}
+
+		src := regA
+		if ins.Op&classMask == classStX {
+			src = regX
+		}
+		t.emit(asm.StoreMem(asm.RFP, off, src, asm.Word))
+		return nil
+
+	case classALU:
+		return t.alu(ins)
+
+	case classJmp:
+		return t.jump(i, ins, length)
+
+	case classRet:
+		switch ins.Op & rvalMask {
+		case rvalK:
+			t.emit(asm.Mov.Imm32(regA, int32(ins.K)))
+		case rvalX:
+			t.emit(asm.Mov.Reg32(regA, regX))
+		case rvalA:
+		default:
+			return errors.Errorf("invalid return value %#x", ins.Op&rvalMask)
+		}
+		t.emit(asm.Return())
+		return nil
+
+	case classMisc:
+		switch ins.Op & miscMask {
+		case miscTAX:
+			t.emit(asm.Mov.Reg32(regX, regA))
+		case miscTXA:
+			t.emit(asm.Mov.Reg32(regA, regX))
+		default:
+			return errors.Errorf("invalid misc operation %#x", ins.Op)
+		}
+		return nil
+	}
+
+	return errors.Errorf("invalid opcode %#x", ins.Op)
+}
+
+func (t *translator) load(ins Instruction) error {
+	switch ins.Op & modeMask {
+	case modeImm:
+		t.emit(asm.Mov.Imm32(regA, int32(ins.K)))
+
+	case modeAbs:
+		offset := int32(ins.K)
+		if offset >= skfAdOff && offset < 0 {
+			return t.ancillary(offset - skfAdOff)
+		}
+
+		size, err := loadSize(ins.Op)
+		if err != nil {
+			return err
+		}
+		t.emit(asm.LoadAbs(offset, size))
+
+	case modeInd:
+		size, err := loadSize(ins.Op)
+		if err != nil {
+			return err
+		}
+		t.emit(asm.LoadInd(regA, regX, int32(ins.K), size))
+
+	case modeMem:
+		off, err := scratch(ins.K)
+		if err != nil {
+			return err
+		}
+		t.emit(asm.LoadMem(regA, asm.RFP, off, asm.Word))
+
+	case modeLen:
+		t.emit(asm.LoadMem(regA, regCtx, skbLen, asm.Word))
+
+	default:
+		return errors.Errorf("invalid load mode %#x", ins.Op&modeMask)
+	}
+
+	return nil
+}
+
+func (t *translator) loadX(ins Instruction) error {
+	switch ins.Op & modeMask {
+	case modeImm:
+		t.emit(asm.Mov.Imm32(regX, int32(ins.K)))
+
+	case modeMem:
+		off, err := scratch(ins.K)
+		if err != nil {
+			return err
+		}
+		t.emit(asm.LoadMem(regX, asm.RFP, off, asm.Word))
+
+	case modeLen:
+		t.emit(asm.LoadMem(regX, regCtx, skbLen, asm.Word))
+
+	case modeMsh:
+		// X = 4 * (P[k] & 0xf). LoadAbs overwrites A, so it is
+		// preserved in a temporary register.
+		t.emit(
+			asm.Mov.Reg(regTmp, regA),
+			asm.LoadAbs(int32(ins.K), asm.Byte),
+			asm.And.Imm32(regA, 0xf),
+			asm.LSh.Imm32(regA, 2),
+			asm.Mov.Reg32(regX, regA),
+			asm.Mov.Reg(regA, regTmp),
+		)
+
+	default:
+		return errors.Errorf("invalid load mode %#x", ins.Op&modeMask)
+	}
+
+	return nil
+}
+
+// ancillary translates loads of data which isn't part of the packet.
+func (t *translator) ancillary(offset int32) error {
+	field := func(off int16) {
+		t.emit(asm.LoadMem(regA, regCtx, off, asm.Word))
+	}
+
+	switch offset {
+	case skfAdProtocol:
+		field(skbProtocol)
+		t.emit(asm.HostTo(asm.BE, regA, asm.Half))
+	case skfAdPktType:
+		field(skbPktType)
+	case skfAdIfIndex:
+		field(skbIfIndex)
+	case skfAdMark:
+		field(skbMark)
+	case skfAdQueue:
+		field(skbQueueMapping)
+	case skfAdRxHash:
+		field(skbHash)
+	case skfAdVlanTag:
+		field(skbVlanTCI)
+	case skfAdVlanTagPresent:
+		field(skbVlanPresent)
+	case skfAdVlanTPID:
+		field(skbVlanProto)
+		t.emit(asm.HostTo(asm.BE, regA, asm.Half))
+	case skfAdCPU:
+		t.emit(asm.GetSMPProcessorID.Call())
+	case skfAdRandom:
+		t.emit(asm.GetPRandomu32.Call())
+	case skfAdALUXorX:
+		t.emit(asm.Xor.Reg32(regA, regX))
+	case skfAdNlAttr, skfAdNlAttrNest, skfAdHaType, skfAdPayOffset:
+		return errors.Errorf("ancillary load %d is not supported", offset)
+	default:
+		return errors.Errorf("invalid ancillary load %d", offset)
+	}
+
+	return nil
+}
+
+var aluOps = map[uint16]asm.ALUOp{
+	0x00: asm.Add,
+	0x10: asm.Sub,
+	0x20: asm.Mul,
+	0x30: asm.Div,
+	0x40: asm.Or,
+	0x50: asm.And,
+	0x60: asm.LSh,
+	0x70: asm.RSh,
+	0x80: asm.Neg,
+	0x90: asm.Mod,
+	0xa0: asm.Xor,
+}
+
+func (t *translator) alu(ins Instruction) error {
+	op, ok := aluOps[ins.Op&opMask]
+	if !ok {
+		return errors.Errorf("invalid ALU operation %#x", ins.Op&opMask)
+	}
+
+	if op == asm.Neg {
+		t.emit(asm.Neg.Imm32(regA, 0))
+		return nil
+	}
+
+	if ins.Op&srcMask == srcX {
+		if op == asm.Div || op == asm.Mod {
+			// Classic BPF returns zero when dividing by zero.
+			t.emit(
+				asm.Instruction{OpCode: asm.JNE.Op(asm.ImmSource), Dst: regX, Offset: 2},
+				asm.Mov.Imm32(regA, 0),
+				asm.Return(),
+			)
+		}
+		t.emit(op.Reg32(regA, regX))
+		return nil
+	}
+
+	switch {
+	case (op == asm.Div || op == asm.Mod) && ins.K == 0:
+		return errors.New("division by zero")
+	case (op == asm.LSh || op == asm.RSh) && ins.K >= 32:
+		return errors.Errorf("shift by %d is out of range", ins.K)
+	}
+
+	t.emit(op.Imm32(regA, int32(ins.K)))
+	return nil
+}
+
+var jumpOps = map[uint16]asm.JumpOp{
+	0x10: asm.JEq,
+	0x20: asm.JGT,
+	0x30: asm.JGE,
+	0x40: asm.JSet,
+}
+
+var invertedJumpOps = map[asm.JumpOp]asm.JumpOp{
+	asm.JEq: asm.JNE,
+	asm.JGT: asm.JLE,
+	asm.JGE: asm.JLT,
+}
+
+func (t *translator) jump(i int, ins Instruction, length int) error {
+	next := i + 1
+
+	if ins.Op&opMask == 0x00 {
+		// Ja
+		if uint64(ins.K) >= uint64(length-next) {
+			return errors.Errorf("jump target %d is out of bounds", uint64(next)+uint64(ins.K))
+		}
+		t.goTo(i, next+int(ins.K))
+		return nil
+	}
+
+	op, ok := jumpOps[ins.Op&opMask]
+	if !ok {
+		return errors.Errorf("invalid jump operation %#x", ins.Op&opMask)
+	}
+
+	jt, jf := next+int(ins.Jt), next+int(ins.Jf)
+	if jt >= length || jf >= length {
+		return errors.New("jump target is out of bounds")
+	}
+
+	if jt == jf {
+		t.goTo(i, jt)
+		return nil
+	}
+
+	cond := func(op asm.JumpOp) asm.Instruction {
+		if ins.Op&srcMask == srcX {
+			return asm.Instruction{OpCode: op.Op(asm.RegSource), Dst: regA, Src: regX}
+		}
+
+		if int32(ins.K) < 0 && op != asm.JSet {
+			// A is zero extended, while immediates are sign extended.
+			return asm.Instruction{OpCode: op.Op(asm.RegSource), Dst: regA, Src: regTmp}
+		}
+
+		return asm.Instruction{OpCode: op.Op(asm.ImmSource), Dst: regA, Constant: int64(int32(ins.K))}
+	}
+
+	if ins.Op&srcMask == srcK && int32(ins.K) < 0 && op != asm.JSet {
+		t.emit(asm.Mov.Imm32(regTmp, int32(ins.K)))
+	}
+
+	inverted, ok := invertedJumpOps[op]
+	switch {
+	case jf == next:
+		t.branch(i, cond(op), jt)
+	case jt == next && ok:
+		t.branch(i, cond(inverted), jf)
+	default:
+		t.branch(i, cond(op), jt)
+		t.goTo(i, jf)
+	}
+
+	return nil
+}
+
+// goTo emits an unconditional jump to a classic instruction.
+func (t *translator) goTo(source, target int) {
+	if target == source+1 {
+		return
+	}
+	t.branch(source, asm.Instruction{OpCode: asm.Ja.Op(asm.ImmSource)}, target)
+}
+
+func (t *translator) branch(source int, ins asm.Instruction, target int) {
+	t.fixups = append(t.fixups, fixup{source, len(t.insns), target})
+	t.emit(ins)
+}
+
+func loadSize(op uint16) (asm.Size, error) {
+	switch op & sizeMask {
+	case sizeW:
+		return asm.Word, nil
+	case sizeH:
+		return asm.Half, nil
+	case sizeB:
+		return asm.Byte, nil
+	default:
+		return asm.InvalidSize, errors.Errorf("invalid load size %#x", op&sizeMask)
+	}
+}
+
+// scratch returns the stack offset of a word of scratch memory.
+func scratch(k uint32) (int16, error) {
+	if k >= memWords {
+		return 0, errors.Errorf("scratch memory index %d is out of bounds", k)
+	}
+	return -int16(memWords-k) * 4, nil
+}
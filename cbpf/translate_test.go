@@ -0,0 +1,198 @@
+package cbpf
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/newtools/ebpf"
+	"github.com/newtools/ebpf/vm"
+)
+
+// tcpdump -dd 'ip and tcp dst port 80 and not ip[6:2] & 0x1fff != 0'
+var tcpPort80 = []Instruction{
+	{0x28, 0, 0, 0x0000000c},
+	{0x15, 0, 7, 0x00000800},
+	{0x30, 0, 0, 0x00000017},
+	{0x15, 0, 5, 0x00000006},
+	{0x28, 0, 0, 0x00000014},
+	{0x45, 3, 0, 0x00001fff},
+	{0xb1, 0, 0, 0x0000000e},
+	{0x48, 0, 0, 0x00000010},
+	{0x15, 1, 0, 0x00000050},
+	{0x6, 0, 0, 0x00000000},
+	{0x6, 0, 0, 0x00040000},
+}
+
+func tcpPacket(port uint16) []byte {
+	pkt := make([]byte, 14+20+20)
+	pkt[12], pkt[13] = 0x08, 0x00
+	ip := pkt[14:]
+	ip[0] = 0x45
+	ip[9] = 6
+	tcp := ip[20:]
+	tcp[2], tcp[3] = byte(port>>8), byte(port)
+	return pkt
+}
+
+func TestTranslate(t *testing.T) {
+	const (
+		ldImm  = classLd | modeImm
+		ldxImm = classLdX | modeImm
+		ldMem  = classLd | modeMem
+		ldLen  = classLd | modeLen
+		st     = classSt
+		jeqK   = classJmp | 0x10 | srcK
+		jgtX   = classJmp | 0x20 | srcX
+		divX   = classALU | 0x30 | srcX
+		retK   = classRet | rvalK
+		retA   = classRet | rvalA
+		retX   = classRet | rvalX
+		tax    = classMisc | miscTAX
+	)
+
+	udp := tcpPacket(80)
+	udp[14+9] = 17
+
+	truncated := tcpPacket(80)[:14+20+2]
+
+	testcases := []struct {
+		name   string
+		filter []Instruction
+		packet []byte
+		want   uint32
+	}{
+		{"port 80", tcpPort80, tcpPacket(80), 0x40000},
+		{"port 81", tcpPort80, tcpPacket(81), 0},
+		{"udp", tcpPort80, udp, 0},
+		{"truncated", tcpPort80, truncated, 0},
+		{"scratch", []Instruction{
+			{ldImm, 0, 0, 42},
+			{st, 0, 0, 15},
+			{ldImm, 0, 0, 0},
+			{ldMem, 0, 0, 15},
+			{retA, 0, 0, 0},
+		}, tcpPacket(80), 42},
+		{"divide by X", []Instruction{
+			{ldImm, 0, 0, 10},
+			{ldxImm, 0, 0, 3},
+			{divX, 0, 0, 0},
+			{retA, 0, 0, 0},
+		}, tcpPacket(80), 3},
+		{"divide by zero", []Instruction{
+			{ldImm, 0, 0, 10},
+			{divX, 0, 0, 0},
+			{retK, 0, 0, 1},
+		}, tcpPacket(80), 0},
+		{"large constant", []Instruction{
+			{ldImm, 0, 0, 0xffffffff},
+			{jeqK, 0, 1, 0xffffffff},
+			{retK, 0, 0, 1},
+			{retK, 0, 0, 2},
+		}, tcpPacket(80), 1},
+		{"compare X", []Instruction{
+			{ldLen, 0, 0, 0},
+			{tax, 0, 0, 0},
+			{ldImm, 0, 0, 100},
+			{jgtX, 1, 0, 0},
+			{retK, 0, 0, 0},
+			{retX, 0, 0, 0},
+		}, tcpPacket(80), 54},
+		{"protocol", []Instruction{
+			{classLd | sizeH | modeAbs, 0, 0, 0xfffff000},
+			{retA, 0, 0, 0},
+		}, tcpPacket(80), 0x800},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			insns, err := Translate(tc.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			spec := &ebpf.ProgramSpec{
+				Type:         ebpf.SocketFilter,
+				Instructions: insns,
+				License:      "MIT",
+			}
+
+			prog, err := vm.NewProgram(spec, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ret, _, err := prog.Test(tc.packet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ret != tc.want {
+				t.Errorf("Expected %#x from vm, got %#x\n%v", tc.want, ret, insns)
+			}
+
+			// Socket filters are passed the packet starting at the
+			// network header when testing in the kernel. SchedCLS
+			// programs receive the whole frame, like a packet socket.
+			kspec := spec.Copy()
+			kspec.Type = ebpf.SchedCLS
+			kprog, err := ebpf.NewProgram(kspec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer kprog.Close()
+
+			ret, _, err = kprog.Test(tc.packet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ret != tc.want {
+				t.Errorf("Expected %#x from kernel, got %#x", tc.want, ret)
+			}
+		})
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+	testcases := []struct {
+		name   string
+		filter []Instruction
+	}{
+		{"empty", nil},
+		{"no return", []Instruction{{classLd | modeImm, 0, 0, 0}}},
+		{"jump out of bounds", []Instruction{{classJmp | 0x10, 1, 0, 0}, {classRet, 0, 0, 0}}},
+		{"division by zero", []Instruction{{classALU | 0x30, 0, 0, 0}, {classRet, 0, 0, 0}}},
+		{"scratch out of bounds", []Instruction{{classSt, 0, 0, 16}, {classRet, 0, 0, 0}}},
+		{"unsupported ancillary", []Instruction{{classLd | modeAbs, 0, 0, 0xfffff000 + skfAdHaType}, {classRet, 0, 0, 0}}},
+	}
+
+	for _, tc := range testcases {
+		if _, err := Translate(tc.filter); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
+
+func ExampleTranslate() {
+	// tcpdump -dd 'ether proto 0x800'
+	insns, err := Translate([]Instruction{
+		{0x28, 0, 0, 0x0000000c},
+		{0x15, 0, 1, 0x00000800},
+		{0x6, 0, 0, 0x00040000},
+		{0x6, 0, 0, 0x00000000},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Print(insns)
+
+	// Output: 0: MovReg dst: r6 src: r1
+	// 	1: Mov32Imm dst: r0 imm: 0
+	// 	2: Mov32Imm dst: r7 imm: 0
+	// 	3: LdAbsH imm: 12
+	// 	4: JNEImm dst: r0 off: 2 imm: 2048
+	// 	5: Mov32Imm dst: r0 imm: 262144
+	// 	6: Exit
+	// 	7: Mov32Imm dst: r0 imm: 0
+	// 	8: Exit
+}
@@ -1,22 +1,62 @@
 package ebpf
 
 import (
+	"hash"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/newtools/ebpf/btf"
 
 	"github.com/pkg/errors"
 )
 
 // CollectionOptions control loading a collection into the kernel.
 type CollectionOptions struct {
+	Maps     MapOptions
 	Programs ProgramOptions
 }
 
+// CollectionSpecOptions control parsing an ELF into a CollectionSpec.
+type CollectionSpecOptions struct {
+	// TargetBTF describes the kernel that CO-RE relocations are
+	// resolved against. Defaults to the BTF of the running kernel,
+	// see btf.LoadKernelSpec.
+	TargetBTF *btf.Spec
+
+	// KernelConfig is the path of the kernel configuration used to
+	// resolve extern variables in the .kconfig section. It may be
+	// compressed with gzip. Defaults to /proc/config.gz or
+	// /boot/config-<release>.
+	KernelConfig string
+
+	// KernelVersion overrides the version of the running kernel, which
+	// replaces MagicKernelVersion in the version section and is the
+	// value of LINUX_KERNEL_VERSION in .kconfig. It is encoded like
+	// LINUX_VERSION_CODE.
+	KernelVersion uint32
+
+	// Sections lists additional conventions for the names of sections
+	// which contain programs. They take precedence over the built-in
+	// conventions with the same prefix.
+	Sections []ProgramSection
+
+	// Strict turns the warnings that would be returned in
+	// CollectionSpec.Warnings into an error.
+	Strict bool
+}
+
 // CollectionSpec describes a collection.
 type CollectionSpec struct {
 	Maps     map[string]*MapSpec
 	Programs map[string]*ProgramSpec
+
+	// Warnings lists the parts of the ELF the spec was loaded from
+	// which were ignored, like executable sections with an unknown
+	// name or unused maps.
+	Warnings []ELFWarning
 }
 
 // Copy returns a recursive copy of the spec.
@@ -38,18 +78,132 @@ func (cs *CollectionSpec) Copy() *CollectionSpec {
 		cpy.Programs[name] = spec.Copy()
 	}
 
+	if cs.Warnings != nil {
+		cpy.Warnings = append([]ELFWarning(nil), cs.Warnings...)
+	}
+
 	return &cpy
 }
 
+// RewriteConstants replaces the value of constants in the .rodata
+// section.
+//
+// The constants must be declared like so in the C program:
+//
+//    static volatile const type foobar;
+//    static volatile const type foobar = default;
+//
+// Replacement values must marshal to the same length as sizeof(type),
+// following the same rules as map values.
+//
+// Returns an error if a constant doesn't exist.
+func (cs *CollectionSpec) RewriteConstants(consts map[string]interface{}) error {
+	rodata := cs.Maps[".rodata"]
+	if rodata == nil {
+		return errors.New("missing .rodata section")
+	}
+
+	datasec, ok := rodata.Value.(*btf.Datasec)
+	if !ok {
+		return errors.New(".rodata: missing BTF")
+	}
+
+	if len(rodata.Contents) != 1 {
+		return errors.New(".rodata: expected exactly one value")
+	}
+
+	value, ok := rodata.Contents[0].Value.([]byte)
+	if !ok {
+		return errors.Errorf(".rodata: value is %T instead of []byte", rodata.Contents[0].Value)
+	}
+
+	// Modify a copy, since the contents may be shared with other
+	// specs.
+	value = append([]byte(nil), value...)
+
+	replaced := make(map[string]bool)
+	for _, vsi := range datasec.Vars {
+		v, ok := vsi.Type.(*btf.Var)
+		if !ok {
+			return errors.Errorf(".rodata: unexpected %T", vsi.Type)
+		}
+
+		replacement, ok := consts[v.Name]
+		if !ok {
+			continue
+		}
+
+		if uint64(vsi.Offset)+uint64(vsi.Size) > uint64(len(value)) {
+			return errors.Errorf(".rodata: variable %s exceeds the section", v.Name)
+		}
+
+		buf, err := marshalBytes(replacement, int(vsi.Size))
+		if err != nil {
+			return errors.Wrapf(err, "constant %s", v.Name)
+		}
+
+		copy(value[vsi.Offset:], buf)
+		replaced[v.Name] = true
+	}
+
+	var missing []string
+	for name := range consts {
+		if !replaced[name] {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return errors.Errorf("spec is missing constants: %s", strings.Join(missing, ", "))
+	}
+
+	rodata.Contents[0].Value = value
+	return nil
+}
+
+// ProgramTag calculates the tag the kernel assigns to a program of the
+// collection once it is loaded, using h as the hash.
+//
+// References to maps in the collection are treated as map loads, like
+// NewCollection does. See ProgramSpec.Tag.
+func (cs *CollectionSpec) ProgramTag(name string, h hash.Hash) (string, error) {
+	progSpec := cs.Programs[name].Copy()
+	if progSpec == nil {
+		return "", errors.Errorf("missing program %s", name)
+	}
+
+	editor := Edit(&progSpec.Instructions)
+
+	for sym := range editor.ReferenceOffsets {
+		if cs.Maps[sym] == nil {
+			continue
+		}
+
+		// The kernel ignores map fds when calculating the tag.
+		if err := editor.rewriteMapFD(sym, 0, false); err != nil {
+			return "", errors.Wrapf(err, "program %s", name)
+		}
+	}
+
+	return progSpec.Tag(h)
+}
+
 // LoadCollectionSpec parse an object file and convert it to a collection
 func LoadCollectionSpec(file string) (*CollectionSpec, error) {
+	return LoadCollectionSpecWithOptions(file, CollectionSpecOptions{})
+}
+
+// LoadCollectionSpecWithOptions parses an object file and converts it
+// to a collection.
+func LoadCollectionSpecWithOptions(file string, opts CollectionSpecOptions) (*CollectionSpec, error) {
 	f, err := os.Open(file)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	return LoadCollectionSpecFromReader(f)
+	return LoadCollectionSpecFromReaderWithOptions(f, opts)
 }
 
 // Collection is a collection of Programs and Maps associated
@@ -70,13 +224,9 @@ func NewCollection(spec *CollectionSpec) (*Collection, error) {
 //
 // Only maps referenced by at least one of the programs are initialized.
 func NewCollectionWithOptions(spec *CollectionSpec, opts CollectionOptions) (*Collection, error) {
-	maps := make(map[string]*Map)
-	for mapName, mapSpec := range spec.Maps {
-		m, err := NewMap(mapSpec)
-		if err != nil {
-			return nil, errors.Wrapf(err, "map %s", mapName)
-		}
-		maps[mapName] = m
+	maps, err := newCollectionMaps(spec.Maps, opts.Maps)
+	if err != nil {
+		return nil, err
 	}
 
 	progs := make(map[string]*Program)
@@ -93,12 +243,14 @@ func NewCollectionWithOptions(spec *CollectionSpec, opts CollectionOptions) (*Co
 
 			// don't overwrite maps already rewritten, users can rewrite programs in the spec themselves
 			if err := editor.rewriteMap(sym, m, false); err != nil {
+				closeAll(maps, progs)
 				return nil, errors.Wrapf(err, "program %s", progName)
 			}
 		}
 
 		prog, err := NewProgramWithOptions(progSpec, opts.Programs)
 		if err != nil {
+			closeAll(maps, progs)
 			return nil, errors.Wrapf(err, "program %s", progName)
 		}
 		progs[progName] = prog
@@ -110,6 +262,81 @@ func NewCollectionWithOptions(spec *CollectionSpec, opts CollectionOptions) (*Co
 	}, nil
 }
 
+// mapReference is a placeholder for a Map in MapSpec.Contents. It is
+// replaced by the map of that name when creating a Collection.
+type mapReference string
+
+// MarshalBinary implements BinaryMarshaler.
+func (mr mapReference) MarshalBinary() ([]byte, error) {
+	return nil, errors.Errorf("reference to map %s is only valid in a collection", string(mr))
+}
+
+// newCollectionMaps creates the maps in specs.
+//
+// Maps which contain references to other maps are created last.
+func newCollectionMaps(specs map[string]*MapSpec, opts MapOptions) (map[string]*Map, error) {
+	maps := make(map[string]*Map)
+
+	var pending []string
+	for name, spec := range specs {
+		if hasMapReferences(spec) {
+			pending = append(pending, name)
+			continue
+		}
+
+		m, err := NewMapWithOptions(spec, opts)
+		if err != nil {
+			closeAll(maps, nil)
+			return nil, errors.Wrapf(err, "map %s", name)
+		}
+		maps[name] = m
+	}
+
+	for _, name := range pending {
+		spec := specs[name].Copy()
+		for i, kv := range spec.Contents {
+			ref, ok := kv.Value.(mapReference)
+			if !ok {
+				continue
+			}
+
+			m := maps[string(ref)]
+			if m == nil {
+				closeAll(maps, nil)
+				return nil, errors.Errorf("map %s: reference to unknown map %s", name, string(ref))
+			}
+			spec.Contents[i].Value = m
+		}
+
+		m, err := NewMapWithOptions(spec, opts)
+		if err != nil {
+			closeAll(maps, nil)
+			return nil, errors.Wrapf(err, "map %s", name)
+		}
+		maps[name] = m
+	}
+
+	return maps, nil
+}
+
+func hasMapReferences(spec *MapSpec) bool {
+	for _, kv := range spec.Contents {
+		if _, ok := kv.Value.(mapReference); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func closeAll(maps map[string]*Map, progs map[string]*Program) {
+	for _, m := range maps {
+		m.Close()
+	}
+	for _, prog := range progs {
+		prog.Close()
+	}
+}
+
 // LoadCollection parses an object file and converts it to a collection.
 func LoadCollection(file string) (*Collection, error) {
 	spec, err := LoadCollectionSpec(file)
@@ -153,3 +153,63 @@ func TestCollectionSpecOverwriteMaps(t *testing.T) {
 		t.Fatal("new / override map not used")
 	}
 }
+
+func TestCollectionSpecProgramTag(t *testing.T) {
+	mapLoad := asm.LoadImm(asm.R1, 0, asm.DWord)
+	mapLoad.Reference = "my-map"
+
+	constLoad := asm.LoadImm(asm.R2, 0, asm.DWord)
+	constLoad.Reference = "my-const"
+
+	cs := CollectionSpec{
+		Maps: map[string]*MapSpec{
+			"my-map": {
+				Type:       Array,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 1,
+			},
+		},
+		Programs: map[string]*ProgramSpec{
+			"test": {
+				Type: SocketFilter,
+				Instructions: asm.Instructions{
+					mapLoad,
+					constLoad,
+					asm.LoadImm(asm.R0, 0, asm.DWord),
+					asm.Return(),
+				},
+				License: "MIT",
+			},
+		},
+	}
+
+	have, err := cs.ProgramTag("test", TagHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := (&ProgramSpec{
+		Instructions: asm.Instructions{
+			asm.LoadMapPtr(asm.R1, 0),
+			asm.LoadImm(asm.R2, 0, asm.DWord),
+			asm.LoadImm(asm.R0, 0, asm.DWord),
+			asm.Return(),
+		},
+	}).Tag(TagHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have != want {
+		t.Errorf("Expected tag %s, got %s", want, have)
+	}
+
+	if cs.Programs["test"].Instructions[0].Src != asm.R0 {
+		t.Error("ProgramTag modifies the spec")
+	}
+
+	if _, err := cs.ProgramTag("bogus", TagHash()); err == nil {
+		t.Error("ProgramTag accepts a missing program")
+	}
+}
@@ -31,16 +31,20 @@ func (ed *Editor) RewriteMap(symbol string, m *Map) error {
 }
 
 func (ed *Editor) rewriteMap(symbol string, m *Map, overwrite bool) error {
-	indices := ed.ReferenceOffsets[symbol]
-	if len(indices) == 0 {
-		return &unreferencedSymbolError{symbol}
-	}
-
 	fd, err := m.fd.value()
 	if err != nil {
 		return err
 	}
 
+	return ed.rewriteMapFD(symbol, fd, overwrite)
+}
+
+func (ed *Editor) rewriteMapFD(symbol string, fd uint32, overwrite bool) error {
+	indices := ed.ReferenceOffsets[symbol]
+	if len(indices) == 0 {
+		return &unreferencedSymbolError{symbol}
+	}
+
 	loadOp := asm.LoadImmOp(asm.DWord)
 
 	for _, index := range indices {
@@ -49,17 +53,33 @@ func (ed *Editor) rewriteMap(symbol string, m *Map, overwrite bool) error {
 			return errors.Errorf("symbol %v: missing load instruction", symbol)
 		}
 
+		if load.Src == pseudoMapValue {
+			// The upper half of the constant holds the offset
+			// into the map value, which must be preserved.
+			if !overwrite && uint32(load.Constant) != 0 {
+				return nil
+			}
+
+			load.Constant = int64(uint64(load.Constant)>>32<<32 | uint64(fd))
+			continue
+		}
+
 		if !overwrite && load.Constant != 0 {
 			return nil
 		}
 
-		load.Src = 1
+		load.Src = pseudoMapFD
 		load.Constant = int64(fd)
 	}
 
 	return nil
 }
 
+const (
+	pseudoMapFD    = asm.R1 // BPF_PSEUDO_MAP_FD
+	pseudoMapValue = asm.R2 // BPF_PSEUDO_MAP_VALUE
+)
+
 // RewriteConstant rewrites all loads of a symbol to a constant value.
 //
 // This is a way to parameterize clang-compiled eBPF byte code at load
@@ -2,24 +2,65 @@ package ebpf
 
 import (
 	"bytes"
+	"crypto/sha1"
 	"debug/elf"
 	"encoding/binary"
+	"encoding/hex"
+	"fmt"
 	"io"
+	"math"
 	"strings"
 
 	"github.com/newtools/ebpf/asm"
+	"github.com/newtools/ebpf/btf"
 
 	"github.com/pkg/errors"
 )
 
 type elfCode struct {
 	*elf.File
-	symtab *symtab
+	symtab       *symtab
+	btf          *btf.Spec
+	opts         CollectionSpecOptions
+	dataSections map[int]*elf.Section
+	mapSections  map[int]*elf.Section
+	progSections map[int]*elf.Section
+	// Offsets of variables in the .kconfig map.
+	kconfig map[string]uint64
+	// Addresses of variables in .ksyms.
+	ksyms map[string]uint64
+	// Symbols generated by LabelJumps, which are removed again once
+	// programs are linked.
+	labels map[string]bool
+	// The raw ELF and its SHA-1, see objectHash.
+	code io.ReaderAt
+	hash string
 }
 
 // LoadCollectionSpecFromReader parses an io.ReaderAt that represents an ELF layout
 // into a CollectionSpec.
 func LoadCollectionSpecFromReader(code io.ReaderAt) (*CollectionSpec, error) {
+	return LoadCollectionSpecFromReaderWithOptions(code, CollectionSpecOptions{})
+}
+
+// LoadCollectionSpecFromReaderWithOptions parses an io.ReaderAt that
+// represents an ELF layout into a CollectionSpec.
+//
+// CO-RE relocations are applied to the instructions of each program,
+// and extern variables in .kconfig and .ksyms are resolved against the
+// running kernel.
+func LoadCollectionSpecFromReaderWithOptions(code io.ReaderAt, opts CollectionSpecOptions) (*CollectionSpec, error) {
+	obj, err := loadObject("", code, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return linkObjects([]*elfObject{obj}, opts)
+}
+
+// loadObject parses an ELF into maps and functions. The functions still
+// have to be linked into programs, see linkObjects.
+func loadObject(name string, code io.ReaderAt, opts CollectionSpecOptions) (*elfObject, error) {
 	f, err := elf.NewFile(code)
 	if err != nil {
 		return nil, err
@@ -31,10 +72,25 @@ func LoadCollectionSpecFromReader(code io.ReaderAt) (*CollectionSpec, error) {
 		return nil, errors.Wrap(err, "load symbols")
 	}
 
-	ec := &elfCode{f, newSymtab(symbols)}
+	btfSpec, err := btf.LoadSpecFromReader(code)
+	if err != nil && err != btf.ErrNotFound {
+		return nil, errors.Wrap(err, "load BTF")
+	}
+
+	ec := &elfCode{
+		File:         f,
+		symtab:       newSymtab(symbols),
+		btf:          btfSpec,
+		opts:         opts,
+		code:         code,
+		dataSections: make(map[int]*elf.Section),
+		mapSections:  make(map[int]*elf.Section),
+		progSections: make(map[int]*elf.Section),
+		labels:       make(map[string]bool),
+	}
 
-	var licenseSection, versionSection *elf.Section
-	progSections := make(map[int]*elf.Section)
+	var licenseSection, versionSection, btfMapSection *elf.Section
+	progSections := ec.progSections
 	relSections := make(map[int]*elf.Section)
 	mapSections := make(map[int]*elf.Section)
 	for i, sec := range ec.Sections {
@@ -45,7 +101,13 @@ func LoadCollectionSpecFromReader(code io.ReaderAt) (*CollectionSpec, error) {
 			versionSection = sec
 		case strings.HasPrefix(sec.Name, "maps"):
 			mapSections[i] = sec
-		case sec.Type == elf.SHT_REL:
+			ec.mapSections[i] = sec
+		case sec.Name == ".maps":
+			btfMapSection = sec
+			ec.mapSections[i] = sec
+		case isDataSection(sec):
+			ec.dataSections[i] = sec
+		case sec.Type == elf.SHT_REL || sec.Type == elf.SHT_RELA:
 			if int(sec.Info) >= len(ec.Sections) {
 				return nil, errors.Errorf("found relocation section %v for missing section %v", i, sec.Info)
 			}
@@ -71,26 +133,157 @@ func LoadCollectionSpecFromReader(code io.ReaderAt) (*CollectionSpec, error) {
 		return nil, errors.Wrap(err, "load version")
 	}
 
+	if version == MagicKernelVersion {
+		version, err = ec.kernelVersion()
+		if err != nil {
+			return nil, errors.Wrap(err, "load version")
+		}
+	}
+
 	maps, err := ec.loadMaps(mapSections)
 	if err != nil {
 		return nil, errors.Wrap(err, "load maps")
 	}
 
-	progs, libs, err := ec.loadPrograms(progSections, relSections, license, version)
-	if err != nil {
+	if err := ec.loadMapTypes(maps); err != nil {
+		return nil, errors.Wrap(err, "load map types")
+	}
+
+	if btfMapSection != nil {
+		if err := ec.loadBTFMaps(maps); err != nil {
+			return nil, errors.Wrap(err, "load BTF maps")
+		}
+	}
+
+	if err := ec.loadDataSections(maps); err != nil {
+		return nil, errors.Wrap(err, "load data sections")
+	}
+
+	if err := ec.loadExterns(maps); err != nil {
+		return nil, errors.Wrap(err, "load externs")
+	}
+
+	obj := &elfObject{
+		name:      name,
+		maps:      maps,
+		dataMaps:  make(map[string]bool),
+		localMaps: make(map[string]bool),
+		btf:       ec.btf,
+		weak:      make(map[string]bool),
+		sections:  make(map[string]string),
+		ksyms:     ec.ksyms,
+		labels:    ec.labels,
+	}
+
+	if err := ec.loadPrograms(obj, progSections, relSections, license, version); err != nil {
 		return nil, errors.Wrap(err, "load programs")
 	}
 
-	if len(libs) > 0 {
-		for name, prog := range progs {
-			editor := Edit(&prog.Instructions)
-			if err := editor.Link(libs...); err != nil {
-				return nil, errors.Wrapf(err, "program %s", name)
+	if maps[kconfigSection] != nil {
+		obj.dataMaps[kconfigSection] = true
+	}
+	for _, sec := range ec.dataSections {
+		obj.dataMaps[sec.Name] = true
+	}
+
+	for _, sym := range ec.symtab.Symbols {
+		sec := ec.progSections[int(sym.Section)]
+		if sec == nil {
+			sec = ec.mapSections[int(sym.Section)]
+		}
+		if sec == nil || sym.Name == "" {
+			continue
+		}
+
+		obj.sections[sym.Name] = sec.Name
+		switch elf.ST_BIND(sym.Info) {
+		case elf.STB_WEAK:
+			obj.weak[sym.Name] = true
+		case elf.STB_LOCAL:
+			if maps[sym.Name] != nil {
+				obj.localMaps[sym.Name] = true
 			}
 		}
 	}
 
-	return &CollectionSpec{maps, progs}, nil
+	obj.warnings, err = ec.ignoredSections(relSections)
+	if err != nil {
+		return nil, errors.Wrap(err, "find ignored sections")
+	}
+
+	return obj, nil
+}
+
+// ELFWarning describes a part of an ELF which was ignored while loading
+// it into a CollectionSpec.
+type ELFWarning struct {
+	// Object is the name of the ELF, if the spec was linked from
+	// multiple objects.
+	Object string
+	// Section is the name of the section the warning refers to.
+	Section string
+	// Symbol is the name of the affected program, map or symbol, if
+	// any.
+	Symbol  string
+	Message string
+}
+
+func (w *ELFWarning) Error() string {
+	msg := fmt.Sprintf("section %s: %s", w.Section, w.Message)
+	if w.Symbol != "" {
+		msg = fmt.Sprintf("section %s: %s: %s", w.Section, w.Symbol, w.Message)
+	}
+
+	if w.Object != "" {
+		return w.Object + ": " + msg
+	}
+	return msg
+}
+
+// ignoredSections returns the executable sections whose name isn't a
+// known program type, and the relocations in sections which don't
+// contain programs.
+//
+// Unused maps and unresolved references are only known once the ELF is
+// linked, see linkWarnings.
+func (ec *elfCode) ignoredSections(relSections map[int]*elf.Section) ([]ELFWarning, error) {
+	sections, err := ec.programSections()
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []ELFWarning
+	for _, sec := range ec.progSections {
+		if sec.Name == ".text" {
+			continue
+		}
+
+		if progType, _ := getProgType(sections, sec.Name); progType == Unrecognized {
+			warnings = append(warnings, ELFWarning{
+				Section: sec.Name,
+				Message: "executable section with unknown program type",
+			})
+		}
+	}
+
+	for idx, rels := range relSections {
+		sec := ec.dataSections[idx]
+		if sec == nil {
+			sec = ec.mapSections[idx]
+		}
+		if sec == nil {
+			// Relocations for programs are applied, and those for
+			// debug info aren't needed.
+			continue
+		}
+
+		warnings = append(warnings, ELFWarning{
+			Section: rels.Name,
+			Message: fmt.Sprintf("relocations for %s are not supported", sec.Name),
+		})
+	}
+
+	return warnings, nil
 }
 
 func loadLicense(sec *elf.Section) (string, error) {
@@ -114,50 +307,205 @@ func loadVersion(sec *elf.Section, bo binary.ByteOrder) (uint32, error) {
 	return version, errors.Wrapf(err, "section %s", sec.Name)
 }
 
-func (ec *elfCode) loadPrograms(progSections, relSections map[int]*elf.Section, license string, version uint32) (map[string]*ProgramSpec, []asm.Instructions, error) {
-	progs := make(map[string]*ProgramSpec)
-	var libs []asm.Instructions
-	for idx, prog := range progSections {
-		funcSym := ec.symtab.forSectionOffset(idx, 0)
-		if funcSym == nil {
-			return nil, nil, errors.Errorf("section %v: no label at start", prog.Name)
-		}
+// kernelVersion returns the version of the kernel the ELF is loaded
+// for, which is the running kernel unless the options override it.
+func (ec *elfCode) kernelVersion() (uint32, error) {
+	if ec.opts.KernelVersion != 0 {
+		return ec.opts.KernelVersion, nil
+	}
+	return kernelVersion()
+}
 
-		var insns asm.Instructions
-		offsets, err := insns.Unmarshal(prog.Open(), ec.ByteOrder)
-		if err != nil {
-			return nil, nil, errors.Wrapf(err, "program %s", funcSym.Name)
-		}
+// loadPrograms decodes the functions in executable sections into obj.
+//
+// Each global function in a section with a recognized name is a program.
+// Other functions, like those in .text or static functions, can only be
+// called from programs. The instructions of programs don't contain the
+// functions they call until they are linked.
+func (ec *elfCode) loadPrograms(obj *elfObject, progSections, relSections map[int]*elf.Section, license string, version uint32) error {
+	sections, err := ec.programSections()
+	if err != nil {
+		return err
+	}
+
+	obj.funcs = make(map[string]asm.Instructions)
+	obj.globals = make(map[string]bool)
+	obj.funcTypes = make(map[string]*btf.Func)
 
-		err = assignSymbols(ec.symtab.forSection(idx), offsets, insns)
+	for idx, sec := range progSections {
+		insns, err := ec.loadSection(idx, sec, relSections[idx])
 		if err != nil {
-			return nil, nil, errors.Wrapf(err, "program %s", funcSym.Name)
+			return errors.Wrapf(err, "section %s", sec.Name)
 		}
 
-		if rels := relSections[idx]; rels != nil {
-			err = ec.applyRelocations(insns, rels, offsets)
-			if err != nil {
-				return nil, nil, errors.Wrapf(err, "program %s: section %s", funcSym.Name, rels.Name)
+		progType, attachType := getProgType(sections, sec.Name)
+
+		for _, fn := range splitFunctions(insns, ec.functionSymbols(idx)) {
+			name := fn.insns[0].Symbol
+			if obj.funcs[name] != nil {
+				return errors.Errorf("section %s: function %s already exists", sec.Name, name)
+			}
+			obj.funcs[name] = fn.insns
+			obj.globals[name] = fn.global
+			if typ := ec.funcType(name); typ != nil {
+				obj.funcTypes[name] = typ
 			}
-		}
 
-		if progType, attachType := getProgType(prog.Name); progType == Unrecognized {
-			// There is no single name we can use for "library" sections,
-			// since they may contain multiple functions. We'll decode the
-			// labels they contain later on, and then link sections that way.
-			libs = append(libs, insns)
-		} else {
-			progs[funcSym.Name] = &ProgramSpec{
-				Name:          funcSym.Name,
+			if progType == Unrecognized || !fn.global {
+				continue
+			}
+
+			obj.progs = append(obj.progs, &ProgramSpec{
+				Name:          name,
 				Type:          progType,
 				AttachType:    attachType,
 				License:       license,
 				KernelVersion: version,
-				Instructions:  insns,
+				Instructions:  fn.insns,
+				BTF:           ec.btf,
+			})
+		}
+	}
+
+	return nil
+}
+
+// funcType returns the BTF of a function, or nil if there is none.
+func (ec *elfCode) funcType(name string) *btf.Func {
+	if ec.btf == nil {
+		return nil
+	}
+
+	types, err := ec.btf.TypesByName(name)
+	if err != nil {
+		return nil
+	}
+
+	for _, typ := range types {
+		if fn, ok := typ.(*btf.Func); ok {
+			return fn
+		}
+	}
+	return nil
+}
+
+// programSections returns the section conventions given in the options,
+// followed by the built-in ones.
+func (ec *elfCode) programSections() ([]ProgramSection, error) {
+	sections := make([]ProgramSection, 0, len(ec.opts.Sections)+len(programSections))
+	for _, section := range ec.opts.Sections {
+		if section.Prefix == "" {
+			return nil, errors.Errorf("program section for %s has an empty prefix", section.Type)
+		}
+		sections = append(sections, section)
+	}
+	return append(sections, programSections...), nil
+}
+
+// loadSection decodes the instructions of an executable section, and
+// applies relocations to them.
+func (ec *elfCode) loadSection(idx int, sec, rels *elf.Section) (asm.Instructions, error) {
+	if ec.symtab.forSectionOffset(idx, 0) == nil {
+		return nil, errors.New("no label at start")
+	}
+
+	var insns asm.Instructions
+	offsets, err := insns.Unmarshal(sec.Open(), ec.ByteOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	err = assignSymbols(ec.symtab.forSection(idx), offsets, insns)
+	if err != nil {
+		return nil, err
+	}
+
+	if ec.btf != nil {
+		if err := ec.btf.AssignLineInfo(sec.Name, insns, offsets); err != nil {
+			return nil, err
+		}
+	}
+
+	if rels != nil {
+		err = ec.applyRelocations(insns, rels, offsets)
+		if err != nil {
+			return nil, errors.Wrapf(err, "section %s", rels.Name)
+		}
+	}
+
+	if len(ec.ksyms) > 0 {
+		editor := Edit(&insns)
+		for name, addr := range ec.ksyms {
+			if err := editor.RewriteConstant(name, addr); err != nil && !IsUnreferencedSymbol(err) {
+				return nil, err
+			}
+		}
+	}
+
+	// Make jumps independent of their position, so that the
+	// section can be split into functions and relocated.
+	symbols, err := insns.SymbolOffsets()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := insns.LabelJumps(); err != nil {
+		return nil, err
+	}
+
+	for _, ins := range insns {
+		if _, ok := symbols[ins.Symbol]; ins.Symbol != "" && !ok {
+			ec.labels[ins.Symbol] = true
+		}
+	}
+
+	if ec.btf != nil && ec.btf.HasCORERelocations(sec.Name) {
+		target, err := ec.coreTarget()
+		if err != nil {
+			return nil, err
+		}
+
+		// Relocations may change the number of raw instructions,
+		// which is why jumps have to be labelled first.
+		if err := ec.btf.CORERelocate(sec.Name, insns, offsets, target); err != nil {
+			return nil, errors.Wrap(err, "CO-RE")
+		}
+	}
+
+	return insns, nil
+}
+
+// functionSymbols returns the symbols in an executable section which
+// mark the start of a function, and whether the function is global.
+//
+// Older versions of LLVM don't tag functions with STT_FUNC. Global
+// symbols without a type are assumed to be functions in that case.
+func (ec *elfCode) functionSymbols(idx int) map[string]bool {
+	symbols := make(map[string]bool)
+	for _, sym := range ec.symtab.forSection(idx) {
+		bind := elf.ST_BIND(sym.Info)
+		global := bind == elf.STB_GLOBAL || bind == elf.STB_WEAK
+
+		switch elf.ST_TYPE(sym.Info) {
+		case elf.STT_FUNC:
+			symbols[sym.Name] = global
+		case elf.STT_NOTYPE:
+			if global {
+				symbols[sym.Name] = true
 			}
 		}
 	}
-	return progs, libs, nil
+	return symbols
+}
+
+// coreTarget returns the BTF that CO-RE relocations are resolved against.
+func (ec *elfCode) coreTarget() (*btf.Spec, error) {
+	if ec.opts.TargetBTF != nil {
+		return ec.opts.TargetBTF, nil
+	}
+
+	spec, err := btf.LoadKernelSpec()
+	return spec, errors.Wrap(err, "load kernel BTF")
 }
 
 func (ec *elfCode) loadMaps(mapSections map[int]*elf.Section) (map[string]*MapSpec, error) {
@@ -179,6 +527,13 @@ func (ec *elfCode) loadMaps(mapSections map[int]*elf.Section) (map[string]*MapSp
 		}
 
 		size := len(data) / n
+		if size == binary.Size(bpfElfMap{}) {
+			if err := ec.loadIproute2Maps(maps, idx, data, n); err != nil {
+				return nil, errors.Wrapf(err, "section %v", sec.Name)
+			}
+			continue
+		}
+
 		var ordered []*MapSpec
 		for i := 0; i < n; i++ {
 			rd := bytes.NewReader(data[i*size : i*size+size])
@@ -192,7 +547,7 @@ func (ec *elfCode) loadMaps(mapSections map[int]*elf.Section) (map[string]*MapSp
 				return nil, errors.Errorf("section %v: map %v already exists", sec.Name, name)
 			}
 
-			var spec MapSpec
+			spec := MapSpec{Name: name}
 			var inner uint32
 			switch {
 			case binary.Read(rd, ec.ByteOrder, &spec.Type) != nil:
@@ -238,75 +593,573 @@ func (ec *elfCode) loadMaps(mapSections map[int]*elf.Section) (map[string]*MapSp
 	return maps, nil
 }
 
-func getProgType(v string) (ProgType, AttachType) {
-	types := map[string]ProgType{
-		// From https://git.kernel.org/pub/scm/linux/kernel/git/torvalds/linux.git/tree/tools/lib/bpf/libbpf.c#n3568
-		"socket":         SocketFilter,
-		"seccomp":        SocketFilter,
-		"kprobe/":        Kprobe,
-		"kretprobe/":     Kprobe,
-		"tracepoint/":    TracePoint,
-		"xdp":            XDP,
-		"perf_event":     PerfEvent,
-		"sockops":        SockOps,
-		"sk_skb":         SkSKB,
-		"sk_msg":         SkMsg,
-		"lirc_mode2":     LircMode2,
-		"flow_dissector": FlowDissector,
-
-		"cgroup_skb/":       CGroupSKB,
-		"cgroup/dev":        CGroupDevice,
-		"cgroup/skb":        CGroupSKB,
-		"cgroup/sock":       CGroupSock,
-		"cgroup/post_bind":  CGroupSock,
-		"cgroup/bind":       CGroupSockAddr,
-		"cgroup/connect":    CGroupSockAddr,
-		"cgroup/sendmsg":    CGroupSockAddr,
-		"cgroup/recvmsg":    CGroupSockAddr,
-		"cgroup/sysctl":     CGroupSysctl,
-		"cgroup/getsockopt": CGroupSockopt,
-		"cgroup/setsockopt": CGroupSockopt,
-		"classifier":        SchedCLS,
-		"action":            SchedACT,
-	}
-	attachTypes := map[string]AttachType{
-		"cgroup_skb/ingress":    AttachCGroupInetIngress,
-		"cgroup_skb/egress":     AttachCGroupInetEgress,
-		"cgroup/sock":           AttachCGroupInetSockCreate,
-		"cgroup/post_bind4":     AttachCGroupInet4PostBind,
-		"cgroup/post_bind6":     AttachCGroupInet6PostBind,
-		"cgroup/dev":            AttachCGroupDevice,
-		"sockops":               AttachCGroupSockOps,
-		"sk_skb/stream_parser":  AttachSkSKBStreamParser,
-		"sk_skb/stream_verdict": AttachSkSKBStreamVerdict,
-		"sk_msg":                AttachSkSKBStreamVerdict,
-		"lirc_mode2":            AttachLircMode2,
-		"flow_dissector":        AttachFlowDissector,
-		"cgroup/bind4":          AttachCGroupInet4Bind,
-		"cgroup/bind6":          AttachCGroupInet6Bind,
-		"cgroup/connect4":       AttachCGroupInet4Connect,
-		"cgroup/connect6":       AttachCGroupInet6Connect,
-		"cgroup/sendmsg4":       AttachCGroupUDP4Sendmsg,
-		"cgroup/sendmsg6":       AttachCGroupUDP6Sendmsg,
-		"cgroup/recvmsg4":       AttachCGroupUDP4Recvmsg,
-		"cgroup/recvmsg6":       AttachCGroupUDP6Recvmsg,
-		"cgroup/sysctl":         AttachCGroupSysctl,
-		"cgroup/getsockopt":     AttachCGroupGetsockopt,
-		"cgroup/setsockopt":     AttachCGroupSetsockopt,
-	}
-	attachType := AttachNone
-	for k, t := range attachTypes {
-		if strings.HasPrefix(v, k) {
-			attachType = t
-		}
-	}
-
-	for k, t := range types {
-		if strings.HasPrefix(v, k) {
-			return t, attachType
-		}
-	}
-	return Unrecognized, AttachNone
+// bpfElfMap is struct bpf_elf_map, the map definition used by iproute2.
+type bpfElfMap struct {
+	Type       MapType
+	KeySize    uint32
+	ValueSize  uint32
+	MaxEntries uint32
+	Flags      uint32
+	ID         uint32
+	Pinning    uint32
+	InnerID    uint32
+	InnerIdx   uint32
+}
+
+// Values of bpf_elf_map.pinning.
+const (
+	iproute2PinNone     = 0
+	iproute2PinObjectNS = 1
+	iproute2PinGlobalNS = 2
+)
+
+// iproute2NoInnerIdx prevents an inner map from being inserted into
+// its outer map.
+const iproute2NoInnerIdx = math.MaxUint32
+
+// loadIproute2Maps loads n map definitions of type struct bpf_elf_map.
+//
+// Maps of maps use the map whose id matches their inner_id as a
+// template. Unless its inner_idx is iproute2NoInnerIdx, the template is
+// also inserted into the outer map at that index.
+func (ec *elfCode) loadIproute2Maps(maps map[string]*MapSpec, idx int, data []byte, n int) error {
+	var (
+		size  = len(data) / n
+		defs  = make(map[string]bpfElfMap)
+		byID  = make(map[uint32]string)
+		names []string
+	)
+
+	for i := 0; i < n; i++ {
+		mapSym := ec.symtab.forSectionOffset(idx, uint64(i*size))
+		if mapSym == nil {
+			return errors.Errorf("missing symbol for map #%d", i)
+		}
+
+		name := mapSym.Name
+		if maps[name] != nil {
+			return errors.Errorf("map %v already exists", name)
+		}
+
+		var def bpfElfMap
+		if err := binary.Read(bytes.NewReader(data[i*size:]), ec.ByteOrder, &def); err != nil {
+			return errors.Wrapf(err, "map %v", name)
+		}
+
+		spec := &MapSpec{
+			Name:       name,
+			Type:       def.Type,
+			KeySize:    def.KeySize,
+			ValueSize:  def.ValueSize,
+			MaxEntries: def.MaxEntries,
+			Flags:      def.Flags,
+		}
+
+		switch def.Pinning {
+		case iproute2PinNone:
+		case iproute2PinObjectNS:
+			hash, err := ec.objectHash()
+			if err != nil {
+				return errors.Wrapf(err, "map %v", name)
+			}
+			spec.Pinning = PinObjectNS
+			spec.PinNamespace = hash
+		case iproute2PinGlobalNS:
+			spec.Pinning = PinGlobalNS
+		default:
+			return errors.Errorf("map %v: unsupported pinning %d", name, def.Pinning)
+		}
+
+		if def.ID != 0 {
+			if other, ok := byID[def.ID]; ok {
+				return errors.Errorf("maps %v and %v have the same id %d", other, name, def.ID)
+			}
+			byID[def.ID] = name
+		}
+
+		maps[name] = spec
+		defs[name] = def
+		names = append(names, name)
+	}
+
+	for _, name := range names {
+		def, spec := defs[name], maps[name]
+		if spec.Type != ArrayOfMaps && spec.Type != HashOfMaps {
+			if def.InnerID != 0 {
+				return errors.Errorf("map %v: inner_id requires a map of maps", name)
+			}
+			continue
+		}
+
+		innerName, ok := byID[def.InnerID]
+		if !ok {
+			return errors.Errorf("map %v: no map with inner_id %d", name, def.InnerID)
+		}
+
+		innerSpec := maps[innerName]
+		if innerSpec.Type == ArrayOfMaps || innerSpec.Type == HashOfMaps {
+			return errors.Errorf("map %v: can't nest map of map", name)
+		}
+
+		spec.InnerMap = innerSpec.Copy()
+		if innerIdx := defs[innerName].InnerIdx; innerIdx != iproute2NoInnerIdx {
+			spec.Contents = append(spec.Contents, MapKV{innerIdx, mapReference(innerName)})
+		}
+	}
+
+	return nil
+}
+
+// objectHash returns the hex encoded SHA-1 of the ELF, which is used by
+// iproute2 to namespace pinned maps.
+func (ec *elfCode) objectHash() (string, error) {
+	if ec.hash != "" {
+		return ec.hash, nil
+	}
+
+	h := sha1.New()
+	if _, err := io.Copy(h, io.NewSectionReader(ec.code, 0, math.MaxInt64)); err != nil {
+		return "", errors.Wrap(err, "can't hash object")
+	}
+
+	ec.hash = hex.EncodeToString(h.Sum(nil))
+	return ec.hash, nil
+}
+
+// loadMapTypes attaches BTF to the key and value of maps.
+//
+// The types are taken from a struct ____btf_map_<name> with members
+// key and value, as emitted by the BPF_ANNOTATE_KV_PAIR macro.
+func (ec *elfCode) loadMapTypes(maps map[string]*MapSpec) error {
+	if ec.btf == nil {
+		return nil
+	}
+
+	for name, spec := range maps {
+		types, err := ec.btf.TypesByName("____btf_map_" + name)
+		if errors.Cause(err) == btf.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		def, ok := types[0].(*btf.Struct)
+		if !ok {
+			return errors.Errorf("map %s: annotation is %T instead of a struct", name, types[0])
+		}
+
+		for _, member := range def.Members {
+			switch member.Name {
+			case "key":
+				spec.Key = member.Type
+			case "value":
+				spec.Value = member.Type
+			}
+		}
+
+		if spec.Key == nil || spec.Value == nil {
+			return errors.Errorf("map %s: annotation lacks key or value", name)
+		}
+	}
+
+	return nil
+}
+
+// loadBTFMaps parses the map definitions in the .maps section.
+//
+// Each map is a variable of an anonymous struct, whose members encode
+// the attributes of the map in their types.
+func (ec *elfCode) loadBTFMaps(maps map[string]*MapSpec) error {
+	if ec.btf == nil {
+		return errors.New("missing BTF")
+	}
+
+	sec, err := ec.btf.Datasec(".maps")
+	if err != nil {
+		return err
+	}
+
+	for _, vs := range sec.Vars {
+		v, ok := vs.Type.(*btf.Var)
+		if !ok {
+			return errors.Errorf("section .maps: unexpected %T", vs.Type)
+		}
+
+		name := v.Name
+		if maps[name] != nil {
+			return errors.Errorf("section .maps: map %v already exists", name)
+		}
+
+		def, ok := btf.UnderlyingType(v.Type).(*btf.Struct)
+		if !ok {
+			return errors.Errorf("map %v: definition is not a struct", name)
+		}
+
+		spec, err := mapSpecFromBTF(name, def, false)
+		if err != nil {
+			return errors.Wrapf(err, "map %v", name)
+		}
+
+		maps[name] = spec
+	}
+
+	return nil
+}
+
+// mapSpecFromBTF decodes a map definition declared with the __uint,
+// __type and __array macros.
+func mapSpecFromBTF(name string, def *btf.Struct, inner bool) (*MapSpec, error) {
+	var (
+		spec = &MapSpec{Name: name}
+		// Map values are decoded once the type of the map is known.
+		values *btf.Array
+		err    error
+	)
+
+	for _, member := range def.Members {
+		var size uint32
+
+		switch member.Name {
+		case "type":
+			var typ uint32
+			typ, err = uintFromBTF(member.Type)
+			spec.Type = MapType(typ)
+
+		case "map_flags":
+			spec.Flags, err = uintFromBTF(member.Type)
+
+		case "max_entries":
+			spec.MaxEntries, err = uintFromBTF(member.Type)
+
+		case "key_size":
+			if size, err = uintFromBTF(member.Type); err == nil {
+				err = spec.setKeySize(size)
+			}
+
+		case "value_size":
+			if size, err = uintFromBTF(member.Type); err == nil {
+				err = spec.setValueSize(size)
+			}
+
+		case "key":
+			if spec.Key, size, err = typeFromBTF(member.Type); err == nil {
+				err = spec.setKeySize(size)
+			}
+
+		case "value":
+			if spec.Value, size, err = typeFromBTF(member.Type); err == nil {
+				err = spec.setValueSize(size)
+			}
+
+		case "values":
+			var ok bool
+			values, ok = member.Type.(*btf.Array)
+			if !ok {
+				err = errors.Errorf("values is %T instead of an array", member.Type)
+			}
+
+		case "pinning":
+			if inner {
+				return nil, errors.New("inner maps can't be pinned")
+			}
+
+			var pinning uint32
+			pinning, err = uintFromBTF(member.Type)
+			spec.Pinning = PinType(pinning)
+			if err == nil && spec.Pinning > PinByName {
+				err = errors.Errorf("unsupported pin type %d", pinning)
+			}
+
+		default:
+			return nil, errors.Errorf("unrecognized field %s", member.Name)
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "field %s", member.Name)
+		}
+	}
+
+	if values != nil {
+		if spec.Type != ArrayOfMaps && spec.Type != HashOfMaps {
+			return nil, errors.Errorf("values aren't supported for %s", spec.Type)
+		}
+
+		if inner {
+			return nil, errors.New("can't nest map of map")
+		}
+
+		ptr, ok := values.Type.(*btf.Pointer)
+		if !ok {
+			return nil, errors.Errorf("values is an array of %T instead of pointers", values.Type)
+		}
+
+		innerDef, ok := btf.UnderlyingType(ptr.Target).(*btf.Struct)
+		if !ok {
+			return nil, errors.New("inner map definition is not a struct")
+		}
+
+		spec.InnerMap, err = mapSpecFromBTF("", innerDef, true)
+		if err != nil {
+			return nil, errors.Wrap(err, "inner map")
+		}
+	}
+
+	return spec, nil
+}
+
+func (ms *MapSpec) setKeySize(size uint32) error {
+	if ms.KeySize != 0 && ms.KeySize != size {
+		return errors.Errorf("key size %d conflicts with %d", size, ms.KeySize)
+	}
+	ms.KeySize = size
+	return nil
+}
+
+func (ms *MapSpec) setValueSize(size uint32) error {
+	if ms.ValueSize != 0 && ms.ValueSize != size {
+		return errors.Errorf("value size %d conflicts with %d", size, ms.ValueSize)
+	}
+	ms.ValueSize = size
+	return nil
+}
+
+// uintFromBTF decodes the __uint macro, which is a pointer to an array
+// with as many elements as the value. For int (*foo)[10] it returns 10.
+func uintFromBTF(typ btf.Type) (uint32, error) {
+	ptr, ok := typ.(*btf.Pointer)
+	if !ok {
+		return 0, errors.Errorf("%T is not a pointer", typ)
+	}
+
+	arr, ok := ptr.Target.(*btf.Array)
+	if !ok {
+		return 0, errors.Errorf("%T is not a pointer to an array", typ)
+	}
+
+	return arr.Nelems, nil
+}
+
+// typeFromBTF decodes the __type macro, which is a pointer to the type.
+// It returns the type and its size.
+func typeFromBTF(typ btf.Type) (btf.Type, uint32, error) {
+	ptr, ok := typ.(*btf.Pointer)
+	if !ok {
+		return nil, 0, errors.Errorf("%T is not a pointer", typ)
+	}
+
+	size, err := btf.Sizeof(ptr.Target)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return ptr.Target, uint32(size), nil
+}
+
+// isDataSection returns true for sections which contain global
+// variables, like .data, .rodata.str1.1 or .bss.
+func isDataSection(sec *elf.Section) bool {
+	if sec.Flags&elf.SHF_ALLOC == 0 || sec.Flags&elf.SHF_EXECINSTR != 0 {
+		return false
+	}
+
+	for _, prefix := range []string{".data", ".rodata", ".bss"} {
+		if sec.Name == prefix || strings.HasPrefix(sec.Name, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// loadDataSections turns each data section into an array with a single
+// entry, which holds the contents of the section.
+//
+// Read-only sections are frozen after creation, and can't be modified
+// by eBPF programs.
+func (ec *elfCode) loadDataSections(maps map[string]*MapSpec) error {
+	for _, sec := range ec.dataSections {
+		if maps[sec.Name] != nil {
+			return errors.Errorf("section %s: map %s already exists", sec.Name, sec.Name)
+		}
+
+		if sec.Size == 0 {
+			// Empty arrays can't be created. Nothing can refer to
+			// an empty section either.
+			continue
+		}
+
+		if sec.Size > math.MaxUint32 {
+			return errors.Errorf("section %s: too large", sec.Name)
+		}
+
+		spec := &MapSpec{
+			Name:       sec.Name,
+			Type:       Array,
+			KeySize:    4,
+			ValueSize:  uint32(sec.Size),
+			MaxEntries: 1,
+		}
+
+		if sec.Type != elf.SHT_NOBITS {
+			data, err := sec.Data()
+			if err != nil {
+				return errors.Wrapf(err, "section %s", sec.Name)
+			}
+			spec.Contents = []MapKV{{uint32(0), data}}
+		}
+
+		if strings.HasPrefix(sec.Name, ".rodata") {
+			spec.Flags = bpfFRdOnlyProg
+			spec.Freeze = true
+		}
+
+		if ec.btf != nil {
+			datasec, err := ec.btf.Datasec(sec.Name)
+			if err != nil && errors.Cause(err) != btf.ErrNotFound {
+				return errors.Wrapf(err, "section %s", sec.Name)
+			}
+			if datasec != nil {
+				spec.Value = datasec
+			}
+		}
+
+		maps[sec.Name] = spec
+	}
+
+	return nil
+}
+
+// BPF_F_RDONLY_PROG prevents eBPF programs from writing to a map.
+const bpfFRdOnlyProg = 1 << 7
+
+// ProgramSection maps executable ELF sections to a program type.
+type ProgramSection struct {
+	// Prefix of the section name, which must not be empty.
+	Prefix     string
+	Type       ProgType
+	AttachType AttachType
+}
+
+// programSections are the section names libbpf understands, see
+// section_defs in tools/lib/bpf/libbpf.c.
+//
+// If several entries describe the same program and attach type, the
+// first one is used when writing ELFs.
+var programSections = []ProgramSection{
+	{"socket", SocketFilter, AttachNone},
+	{"sk_reuseport/migrate", SkReuseport, AttachSkReuseportSelectOrMigrate},
+	{"sk_reuseport", SkReuseport, AttachSkReuseportSelect},
+	{"kprobe/", Kprobe, AttachNone},
+	{"uprobe/", Kprobe, AttachNone},
+	{"kretprobe/", Kprobe, AttachNone},
+	{"uretprobe/", Kprobe, AttachNone},
+	{"ksyscall/", Kprobe, AttachNone},
+	{"kretsyscall/", Kprobe, AttachNone},
+	{"usdt/", Kprobe, AttachNone},
+	{"kprobe.multi/", Kprobe, AttachTraceKprobeMulti},
+	{"kretprobe.multi/", Kprobe, AttachTraceKprobeMulti},
+	{"uprobe.multi/", Kprobe, AttachTraceUprobeMulti},
+	{"uretprobe.multi/", Kprobe, AttachTraceUprobeMulti},
+	{"classifier", SchedCLS, AttachNone},
+	{"tc", SchedCLS, AttachNone},
+	{"tcx/ingress", SchedCLS, AttachTCXIngress},
+	{"tcx/egress", SchedCLS, AttachTCXEgress},
+	{"netkit/primary", SchedCLS, AttachNetkitPrimary},
+	{"netkit/peer", SchedCLS, AttachNetkitPeer},
+	{"action", SchedACT, AttachNone},
+	{"tracepoint/", TracePoint, AttachNone},
+	{"tp/", TracePoint, AttachNone},
+	{"raw_tracepoint/", RawTracepoint, AttachNone},
+	{"raw_tp/", RawTracepoint, AttachNone},
+	{"raw_tracepoint.w/", RawTracepointWritable, AttachNone},
+	{"raw_tp.w/", RawTracepointWritable, AttachNone},
+	{"tp_btf/", Tracing, AttachTraceRawTp},
+	{"fentry/", Tracing, AttachTraceFEntry},
+	{"fexit/", Tracing, AttachTraceFExit},
+	{"fmod_ret/", Tracing, AttachModifyReturn},
+	{"iter/", Tracing, AttachTraceIter},
+	{"freplace/", Extension, AttachNone},
+	{"lsm/", LSM, AttachLSMMac},
+	{"lsm_cgroup/", LSM, AttachLSMCGroup},
+	{"struct_ops/", StructOps, AttachNone},
+	{"struct_ops", StructOps, AttachNone},
+	{"syscall", Syscall, AttachNone},
+	{"xdp", XDP, AttachNone},
+	{"xdp/devmap", XDP, AttachXDPDevMap},
+	{"xdp/cpumap", XDP, AttachXDPCPUMap},
+	{"perf_event", PerfEvent, AttachNone},
+	{"lwt_in", LWTIn, AttachNone},
+	{"lwt_out", LWTOut, AttachNone},
+	{"lwt_xmit", LWTXmit, AttachNone},
+	{"lwt_seg6local", LWTSeg6Local, AttachNone},
+	{"sockops", SockOps, AttachCGroupSockOps},
+	{"sk_skb", SkSKB, AttachNone},
+	{"sk_skb/stream_parser", SkSKB, AttachSkSKBStreamParser},
+	{"sk_skb/stream_verdict", SkSKB, AttachSkSKBStreamVerdict},
+	{"sk_skb/verdict", SkSKB, AttachSkSKBVerdict},
+	{"sk_msg", SkMsg, AttachSkMsgVerdict},
+	{"lirc_mode2", LircMode2, AttachLircMode2},
+	{"flow_dissector", FlowDissector, AttachFlowDissector},
+	{"cgroup/skb", CGroupSKB, AttachNone},
+	{"cgroup_skb/", CGroupSKB, AttachNone},
+	{"cgroup_skb/ingress", CGroupSKB, AttachCGroupInetIngress},
+	{"cgroup_skb/egress", CGroupSKB, AttachCGroupInetEgress},
+	{"cgroup/dev", CGroupDevice, AttachCGroupDevice},
+	{"cgroup/sock", CGroupSock, AttachCGroupInetSockCreate},
+	{"cgroup/sock_create", CGroupSock, AttachCGroupInetSockCreate},
+	{"cgroup/sock_release", CGroupSock, AttachCGroupInetSockRelease},
+	{"cgroup/post_bind", CGroupSock, AttachNone},
+	{"cgroup/post_bind4", CGroupSock, AttachCGroupInet4PostBind},
+	{"cgroup/post_bind6", CGroupSock, AttachCGroupInet6PostBind},
+	{"cgroup/bind", CGroupSockAddr, AttachNone},
+	{"cgroup/bind4", CGroupSockAddr, AttachCGroupInet4Bind},
+	{"cgroup/bind6", CGroupSockAddr, AttachCGroupInet6Bind},
+	{"cgroup/connect", CGroupSockAddr, AttachNone},
+	{"cgroup/connect4", CGroupSockAddr, AttachCGroupInet4Connect},
+	{"cgroup/connect6", CGroupSockAddr, AttachCGroupInet6Connect},
+	{"cgroup/connect_unix", CGroupSockAddr, AttachCGroupUnixConnect},
+	{"cgroup/sendmsg", CGroupSockAddr, AttachNone},
+	{"cgroup/sendmsg4", CGroupSockAddr, AttachCGroupUDP4Sendmsg},
+	{"cgroup/sendmsg6", CGroupSockAddr, AttachCGroupUDP6Sendmsg},
+	{"cgroup/sendmsg_unix", CGroupSockAddr, AttachCGroupUnixSendmsg},
+	{"cgroup/recvmsg", CGroupSockAddr, AttachNone},
+	{"cgroup/recvmsg4", CGroupSockAddr, AttachCGroupUDP4Recvmsg},
+	{"cgroup/recvmsg6", CGroupSockAddr, AttachCGroupUDP6Recvmsg},
+	{"cgroup/recvmsg_unix", CGroupSockAddr, AttachCGroupUnixRecvmsg},
+	{"cgroup/getpeername4", CGroupSockAddr, AttachCGroupInet4GetPeername},
+	{"cgroup/getpeername6", CGroupSockAddr, AttachCGroupInet6GetPeername},
+	{"cgroup/getpeername_unix", CGroupSockAddr, AttachCGroupUnixGetpeername},
+	{"cgroup/getsockname4", CGroupSockAddr, AttachCGroupInet4GetSockname},
+	{"cgroup/getsockname6", CGroupSockAddr, AttachCGroupInet6GetSockname},
+	{"cgroup/getsockname_unix", CGroupSockAddr, AttachCGroupUnixGetsockname},
+	{"cgroup/sysctl", CGroupSysctl, AttachCGroupSysctl},
+	{"cgroup/getsockopt", CGroupSockopt, AttachCGroupGetsockopt},
+	{"cgroup/setsockopt", CGroupSockopt, AttachCGroupSetsockopt},
+	{"sk_lookup", SkLookup, AttachSkLookup},
+	{"netfilter", Netfilter, AttachNetfilter},
+}
+
+// getProgType returns the type of the program in a section.
+//
+// The entry with the longest matching prefix wins. If prefixes are of
+// equal length, the first entry wins.
+func getProgType(sections []ProgramSection, name string) (ProgType, AttachType) {
+	var match *ProgramSection
+	for i := range sections {
+		section := &sections[i]
+		if !strings.HasPrefix(name, section.Prefix) {
+			continue
+		}
+
+		if match == nil || len(section.Prefix) > len(match.Prefix) {
+			match = section
+		}
+	}
+
+	if match == nil {
+		return Unrecognized, AttachNone
+	}
+	return match.Type, match.AttachType
 }
 
 func assignSymbols(symbolOffsets map[uint64]*elf.Symbol, insOffsets map[uint64]int, insns asm.Instructions) error {
@@ -320,31 +1173,213 @@ func assignSymbols(symbolOffsets map[uint64]*elf.Symbol, insOffsets map[uint64]i
 	return nil
 }
 
+// BPF relocation types, see Documentation/bpf/llvm_reloc.rst.
+const (
+	rBPFNone  = 0  // R_BPF_NONE
+	rBPF64_64 = 1  // R_BPF_64_64, for 64 bit immediate loads
+	rBPF64_32 = 10 // R_BPF_64_32, for bpf to bpf calls
+)
+
+// elfRelocation is a decoded REL or RELA entry.
+type elfRelocation struct {
+	offset uint64
+	typ    uint32
+	sym    *elf.Symbol
+	addend int64
+	// rela is false if the addend is stored in the instruction.
+	rela bool
+}
+
 func (ec *elfCode) applyRelocations(insns asm.Instructions, sec *elf.Section, offsets map[uint64]int) error {
-	if sec.Entsize < 16 {
-		return errors.New("rls are less than 16 bytes")
+	rels, err := ec.readRelocations(sec)
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range rels {
+		idx, ok := offsets[rel.offset]
+		if !ok {
+			return errors.Errorf("symbol %v: invalid instruction offset %x", rel.sym.Name, rel.offset)
+		}
+
+		if err := ec.relocateInstruction(&insns[idx], rel); err != nil {
+			return errors.Wrapf(err, "relocation at offset %#x", rel.offset)
+		}
+	}
+	return nil
+}
+
+func (ec *elfCode) readRelocations(sec *elf.Section) ([]elfRelocation, error) {
+	var rel elf.Rel64
+	var rela elf.Rela64
+
+	isRela := sec.Type == elf.SHT_RELA
+	minSize := uint64(binary.Size(&rel))
+	if isRela {
+		minSize = uint64(binary.Size(&rela))
+	}
+
+	if sec.Entsize < minSize {
+		return nil, errors.Errorf("relocations are less than %d bytes", minSize)
+	}
+
+	data, err := sec.Data()
+	if err != nil {
+		return nil, err
 	}
 
-	r := sec.Open()
-	for off := uint64(0); off < sec.Size; off += sec.Entsize {
-		ent := io.LimitReader(r, int64(sec.Entsize))
+	var rels []elfRelocation
+	for off := uint64(0); off+sec.Entsize <= uint64(len(data)); off += sec.Entsize {
+		ent := bytes.NewReader(data[off : off+sec.Entsize])
 
-		var rel elf.Rel64
-		if binary.Read(ent, ec.ByteOrder, &rel) != nil {
-			return errors.Errorf("can't parse relocation at offset %v", off)
+		var r elfRelocation
+		var info uint64
+		if isRela {
+			if err := binary.Read(ent, ec.ByteOrder, &rela); err != nil {
+				return nil, errors.Errorf("can't parse relocation at offset %v", off)
+			}
+			r.offset, info, r.addend, r.rela = rela.Off, rela.Info, rela.Addend, true
+		} else {
+			if err := binary.Read(ent, ec.ByteOrder, &rel); err != nil {
+				return nil, errors.Errorf("can't parse relocation at offset %v", off)
+			}
+			r.offset, info = rel.Off, rel.Info
+		}
+
+		r.typ = elf.R_TYPE64(info)
+		if r.typ == rBPFNone {
+			continue
 		}
 
-		sym, err := ec.symtab.forRelocation(rel)
+		r.sym, err = ec.symtab.forRelocation(info)
 		if err != nil {
-			return errors.Wrapf(err, "relocation at offset %v", off)
+			return nil, errors.Wrapf(err, "relocation at offset %v", off)
 		}
 
-		idx, ok := offsets[rel.Off]
-		if !ok {
-			return errors.Errorf("symbol %v: invalid instruction offset %x", sym, rel.Off)
+		rels = append(rels, r)
+	}
+
+	return rels, nil
+}
+
+// relocateInstruction resolves the target of a relocation, and updates
+// the instruction to refer to it.
+//
+// Relocations may refer to a named symbol, or to a section symbol plus
+// an addend. In REL sections the addend is stored in the instruction:
+// for loads it is a byte offset, for calls an instruction offset
+// relative to the next instruction.
+func (ec *elfCode) relocateInstruction(ins *asm.Instruction, rel elfRelocation) error {
+	var isCall bool
+	switch rel.typ {
+	case rBPF64_64:
+		if ins.OpCode != asm.LoadImmOp(asm.DWord) {
+			return errors.Errorf("R_BPF_64_64 applies to 64 bit loads, not %v", ins.OpCode)
+		}
+
+	case rBPF64_32:
+		if ins.OpCode.Class() != asm.JumpClass || ins.OpCode.JumpOp() != asm.Call || ins.Src != asm.R1 {
+			return errors.Errorf("R_BPF_64_32 applies to bpf to bpf calls, not %v", ins.OpCode)
+		}
+		isCall = true
+
+	default:
+		return errors.Errorf("relocation type %d is not supported", rel.typ)
+	}
+
+	addend := rel.addend
+	if !rel.rela {
+		addend = ins.Constant
+		if isCall {
+			addend = (ins.Constant + 1) * asm.InstructionSize
+		}
+	}
+
+	sym := rel.sym
+	symSection := int(sym.Section)
+	isSection := elf.ST_TYPE(sym.Info) == elf.STT_SECTION
+	offset := uint64(int64(sym.Value) + addend)
+
+	switch {
+	case isCall && sym.Section == elf.SHN_UNDEF:
+		if addend != 0 {
+			return errors.Errorf("call to extern %s: non-zero addend %d", sym.Name, addend)
+		}
+
+		// Resolved when linking with the object which defines the
+		// function, see LinkCollectionSpec.
+		ins.Constant = -1
+		ins.Reference = sym.Name
+		return nil
+
+	case isCall:
+		if ec.progSections[symSection] == nil {
+			return errors.Errorf("call to %q outside of an executable section", sym.Name)
 		}
-		insns[idx].Reference = sym.Name
+
+		fn := ec.symtab.forSectionOffset(symSection, offset)
+		if fn == nil {
+			return errors.Errorf("call to symbol %q plus %d: no function at offset %d", sym.Name, addend, offset)
+		}
+
+		ins.Constant = -1
+		ins.Reference = fn.Name
+		return nil
+
+	case sym.Section == elf.SHN_UNDEF:
+		if addend != 0 {
+			return errors.Errorf("extern %s: non-zero addend %d", sym.Name, addend)
+		}
+
+		if offset, ok := ec.kconfig[sym.Name]; ok {
+			return loadMapValue(ins, kconfigSection, offset)
+		}
+
+		// Left to the user, see Editor.RewriteConstant.
+		ins.Reference = sym.Name
+		return nil
+
+	case ec.dataSections[symSection] != nil:
+		sec := ec.dataSections[symSection]
+		if offset >= sec.Size {
+			return errors.Errorf("section %s: offset %d is out of bounds", sec.Name, offset)
+		}
+
+		return loadMapValue(ins, sec.Name, offset)
+
+	case ec.mapSections[symSection] != nil:
+		m := ec.symtab.forSectionOffset(symSection, offset)
+		if m == nil {
+			return errors.Errorf("symbol %q plus %d: no map at offset %d", sym.Name, addend, offset)
+		}
+
+		ins.Constant = 0
+		ins.Reference = m.Name
+		return nil
+
+	case isSection:
+		return errors.Errorf("references to section %d are not supported", symSection)
+
+	default:
+		if addend != 0 {
+			return errors.Errorf("symbol %s: non-zero addend %d", sym.Name, addend)
+		}
+
+		ins.Reference = sym.Name
+		return nil
+	}
+}
+
+// loadMapValue turns ins into a load of a pointer to offset in the value
+// of a single entry array.
+func loadMapValue(ins *asm.Instruction, mapName string, offset uint64) error {
+	if ins.OpCode != asm.LoadImmOp(asm.DWord) {
+		return errors.Errorf("map %s: reference from %v instead of a 64 bit load", mapName, ins.OpCode)
 	}
+
+	ins.Src = pseudoMapValue
+	ins.Constant = int64(offset) << 32
+	ins.Reference = mapName
 	return nil
 }
 
@@ -397,9 +1432,9 @@ func (st *symtab) forSectionOffset(sec int, offset uint64) *elf.Symbol {
 	return offsets[offset]
 }
 
-func (st *symtab) forRelocation(rel elf.Rel64) (*elf.Symbol, error) {
-	symNo := int(elf.R_SYM64(rel.Info) - 1)
-	if symNo >= len(st.Symbols) {
+func (st *symtab) forRelocation(info uint64) (*elf.Symbol, error) {
+	symNo := int(elf.R_SYM64(info)) - 1
+	if symNo < 0 || symNo >= len(st.Symbols) {
 		return nil, errors.Errorf("symbol %v doesnt exist", symNo)
 	}
 	return &st.Symbols[symNo], nil
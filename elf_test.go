@@ -1,9 +1,21 @@
 package ebpf
 
 import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/newtools/ebpf/asm"
+	"github.com/newtools/ebpf/btf"
+
+	"github.com/pkg/errors"
 )
 
 func TestLoadCollectionSpec(t *testing.T) {
@@ -20,31 +32,34 @@ func TestLoadCollectionSpec(t *testing.T) {
 			}
 
 			hashMapSpec := &MapSpec{
-				"hash_map",
-				Hash,
-				4,
-				2,
-				1,
-				0,
-				nil,
+				Name:       "hash_map",
+				Type:       Hash,
+				KeySize:    4,
+				ValueSize:  2,
+				MaxEntries: 1,
 			}
 			checkMapSpec(t, spec.Maps, "hash_map", hashMapSpec)
 			checkMapSpec(t, spec.Maps, "array_of_hash_map", &MapSpec{
-				"hash_map", ArrayOfMaps, 4, 0, 2, 0, hashMapSpec,
+				Name:       "hash_map",
+				Type:       ArrayOfMaps,
+				KeySize:    4,
+				MaxEntries: 2,
+				InnerMap:   hashMapSpec,
 			})
 
 			hashMap2Spec := &MapSpec{
-				"",
-				Hash,
-				4,
-				1,
-				2,
-				1,
-				nil,
+				Type:       Hash,
+				KeySize:    4,
+				ValueSize:  1,
+				MaxEntries: 2,
+				Flags:      1,
 			}
 			checkMapSpec(t, spec.Maps, "hash_map2", hashMap2Spec)
 			checkMapSpec(t, spec.Maps, "hash_of_hash_map", &MapSpec{
-				"", HashOfMaps, 4, 0, 2, 0, hashMap2Spec,
+				Type:       HashOfMaps,
+				KeySize:    4,
+				MaxEntries: 2,
+				InnerMap:   hashMap2Spec,
 			})
 
 			checkProgramSpec(t, spec.Programs, "xdp_prog", &ProgramSpec{
@@ -60,6 +75,23 @@ func TestLoadCollectionSpec(t *testing.T) {
 
 			t.Log(spec.Programs["xdp_prog"].Instructions)
 
+			// Jumps are labelled while loading, which mustn't be
+			// visible in the result.
+			for name, prog := range spec.Programs {
+				for i, ins := range prog.Instructions {
+					if strings.Contains(ins.Symbol, ".L") {
+						t.Errorf("%s: instruction %d has generated symbol %s", name, i, ins.Symbol)
+					}
+					if ins.OpCode.Class() == asm.JumpClass && ins.OpCode.JumpOp() != asm.Call && ins.Reference != "" {
+						t.Errorf("%s: jump %d uses a reference: %v", name, i, ins)
+					}
+				}
+			}
+
+			if strings.HasSuffix(file, "clang-8.elf") && spec.Programs["xdp_prog"].BTF == nil {
+				t.Error("Program doesn't have BTF")
+			}
+
 			coll, err := NewCollection(spec)
 			if err != nil {
 				t.Fatal(err)
@@ -124,6 +156,10 @@ func mapSpecEqual(t *testing.T, name string, have, want *MapSpec) {
 		t.Errorf("%s: expected flags %v, got %v", name, want.Flags, have.Flags)
 	}
 
+	if have.Pinning != want.Pinning {
+		t.Errorf("%s: expected pinning %v, got %v", name, want.Pinning, have.Pinning)
+	}
+
 	switch {
 	case have.InnerMap != nil && want.InnerMap == nil:
 		t.Errorf("%s: extraneous InnerMap", name)
@@ -167,3 +203,757 @@ func TestLoadInvalidMap(t *testing.T) {
 		t.Fatal("should be fail")
 	}
 }
+
+func TestLoadBTFMaps(t *testing.T) {
+	spec, err := LoadCollectionSpec("testdata/btf_map.elf")
+	if err != nil {
+		t.Fatal("Can't parse ELF:", err)
+	}
+
+	checkMapSpec(t, spec.Maps, "hash_map", &MapSpec{
+		Type:       Hash,
+		KeySize:    4,
+		ValueSize:  8,
+		MaxEntries: 1,
+		Flags:      1,
+	})
+	checkMapSpec(t, spec.Maps, "array_map", &MapSpec{
+		Type:       Array,
+		KeySize:    4,
+		ValueSize:  2,
+		MaxEntries: 2,
+		Pinning:    PinByName,
+	})
+	checkMapSpec(t, spec.Maps, "array_of_hash_map", &MapSpec{
+		Type:       ArrayOfMaps,
+		KeySize:    4,
+		MaxEntries: 2,
+		InnerMap: &MapSpec{
+			Type:       Hash,
+			KeySize:    4,
+			ValueSize:  4,
+			MaxEntries: 1,
+		},
+	})
+
+	hashMap := spec.Maps["hash_map"]
+	if hashMap.Key == nil || hashMap.Value == nil {
+		t.Fatal("Map key or value is missing type information")
+	}
+	if name := hashMap.Value.TypeName(); name != "uint64_t" {
+		t.Error("Expected value of type uint64_t, got", name)
+	}
+
+	coll, err := NewCollection(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coll.Close()
+}
+
+func TestLoadGlobalData(t *testing.T) {
+	spec, err := LoadCollectionSpec("testdata/global_data.elf")
+	if err != nil {
+		t.Fatal("Can't parse ELF:", err)
+	}
+
+	checkMapSpec(t, spec.Maps, ".rodata", &MapSpec{
+		Type:       Array,
+		KeySize:    4,
+		ValueSize:  12,
+		MaxEntries: 1,
+		Flags:      bpfFRdOnlyProg,
+	})
+	checkMapSpec(t, spec.Maps, ".data", &MapSpec{
+		Type:       Array,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	})
+	checkMapSpec(t, spec.Maps, ".bss", &MapSpec{
+		Type:       Array,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	})
+	checkMapSpec(t, spec.Maps, ".rodata.str1.1", &MapSpec{
+		Type:       Array,
+		KeySize:    4,
+		ValueSize:  6,
+		MaxEntries: 1,
+		Flags:      bpfFRdOnlyProg,
+	})
+
+	if err := spec.RewriteConstants(map[string]interface{}{"missing": uint32(1)}); err == nil {
+		t.Error("RewriteConstants doesn't return an error for missing constants")
+	}
+
+	original := spec.Copy()
+	if err := spec.RewriteConstants(map[string]interface{}{"arg": uint32(42)}); err != nil {
+		t.Fatal("Can't rewrite constants:", err)
+	}
+
+	if arg := original.Maps[".rodata"].Contents[0].Value.([]byte)[8]; arg != 1 {
+		t.Error("RewriteConstants modifies copies of the spec")
+	}
+
+	coll, err := NewCollection(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coll.Close()
+
+	for i, want := range []uint32{7 + 42 + 5 + 'e', 7 + 42 + 10 + 'e'} {
+		ret, _, err := coll.Programs["global_data"].Test(make([]byte, 14))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ret != want {
+			t.Errorf("Run %d: expected %d, got %d", i, want, ret)
+		}
+	}
+
+	var total uint32
+	if _, err := coll.Maps[".bss"].Get(uint32(0), &total); err != nil {
+		t.Fatal(err)
+	}
+	if total != 10 {
+		t.Error("Expected total of 10, got", total)
+	}
+
+	if err := coll.Maps[".rodata"].Put(uint32(0), make([]byte, 12)); err == nil {
+		t.Error(".rodata isn't frozen")
+	}
+}
+
+func TestLoadExterns(t *testing.T) {
+	spec, err := LoadCollectionSpecWithOptions("testdata/kconfig.elf", CollectionSpecOptions{
+		KernelConfig: "testdata/kconfig.config",
+	})
+	if err != nil {
+		t.Fatal("Can't parse ELF:", err)
+	}
+
+	version, err := kernelVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open("/proc/kallsyms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	addrs, err := kallsymsAddresses(f, map[string]bool{"_text": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coll, err := NewCollection(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coll.Close()
+
+	for name, want := range map[string]uint32{
+		"kernel_version": version,
+		"hz":             250,
+		"bool":           1,
+		"tristate":       triModule,
+		"string":         'n',
+		"missing":        0,
+		"ksym":           uint32(addrs["_text"]),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ret, _, err := coll.Programs[name].Test(make([]byte, 14))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ret != want {
+				t.Errorf("Expected %d, got %d", want, ret)
+			}
+		})
+	}
+
+	_, err = LoadCollectionSpecWithOptions("testdata/kconfig.elf", CollectionSpecOptions{
+		KernelConfig: "testdata/missing.config",
+	})
+	if err == nil {
+		t.Error("Loading doesn't fail if the kernel config is missing")
+	}
+}
+
+func TestLoadMultiplePrograms(t *testing.T) {
+	spec, err := LoadCollectionSpec("testdata/multi_prog.elf")
+	if err != nil {
+		t.Fatal("Can't parse ELF:", err)
+	}
+
+	if len(spec.Programs) != 2 {
+		t.Error("Expected two programs, got", len(spec.Programs))
+	}
+
+	for name, want := range map[string]struct {
+		ret   uint32
+		funcs []string
+	}{
+		"first":  {41, []string{"first", "lib_add", "lib_double"}},
+		"second": {42, []string{"second", "sub"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			progSpec := spec.Programs[name]
+			if progSpec == nil {
+				t.Fatal("Missing program")
+			}
+
+			symbols, err := progSpec.Instructions.SymbolOffsets()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, fn := range want.funcs {
+				if _, ok := symbols[fn]; !ok {
+					t.Error("Function is not linked:", fn)
+				}
+			}
+
+			if _, ok := symbols["unused"]; ok {
+				t.Error("Unused function is linked")
+			}
+
+			prog, err := NewProgram(progSpec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer prog.Close()
+
+			ret, _, err := prog.Test(make([]byte, 14))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ret != want.ret {
+				t.Errorf("Expected %d, got %d", want.ret, ret)
+			}
+		})
+	}
+}
+
+func TestLoadIproute2Maps(t *testing.T) {
+	spec, err := LoadCollectionSpec("testdata/iproute2.elf")
+	if err != nil {
+		t.Fatal("Can't parse ELF:", err)
+	}
+
+	inner := &MapSpec{
+		Type:       Array,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+		Pinning:    PinGlobalNS,
+	}
+	checkMapSpec(t, spec.Maps, "inner_map", inner)
+	checkMapSpec(t, spec.Maps, "outer_map", &MapSpec{
+		Type:       ArrayOfMaps,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+		Pinning:    PinObjectNS,
+		InnerMap:   inner,
+	})
+
+	outer := spec.Maps["outer_map"]
+	if len(outer.PinNamespace) != 40 {
+		t.Errorf("Expected a SHA-1 as namespace, got %q", outer.PinNamespace)
+	}
+
+	if len(outer.Contents) != 1 || outer.Contents[0].Value != mapReference("inner_map") {
+		t.Error("inner_map isn't inserted into outer_map:", outer.Contents)
+	}
+
+	tmp, err := ioutil.TempDir("/sys/fs/bpf", "ebpf-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	opts := CollectionOptions{
+		Maps: MapOptions{PinPath: tmp},
+	}
+
+	run := func(t *testing.T) uint32 {
+		t.Helper()
+
+		coll, err := NewCollectionWithOptions(spec, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer coll.Close()
+
+		ret, _, err := coll.Programs["iproute2"].Test(make([]byte, 14))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := coll.Maps["inner_map"].Put(uint32(0), uint32(42)); err != nil {
+			t.Fatal(err)
+		}
+
+		return ret
+	}
+
+	if ret := run(t); ret != 0 {
+		t.Error("Expected 0 from new maps, got", ret)
+	}
+
+	for _, path := range []string{
+		filepath.Join(tmp, "tc", "globals", "inner_map"),
+		filepath.Join(tmp, "tc", outer.PinNamespace, "outer_map"),
+	} {
+		if _, err := os.Stat(path); err != nil {
+			t.Error("Map isn't pinned:", err)
+		}
+	}
+
+	if ret := run(t); ret != 42 {
+		t.Error("Expected 42 from pinned maps, got", ret)
+	}
+
+	incompatible := spec.Copy()
+	incompatible.Maps["inner_map"].MaxEntries = 2
+	if _, err := NewCollectionWithOptions(incompatible, opts); err == nil {
+		t.Error("Loading an incompatible pinned map doesn't fail")
+	}
+}
+
+func TestLoadSectionRelocations(t *testing.T) {
+	rel, err := ioutil.ReadFile("testdata/section_reloc.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, buf := range map[string][]byte{
+		"REL":  rel,
+		"RELA": convertToRela(t, rel),
+	} {
+		t.Run(name, func(t *testing.T) {
+			spec, err := LoadCollectionSpecFromReader(bytes.NewReader(buf))
+			if err != nil {
+				t.Fatal("Can't parse ELF:", err)
+			}
+
+			refs := spec.Programs["section_reloc"].Instructions.ReferenceOffsets()
+			for _, sym := range []string{"first_map", "second_map", "add"} {
+				if len(refs[sym]) != 1 {
+					t.Errorf("Expected one reference to %s, got %d", sym, len(refs[sym]))
+				}
+			}
+
+			coll, err := NewCollection(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer coll.Close()
+
+			ret, _, err := coll.Programs["section_reloc"].Test(make([]byte, 14))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ret != 42 {
+				t.Error("Expected 42, got", ret)
+			}
+		})
+	}
+}
+
+// convertToRela turns the REL sections of a little endian ELF into RELA
+// sections, by moving the addends out of the instructions.
+func convertToRela(t *testing.T, buf []byte) []byte {
+	t.Helper()
+
+	f, err := elf.NewFile(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := append([]byte(nil), buf...)
+	bo := binary.LittleEndian
+	shoff := bo.Uint64(buf[0x28:])
+	shentsize := uint64(bo.Uint16(buf[0x3a:]))
+
+	for i, sec := range f.Sections {
+		if sec.Type != elf.SHT_REL || f.Sections[sec.Info].Flags&elf.SHF_EXECINSTR == 0 {
+			continue
+		}
+
+		data, err := sec.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var relas bytes.Buffer
+		for off := 0; off < len(data); off += int(sec.Entsize) {
+			var rel elf.Rel64
+			if err := binary.Read(bytes.NewReader(data[off:]), bo, &rel); err != nil {
+				t.Fatal(err)
+			}
+
+			imm := out[f.Sections[sec.Info].Offset+rel.Off+4:][:4]
+			addend := int64(int32(bo.Uint32(imm)))
+			if elf.R_TYPE64(rel.Info) == rBPF64_32 {
+				addend = (addend + 1) * asm.InstructionSize
+				bo.PutUint32(imm, math.MaxUint32)
+			} else {
+				bo.PutUint32(imm, 0)
+			}
+
+			rela := elf.Rela64{Off: rel.Off, Info: rel.Info, Addend: addend}
+			if err := binary.Write(&relas, bo, &rela); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		hdr := out[shoff+uint64(i)*shentsize:]
+		bo.PutUint32(hdr[4:], uint32(elf.SHT_RELA))
+		bo.PutUint64(hdr[24:], uint64(len(out)))
+		bo.PutUint64(hdr[32:], uint64(relas.Len()))
+		bo.PutUint64(hdr[56:], uint64(binary.Size(elf.Rela64{})))
+		out = append(out, relas.Bytes()...)
+	}
+
+	return out
+}
+
+func TestLoadCORE(t *testing.T) {
+	target, err := btf.LoadSpec("testdata/core_target.elf")
+	if err != nil {
+		t.Fatal("Can't load target BTF:", err)
+	}
+
+	spec, err := LoadCollectionSpecWithOptions("testdata/core.elf", CollectionSpecOptions{
+		TargetBTF: target,
+	})
+	if err != nil {
+		t.Fatal("Can't parse ELF:", err)
+	}
+
+	types, err := target.TypesByName("s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := target.TypeID(types[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]uint32{
+		"field_offset": 8,
+		"field_size":   8,
+		"field_exists": 1,
+		"field_signed": 0,
+		"bitfield":     47<<8 | 58,
+		"type_id":      uint32(id),
+		"type_size":    32,
+		"type_exists":  1,
+		"enum_value":   10,
+		"enum_exists":  1,
+	} {
+		t.Run(name, func(t *testing.T) {
+			prog, err := NewProgram(spec.Programs[name])
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer prog.Close()
+
+			ret, _, err := prog.Test(make([]byte, 14))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ret != want {
+				t.Errorf("Expected %d, got %d", want, ret)
+			}
+		})
+	}
+
+	load := spec.Programs["load"].Instructions[0]
+	if load.Offset != 16 || load.OpCode.Size() != asm.DWord {
+		t.Error("Load isn't relocated:", load)
+	}
+
+	poison := spec.Programs["poison"].Instructions[0]
+	if poison.OpCode.JumpOp() != asm.Call || poison.Constant != 0xbad2310 {
+		t.Error("Impossible relocation isn't poisoned:", poison)
+	}
+}
+
+func TestLoadLineInfo(t *testing.T) {
+	spec, err := LoadCollectionSpec("testdata/line_info.elf")
+	if err != nil {
+		t.Fatal("Can't parse ELF:", err)
+	}
+
+	insns := spec.Programs["line_info"].Instructions
+	for i, ins := range insns {
+		if ins.Source == nil || ins.Source.FileName != "testdata/line_info.c" {
+			t.Fatalf("Instruction %d has source %v", i, ins.Source)
+		}
+	}
+
+	if text := insns[0].Source.Text; text != "\treturn add(skb->len, 28);" {
+		t.Errorf("Expected the text of line 14, got %q", text)
+	}
+
+	prog, err := NewProgramWithOptions(spec.Programs["line_info"], ProgramOptions{LogLevel: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prog.Close()
+
+	// The verifier only includes source code in the log if the
+	// kernel accepted the line info.
+	if !strings.Contains(prog.VerifierLog, "return a + b;") {
+		t.Error("Verifier log doesn't contain source code:", prog.VerifierLog)
+	}
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The kernel strips the Ethernet header of the input, so
+	// skb->len is zero.
+	if ret != 28 {
+		t.Error("Expected 28, got", ret)
+	}
+
+	_, err = NewProgram(spec.Programs["invalid_ctx"])
+	if err == nil {
+		t.Fatal("Loading invalid_ctx doesn't fail")
+	}
+
+	if !strings.Contains(err.Error(), "at testdata/line_info.c:19") {
+		t.Error("Error doesn't point at line 19:", err)
+	}
+
+	// A program which is invalid regardless of its BTF keeps the log
+	// of the attempt with line info.
+	_, err = NewProgramWithOptions(spec.Programs["invalid_ctx"], ProgramOptions{LogLevel: 2})
+	if err == nil {
+		t.Fatal("Loading invalid_ctx doesn't fail")
+	}
+
+	if !strings.Contains(err.Error(), "return *(int *)((char *)skb + 1000);") {
+		t.Error("Verifier log doesn't contain source code:", err)
+	}
+
+	// BTF which doesn't describe the program isn't silently dropped.
+	renamed := spec.Programs["line_info"].Copy()
+	renamed.Instructions[0].Symbol = "renamed"
+	if _, err := NewProgram(renamed); errors.Cause(err) != btf.ErrNotFound {
+		t.Error("Expected ErrNotFound for a function without BTF, got", err)
+	}
+}
+
+func TestLoadMagicKernelVersion(t *testing.T) {
+	spec := &CollectionSpec{
+		Programs: map[string]*ProgramSpec{
+			"prog": {
+				Name:          "prog",
+				Type:          Kprobe,
+				License:       "MIT",
+				KernelVersion: MagicKernelVersion,
+				Instructions: asm.Instructions{
+					asm.Mov.Imm(asm.R0, 0),
+					asm.Return(),
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := spec.WriteELF(&buf, nativeEndian); err != nil {
+		t.Fatal("Can't write ELF:", err)
+	}
+
+	have, err := LoadCollectionSpecFromReaderWithOptions(bytes.NewReader(buf.Bytes()), CollectionSpecOptions{
+		KernelVersion: 0x050400,
+	})
+	if err != nil {
+		t.Fatal("Can't parse ELF:", err)
+	}
+
+	if version := have.Programs["prog"].KernelVersion; version != 0x050400 {
+		t.Errorf("Expected version 0x050400 from the options, got %#x", version)
+	}
+
+	have, err = LoadCollectionSpecFromReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal("Can't parse ELF:", err)
+	}
+
+	want, err := kernelVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version := have.Programs["prog"].KernelVersion; version != want {
+		t.Errorf("Expected version %#x of the running kernel, got %#x", want, version)
+	}
+}
+
+func TestGetProgType(t *testing.T) {
+	for name, want := range map[string]struct {
+		ProgType
+		AttachType
+	}{
+		"socket":                   {SocketFilter, AttachNone},
+		"seccomp":                  {Unrecognized, AttachNone},
+		"kprobe/sys_open":          {Kprobe, AttachNone},
+		"kprobe.multi/vfs_*":       {Kprobe, AttachTraceKprobeMulti},
+		"raw_tracepoint/sys_enter": {RawTracepoint, AttachNone},
+		"raw_tp.w/sys_enter":       {RawTracepointWritable, AttachNone},
+		"tp_btf/sched_switch":      {Tracing, AttachTraceRawTp},
+		"fentry/tcp_connect":       {Tracing, AttachTraceFEntry},
+		"iter/task":                {Tracing, AttachTraceIter},
+		"lwt_in":                   {LWTIn, AttachNone},
+		"lwt_seg6local":            {LWTSeg6Local, AttachNone},
+		"sk_reuseport":             {SkReuseport, AttachSkReuseportSelect},
+		"sk_reuseport/migrate":     {SkReuseport, AttachSkReuseportSelectOrMigrate},
+		"sk_msg":                   {SkMsg, AttachSkMsgVerdict},
+		"sk_skb/stream_parser":     {SkSKB, AttachSkSKBStreamParser},
+		"cgroup/sock":              {CGroupSock, AttachCGroupInetSockCreate},
+		"cgroup/sock_release":      {CGroupSock, AttachCGroupInetSockRelease},
+		"cgroup/connect6":          {CGroupSockAddr, AttachCGroupInet6Connect},
+		"cgroup/sendmsg_unix":      {CGroupSockAddr, AttachCGroupUnixSendmsg},
+		"xdp/devmap":               {XDP, AttachXDPDevMap},
+		".text":                    {Unrecognized, AttachNone},
+	} {
+		progType, attachType := getProgType(programSections, name)
+		if progType != want.ProgType || attachType != want.AttachType {
+			t.Errorf("%s: expected %s with attach type %d, got %s with %d", name, want.ProgType, want.AttachType, progType, attachType)
+		}
+	}
+
+	custom := append([]ProgramSection{
+		{"sk_msg", SkSKB, AttachNone},
+		{"custom/", LSM, AttachLSMMac},
+	}, programSections...)
+
+	if progType, _ := getProgType(custom, "sk_msg"); progType != SkSKB {
+		t.Error("Custom section doesn't replace built-in section with the same prefix")
+	}
+	if progType, _ := getProgType(custom, "custom/foo"); progType != LSM {
+		t.Error("Custom section isn't recognized")
+	}
+}
+
+func TestLoadCustomSections(t *testing.T) {
+	spec, err := LoadCollectionSpecWithOptions("testdata/multi_prog.elf", CollectionSpecOptions{
+		Sections: []ProgramSection{{"socket", XDP, AttachNone}},
+	})
+	if err != nil {
+		t.Fatal("Can't parse ELF:", err)
+	}
+
+	for name, prog := range spec.Programs {
+		if prog.Type != XDP {
+			t.Errorf("Program %s has type %s instead of XDP", name, prog.Type)
+		}
+	}
+
+	_, err = LoadCollectionSpecWithOptions("testdata/multi_prog.elf", CollectionSpecOptions{
+		Sections: []ProgramSection{{"", XDP, AttachNone}},
+	})
+	if err == nil {
+		t.Error("Empty prefix doesn't return an error")
+	}
+}
+
+func TestLoadWarnings(t *testing.T) {
+	spec, err := LoadCollectionSpec("testdata/strict.elf")
+	if err != nil {
+		t.Fatal("Can't parse ELF:", err)
+	}
+
+	if spec.Programs["valid"] == nil {
+		t.Error("Missing program valid")
+	}
+
+	want := []ELFWarning{
+		{Section: ".bss", Message: "data section is not used by any program"},
+		{Section: ".data", Message: "data section is not used by any program"},
+		{Section: ".rel.data", Message: "relocations for .data are not supported"},
+		{Section: "maps", Symbol: "unused_map", Message: "map is not used by any program"},
+		{Section: "socket", Symbol: "valid", Message: "unresolved reference to missing"},
+		{Section: "sokcet", Message: "executable section with unknown program type"},
+	}
+	if !reflect.DeepEqual(spec.Warnings, want) {
+		t.Errorf("Unexpected warnings:\nhave: %v\nwant: %v", spec.Warnings, want)
+	}
+
+	_, err = LoadCollectionSpecWithOptions("testdata/strict.elf", CollectionSpecOptions{Strict: true})
+	if err == nil {
+		t.Fatal("Strict mode doesn't return an error")
+	}
+	if !strings.Contains(err.Error(), "section sokcet:") {
+		t.Error("Error doesn't mention section sokcet:", err)
+	}
+
+	if _, err := LoadCollectionSpecWithOptions("testdata/multi_prog.elf", CollectionSpecOptions{Strict: true}); err != nil {
+		t.Error("Strict mode rejects valid ELF:", err)
+	}
+}
+
+func TestLoadISAv4(t *testing.T) {
+	spec, err := LoadCollectionSpec("testdata/isa_v4.elf")
+	if err != nil {
+		t.Fatal("Can't parse ELF:", err)
+	}
+
+	progSpec := spec.Programs["isa_v4"]
+	if progSpec == nil {
+		t.Fatal("Missing program isa_v4")
+	}
+
+	insns := progSpec.Instructions
+	for _, i := range []int{1, 3} {
+		if !insns[i].IsSigned() {
+			t.Errorf("Instruction %d: expected signed operation, got %v", i, insns[i])
+		}
+	}
+	if size := insns[6].SignExtension(); size != asm.Byte {
+		t.Error("Expected sign extending move of a byte, got", size)
+	}
+	if mode := insns[5].OpCode.Mode(); mode != asm.MemSXMode {
+		t.Error("Expected sign extending load, got", mode)
+	}
+
+	targets, err := insns.Targets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if targets[9] != 12 {
+		t.Error("Expected long jump to target instruction 12, got", targets[9])
+	}
+
+	prog, err := NewProgram(progSpec)
+	if err != nil {
+		t.Skip("Kernel doesn't support ISA v4:", err)
+	}
+	defer prog.Close()
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ret != 65193 {
+		t.Error("Expected 65193, got", ret)
+	}
+}
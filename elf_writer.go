@@ -0,0 +1,965 @@
+package ebpf
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/newtools/ebpf/asm"
+
+	"github.com/pkg/errors"
+)
+
+// WriteELF serializes the spec into a relocatable BPF ELF, which can be
+// read by LoadCollectionSpecFromReader and tools like tc.
+//
+// Each program is written to a section named after its type. Functions
+// called by programs are written to .text. Maps are written to a maps
+// section, using the iproute2 layout if they are pinned with
+// PinObjectNS or PinGlobalNS. Global data is written to .data, .rodata
+// and .bss.
+//
+// Reading the ELF back results in an identical spec, with the following
+// exceptions: BTF is not written, maps pinned with PinObjectNS use the
+// hash of the new ELF as namespace, and jumps with a numeric offset are
+// read back as references to labels.
+func (cs *CollectionSpec) WriteELF(w io.Writer, bo binary.ByteOrder) error {
+	ew, err := newELFWriter(bo)
+	if err != nil {
+		return err
+	}
+
+	license, version, err := cs.programMetadata()
+	if err != nil {
+		return err
+	}
+
+	if err := ew.writeMaps(cs.Maps); err != nil {
+		return errors.Wrap(err, "write maps")
+	}
+
+	if err := ew.writePrograms(cs.Programs); err != nil {
+		return errors.Wrap(err, "write programs")
+	}
+
+	ew.addSection(&elfSection{
+		name:  "license",
+		typ:   elf.SHT_PROGBITS,
+		flags: elf.SHF_ALLOC | elf.SHF_WRITE,
+		data:  append([]byte(license), 0),
+		align: 1,
+	})
+
+	if version != 0 {
+		data := make([]byte, 4)
+		bo.PutUint32(data, version)
+		ew.addSection(&elfSection{
+			name:  "version",
+			typ:   elf.SHT_PROGBITS,
+			flags: elf.SHF_ALLOC | elf.SHF_WRITE,
+			data:  data,
+			align: 4,
+		})
+	}
+
+	return ew.writeTo(w)
+}
+
+// programMetadata returns the license and kernel version shared by all
+// programs. An ELF can only hold one of each.
+func (cs *CollectionSpec) programMetadata() (string, uint32, error) {
+	var (
+		license string
+		version uint32
+		first   = true
+	)
+
+	for _, name := range sortedProgramNames(cs.Programs) {
+		prog := cs.Programs[name]
+		if first {
+			license, version, first = prog.License, prog.KernelVersion, false
+			continue
+		}
+
+		if prog.License != license {
+			return "", 0, errors.Errorf("program %s: license %q differs from %q", name, prog.License, license)
+		}
+
+		if prog.KernelVersion != version {
+			return "", 0, errors.Errorf("program %s: kernel version %d differs from %d", name, prog.KernelVersion, version)
+		}
+	}
+
+	return license, version, nil
+}
+
+type elfSection struct {
+	name    string
+	typ     elf.SectionType
+	flags   elf.SectionFlag
+	data    []byte
+	size    uint64 // Only used for SHT_NOBITS.
+	align   uint64
+	entsize uint64
+	link    *elfSection
+	info    *elfSection
+
+	index  int
+	offset uint64
+	relocs []elfWriterRelocation
+}
+
+type elfSymbol struct {
+	name    string
+	bind    elf.SymBind
+	typ     elf.SymType
+	section *elfSection
+	value   uint64
+	size    uint64
+
+	index int
+}
+
+type elfWriterRelocation struct {
+	offset uint64
+	typ    uint32
+	sym    *elfSymbol
+}
+
+type elfWriter struct {
+	bo       binary.ByteOrder
+	data     elf.Data
+	sections []*elfSection
+	symbols  []*elfSymbol
+	// Global symbols by name, to detect clashes.
+	globals map[string]*elfSymbol
+
+	// Symbols of maps by name, and of data sections by section name.
+	maps        map[string]*elfSymbol
+	dataMaps    map[string]*elfSymbol
+	externs     map[string]*elfSymbol
+	functions   map[string]*elfSymbol
+	functionBuf map[string]asm.Instructions
+}
+
+func newELFWriter(bo binary.ByteOrder) (*elfWriter, error) {
+	var data elf.Data
+	switch bo {
+	case binary.LittleEndian:
+		data = elf.ELFDATA2LSB
+	case binary.BigEndian:
+		data = elf.ELFDATA2MSB
+	default:
+		return nil, errors.Errorf("unsupported byte order %v", bo)
+	}
+
+	return &elfWriter{
+		bo:          bo,
+		data:        data,
+		globals:     make(map[string]*elfSymbol),
+		maps:        make(map[string]*elfSymbol),
+		dataMaps:    make(map[string]*elfSymbol),
+		externs:     make(map[string]*elfSymbol),
+		functions:   make(map[string]*elfSymbol),
+		functionBuf: make(map[string]asm.Instructions),
+	}, nil
+}
+
+func (ew *elfWriter) addSection(sec *elfSection) *elfSection {
+	ew.sections = append(ew.sections, sec)
+	return sec
+}
+
+func (ew *elfWriter) addSymbol(sym *elfSymbol) (*elfSymbol, error) {
+	if sym.bind != elf.STB_LOCAL {
+		if ew.globals[sym.name] != nil {
+			return nil, errors.Errorf("duplicate symbol %s", sym.name)
+		}
+		ew.globals[sym.name] = sym
+	}
+
+	ew.symbols = append(ew.symbols, sym)
+	return sym, nil
+}
+
+// isDataMap returns true if spec holds the contents of a data section,
+// see loadDataSections.
+func isDataMap(name string) bool {
+	for _, prefix := range []string{".data", ".rodata", ".bss"} {
+		if name == prefix || strings.HasPrefix(name, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (ew *elfWriter) writeMaps(specs map[string]*MapSpec) error {
+	var all []string
+	for name := range specs {
+		all = append(all, name)
+	}
+	sort.Strings(all)
+
+	var names []string
+	for _, name := range all {
+		spec := specs[name]
+		if spec.Name != name {
+			return errors.Errorf("map %s: name %q doesn't match", name, spec.Name)
+		}
+
+		if isDataMap(name) {
+			if err := ew.writeDataMap(spec); err != nil {
+				return errors.Wrapf(err, "map %s", name)
+			}
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	// Inner maps must precede maps of maps.
+	isMapOfMaps := func(name string) bool {
+		typ := specs[name].Type
+		return typ == ArrayOfMaps || typ == HashOfMaps
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return !isMapOfMaps(names[i]) && isMapOfMaps(names[j])
+	})
+
+	// Find the templates of maps of maps, which must be part of the
+	// collection since the inner map index refers to them.
+	inner := make(map[string]string)
+	iproute2 := false
+	for _, name := range names {
+		spec := specs[name]
+		if spec.Pinning == PinObjectNS || spec.Pinning == PinGlobalNS || hasMapReferences(spec) {
+			iproute2 = true
+		}
+
+		if !isMapOfMaps(name) {
+			if spec.InnerMap != nil {
+				return errors.Errorf("map %s: InnerMap requires a map of maps", name)
+			}
+			continue
+		}
+
+		if spec.InnerMap == nil {
+			return errors.Errorf("map %s: missing InnerMap", name)
+		}
+
+		template := specs[spec.InnerMap.Name]
+		if template == nil || isMapOfMaps(spec.InnerMap.Name) || !reflect.DeepEqual(template, spec.InnerMap) {
+			return errors.Errorf("map %s: InnerMap must be a copy of another map in the collection", name)
+		}
+		inner[name] = spec.InnerMap.Name
+	}
+
+	var (
+		buf bytes.Buffer
+		err error
+	)
+	if iproute2 {
+		err = writeIproute2Maps(&buf, ew.bo, specs, names, inner)
+	} else {
+		err = writeLegacyMaps(&buf, ew.bo, specs, names, inner)
+	}
+	if err != nil {
+		return err
+	}
+
+	sec := ew.addSection(&elfSection{
+		name:  "maps",
+		typ:   elf.SHT_PROGBITS,
+		flags: elf.SHF_ALLOC | elf.SHF_WRITE,
+		data:  buf.Bytes(),
+		align: 4,
+	})
+
+	size := uint64(buf.Len() / len(names))
+	for i, name := range names {
+		sym, err := ew.addSymbol(&elfSymbol{
+			name:    name,
+			bind:    elf.STB_GLOBAL,
+			typ:     elf.STT_OBJECT,
+			section: sec,
+			value:   uint64(i) * size,
+			size:    size,
+		})
+		if err != nil {
+			return err
+		}
+		ew.maps[name] = sym
+	}
+
+	return nil
+}
+
+// legacyMapDef is the map definition written by writeLegacyMaps. It
+// is a prefix of the layout used by samples/bpf.
+type legacyMapDef struct {
+	Type        MapType
+	KeySize     uint32
+	ValueSize   uint32
+	MaxEntries  uint32
+	Flags       uint32
+	InnerMapIdx uint32
+}
+
+func writeLegacyMaps(w io.Writer, bo binary.ByteOrder, specs map[string]*MapSpec, names []string, inner map[string]string) error {
+	indices := make(map[string]int)
+	for i, name := range names {
+		spec := specs[name]
+		indices[name] = i
+
+		switch {
+		case spec.Pinning != PinNone:
+			return errors.Errorf("map %s: %s can't be written", name, spec.Pinning)
+		case len(spec.Contents) > 0, spec.Freeze:
+			return errors.Errorf("map %s: contents can't be written", name)
+		}
+
+		def := legacyMapDef{
+			Type:       spec.Type,
+			KeySize:    spec.KeySize,
+			ValueSize:  spec.ValueSize,
+			MaxEntries: spec.MaxEntries,
+			Flags:      spec.Flags,
+		}
+		if template, ok := inner[name]; ok {
+			def.InnerMapIdx = uint32(indices[template])
+		}
+
+		if err := binary.Write(w, bo, &def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeIproute2Maps(w io.Writer, bo binary.ByteOrder, specs map[string]*MapSpec, names []string, inner map[string]string) error {
+	ids := make(map[string]uint32)
+	innerIdx := make(map[string]uint32)
+	for _, name := range names {
+		template, ok := inner[name]
+		if !ok {
+			continue
+		}
+
+		if ids[template] == 0 {
+			ids[template] = uint32(len(ids) + 1)
+		}
+
+		// The template is inserted into all of its outer maps at
+		// the same index.
+		idx := uint32(iproute2NoInnerIdx)
+		if contents := specs[name].Contents; len(contents) > 0 {
+			key, ok := contents[0].Key.(uint32)
+			if len(contents) != 1 || !ok || contents[0].Value != mapReference(template) || key == iproute2NoInnerIdx {
+				return errors.Errorf("map %s: contents can't be written", name)
+			}
+			idx = key
+		}
+
+		if prev, ok := innerIdx[template]; ok && prev != idx {
+			return errors.Errorf("map %s: %s is inserted at different indices", name, template)
+		}
+		innerIdx[template] = idx
+	}
+
+	for _, name := range names {
+		spec := specs[name]
+
+		def := bpfElfMap{
+			Type:       spec.Type,
+			KeySize:    spec.KeySize,
+			ValueSize:  spec.ValueSize,
+			MaxEntries: spec.MaxEntries,
+			Flags:      spec.Flags,
+			ID:         ids[name],
+			InnerID:    ids[inner[name]],
+			InnerIdx:   innerIdx[name],
+		}
+
+		switch spec.Pinning {
+		case PinNone:
+			def.Pinning = iproute2PinNone
+		case PinObjectNS:
+			def.Pinning = iproute2PinObjectNS
+		case PinGlobalNS:
+			def.Pinning = iproute2PinGlobalNS
+		default:
+			return errors.Errorf("map %s: %s can't be written", name, spec.Pinning)
+		}
+
+		if spec.Freeze || (len(spec.Contents) > 0 && inner[name] == "") {
+			return errors.Errorf("map %s: contents can't be written", name)
+		}
+
+		if err := binary.Write(w, bo, &def); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeDataMap writes a map which was created by loadDataSections.
+func (ew *elfWriter) writeDataMap(spec *MapSpec) error {
+	readOnly := strings.HasPrefix(spec.Name, ".rodata")
+	bss := spec.Name == ".bss" || strings.HasPrefix(spec.Name, ".bss.")
+
+	var flags uint32
+	if readOnly {
+		flags = bpfFRdOnlyProg
+	}
+
+	switch {
+	case spec.Type != Array || spec.KeySize != 4 || spec.MaxEntries != 1 || spec.ValueSize == 0:
+		return errors.New("data sections must be single element arrays")
+	case spec.Flags != flags || spec.Freeze != readOnly:
+		return errors.New("flags don't match the section")
+	case spec.InnerMap != nil || spec.Pinning != PinNone:
+		return errors.New("data sections can't be nested or pinned")
+	}
+
+	sec := &elfSection{
+		name:  spec.Name,
+		typ:   elf.SHT_PROGBITS,
+		flags: elf.SHF_ALLOC | elf.SHF_WRITE,
+		align: 8,
+	}
+
+	if readOnly {
+		sec.flags = elf.SHF_ALLOC
+	}
+
+	if bss {
+		if len(spec.Contents) != 0 {
+			return errors.New(".bss can't have contents")
+		}
+
+		sec.typ = elf.SHT_NOBITS
+		sec.size = uint64(spec.ValueSize)
+	} else {
+		if len(spec.Contents) != 1 || spec.Contents[0].Key != uint32(0) {
+			return errors.New("contents must be a single value at key zero")
+		}
+
+		value, ok := spec.Contents[0].Value.([]byte)
+		if !ok || len(value) != int(spec.ValueSize) {
+			return errors.Errorf("value must be %d bytes", spec.ValueSize)
+		}
+
+		sec.data = value
+	}
+
+	ew.addSection(sec)
+	sym, err := ew.addSymbol(&elfSymbol{
+		bind:    elf.STB_LOCAL,
+		typ:     elf.STT_SECTION,
+		section: sec,
+	})
+	if err != nil {
+		return err
+	}
+
+	ew.dataMaps[spec.Name] = sym
+	return nil
+}
+
+func sortedProgramNames(progs map[string]*ProgramSpec) []string {
+	names := make([]string, 0, len(progs))
+	for name := range progs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writePrograms writes each program into its own section.
+//
+// Programs are split into functions at the targets of bpf to bpf calls.
+// Functions other than the entry point of a program are written to
+// .text, once per name.
+func (ew *elfWriter) writePrograms(progs map[string]*ProgramSpec) error {
+	type program struct {
+		name    string
+		section string
+		entry   asm.Instructions
+	}
+
+	var (
+		programs []program
+		text     []string
+	)
+
+	for _, name := range sortedProgramNames(progs) {
+		prog := progs[name]
+		if prog.Name != name {
+			return errors.Errorf("program %s: name %q doesn't match", name, prog.Name)
+		}
+
+		if len(prog.Instructions) == 0 {
+			return errors.Errorf("program %s: no instructions", name)
+		}
+
+		secName, err := progSectionName(prog.Type, prog.AttachType)
+		if err != nil {
+			return errors.Wrapf(err, "program %s", name)
+		}
+		if strings.HasSuffix(secName, "/") {
+			secName += name
+		}
+
+		insns := append(asm.Instructions(nil), prog.Instructions...)
+		switch insns[0].Symbol {
+		case "":
+			insns[0].Symbol = name
+		case name:
+		default:
+			return errors.Errorf("program %s: first instruction has symbol %s", name, insns[0].Symbol)
+		}
+
+		callees := make(map[string]bool)
+		for _, ins := range insns {
+			if ins.OpCode.JumpOp() == asm.Call && ins.Src == asm.R1 && ins.Reference != "" {
+				callees[ins.Reference] = true
+			}
+		}
+
+		funcs := splitFunctions(insns, callees)
+		programs = append(programs, program{name, secName, funcs[0].insns})
+
+		for _, fn := range funcs[1:] {
+			fnName := fn.insns[0].Symbol
+			if existing, ok := ew.functionBuf[fnName]; ok {
+				if !reflect.DeepEqual(existing, fn.insns) {
+					return errors.Errorf("program %s: function %s differs from another program", name, fnName)
+				}
+				continue
+			}
+
+			ew.functionBuf[fnName] = fn.insns
+			text = append(text, fnName)
+		}
+	}
+
+	// Program entry points may be called by other programs.
+	for _, prog := range programs {
+		if existing, ok := ew.functionBuf[prog.name]; ok {
+			if !reflect.DeepEqual(existing, prog.entry) {
+				return errors.Errorf("program %s: called as a function with different instructions", prog.name)
+			}
+		}
+		ew.functionBuf[prog.name] = prog.entry
+	}
+
+	sections := make(map[string]*elfSection)
+	for _, prog := range programs {
+		sec := ew.addSection(newExecSection(prog.section))
+		if err := ew.addFunctionSymbol(sec, prog.name); err != nil {
+			return err
+		}
+		sections[prog.name] = sec
+	}
+
+	var textSec *elfSection
+	for _, name := range text {
+		if sections[name] != nil {
+			continue
+		}
+
+		if textSec == nil {
+			textSec = ew.addSection(newExecSection(".text"))
+		}
+
+		if err := ew.addFunctionSymbol(textSec, name); err != nil {
+			return err
+		}
+		sections[name] = textSec
+	}
+
+	// Symbols must exist before instructions are encoded, since
+	// functions may call functions which come after them.
+	for _, sec := range ew.sections {
+		if sec.typ != elf.SHT_PROGBITS || sec.flags&elf.SHF_EXECINSTR == 0 {
+			continue
+		}
+
+		var names []string
+		for _, sym := range ew.symbols {
+			if sym.section == sec && sym.typ == elf.STT_FUNC {
+				names = append(names, sym.name)
+			}
+		}
+
+		for _, name := range names {
+			if err := ew.writeFunction(sec, ew.functions[name], ew.functionBuf[name]); err != nil {
+				return errors.Wrapf(err, "function %s", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func newExecSection(name string) *elfSection {
+	return &elfSection{
+		name:  name,
+		typ:   elf.SHT_PROGBITS,
+		flags: elf.SHF_ALLOC | elf.SHF_EXECINSTR,
+		align: 8,
+	}
+}
+
+func (ew *elfWriter) addFunctionSymbol(sec *elfSection, name string) error {
+	sym, err := ew.addSymbol(&elfSymbol{
+		name:    name,
+		bind:    elf.STB_GLOBAL,
+		typ:     elf.STT_FUNC,
+		section: sec,
+	})
+	if err != nil {
+		return err
+	}
+
+	ew.functions[name] = sym
+	return nil
+}
+
+// writeFunction appends the encoded insns to sec.
+//
+// References to maps, data sections, functions and externs are turned
+// into relocations. Jumps must stay within the function.
+func (ew *elfWriter) writeFunction(sec *elfSection, sym *elfSymbol, insns asm.Instructions) error {
+	base := uint64(len(sec.data))
+	sym.value = base
+
+	insns = append(asm.Instructions(nil), insns...)
+
+	var (
+		calls []uint64
+		pos   uint64
+	)
+	for i := range insns {
+		ins := &insns[i]
+		offset := base + pos
+		pos += asm.InstructionSize
+		if ins.OpCode == asm.LoadImmOp(asm.DWord) {
+			pos += asm.InstructionSize
+		}
+
+		if i > 0 && ins.Symbol != "" {
+			if _, err := ew.addSymbol(&elfSymbol{
+				name:    ins.Symbol,
+				bind:    elf.STB_LOCAL,
+				typ:     elf.STT_NOTYPE,
+				section: sec,
+				value:   offset,
+			}); err != nil {
+				return err
+			}
+		}
+
+		if ins.Reference == "" {
+			continue
+		}
+
+		if ins.OpCode.JumpOp() == asm.Call && ins.Src == asm.R1 {
+			target := ew.functions[ins.Reference]
+			if target == nil {
+				return errors.Errorf("instruction %d: call to unknown function %s", i, ins.Reference)
+			}
+
+			// The immediate is patched below, since Marshal would
+			// try to resolve the reference.
+			ins.Constant = 0
+			calls = append(calls, offset-base)
+			sec.relocs = append(sec.relocs, elfWriterRelocation{offset, rBPF64_32, target})
+			continue
+		}
+
+		if cls := ins.OpCode.Class(); cls == asm.JumpClass || cls == asm.Jump32Class {
+			// Resolved by Marshal.
+			continue
+		}
+
+		if ins.OpCode != asm.LoadImmOp(asm.DWord) {
+			return errors.Errorf("instruction %d: reference to %s from %v", i, ins.Reference, ins.OpCode)
+		}
+
+		var target *elfSymbol
+		switch {
+		case ew.dataMaps[ins.Reference] != nil:
+			if ins.Src != pseudoMapValue {
+				return errors.Errorf("instruction %d: reference to %s must load a map value", i, ins.Reference)
+			}
+
+			target = ew.dataMaps[ins.Reference]
+			ins.Constant = int64(uint64(ins.Constant) >> 32)
+
+		case ew.maps[ins.Reference] != nil:
+			target = ew.maps[ins.Reference]
+			ins.Constant = 0
+
+		case ew.globals[ins.Reference] != nil:
+			return errors.Errorf("instruction %d: reference to function %s", i, ins.Reference)
+
+		default:
+			if ins.Constant != 0 {
+				return errors.Errorf("instruction %d: reference to %s with non-zero constant", i, ins.Reference)
+			}
+
+			target = ew.externs[ins.Reference]
+			if target == nil {
+				var err error
+				target, err = ew.addSymbol(&elfSymbol{
+					name: ins.Reference,
+					bind: elf.STB_GLOBAL,
+					typ:  elf.STT_NOTYPE,
+				})
+				if err != nil {
+					return err
+				}
+				ew.externs[ins.Reference] = target
+			}
+		}
+
+		sec.relocs = append(sec.relocs, elfWriterRelocation{offset, rBPF64_64, target})
+	}
+
+	var buf bytes.Buffer
+	if err := insns.Marshal(&buf, ew.bo); err != nil {
+		return err
+	}
+
+	code := buf.Bytes()
+	for _, off := range calls {
+		ew.bo.PutUint32(code[off+4:], uint32(0xffffffff))
+	}
+
+	sym.size = uint64(len(code))
+	sec.data = append(sec.data, code...)
+	return nil
+}
+
+// writeTo lays out the ELF and writes it to w.
+//
+// Section 0 is the null section, followed by the sections added to the
+// writer, relocation sections, the symbol table and the string table.
+func (ew *elfWriter) writeTo(w io.Writer) error {
+	var (
+		strtab  = newStringTable()
+		symtab  = &elfSection{name: ".symtab", typ: elf.SHT_SYMTAB, align: 8, entsize: uint64(binary.Size(elf.Sym64{}))}
+		strsec  = &elfSection{name: ".strtab", typ: elf.SHT_STRTAB, align: 1}
+		relsecs []*elfSection
+	)
+
+	for _, sec := range ew.sections {
+		if len(sec.relocs) == 0 {
+			continue
+		}
+
+		relsecs = append(relsecs, &elfSection{
+			name:    ".rel" + sec.name,
+			typ:     elf.SHT_REL,
+			flags:   elf.SHF_INFO_LINK,
+			align:   8,
+			entsize: uint64(binary.Size(elf.Rel64{})),
+			link:    symtab,
+			info:    sec,
+			relocs:  sec.relocs,
+		})
+	}
+
+	sections := append([]*elfSection{{}}, ew.sections...)
+	sections = append(sections, relsecs...)
+	sections = append(sections, symtab, strsec)
+	for i, sec := range sections {
+		sec.index = i
+	}
+	symtab.link = strsec
+
+	// Local symbols must precede global ones.
+	symbols := []*elfSymbol{{}}
+	for _, bind := range []elf.SymBind{elf.STB_LOCAL, elf.STB_GLOBAL} {
+		if bind == elf.STB_GLOBAL {
+			symtab.info = &elfSection{index: len(symbols)}
+		}
+
+		for _, sym := range ew.symbols {
+			if (sym.bind == elf.STB_LOCAL) == (bind == elf.STB_LOCAL) {
+				sym.index = len(symbols)
+				symbols = append(symbols, sym)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, sym := range symbols {
+		var shndx uint16
+		if sym.section != nil {
+			shndx = uint16(sym.section.index)
+		}
+
+		entry := elf.Sym64{
+			Info:  elf.ST_INFO(sym.bind, sym.typ),
+			Shndx: shndx,
+			Value: sym.value,
+			Size:  sym.size,
+		}
+		if sym.name != "" {
+			entry.Name = strtab.add(sym.name)
+		}
+
+		if err := binary.Write(&buf, ew.bo, &entry); err != nil {
+			return err
+		}
+	}
+	symtab.data = buf.Bytes()
+
+	for _, sec := range relsecs {
+		var buf bytes.Buffer
+		for _, rel := range sec.relocs {
+			entry := elf.Rel64{
+				Off:  rel.offset,
+				Info: elf.R_INFO(uint32(rel.sym.index), rel.typ),
+			}
+			if err := binary.Write(&buf, ew.bo, &entry); err != nil {
+				return err
+			}
+		}
+		sec.data = buf.Bytes()
+	}
+
+	names := make([]uint32, len(sections))
+	for i, sec := range sections[1:] {
+		names[i+1] = strtab.add(sec.name)
+	}
+	strsec.data = strtab.Bytes()
+
+	// Lay out the file: header, section contents, section headers.
+	offset := uint64(binary.Size(elf.Header64{}))
+	for _, sec := range sections[1:] {
+		if sec.typ == elf.SHT_NOBITS {
+			sec.offset = offset
+			continue
+		}
+
+		offset = uint64(align(int(offset), int(sec.align)))
+		sec.offset = offset
+		offset += uint64(len(sec.data))
+	}
+	shoff := uint64(align(int(offset), 8))
+
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_REL),
+		Machine:   uint16(elf.EM_BPF),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     shoff,
+		Ehsize:    uint16(binary.Size(elf.Header64{})),
+		Shentsize: uint16(binary.Size(elf.Section64{})),
+		Shnum:     uint16(len(sections)),
+		Shstrndx:  uint16(strsec.index),
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(ew.data)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	out := bytes.NewBuffer(nil)
+	if err := binary.Write(out, ew.bo, &hdr); err != nil {
+		return err
+	}
+
+	for _, sec := range sections[1:] {
+		if sec.typ == elf.SHT_NOBITS {
+			continue
+		}
+
+		out.Write(make([]byte, int(sec.offset)-out.Len()))
+		out.Write(sec.data)
+	}
+	out.Write(make([]byte, int(shoff)-out.Len()))
+
+	for i, sec := range sections {
+		if i == 0 {
+			if err := binary.Write(out, ew.bo, &elf.Section64{}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		size := uint64(len(sec.data))
+		if sec.typ == elf.SHT_NOBITS {
+			size = sec.size
+		}
+
+		shdr := elf.Section64{
+			Name:      names[i],
+			Type:      uint32(sec.typ),
+			Flags:     uint64(sec.flags),
+			Off:       sec.offset,
+			Size:      size,
+			Addralign: sec.align,
+			Entsize:   sec.entsize,
+		}
+		if sec.link != nil {
+			shdr.Link = uint32(sec.link.index)
+		}
+		if sec.info != nil {
+			shdr.Info = uint32(sec.info.index)
+		}
+
+		if err := binary.Write(out, ew.bo, &shdr); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// stringTable is the contents of an SHT_STRTAB section.
+type stringTable struct {
+	bytes.Buffer
+	offsets map[string]uint32
+}
+
+func newStringTable() *stringTable {
+	st := &stringTable{offsets: make(map[string]uint32)}
+	st.WriteByte(0)
+	return st
+}
+
+func (st *stringTable) add(s string) uint32 {
+	if off, ok := st.offsets[s]; ok {
+		return off
+	}
+
+	off := uint32(st.Len())
+	st.WriteString(s)
+	st.WriteByte(0)
+	st.offsets[s] = off
+	return off
+}
+
+// progSectionName returns the name of a section which getProgType
+// recognizes as typ and attachType. Names ending in a slash require a
+// suffix.
+func progSectionName(typ ProgType, attachType AttachType) (string, error) {
+	for _, section := range programSections {
+		if section.Type == typ && section.AttachType == attachType {
+			return section.Prefix, nil
+		}
+	}
+	return "", errors.Errorf("no section name for %s with attach type %d", typ, attachType)
+}
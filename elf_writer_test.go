@@ -0,0 +1,216 @@
+package ebpf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/newtools/ebpf/asm"
+)
+
+func TestWriteELF(t *testing.T) {
+	for _, file := range []string{
+		"testdata/loader-clang-8.elf",
+		"testdata/multi_prog.elf",
+		"testdata/section_reloc.elf",
+		"testdata/global_data.elf",
+		"testdata/iproute2.elf",
+	} {
+		t.Run(file, func(t *testing.T) {
+			spec, err := LoadCollectionSpec(file)
+			if err != nil {
+				t.Fatal("Can't parse ELF:", err)
+			}
+			stripBTF(spec)
+
+			var buf bytes.Buffer
+			if err := spec.WriteELF(&buf, binary.LittleEndian); err != nil {
+				t.Fatal("Can't write ELF:", err)
+			}
+
+			have, err := LoadCollectionSpecFromReader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal("Can't parse written ELF:", err)
+			}
+
+			for _, specs := range []map[string]*MapSpec{spec.Maps, have.Maps} {
+				for _, m := range specs {
+					m.PinNamespace = ""
+				}
+			}
+
+			for name, want := range spec.Maps {
+				if !reflect.DeepEqual(have.Maps[name], want) {
+					t.Errorf("Map %s differs:\nhave: %#v\nwant: %#v", name, have.Maps[name], want)
+				}
+			}
+
+			for name, want := range spec.Programs {
+				if !reflect.DeepEqual(have.Programs[name], want) {
+					t.Errorf("Program %s differs:\nhave: %v\nwant: %v", name, have.Programs[name], want)
+				}
+			}
+
+			if !reflect.DeepEqual(have, spec) {
+				t.Error("Written ELF doesn't match")
+			}
+		})
+	}
+}
+
+func TestWriteELFFromInstructions(t *testing.T) {
+	insns := asm.Instructions{
+		asm.LoadMapPtr(asm.R1, 0),
+		asm.Mov.Reg(asm.R2, asm.R10),
+		asm.Add.Imm(asm.R2, -4),
+		asm.StoreImm(asm.R2, 0, 0, asm.Word),
+		asm.MapLookupElement.Call(),
+		asm.JEq.Imm(asm.R0, 0, "ret"),
+		asm.LoadMem(asm.R1, asm.R0, 0, asm.Word),
+		asm.Call.Label("add_one"),
+		asm.Return().Sym("ret"),
+		asm.Mov.Reg(asm.R0, asm.R1).Sym("add_one"),
+		asm.Add.Imm(asm.R0, 1),
+		asm.Return(),
+	}
+	insns[0].Reference = "test_map"
+
+	spec := &CollectionSpec{
+		Maps: map[string]*MapSpec{
+			"test_map": {
+				Name:       "test_map",
+				Type:       Array,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 1,
+			},
+		},
+		Programs: map[string]*ProgramSpec{
+			"test_prog": {
+				Name:          "test_prog",
+				Type:          SocketFilter,
+				Instructions:  insns,
+				License:       "MIT",
+				KernelVersion: 0x050400,
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := spec.WriteELF(&buf, nativeEndian); err != nil {
+		t.Fatal("Can't write ELF:", err)
+	}
+
+	have, err := LoadCollectionSpecFromReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal("Can't parse written ELF:", err)
+	}
+
+	prog := have.Programs["test_prog"]
+	if prog == nil {
+		t.Fatal("Program is missing")
+	}
+
+	if prog.License != "MIT" || prog.KernelVersion != 0x050400 {
+		t.Errorf("Expected license MIT and version 0x050400, got %q and %#x", prog.License, prog.KernelVersion)
+	}
+
+	refs := prog.Instructions.ReferenceOffsets()
+	if len(refs["test_map"]) != 1 || len(refs["add_one"]) != 1 {
+		t.Error("Missing references to test_map or add_one:", refs)
+	}
+
+	coll, err := NewCollection(have)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coll.Close()
+
+	if err := coll.Maps["test_map"].Put(uint32(0), uint32(41)); err != nil {
+		t.Fatal(err)
+	}
+
+	ret, _, err := coll.Programs["test_prog"].Test(make([]byte, 14))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ret != 42 {
+		t.Error("Expected 42, got", ret)
+	}
+}
+
+func TestWriteELFErrors(t *testing.T) {
+	newSpec := func() *CollectionSpec {
+		return &CollectionSpec{
+			Maps: map[string]*MapSpec{
+				"inner": {Name: "inner", Type: Array, KeySize: 4, ValueSize: 4, MaxEntries: 1},
+				"outer": {Name: "outer", Type: ArrayOfMaps, KeySize: 4, MaxEntries: 1},
+			},
+			Programs: map[string]*ProgramSpec{
+				"a": {Name: "a", Type: SocketFilter, License: "MIT", Instructions: asm.Instructions{asm.Return()}},
+				"b": {Name: "b", Type: SocketFilter, License: "MIT", Instructions: asm.Instructions{asm.Return()}},
+			},
+		}
+	}
+
+	for name, modify := range map[string]func(*CollectionSpec){
+		"license": func(cs *CollectionSpec) { cs.Programs["b"].License = "GPL" },
+		"anonymous inner": func(cs *CollectionSpec) {
+			cs.Maps["outer"].InnerMap = &MapSpec{Type: Array, KeySize: 4, ValueSize: 4, MaxEntries: 1}
+		},
+		"contents":    func(cs *CollectionSpec) { cs.Maps["inner"].Contents = []MapKV{{uint32(0), uint32(1)}} },
+		"pin by name": func(cs *CollectionSpec) { cs.Maps["inner"].Pinning = PinByName },
+		"prog type":   func(cs *CollectionSpec) { cs.Programs["a"].Type = Unrecognized },
+	} {
+		cs := newSpec()
+		cs.Maps["outer"].InnerMap = cs.Maps["inner"].Copy()
+		modify(cs)
+
+		if err := cs.WriteELF(&bytes.Buffer{}, binary.LittleEndian); err == nil {
+			t.Errorf("%s: writing ELF doesn't fail", name)
+		}
+	}
+
+	cs := newSpec()
+	cs.Maps["outer"].InnerMap = cs.Maps["inner"].Copy()
+	if err := cs.WriteELF(&bytes.Buffer{}, binary.LittleEndian); err != nil {
+		t.Error("Can't write valid spec:", err)
+	}
+}
+
+func TestProgSectionName(t *testing.T) {
+	for _, section := range programSections {
+		name, err := progSectionName(section.Type, section.AttachType)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.HasSuffix(name, "/") {
+			name += "prog"
+		}
+
+		progType, attachType := getProgType(programSections, name)
+		if progType != section.Type || attachType != section.AttachType {
+			t.Errorf("%s: section %s is recognized as %s with attach type %d", section.Prefix, name, progType, attachType)
+		}
+	}
+}
+
+// stripBTF removes the information which WriteELF can't serialize.
+func stripBTF(cs *CollectionSpec) {
+	for _, prog := range cs.Programs {
+		prog.BTF = nil
+		for i := range prog.Instructions {
+			prog.Instructions[i].Source = nil
+		}
+	}
+
+	for _, m := range cs.Maps {
+		for ; m != nil; m = m.InnerMap {
+			m.Key, m.Value = nil, nil
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package ebpf
+
+import (
+	"bufio"
+	"debug/elf"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/newtools/ebpf/btf"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// kconfigSection holds extern variables which are resolved from the
+	// kernel configuration, like CONFIG_HZ.
+	kconfigSection = ".kconfig"
+	// ksymsSection holds extern variables which are resolved to the
+	// address of a kernel symbol.
+	ksymsSection = ".ksyms"
+)
+
+// loadExterns resolves the extern variables in the .kconfig and .ksyms
+// sections.
+//
+// Kconfig variables are stored in a frozen array, similar to .rodata.
+// References to ksyms are rewritten into constants.
+func (ec *elfCode) loadExterns(maps map[string]*MapSpec) error {
+	if ec.btf == nil {
+		return nil
+	}
+
+	// Externs are undefined symbols. Weak externs may be missing.
+	externs := make(map[string]*elf.Symbol)
+	for i, sym := range ec.symtab.Symbols {
+		if sym.Section == elf.SHN_UNDEF && sym.Name != "" {
+			externs[sym.Name] = &ec.symtab.Symbols[i]
+		}
+	}
+
+	if err := ec.loadKconfig(maps, externs); err != nil {
+		return errors.Wrap(err, kconfigSection)
+	}
+
+	if err := ec.loadKsyms(externs); err != nil {
+		return errors.Wrap(err, ksymsSection)
+	}
+
+	return nil
+}
+
+func (ec *elfCode) loadKconfig(maps map[string]*MapSpec, externs map[string]*elf.Symbol) error {
+	datasec, err := ec.btf.Datasec(kconfigSection)
+	if errors.Cause(err) == btf.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if maps[kconfigSection] != nil {
+		return errors.Errorf("map %s already exists", kconfigSection)
+	}
+
+	// Lay out the variables with their natural alignment.
+	var size uint32
+	for i := range datasec.Vars {
+		vsi := &datasec.Vars[i]
+		v, ok := vsi.Type.(*btf.Var)
+		if !ok {
+			return errors.Errorf("unexpected %T", vsi.Type)
+		}
+
+		varSize, err := btf.Sizeof(v.Type)
+		if err != nil {
+			return errors.Wrapf(err, "variable %s", v.Name)
+		}
+
+		size = uint32(align(int(size), kconfigAlignment(v.Type)))
+		vsi.Offset = size
+		vsi.Size = uint32(varSize)
+		size += uint32(varSize)
+	}
+	datasec.Size = size
+
+	if size == 0 {
+		return nil
+	}
+
+	var config kconfig
+	data := make([]byte, size)
+	ec.kconfig = make(map[string]uint64)
+	for _, vsi := range datasec.Vars {
+		v := vsi.Type.(*btf.Var)
+		buf := data[vsi.Offset : vsi.Offset+vsi.Size]
+		ec.kconfig[v.Name] = uint64(vsi.Offset)
+
+		if v.Name == "LINUX_KERNEL_VERSION" {
+			version, err := ec.kernelVersion()
+			if err != nil {
+				return errors.Wrap(err, v.Name)
+			}
+
+			if vsi.Size != 4 {
+				return errors.Errorf("%s must be 4 bytes", v.Name)
+			}
+
+			ec.ByteOrder.PutUint32(buf, version)
+			continue
+		}
+
+		if !strings.HasPrefix(v.Name, "CONFIG_") {
+			return errors.Errorf("unsupported variable %s", v.Name)
+		}
+
+		if config == nil {
+			config, err = loadKconfig(ec.opts.KernelConfig)
+			if err != nil {
+				return err
+			}
+		}
+
+		value, ok := config[v.Name]
+		if !ok {
+			if sym := externs[v.Name]; sym != nil && elf.ST_BIND(sym.Info) == elf.STB_WEAK {
+				// Missing weak variables are zero.
+				continue
+			}
+			return errors.Errorf("%s is missing from the kernel config", v.Name)
+		}
+
+		if err := encodeKconfig(buf, v.Type, value, ec.ByteOrder); err != nil {
+			return errors.Wrap(err, v.Name)
+		}
+	}
+
+	maps[kconfigSection] = &MapSpec{
+		Name:       kconfigSection,
+		Type:       Array,
+		KeySize:    4,
+		ValueSize:  size,
+		MaxEntries: 1,
+		Flags:      bpfFRdOnlyProg,
+		Freeze:     true,
+		Value:      datasec,
+		Contents:   []MapKV{{uint32(0), data}},
+	}
+
+	return nil
+}
+
+// kconfigAlignment returns the alignment of a variable in .kconfig.
+func kconfigAlignment(typ btf.Type) int {
+	switch t := btf.UnderlyingType(typ).(type) {
+	case *btf.Int:
+		return int(t.Size)
+	case *btf.Enum:
+		return int(t.Size)
+	case *btf.Array:
+		return kconfigAlignment(t.Type)
+	default:
+		return 1
+	}
+}
+
+func (ec *elfCode) loadKsyms(externs map[string]*elf.Symbol) error {
+	datasec, err := ec.btf.Datasec(ksymsSection)
+	if errors.Cause(err) == btf.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for _, vsi := range datasec.Vars {
+		v, ok := vsi.Type.(*btf.Var)
+		if !ok {
+			return errors.Errorf("%T is not supported", vsi.Type)
+		}
+
+		if _, ok := btf.UnderlyingType(v.Type).(*btf.Void); !ok {
+			return errors.Errorf("variable %s: only typeless ksyms are supported", v.Name)
+		}
+
+		names[v.Name] = true
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	f, err := os.Open("/proc/kallsyms")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	addrs, err := kallsymsAddresses(f, names)
+	if err != nil {
+		return errors.Wrap(err, "/proc/kallsyms")
+	}
+
+	for name := range names {
+		if _, ok := addrs[name]; ok {
+			continue
+		}
+
+		if sym := externs[name]; sym != nil && elf.ST_BIND(sym.Info) == elf.STB_WEAK {
+			// Missing weak symbols have a zero address.
+			addrs[name] = 0
+			continue
+		}
+
+		return errors.Errorf("kernel symbol %s doesn't exist", name)
+	}
+
+	ec.ksyms = addrs
+	return nil
+}
+
+// kallsymsAddresses finds the addresses of symbols in a file with the
+// format of /proc/kallsyms.
+func kallsymsAddresses(r io.Reader, names map[string]bool) (map[string]uint64, error) {
+	addrs := make(map[string]uint64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// ffffffff81000000 T _text [module]
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || !names[fields[2]] {
+			continue
+		}
+
+		name := fields[2]
+		addr, err := strconv.ParseUint(fields[0], 16, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "symbol %s", name)
+		}
+
+		if addr == 0 {
+			return nil, errors.Errorf("symbol %s: address is hidden, check kernel.kptr_restrict", name)
+		}
+
+		if prev, ok := addrs[name]; ok && prev != addr {
+			return nil, errors.Errorf("symbol %s is ambiguous", name)
+		}
+
+		addrs[name] = addr
+	}
+
+	return addrs, scanner.Err()
+}
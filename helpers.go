@@ -0,0 +1,378 @@
+package ebpf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/newtools/ebpf/asm"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	tcProgTypes      = []ProgType{SchedCLS, SchedACT}
+	tracingProgTypes = []ProgType{Kprobe, TracePoint, PerfEvent, RawTracepoint, RawTracepointWritable, Tracing, LSM}
+	cgroupProgTypes  = []ProgType{CGroupSKB, CGroupSock, CGroupDevice, CGroupSockAddr, CGroupSysctl, CGroupSockopt}
+	lwtProgTypes     = []ProgType{LWTIn, LWTOut, LWTXmit, LWTSeg6Local}
+	// skcToProgTypes may call the bpf_skc_to_* helpers.
+	skcToProgTypes = []ProgType{
+		SocketFilter, SchedCLS, SchedACT, XDP, CGroupSKB, CGroupSockAddr, SockOps, SkSKB, SkMsg,
+		LWTIn, LWTOut, LWTXmit, LWTSeg6Local, SkLookup, FlowDissector, Tracing, LSM,
+	}
+)
+
+// progTypes concatenates lists of program types.
+func progTypes(lists ...[]ProgType) []ProgType {
+	var types []ProgType
+	for _, list := range lists {
+		types = append(types, list...)
+	}
+	return types
+}
+
+// baseHelpers are available to all program types, like
+// bpf_base_func_proto in the kernel. Some of them require CAP_BPF or
+// CAP_PERFMON, and older kernels restrict the task helpers to tracing
+// and cgroup programs.
+var baseHelpers = map[asm.BuiltinFunc]bool{
+	asm.MapLookupElement:       true,
+	asm.MapUpdateElement:       true,
+	asm.MapDeleteElement:       true,
+	asm.MapPushElement:         true,
+	asm.MapPopElement:          true,
+	asm.MapPeekElement:         true,
+	asm.MapLookupPerCPUElement: true,
+	asm.ForEachMapElement:      true,
+	asm.TailCall:               true,
+	asm.KtimeGetNS:             true,
+	asm.KtimeGetBootNS:         true,
+	asm.KtimeGetTAINS:          true,
+	asm.Jiffies64:              true,
+	asm.GetPRandomu32:          true,
+	asm.GetSMPProcessorID:      true,
+	asm.GetNUMANodeID:          true,
+	asm.TracePrintk:            true,
+	asm.TraceVprintk:           true,
+	asm.Snprintf:               true,
+	asm.SnprintfBTF:            true,
+	asm.ProbeReadUser:          true,
+	asm.ProbeReadKernel:        true,
+	asm.ProbeReadUserStr:       true,
+	asm.ProbeReadKernelStr:     true,
+	asm.GetCurrentTask:         true,
+	asm.GetCurrentTaskBTF:      true,
+	asm.PerCPUPtr:              true,
+	asm.ThisCPUPtr:             true,
+	asm.SpinLock:               true,
+	asm.SpinUnlock:             true,
+	asm.Strtol:                 true,
+	asm.Strtoul:                true,
+	asm.Strncmp:                true,
+	asm.Loop:                   true,
+	asm.TimerInit:              true,
+	asm.TimerSetCallback:       true,
+	asm.TimerStart:             true,
+	asm.TimerCancel:            true,
+	asm.KptrXchg:               true,
+	asm.RingbufOutput:          true,
+	asm.RingbufReserve:         true,
+	asm.RingbufSubmit:          true,
+	asm.RingbufDiscard:         true,
+	asm.RingbufQuery:           true,
+	asm.RingbufReserveDynptr:   true,
+	asm.RingbufSubmitDynptr:    true,
+	asm.RingbufDiscardDynptr:   true,
+	asm.UserRingbufDrain:       true,
+	asm.DynptrFromMem:          true,
+	asm.DynptrRead:             true,
+	asm.DynptrWrite:            true,
+	asm.DynptrData:             true,
+
+	// Tasks and cgroups
+	asm.GetCurrentPIDTGID:          true,
+	asm.GetCurrentUIDGID:           true,
+	asm.GetCurrentComm:             true,
+	asm.GetCurrentCGroupID:         true,
+	asm.GetCurrentAncestorCGroupID: true,
+	asm.GetNSCurrentPIDTGID:        true,
+	asm.GetCGroupClassID:           true,
+	asm.CurrentTaskUnderCGroup:     true,
+	asm.TaskPTRegs:                 true,
+	asm.TaskStorageGet:             true,
+	asm.TaskStorageDelete:          true,
+	asm.GetTaskStack:               true,
+	asm.FindVMA:                    true,
+	asm.CopyFromUser:               true,
+	asm.CopyFromUserTask:           true,
+	asm.SendSignal:                 true,
+	asm.SendSignalThread:           true,
+	asm.PerfEventRead:              true,
+	asm.PerfEventReadValue:         true,
+	asm.GetBranchSnapshot:          true,
+}
+
+// helperProgTypes lists the program types which may call a helper
+// that isn't in baseHelpers.
+//
+// The kernel may still restrict helpers based on the attach type or
+// the privileges of the loader.
+var helperProgTypes = map[asm.BuiltinFunc][]ProgType{
+	// Timers
+	asm.KtimeGetCoarseNS: {
+		SocketFilter, SchedCLS, SchedACT, XDP, CGroupSKB, CGroupSock, CGroupSockAddr, CGroupSysctl,
+		SockOps, SkSKB, SkMsg, LWTIn, LWTOut, LWTXmit, LWTSeg6Local, SkReuseport, SkLookup,
+		FlowDissector, LircMode2, Syscall,
+	},
+
+	// Tasks and cgroups
+	asm.SockFromFile:    {Tracing, LSM},
+	asm.GetLocalStorage: append(cgroupProgTypes, SockOps),
+	asm.GetRetval:       {CGroupSock, CGroupSockAddr, CGroupSockopt, LSM},
+	asm.SetRetval:       {CGroupSock, CGroupSockAddr, CGroupSockopt, LSM},
+
+	// Sockets and packets
+	asm.PerfEventOutput: progTypes(tracingProgTypes, cgroupProgTypes, lwtProgTypes, []ProgType{
+		SocketFilter, SchedCLS, SchedACT, XDP, SockOps, SkSKB, SkMsg, SkLookup,
+	}),
+	asm.SKBLoadBytes:             progTypes([]ProgType{SocketFilter, CGroupSKB, SkSKB, SkReuseport, FlowDissector}, tcProgTypes, lwtProgTypes),
+	asm.SKBLoadBytesRelative:     progTypes([]ProgType{SocketFilter, CGroupSKB, SkReuseport}, tcProgTypes),
+	asm.GetSocketCookie:          progTypes([]ProgType{SocketFilter, CGroupSKB, CGroupSock, CGroupSockAddr, SockOps, SkSKB, SkReuseport}, tcProgTypes),
+	asm.GetSocketUID:             progTypes([]ProgType{SocketFilter, CGroupSKB, SkSKB}, tcProgTypes),
+	asm.GetNetNSCookie:           progTypes([]ProgType{SocketFilter, CGroupSKB, CGroupSock, CGroupSockAddr, CGroupSockopt, SockOps, SkMsg}, tcProgTypes),
+	asm.SetSockOpt:               {SockOps, CGroupSockAddr, CGroupSockopt},
+	asm.GetSockOpt:               {SockOps, CGroupSockAddr, CGroupSockopt},
+	asm.SkStorageGet:             progTypes([]ProgType{CGroupSKB, CGroupSock, CGroupSockAddr, CGroupSockopt, SockOps, SkMsg, Tracing, LSM}, tcProgTypes),
+	asm.SkStorageDelete:          progTypes([]ProgType{CGroupSKB, CGroupSockAddr, CGroupSockopt, SockOps, SkMsg, Tracing, LSM}, tcProgTypes),
+	asm.SkLookupTCP:              progTypes([]ProgType{XDP, SkSKB, CGroupSKB, CGroupSockAddr}, tcProgTypes),
+	asm.SkLookupUDP:              progTypes([]ProgType{XDP, SkSKB, CGroupSKB, CGroupSockAddr}, tcProgTypes),
+	asm.SkcLookupTCP:             progTypes([]ProgType{XDP, SkSKB, CGroupSKB, CGroupSockAddr}, tcProgTypes),
+	asm.SkRelease:                progTypes([]ProgType{XDP, SkSKB, CGroupSKB, CGroupSockAddr, SkLookup}, tcProgTypes),
+	asm.SkFullsock:               progTypes([]ProgType{CGroupSKB}, tcProgTypes),
+	asm.TCPSock:                  progTypes([]ProgType{CGroupSKB, CGroupSockopt, SockOps}, tcProgTypes),
+	asm.GetListenerSock:          progTypes([]ProgType{CGroupSKB}, tcProgTypes),
+	asm.SKBECNSetCE:              progTypes([]ProgType{CGroupSKB}, tcProgTypes),
+	asm.SKBCGroupID:              progTypes([]ProgType{CGroupSKB}, tcProgTypes),
+	asm.SKBAncestorCGroupID:      progTypes([]ProgType{CGroupSKB}, tcProgTypes),
+	asm.SkCGroupID:               {CGroupSKB},
+	asm.SkAncestorCGroupID:       {CGroupSKB},
+	asm.TCPCheckSyncookie:        progTypes([]ProgType{XDP}, tcProgTypes),
+	asm.TCPGenSyncookie:          progTypes([]ProgType{XDP}, tcProgTypes),
+	asm.TCPRawGenSyncookieIPv4:   progTypes([]ProgType{XDP}, tcProgTypes),
+	asm.TCPRawGenSyncookieIPv6:   progTypes([]ProgType{XDP}, tcProgTypes),
+	asm.TCPRawCheckSyncookieIPv4: progTypes([]ProgType{XDP}, tcProgTypes),
+	asm.TCPRawCheckSyncookieIPv6: progTypes([]ProgType{XDP}, tcProgTypes),
+	asm.SkcToTCP6Sock:            skcToProgTypes,
+	asm.SkcToTCPSock:             skcToProgTypes,
+	asm.SkcToTCPTimewaitSock:     skcToProgTypes,
+	asm.SkcToTCPRequestSock:      skcToProgTypes,
+	asm.SkcToUDP6Sock:            skcToProgTypes,
+	asm.SkcToUnixSock:            skcToProgTypes,
+	asm.SkcToMPTCPSock:           skcToProgTypes,
+	asm.TCPSendAck:               {StructOps},
+
+	// Tracing
+	asm.ProbeRead:          tracingProgTypes,
+	asm.ProbeReadStr:       tracingProgTypes,
+	asm.ProbeWriteUser:     tracingProgTypes,
+	asm.GetStackID:         tracingProgTypes,
+	asm.GetStack:           tracingProgTypes,
+	asm.GetAttachCookie:    tracingProgTypes,
+	asm.OverrideReturn:     {Kprobe},
+	asm.GetFuncIP:          tracingProgTypes,
+	asm.GetFuncArg:         {Tracing},
+	asm.GetFuncRet:         {Tracing},
+	asm.GetFuncArgCnt:      {Tracing},
+	asm.PerfProgReadValue:  {PerfEvent},
+	asm.ReadBranchRecords:  {PerfEvent},
+	asm.DPath:              {Tracing, LSM},
+	asm.SKBOutput:          {Tracing},
+	asm.XDPOutput:          {Tracing},
+	asm.SeqPrintf:          {Tracing},
+	asm.SeqWrite:           {Tracing},
+	asm.SeqPrintfBTF:       {Tracing},
+	asm.InodeStorageGet:    {LSM, Tracing},
+	asm.InodeStorageDelete: {LSM, Tracing},
+	asm.BprmOptsSet:        {LSM},
+	asm.IMAInodeHash:       {LSM, Tracing},
+	asm.IMAFileHash:        {LSM, Tracing},
+
+	// Syscall
+	asm.SysBPF:             {Syscall},
+	asm.SysClose:           {Syscall},
+	asm.BTFFindByNameKind:  {Syscall},
+	asm.KallsymsLookupName: {Syscall},
+
+	// Traffic control
+	asm.GetRouteRealm:     progTypes(tcProgTypes, lwtProgTypes),
+	asm.SKBUnderCGroup:    progTypes(tcProgTypes, lwtProgTypes),
+	asm.GetHashRecalc:     progTypes(tcProgTypes, lwtProgTypes),
+	asm.CsumDiff:          progTypes(tcProgTypes, lwtProgTypes, []ProgType{XDP}),
+	asm.SKBVlanPush:       tcProgTypes,
+	asm.SKBVlanPop:        tcProgTypes,
+	asm.SKBChangeProto:    tcProgTypes,
+	asm.SKBChangeType:     tcProgTypes,
+	asm.CSUMUpdate:        append(tcProgTypes, LWTXmit),
+	asm.CSUMLevel:         append(tcProgTypes, LWTXmit),
+	asm.SetHashInvalid:    append(tcProgTypes, LWTXmit),
+	asm.SetHash:           tcProgTypes,
+	asm.SKBGetXFRMState:   tcProgTypes,
+	asm.SKBCGroupClassID:  tcProgTypes,
+	asm.RedirectNeigh:     tcProgTypes,
+	asm.RedirectPeer:      tcProgTypes,
+	asm.SKBSetTstamp:      tcProgTypes,
+	asm.CloneRedirect:     append(tcProgTypes, LWTXmit),
+	asm.CSUMReplaceL3:     append(tcProgTypes, LWTXmit),
+	asm.CSUMReplaceL4:     append(tcProgTypes, LWTXmit),
+	asm.SKBGetTunnelKey:   append(tcProgTypes, LWTXmit),
+	asm.SKBSetTunnelKey:   append(tcProgTypes, LWTXmit),
+	asm.SKBGetTunnelOpt:   append(tcProgTypes, LWTXmit),
+	asm.SKBSetTunnelOpt:   append(tcProgTypes, LWTXmit),
+	asm.SKBStoreBytes:     append(tcProgTypes, LWTXmit, SkSKB),
+	asm.SKBChangeTail:     append(tcProgTypes, LWTXmit, SkSKB),
+	asm.SKBChangeHead:     append(tcProgTypes, LWTXmit, SkSKB),
+	asm.SKBAdjustRoom:     append(tcProgTypes, SkSKB),
+	asm.SKBPullData:       append(tcProgTypes, SkSKB, LWTIn, LWTOut, LWTXmit, LWTSeg6Local),
+	asm.Redirect:          append(tcProgTypes, XDP, LWTXmit),
+	asm.FIBLookup:         append(tcProgTypes, XDP),
+	asm.CheckMTU:          append(tcProgTypes, XDP),
+	asm.SkAssign:          append(tcProgTypes, SkLookup),
+	asm.LWTPushEncap:      {LWTIn, LWTXmit},
+	asm.LWTSeg6StoreBytes: {LWTSeg6Local},
+	asm.LWTSeg6AdjustSRH:  {LWTSeg6Local},
+	asm.LWTSeg6Action:     {LWTSeg6Local},
+
+	// XDP
+	asm.XDPAdjustHead: {XDP},
+	asm.XDPAdjustMeta: {XDP},
+	asm.XDPAdjustTail: {XDP},
+	asm.XDPGetBuffLen: {XDP},
+	asm.XDPLoadBytes:  {XDP},
+	asm.XDPStoreBytes: {XDP},
+	asm.RedirectMap:   {XDP},
+
+	// Sockets
+	asm.SkRedirectMap:         {SkSKB},
+	asm.SkRedirectHash:        {SkSKB},
+	asm.MsgRedirectMap:        {SkMsg},
+	asm.MsgRedirectHash:       {SkMsg},
+	asm.MsgApplyBytes:         {SkMsg},
+	asm.MsgCorkBytes:          {SkMsg},
+	asm.MsgPullData:           {SkMsg},
+	asm.MsgPushData:           {SkMsg},
+	asm.MsgPopData:            {SkMsg},
+	asm.SockMapUpdate:         {SockOps},
+	asm.SockHashUpdate:        {SockOps},
+	asm.SockOpsCBFlagsSet:     {SockOps},
+	asm.LoadHdrOpt:            {SockOps},
+	asm.StoreHdrOpt:           {SockOps},
+	asm.ReserveHdrOpt:         {SockOps},
+	asm.SkSelectReuseport:     {SkReuseport},
+	asm.Bind:                  {CGroupSockAddr},
+	asm.SysctlGetName:         {CGroupSysctl},
+	asm.SysctlGetCurrentValue: {CGroupSysctl},
+	asm.SysctlGetNewValue:     {CGroupSysctl},
+	asm.SysctlSetNewValue:     {CGroupSysctl},
+
+	// Infrared remote controls
+	asm.RCRepeat:     {LircMode2},
+	asm.RCKeydown:    {LircMode2},
+	asm.RCPointerRel: {LircMode2},
+}
+
+// HelperAvailable returns true if a program of the given type may call
+// a helper. It returns false for helpers this package doesn't know.
+//
+// Extension and StructOps programs inherit the helpers of the program
+// or subsystem they attach to, and may call any helper.
+func HelperAvailable(typ ProgType, fn asm.BuiltinFunc) bool {
+	if typ == Extension || typ == StructOps {
+		return true
+	}
+
+	if baseHelpers[fn] {
+		return true
+	}
+
+	types, ok := helperProgTypes[fn]
+	if !ok {
+		return false
+	}
+
+	for _, t := range types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// isGPLCompatible mirrors license_is_gpl_compatible in the kernel.
+func isGPLCompatible(license string) bool {
+	switch license {
+	case "GPL", "GPL v2", "GPL and additional rights", "Dual BSD/GPL", "Dual MIT/GPL", "Dual MPL/GPL":
+		return true
+	default:
+		return false
+	}
+}
+
+// Lint checks that the helpers called by the program are available
+// to its type and compatible with its license.
+//
+// Returns an error describing all violations.
+func (ps *ProgramSpec) Lint() error {
+	return lintErr(ps.lint(ps.Name))
+}
+
+func (ps *ProgramSpec) lint(name string) []string {
+	var (
+		problems []string
+		seen     = make(map[asm.BuiltinFunc]bool)
+	)
+
+	for _, ins := range ps.Instructions {
+		if ins.OpCode.Class() != asm.JumpClass || ins.OpCode.JumpOp() != asm.Call || ins.Src == asm.R1 {
+			continue
+		}
+
+		fn := asm.BuiltinFunc(ins.Constant)
+		if seen[fn] {
+			continue
+		}
+		seen[fn] = true
+
+		if info, ok := fn.Info(); ok && info.GPLOnly && !isGPLCompatible(ps.License) {
+			problems = append(problems, fmt.Sprintf("program %s calls GPL-only helper %s but License is %s", name, fn, ps.License))
+		}
+
+		// The availability of unknown helpers can't be checked.
+		if _, ok := fn.Info(); ok && !HelperAvailable(ps.Type, fn) {
+			problems = append(problems, fmt.Sprintf("program %s: %s not allowed in %s", name, fn, ps.Type))
+		}
+	}
+
+	return problems
+}
+
+// Lint checks all programs in the collection, see ProgramSpec.Lint.
+func (cs *CollectionSpec) Lint() error {
+	names := make([]string, 0, len(cs.Programs))
+	for name := range cs.Programs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		problems = append(problems, cs.Programs[name].lint(name)...)
+	}
+	return lintErr(problems)
+}
+
+func lintErr(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "\n"))
+}
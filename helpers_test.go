@@ -0,0 +1,129 @@
+package ebpf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/newtools/ebpf/asm"
+)
+
+func TestCollectionSpecLint(t *testing.T) {
+	cs := &CollectionSpec{
+		Programs: map[string]*ProgramSpec{
+			"socket_x": {
+				Type: SocketFilter,
+				Instructions: asm.Instructions{
+					asm.ProbeRead.Call(),
+					asm.XDPAdjustHead.Call(),
+					asm.Return(),
+				},
+				License: "MIT",
+			},
+			"xdp_y": {
+				Type: XDP,
+				Instructions: asm.Instructions{
+					asm.XDPAdjustHead.Call(),
+					asm.KtimeGetNS.Call(),
+					asm.Return(),
+				},
+				License: "MIT",
+			},
+		},
+	}
+
+	err := cs.Lint()
+	if err == nil {
+		t.Fatal("Lint doesn't return an error")
+	}
+
+	msg := err.Error()
+	for _, want := range []string{
+		"program socket_x calls GPL-only helper ProbeRead but License is MIT",
+		"XDPAdjustHead not allowed in SocketFilter",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Error %q doesn't contain %q", msg, want)
+		}
+	}
+	if strings.Contains(msg, "xdp_y") {
+		t.Error("Valid program is reported:", msg)
+	}
+
+	cs.Programs["socket_x"].License = "Dual MIT/GPL"
+	cs.Programs["socket_x"].Type = Kprobe
+	if err := cs.Programs["socket_x"].Lint(); err == nil || strings.Contains(err.Error(), "GPL") {
+		t.Error("Expected only an availability error, got", err)
+	}
+}
+
+func TestHelperAvailable(t *testing.T) {
+	for fn := asm.BuiltinFunc(1); fn < 512; fn++ {
+		if _, ok := fn.Info(); !ok {
+			continue
+		}
+
+		if _, ok := helperProgTypes[fn]; !ok && !baseHelpers[fn] {
+			t.Errorf("Availability of %s is unknown", fn)
+		}
+	}
+
+	for _, tc := range []struct {
+		typ   ProgType
+		fn    asm.BuiltinFunc
+		allow bool
+	}{
+		{SocketFilter, asm.SKBLoadBytes, true},
+		{XDP, asm.SKBLoadBytes, false},
+		{Kprobe, asm.SKBLoadBytes, false},
+		{Kprobe, asm.SockFromFile, false},
+		{Tracing, asm.SockFromFile, true},
+		{XDP, asm.XDPOutput, false},
+		{XDP, asm.MapLookupElement, true},
+		{Extension, asm.XDPAdjustHead, true},
+		{SocketFilter, asm.BuiltinFunc(-1), false},
+	} {
+		if have := HelperAvailable(tc.typ, tc.fn); have != tc.allow {
+			t.Errorf("%s in %s: expected %t, got %t", tc.fn, tc.typ, tc.allow, have)
+		}
+	}
+}
+
+func TestHelperAvailableKernel(t *testing.T) {
+	for _, tc := range []struct {
+		typ ProgType
+		fn  asm.BuiltinFunc
+	}{
+		{SocketFilter, asm.SKBLoadBytes},
+		{SchedCLS, asm.SKBStoreBytes},
+		{XDP, asm.SKBStoreBytes},
+		{XDP, asm.XDPOutput},
+		{Kprobe, asm.ProbeRead},
+		{Kprobe, asm.SockFromFile},
+		{SchedCLS, asm.SkCGroupID},
+		{CGroupSKB, asm.SkCGroupID},
+	} {
+		spec := &ProgramSpec{
+			Type:    tc.typ,
+			License: "GPL",
+			Instructions: asm.Instructions{
+				tc.fn.Call(),
+				asm.Mov.Imm(asm.R0, 0),
+				asm.Return(),
+			},
+		}
+
+		// The verifier rejects the missing arguments of available
+		// helpers, and names unavailable helpers.
+		kernel := true
+		prog, err := NewProgramWithOptions(spec, ProgramOptions{LogLevel: 1})
+		if err == nil {
+			prog.Close()
+		} else if msg := err.Error(); strings.Contains(msg, "unknown func") || strings.Contains(msg, "cannot use helper") {
+			kernel = false
+		}
+
+		if have := HelperAvailable(tc.typ, tc.fn); have != kernel {
+			t.Errorf("%s in %s: kernel allows it: %t, HelperAvailable: %t", tc.fn, tc.typ, kernel, have)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package ebpf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/newtools/ebpf/btf"
+
+	"github.com/pkg/errors"
+)
+
+// kconfig maps CONFIG_* options to their unparsed values, like
+// y, m, 100 or "a string".
+//
+// Options which are "not set" have the value n.
+type kconfig map[string]string
+
+// loadKconfig reads the configuration of the running kernel.
+//
+// If path is empty, the configuration is read from /proc/config.gz
+// or /boot/config-<release>.
+func loadKconfig(path string) (kconfig, error) {
+	if path == "" {
+		release, err := kernelRelease()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, candidate := range []string{"/proc/config.gz", "/boot/config-" + release} {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+
+		if path == "" {
+			return nil, errors.New("can't find kernel config")
+		}
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read kernel config")
+	}
+
+	var rd io.Reader = bytes.NewReader(buf)
+	if bytes.HasPrefix(buf, []byte{0x1f, 0x8b}) {
+		rd, err = gzip.NewReader(rd)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s", path)
+		}
+	}
+
+	config, err := parseKconfig(rd)
+	return config, errors.Wrapf(err, "%s", path)
+}
+
+func parseKconfig(r io.Reader) (kconfig, error) {
+	config := make(kconfig)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "# CONFIG_") && strings.HasSuffix(line, " is not set") {
+			name := strings.TrimSuffix(strings.TrimPrefix(line, "# "), " is not set")
+			config[name] = "n"
+			continue
+		}
+
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], "CONFIG_") {
+			return nil, errors.Errorf("invalid line %q", line)
+		}
+
+		config[parts[0]] = parts[1]
+	}
+
+	return config, scanner.Err()
+}
+
+// Values of enum libbpf_tristate.
+const (
+	triNo     = 0
+	triYes    = 1
+	triModule = 2
+)
+
+// encodeKconfig converts the value of an option into the representation
+// of typ, following the conventions of libbpf.
+//
+// Booleans and enum libbpf_tristate accept y, n and m. Arrays of char
+// accept quoted strings, which are truncated to fit. Integers accept
+// decimal, octal and hexadecimal numbers.
+func encodeKconfig(buf []byte, typ btf.Type, value string, bo binary.ByteOrder) error {
+	switch t := btf.UnderlyingType(typ).(type) {
+	case *btf.Int:
+		if t.Encoding&btf.Bool != 0 {
+			switch value {
+			case "y":
+				buf[0] = 1
+			case "n":
+				buf[0] = 0
+			default:
+				return errors.Errorf("invalid value %q for bool", value)
+			}
+			return nil
+		}
+
+		return encodeKconfigInt(buf, int(t.Size), t.Encoding&btf.Signed != 0, value, bo)
+
+	case *btf.Enum:
+		if t.Name == "libbpf_tristate" {
+			var tri uint64
+			switch value {
+			case "y":
+				tri = triYes
+			case "m":
+				tri = triModule
+			case "n":
+				tri = triNo
+			default:
+				return errors.Errorf("invalid value %q for tristate", value)
+			}
+			return putUint(buf, int(t.Size), tri, bo)
+		}
+
+		return encodeKconfigInt(buf, int(t.Size), t.Signed, value, bo)
+
+	case *btf.Array:
+		elem, ok := btf.UnderlyingType(t.Type).(*btf.Int)
+		if !ok || elem.Size != 1 {
+			return errors.New("only arrays of char are supported")
+		}
+
+		str, err := strconv.Unquote(value)
+		if err != nil || !strings.HasPrefix(value, `"`) {
+			return errors.Errorf("invalid value %s for string", value)
+		}
+
+		if t.Nelems == 0 {
+			return nil
+		}
+
+		// Always leave space for the NUL terminator.
+		n := copy(buf[:t.Nelems-1], str)
+		buf[n] = 0
+		return nil
+
+	default:
+		return errors.Errorf("unsupported type %T", t)
+	}
+}
+
+func encodeKconfigInt(buf []byte, size int, signed bool, value string, bo binary.ByteOrder) error {
+	bits := size * 8
+	if signed {
+		n, err := strconv.ParseInt(value, 0, bits)
+		if err != nil {
+			return errors.Errorf("invalid value %q for %d bit integer", value, bits)
+		}
+		return putUint(buf, size, uint64(n), bo)
+	}
+
+	n, err := strconv.ParseUint(value, 0, bits)
+	if err != nil {
+		return errors.Errorf("invalid value %q for %d bit unsigned integer", value, bits)
+	}
+	return putUint(buf, size, n, bo)
+}
+
+func putUint(buf []byte, size int, value uint64, bo binary.ByteOrder) error {
+	switch size {
+	case 1:
+		buf[0] = byte(value)
+	case 2:
+		bo.PutUint16(buf, uint16(value))
+	case 4:
+		bo.PutUint32(buf, uint32(value))
+	case 8:
+		bo.PutUint64(buf, value)
+	default:
+		return errors.Errorf("unsupported integer size %d", size)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package ebpf
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/newtools/ebpf/btf"
+)
+
+func TestParseKconfig(t *testing.T) {
+	config, err := parseKconfig(strings.NewReader(`
+# Comment
+CONFIG_A=y
+CONFIG_B=0x10
+CONFIG_C="foo bar"
+# CONFIG_D is not set
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"CONFIG_A": "y",
+		"CONFIG_B": "0x10",
+		"CONFIG_C": `"foo bar"`,
+		"CONFIG_D": "n",
+	} {
+		if have := config[name]; have != want {
+			t.Errorf("%s: expected %s, got %s", name, want, have)
+		}
+	}
+
+	if _, err := parseKconfig(strings.NewReader("garbage")); err == nil {
+		t.Error("Parsing invalid lines doesn't return an error")
+	}
+}
+
+func TestEncodeKconfig(t *testing.T) {
+	u16 := &btf.Int{Size: 2}
+	s8 := &btf.Int{Size: 1, Encoding: btf.Signed}
+	boolean := &btf.Int{Size: 1, Encoding: btf.Bool}
+	tristate := &btf.Enum{Name: "libbpf_tristate", Size: 4}
+	str := &btf.Array{Type: &btf.Int{Size: 1, Encoding: btf.Signed}, Nelems: 4}
+
+	for _, test := range []struct {
+		typ   btf.Type
+		value string
+		want  []byte
+	}{
+		{u16, "0x102", []byte{2, 1}},
+		{u16, "010", []byte{8, 0}},
+		{s8, "-1", []byte{0xff}},
+		{boolean, "y", []byte{1}},
+		{boolean, "n", []byte{0}},
+		{tristate, "m", []byte{2, 0, 0, 0}},
+		{str, `"ab"`, []byte{'a', 'b', 0, 0}},
+		{str, `"abcdef"`, []byte{'a', 'b', 'c', 0}},
+		{&btf.Typedef{Name: "u16", Type: u16}, "1", []byte{1, 0}},
+	} {
+		buf := make([]byte, len(test.want))
+		if err := encodeKconfig(buf, test.typ, test.value, binary.LittleEndian); err != nil {
+			t.Errorf("%T %s: %s", test.typ, test.value, err)
+			continue
+		}
+
+		if string(buf) != string(test.want) {
+			t.Errorf("%T %s: expected %v, got %v", test.typ, test.value, test.want, buf)
+		}
+	}
+
+	for _, test := range []struct {
+		typ   btf.Type
+		value string
+	}{
+		{u16, "0x10000"},
+		{u16, "y"},
+		{s8, "128"},
+		{boolean, "m"},
+		{tristate, "1"},
+		{str, "ab"},
+	} {
+		buf := make([]byte, 8)
+		if err := encodeKconfig(buf, test.typ, test.value, binary.LittleEndian); err == nil {
+			t.Errorf("%T %s: expected an error", test.typ, test.value)
+		}
+	}
+}
+
+func TestKallsymsAddresses(t *testing.T) {
+	addrs, err := kallsymsAddresses(strings.NewReader(`ffffffff81000000 T _text
+ffffffffc0000000 t foo	[mod]
+ffffffff81000010 T bar
+`), map[string]bool{"_text": true, "foo": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(addrs) != 2 || addrs["_text"] != 0xffffffff81000000 || addrs["foo"] != 0xffffffffc0000000 {
+		t.Error("Unexpected addresses:", addrs)
+	}
+
+	_, err = kallsymsAddresses(strings.NewReader("0000000000000000 T _text\n"), map[string]bool{"_text": true})
+	if err == nil {
+		t.Error("Hidden addresses don't return an error")
+	}
+}
@@ -0,0 +1,691 @@
+package ebpf
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/newtools/ebpf/asm"
+	"github.com/newtools/ebpf/btf"
+
+	"github.com/pkg/errors"
+)
+
+// ELFObject is an ELF which is linked with others, see
+// LinkCollectionSpecFromReaders.
+type ELFObject struct {
+	// Name identifies the object in errors and warnings.
+	Name string
+	Code io.ReaderAt
+}
+
+// LinkCollectionSpec loads several object files and links them into a
+// single CollectionSpec, like llvm-link would.
+//
+// Programs may call global functions and refer to maps which are
+// defined in another object, by declaring them extern. A global
+// definition replaces weak definitions of the same name, otherwise the
+// first weak definition is used. Static functions and maps are private
+// to their object, and are renamed if they clash with a symbol of
+// another object. Data sections with the same name are concatenated.
+//
+// Defining a global function or map in multiple objects is an error.
+func LinkCollectionSpec(files []string, opts CollectionSpecOptions) (*CollectionSpec, error) {
+	objects := make([]ELFObject, 0, len(files))
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		objects = append(objects, ELFObject{file, f})
+	}
+
+	return LinkCollectionSpecFromReaders(objects, opts)
+}
+
+// LinkCollectionSpecFromReaders links several ELF into a single
+// CollectionSpec, see LinkCollectionSpec.
+func LinkCollectionSpecFromReaders(objects []ELFObject, opts CollectionSpecOptions) (*CollectionSpec, error) {
+	if len(objects) == 0 {
+		return nil, errors.New("no objects to link")
+	}
+
+	objs := make([]*elfObject, 0, len(objects))
+	names := make(map[string]bool)
+	for i, object := range objects {
+		if object.Name == "" {
+			return nil, errors.Errorf("object #%d has no name", i)
+		}
+		if names[object.Name] {
+			return nil, errors.Errorf("object %s is linked twice", object.Name)
+		}
+		names[object.Name] = true
+
+		obj, err := loadObject(object.Name, object.Code, opts)
+		if err != nil {
+			return nil, errors.Wrap(err, object.Name)
+		}
+		objs = append(objs, obj)
+	}
+
+	return linkObjects(objs, opts)
+}
+
+// elfObject is a single ELF, whose functions haven't been linked into
+// programs yet.
+type elfObject struct {
+	// name is empty unless the object is linked with others.
+	name string
+	maps map[string]*MapSpec
+	// Maps which contain a data section, or .kconfig.
+	dataMaps map[string]bool
+	// Maps which are private to the object, like static maps.
+	localMaps map[string]bool
+	// All functions by name, and whether they are global.
+	funcs   map[string]asm.Instructions
+	globals map[string]bool
+	// The BTF of the object and of each of its functions, if any.
+	btf       *btf.Spec
+	funcTypes map[string]*btf.Func
+	// Programs refer to the unlinked instructions in funcs.
+	progs []*ProgramSpec
+	// Functions and maps which may be replaced by a global definition.
+	weak map[string]bool
+	// The section which defines each function and map.
+	sections map[string]string
+	// Addresses of variables in .ksyms, which are already resolved.
+	ksyms map[string]uint64
+	// Jump labels generated while loading the object.
+	labels   map[string]bool
+	warnings []ELFWarning
+}
+
+// wrap adds the name of the object to err, if it has one.
+func (obj *elfObject) wrap(err error) error {
+	if obj.name == "" {
+		return err
+	}
+	return errors.Wrap(err, obj.name)
+}
+
+// linkObjects merges the maps and functions of objs, and links the
+// programs they contain.
+func linkObjects(objs []*elfObject, opts CollectionSpecOptions) (*CollectionSpec, error) {
+	renameLocalSymbols(objs)
+
+	maps, mapOwners, err := mergeMaps(objs)
+	if err != nil {
+		return nil, err
+	}
+
+	funcs, funcOwners, err := mergeFunctions(objs)
+	if err != nil {
+		return nil, err
+	}
+
+	linkedBTF, err := linkBTF(objs, funcOwners)
+	if err != nil {
+		return nil, errors.Wrap(err, "link BTF")
+	}
+
+	labels := make(map[string]bool)
+	for _, obj := range objs {
+		for label := range obj.labels {
+			labels[label] = true
+		}
+	}
+
+	var (
+		progs      = make(map[string]*ProgramSpec)
+		progOwners = make(map[string]*elfObject)
+		warnings   []ELFWarning
+	)
+
+	for _, obj := range objs {
+		for _, prog := range obj.progs {
+			if funcOwners[prog.Name] != obj {
+				// A weak program which is replaced by another
+				// object.
+				continue
+			}
+
+			insns, err := link(prog.Instructions, funcs)
+			if err != nil {
+				return nil, obj.wrap(errors.Wrapf(err, "program %s", prog.Name))
+			}
+
+			// Linked functions may come from other objects, so
+			// remove the labels of all of them.
+			if err := insns.UnlabelJumps(labels); err != nil {
+				return nil, obj.wrap(errors.Wrapf(err, "program %s", prog.Name))
+			}
+
+			if len(objs) > 1 {
+				prog.BTF = programBTF(linkedBTF, insns, funcOwners)
+			}
+
+			prog.Instructions = insns
+			progs[prog.Name] = prog
+			progOwners[prog.Name] = obj
+		}
+
+		for _, w := range obj.warnings {
+			w.Object = obj.name
+			warnings = append(warnings, w)
+		}
+	}
+
+	linked, err := linkWarnings(objs, maps, mapOwners, progs, progOwners)
+	if err != nil {
+		return nil, err
+	}
+	warnings = append(warnings, linked...)
+
+	sort.Slice(warnings, func(i, j int) bool {
+		a, b := warnings[i], warnings[j]
+		if a.Object != b.Object {
+			return a.Object < b.Object
+		}
+		if a.Section != b.Section {
+			return a.Section < b.Section
+		}
+		return a.Error() < b.Error()
+	})
+
+	if opts.Strict && len(warnings) > 0 {
+		msgs := make([]string, 0, len(warnings))
+		for _, w := range warnings {
+			msgs = append(msgs, w.Error())
+		}
+		return nil, errors.Errorf("strict mode: %s", strings.Join(msgs, "; "))
+	}
+
+	return &CollectionSpec{
+		Maps:     maps,
+		Programs: progs,
+		Warnings: warnings,
+	}, nil
+}
+
+// renameLocalSymbols makes the symbols which aren't visible outside of
+// their object unique, like static functions, static maps and jump
+// labels.
+//
+// Symbols are only renamed if they clash with a symbol of another
+// object, so that loading a single object doesn't change any names.
+func renameLocalSymbols(objs []*elfObject) {
+	exported := make(map[string]bool)
+	for _, obj := range objs {
+		for name, global := range obj.globals {
+			if global {
+				exported[name] = true
+			}
+		}
+
+		for name := range obj.maps {
+			if !obj.localMaps[name] {
+				exported[name] = true
+			}
+		}
+	}
+
+	claimed := make(map[string]bool)
+	for _, obj := range objs {
+		renames := make(map[string]string)
+		claim := func(sym string) {
+			unique := sym
+			for i := 1; exported[unique] || claimed[unique]; i++ {
+				unique = fmt.Sprintf("%s.%d", sym, i)
+			}
+
+			claimed[unique] = true
+			if unique != sym {
+				renames[sym] = unique
+			}
+		}
+
+		for _, fn := range obj.funcs {
+			for _, ins := range fn {
+				if sym := ins.Symbol; sym != "" && !obj.globals[sym] {
+					claim(sym)
+				}
+			}
+		}
+
+		for name := range obj.localMaps {
+			claim(name)
+		}
+
+		if len(renames) == 0 {
+			continue
+		}
+
+		for _, fn := range obj.funcs {
+			for i := range fn {
+				if unique, ok := renames[fn[i].Symbol]; ok {
+					fn[i].Symbol = unique
+				}
+				if unique, ok := renames[fn[i].Reference]; ok {
+					fn[i].Reference = unique
+				}
+			}
+		}
+
+		for _, m := range obj.maps {
+			if unique, ok := renames[m.Name]; ok {
+				m.Name = unique
+			}
+			if m.InnerMap != nil {
+				if unique, ok := renames[m.InnerMap.Name]; ok {
+					m.InnerMap.Name = unique
+				}
+			}
+			for i, kv := range m.Contents {
+				if ref, ok := kv.Value.(mapReference); ok {
+					if unique, ok := renames[string(ref)]; ok {
+						m.Contents[i].Value = mapReference(unique)
+					}
+				}
+			}
+		}
+
+		for name, unique := range renames {
+			if obj.labels[name] {
+				delete(obj.labels, name)
+				obj.labels[unique] = true
+			}
+
+			if fn, ok := obj.funcs[name]; ok {
+				delete(obj.funcs, name)
+				obj.funcs[unique] = fn
+				obj.globals[unique] = obj.globals[name]
+				delete(obj.globals, name)
+				obj.sections[unique] = obj.sections[name]
+			}
+
+			if typ, ok := obj.funcTypes[name]; ok {
+				delete(obj.funcTypes, name)
+				obj.funcTypes[unique] = typ
+			}
+
+			if m, ok := obj.maps[name]; ok {
+				delete(obj.maps, name)
+				obj.maps[unique] = m
+				delete(obj.localMaps, name)
+				obj.localMaps[unique] = true
+				obj.sections[unique] = obj.sections[name]
+			}
+		}
+	}
+}
+
+// mergeFunctions returns the functions of all objects by name, and the
+// object which defines each of them.
+func mergeFunctions(objs []*elfObject) (map[string]asm.Instructions, map[string]*elfObject, error) {
+	funcs := make(map[string]asm.Instructions)
+	owners := make(map[string]*elfObject)
+	for _, obj := range objs {
+		for name, fn := range obj.funcs {
+			if other := owners[name]; other != nil {
+				switch {
+				case obj.weak[name]:
+					continue
+				case !other.weak[name]:
+					return nil, nil, errors.Errorf("function %s is defined in both %s and %s", name, other.name, obj.name)
+				}
+			}
+
+			funcs[name] = fn
+			owners[name] = obj
+		}
+	}
+
+	return funcs, owners, nil
+}
+
+// linkBTF combines the BTF of objs, so that programs which call
+// functions of other objects keep their func and line info. Functions
+// refer to the Func of the object which defines them, even if they
+// were renamed.
+//
+// Returns nil if there is only a single object, since its BTF can be
+// used as is, or if no object has BTF.
+func linkBTF(objs []*elfObject, funcOwners map[string]*elfObject) (*btf.Spec, error) {
+	if len(objs) == 1 {
+		return nil, nil
+	}
+
+	var specs []*btf.Spec
+	for _, obj := range objs {
+		if obj.btf != nil {
+			specs = append(specs, obj.btf)
+		}
+	}
+
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	funcs := make(map[string]*btf.Func)
+	for name, obj := range funcOwners {
+		if typ := obj.funcTypes[name]; typ != nil {
+			funcs[name] = typ
+		}
+	}
+
+	return btf.Merge(specs, funcs)
+}
+
+// programBTF returns the BTF of a linked program, which is nil if one
+// of its functions comes from an object without BTF.
+func programBTF(linked *btf.Spec, insns asm.Instructions, funcOwners map[string]*elfObject) *btf.Spec {
+	for _, ins := range insns {
+		if obj := funcOwners[ins.Symbol]; obj != nil && obj.btf == nil {
+			return nil
+		}
+	}
+	return linked
+}
+
+// mergeMaps returns the maps of all objects by name, and the object
+// which defines each of them.
+//
+// Data sections of the same name are concatenated, and the instructions
+// which refer to them are adjusted to the new offsets.
+func mergeMaps(objs []*elfObject) (map[string]*MapSpec, map[string]*elfObject, error) {
+	maps := make(map[string]*MapSpec)
+	owners := make(map[string]*elfObject)
+	for _, obj := range objs {
+		for name, m := range obj.maps {
+			other := owners[name]
+			switch {
+			case other == nil:
+			case other.dataMaps[name] && obj.dataMaps[name]:
+				offset, err := appendDataSection(maps[name], m)
+				if err != nil {
+					return nil, nil, obj.wrap(errors.Wrapf(err, "section %s", name))
+				}
+
+				obj.relocateDataSection(name, offset)
+				continue
+			case obj.weak[name]:
+				continue
+			case !other.weak[name]:
+				return nil, nil, errors.Errorf("map %s is defined in both %s and %s", name, other.name, obj.name)
+			}
+
+			maps[name] = m
+			owners[name] = obj
+		}
+	}
+
+	return maps, owners, nil
+}
+
+// dataSectionAlignment is the alignment of data sections which are
+// appended to each other.
+const dataSectionAlignment = 8
+
+// appendDataSection appends the contents of src to dst, and returns the
+// offset of src in the value of dst.
+func appendDataSection(dst, src *MapSpec) (uint32, error) {
+	if dst.Flags != src.Flags || dst.Freeze != src.Freeze {
+		return 0, errors.New("incompatible flags")
+	}
+
+	offset := uint64(dst.ValueSize+dataSectionAlignment-1) &^ (dataSectionAlignment - 1)
+	size := offset + uint64(src.ValueSize)
+	if size > math.MaxUint32 {
+		return 0, errors.New("too large")
+	}
+
+	contents := func(m *MapSpec) ([]byte, error) {
+		if len(m.Contents) == 0 {
+			return nil, nil
+		}
+
+		data, ok := m.Contents[0].Value.([]byte)
+		if !ok || len(m.Contents) > 1 {
+			return nil, errors.Errorf("map %s: unexpected contents", m.Name)
+		}
+		return data, nil
+	}
+
+	dstData, err := contents(dst)
+	if err != nil {
+		return 0, err
+	}
+
+	srcData, err := contents(src)
+	if err != nil {
+		return 0, err
+	}
+
+	if dstData != nil || srcData != nil {
+		data := make([]byte, size)
+		copy(data, dstData)
+		copy(data[offset:], srcData)
+		dst.Contents = []MapKV{{uint32(0), data}}
+	}
+
+	dst.ValueSize = uint32(size)
+	dst.Value = appendDatasec(dst.Value, src.Value, uint32(offset), uint32(size))
+	return uint32(offset), nil
+}
+
+// appendDatasec combines the BTF of two data sections, where src starts
+// at offset. Returns nil if neither section has BTF.
+//
+// The result is a new Datasec, since the inputs belong to the BTF of
+// their objects.
+func appendDatasec(dst, src btf.Type, offset, size uint32) btf.Type {
+	dstSec, dstOK := dst.(*btf.Datasec)
+	srcSec, srcOK := src.(*btf.Datasec)
+	if !dstOK && !srcOK {
+		return nil
+	}
+
+	merged := &btf.Datasec{Size: size}
+	if dstOK {
+		merged.Name = dstSec.Name
+		merged.Vars = append(merged.Vars, dstSec.Vars...)
+	}
+
+	if srcOK {
+		if merged.Name == "" {
+			merged.Name = srcSec.Name
+		}
+		for _, vsi := range srcSec.Vars {
+			vsi.Offset += offset
+			merged.Vars = append(merged.Vars, vsi)
+		}
+	}
+
+	return merged
+}
+
+// relocateDataSection adds offset to all loads of a pointer into the
+// given data section.
+func (obj *elfObject) relocateDataSection(name string, offset uint32) {
+	for _, fn := range obj.funcs {
+		for i := range fn {
+			if fn[i].Reference == name && fn[i].Src == pseudoMapValue {
+				fn[i].Constant += int64(offset) << 32
+			}
+		}
+	}
+}
+
+// linkWarnings returns the maps which aren't used by any program or map,
+// and references which don't resolve to a map or function.
+//
+// Extern symbols which are left for Editor.RewriteConstant are
+// unresolved as well.
+func linkWarnings(objs []*elfObject, maps map[string]*MapSpec, mapOwners map[string]*elfObject, progs map[string]*ProgramSpec, progOwners map[string]*elfObject) ([]ELFWarning, error) {
+	var warnings []ELFWarning
+
+	used := make(map[string]bool)
+	for _, m := range maps {
+		if m.InnerMap != nil && m.InnerMap.Name != "" {
+			used[m.InnerMap.Name] = true
+		}
+
+		for _, kv := range m.Contents {
+			if ref, ok := kv.Value.(mapReference); ok {
+				used[string(ref)] = true
+			}
+		}
+	}
+
+	for name, prog := range progs {
+		obj := progOwners[name]
+		symbols, err := prog.Instructions.SymbolOffsets()
+		if err != nil {
+			return nil, obj.wrap(errors.Wrapf(err, "program %s", name))
+		}
+
+		unresolved := make(map[string]bool)
+		for _, ins := range prog.Instructions {
+			ref := ins.Reference
+			if ref == "" || unresolved[ref] {
+				continue
+			}
+
+			if maps[ref] != nil {
+				used[ref] = true
+				continue
+			}
+
+			if _, ok := symbols[ref]; ok {
+				continue
+			}
+
+			if _, ok := obj.ksyms[ref]; ok {
+				continue
+			}
+
+			unresolved[ref] = true
+			warnings = append(warnings, ELFWarning{
+				Object:  obj.name,
+				Section: obj.sections[name],
+				Symbol:  name,
+				Message: fmt.Sprintf("unresolved reference to %s", ref),
+			})
+		}
+	}
+
+	for name := range maps {
+		if used[name] {
+			continue
+		}
+
+		obj := mapOwners[name]
+		if obj.dataMaps[name] {
+			warnings = append(warnings, ELFWarning{
+				Object:  obj.name,
+				Section: name,
+				Message: "data section is not used by any program",
+			})
+			continue
+		}
+
+		warnings = append(warnings, ELFWarning{
+			Object:  obj.name,
+			Section: obj.sections[name],
+			Symbol:  name,
+			Message: "map is not used by any program",
+		})
+	}
+
+	return warnings, nil
+}
+
+// function is a contiguous part of a section, which starts at a
+// function symbol.
+type function struct {
+	insns  asm.Instructions
+	global bool
+}
+
+// splitFunctions splits insns at each symbol in symbols.
+//
+// The first instruction always starts a function, even if its symbol
+// isn't in symbols. Each function is a copy, so that appending to it
+// doesn't clobber its neighbours.
+func splitFunctions(insns asm.Instructions, symbols map[string]bool) []function {
+	var (
+		funcs []function
+		start int
+	)
+
+	for i := 1; i <= len(insns); i++ {
+		if i < len(insns) {
+			if _, ok := symbols[insns[i].Symbol]; !ok {
+				continue
+			}
+		}
+
+		global, ok := symbols[insns[start].Symbol]
+		if !ok {
+			// The function at the start of the section isn't
+			// tagged, treat it like older versions of the loader.
+			global = true
+		}
+
+		funcs = append(funcs, function{
+			append(asm.Instructions(nil), insns[start:i]...),
+			global,
+		})
+		start = i
+	}
+
+	return funcs
+}
+
+// link appends the functions called by insns to it. This includes
+// functions called by linked functions.
+//
+// Each function is only linked once, and the result doesn't share
+// memory with insns or funcs.
+func link(insns asm.Instructions, funcs map[string]asm.Instructions) (asm.Instructions, error) {
+	insns = append(asm.Instructions(nil), insns...)
+
+	linked := make(map[string]bool)
+	for _, ins := range insns {
+		if ins.Symbol != "" {
+			linked[ins.Symbol] = true
+		}
+	}
+
+	// Appended functions are scanned as well, since the loop
+	// re-evaluates the length of insns.
+	for i := 0; i < len(insns); i++ {
+		ins := insns[i]
+		if ins.OpCode.JumpOp() != asm.Call || ins.Src != asm.R1 || ins.Reference == "" {
+			continue
+		}
+
+		if linked[ins.Reference] {
+			continue
+		}
+
+		fn := funcs[ins.Reference]
+		if fn == nil {
+			return nil, errors.Errorf("call to unknown function %s", ins.Reference)
+		}
+
+		for _, ins := range fn {
+			if ins.Symbol != "" {
+				linked[ins.Symbol] = true
+			}
+		}
+		insns = append(insns, fn...)
+	}
+
+	return insns, nil
+}
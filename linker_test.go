@@ -0,0 +1,254 @@
+package ebpf
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/newtools/ebpf/asm"
+	"github.com/newtools/ebpf/btf"
+)
+
+func TestSplitFunctions(t *testing.T) {
+	insns := asm.Instructions{
+		asm.Mov.Imm(asm.R0, 0).Sym("first"),
+		asm.Return(),
+		asm.Mov.Imm(asm.R0, 1).Sym("label"),
+		asm.Return(),
+		asm.Mov.Imm(asm.R0, 2).Sym("second"),
+		asm.Return(),
+	}
+
+	funcs := splitFunctions(insns, map[string]bool{"first": true, "second": false})
+	if len(funcs) != 2 {
+		t.Fatal("Expected two functions, got", len(funcs))
+	}
+
+	if len(funcs[0].insns) != 4 || !funcs[0].global {
+		t.Error("First function is incorrect:", funcs[0])
+	}
+
+	if len(funcs[1].insns) != 2 || funcs[1].global {
+		t.Error("Second function is incorrect:", funcs[1])
+	}
+}
+
+func TestLink(t *testing.T) {
+	call := func(fn string) asm.Instruction {
+		return asm.Instruction{
+			OpCode:    asm.OpCode(asm.JumpClass).SetJumpOp(asm.Call),
+			Src:       asm.R1,
+			Constant:  -1,
+			Reference: fn,
+		}
+	}
+
+	funcs := map[string]asm.Instructions{
+		"a": {call("b").Sym("a"), asm.Return()},
+		"b": {call("a").Sym("b"), call("c"), asm.Return()},
+		"c": {asm.Mov.Imm(asm.R0, 0).Sym("c"), asm.Return()},
+		"d": {asm.Mov.Imm(asm.R0, 0).Sym("d"), asm.Return()},
+	}
+
+	prog := asm.Instructions{call("a").Sym("prog"), asm.Return()}
+	insns, err := link(prog, funcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	symbols, err := insns.SymbolOffsets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fn := range []string{"prog", "a", "b", "c"} {
+		if _, ok := symbols[fn]; !ok {
+			t.Error("Missing function", fn)
+		}
+	}
+
+	if _, ok := symbols["d"]; ok {
+		t.Error("Uncalled function is linked")
+	}
+
+	if len(insns) != 9 {
+		t.Error("Expected 9 instructions, got", len(insns))
+	}
+
+	if len(prog) != 2 {
+		t.Error("link modifies its input")
+	}
+
+	if _, err := link(asm.Instructions{call("missing")}, funcs); err == nil {
+		t.Error("Linking a missing function doesn't return an error")
+	}
+}
+
+func TestLinkCollectionSpec(t *testing.T) {
+	files := []string{"testdata/link_a.elf", "testdata/link_b.elf"}
+	spec, err := LinkCollectionSpec(files, CollectionSpecOptions{Strict: true})
+	if err != nil {
+		t.Fatal("Can't link ELF:", err)
+	}
+
+	for _, name := range []string{"linked", "linked_b"} {
+		if spec.Programs[name] == nil {
+			t.Error("Missing program", name)
+		}
+	}
+
+	data := spec.Maps[".data"]
+	if data == nil {
+		t.Fatal("Missing .data")
+	}
+	if data.ValueSize != 12 {
+		t.Error("Expected data sections to be concatenated, got size", data.ValueSize)
+	}
+
+	coll, err := NewCollection(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coll.Close()
+
+	ret, _, err := coll.Programs["linked"].Test(make([]byte, 14))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 20 * 2 from link_a, 2 * 3 from link_b and 1 from the global
+	// weak_fn, which replaces the weak one.
+	if ret != 47 {
+		t.Error("Expected 47, got", ret)
+	}
+
+	if _, err := LoadCollectionSpec("testdata/link_a.elf"); err == nil {
+		t.Error("Loading an object with extern functions doesn't fail")
+	}
+}
+
+func TestLinkRewriteConstants(t *testing.T) {
+	files := []string{"testdata/link_rodata_a.elf", "testdata/link_rodata_b.elf"}
+	spec, err := LinkCollectionSpec(files, CollectionSpecOptions{})
+	if err != nil {
+		t.Fatal("Can't link ELF:", err)
+	}
+
+	if size := spec.Maps[".rodata"].ValueSize; size != 12 {
+		t.Error("Expected .rodata to be concatenated, got size", size)
+	}
+
+	err = spec.RewriteConstants(map[string]interface{}{
+		"a_const": uint32(10),
+		"b_const": uint32(20),
+	})
+	if err != nil {
+		t.Fatal("Can't rewrite constants:", err)
+	}
+
+	coll, err := NewCollection(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coll.Close()
+
+	for name, want := range map[string]uint32{"rodata_a": 10, "rodata_b": 20} {
+		ret, _, err := coll.Programs[name].Test(make([]byte, 14))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ret != want {
+			t.Errorf("%s: expected %d, got %d", name, want, ret)
+		}
+	}
+}
+
+func TestLinkCollectionSpecBTF(t *testing.T) {
+	files := []string{"testdata/link_btf_a.elf", "testdata/link_btf_b.elf"}
+	spec, err := LinkCollectionSpec(files, CollectionSpecOptions{Strict: true})
+	if err != nil {
+		t.Fatal("Can't link ELF:", err)
+	}
+
+	for _, name := range []string{"counters", "counters.1"} {
+		if spec.Maps[name] == nil {
+			t.Error("Missing static map", name)
+		}
+	}
+
+	// btf_a calls both static helper functions, one of which is
+	// renamed, via b_value.
+	for name, funcs := range map[string]int{"btf_a": 4, "btf_b": 3} {
+		prog := spec.Programs[name]
+		if prog.BTF == nil {
+			t.Fatalf("%s: missing BTF", name)
+		}
+
+		info, err := prog.BTF.ProgramInfo(prog.Instructions, nativeEndian)
+		if err != nil {
+			t.Fatalf("%s: can't generate BTF: %v", name, err)
+		}
+
+		if n := len(info.FuncInfo) / btf.FuncInfoSize; n != funcs {
+			t.Errorf("%s: expected func info for %d functions, got %d", name, funcs, n)
+		}
+	}
+
+	coll, err := NewCollectionWithOptions(spec, CollectionOptions{
+		Programs: ProgramOptions{LogLevel: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coll.Close()
+
+	// The verifier only prints source lines if it accepted the BTF.
+	if log := coll.Programs["btf_a"].VerifierLog; !strings.Contains(log, "return x * 3;") {
+		t.Error("Verifier log doesn't contain line info of the other object:\n", log)
+	}
+
+	for name, want := range map[string]uint32{"btf_a": 4, "btf_b": 6} {
+		ret, _, err := coll.Programs[name].Test(make([]byte, 14))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ret != want {
+			t.Errorf("%s: expected %d, got %d", name, want, ret)
+		}
+	}
+
+	for name, want := range map[string]uint32{"counters": 1, "counters.1": 2} {
+		var value uint32
+		if _, err := coll.Maps[name].Get(uint32(0), &value); err != nil {
+			t.Fatal(err)
+		}
+
+		if value != want {
+			t.Errorf("%s: expected %d, got %d", name, want, value)
+		}
+	}
+}
+
+func TestLinkCollectionSpecDuplicates(t *testing.T) {
+	var objects []ELFObject
+	for _, name := range []string{"first", "second"} {
+		f, err := os.Open("testdata/link_b.elf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		objects = append(objects, ELFObject{name, f})
+	}
+
+	_, err := LinkCollectionSpecFromReaders(objects, CollectionSpecOptions{})
+	if err == nil {
+		t.Fatal("Linking duplicate functions doesn't fail")
+	}
+
+	if msg := err.Error(); !strings.Contains(msg, "first") || !strings.Contains(msg, "second") {
+		t.Error("Error doesn't name both objects:", err)
+	}
+}
@@ -2,8 +2,13 @@ package ebpf
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"unsafe"
 
+	"github.com/newtools/ebpf/btf"
+
 	"github.com/pkg/errors"
 	"golang.org/x/sys/unix"
 )
@@ -20,6 +25,31 @@ type MapSpec struct {
 	Flags      uint32
 	// InnerMap is used as a template for ArrayOfMaps and HashOfMaps
 	InnerMap *MapSpec
+
+	// Pinning is the pinning behaviour requested by the ELF the spec
+	// was loaded from.
+	Pinning PinType
+
+	// PinNamespace separates maps pinned with PinObjectNS. The ELF
+	// loader uses the SHA-1 of the object, the same as tc.
+	PinNamespace string
+
+	// Key and Value describe the layout of the map. They are nil
+	// unless the spec was loaded from an ELF with BTF.
+	Key, Value btf.Type
+
+	// Contents are written to the map after it has been created.
+	Contents []MapKV
+
+	// Freeze prevents user space from modifying the map once
+	// Contents have been written. Requires at least Linux 5.2.
+	Freeze bool
+}
+
+// MapKV is used to initialize the contents of a Map.
+type MapKV struct {
+	Key   interface{}
+	Value interface{}
 }
 
 func (ms *MapSpec) String() string {
@@ -34,9 +64,49 @@ func (ms *MapSpec) Copy() *MapSpec {
 
 	cpy := *ms
 	cpy.InnerMap = ms.InnerMap.Copy()
+	cpy.Contents = append([]MapKV(nil), ms.Contents...)
 	return &cpy
 }
 
+// pinPath returns where the map is pinned below root, or an empty
+// string if it isn't pinned.
+//
+// The layout of PinObjectNS and PinGlobalNS matches tc if root is
+// the mount point of bpffs.
+func (ms *MapSpec) pinPath(root string) (string, error) {
+	if ms.Pinning == PinNone || root == "" {
+		return "", nil
+	}
+
+	if ms.Name == "" {
+		return "", errors.Errorf("%s requires a name", ms.Pinning)
+	}
+
+	switch ms.Pinning {
+	case PinByName:
+		return filepath.Join(root, ms.Name), nil
+	case PinObjectNS:
+		if ms.PinNamespace == "" {
+			return "", errors.Errorf("%s requires a namespace", ms.Pinning)
+		}
+		return filepath.Join(root, "tc", ms.PinNamespace, ms.Name), nil
+	case PinGlobalNS:
+		return filepath.Join(root, "tc", "globals", ms.Name), nil
+	default:
+		return "", errors.Errorf("unsupported pin type %s", ms.Pinning)
+	}
+}
+
+// MapOptions control loading a map into the kernel.
+type MapOptions struct {
+	// PinPath is the root below which maps are pinned, usually the
+	// mount point of bpffs. MapSpec.Pinning is ignored if it is empty.
+	//
+	// Existing pinned maps are re-used if they are compatible with
+	// the spec, otherwise an error is returned.
+	PinPath string
+}
+
 // Map represents a Map file descriptor.
 //
 // It is not safe to close a map which is used by other goroutines.
@@ -57,6 +127,94 @@ type Map struct {
 // Creating a map for the first time will perform feature detection
 // by creating small, temporary maps.
 func NewMap(spec *MapSpec) (*Map, error) {
+	return NewMapWithOptions(spec, MapOptions{})
+}
+
+// NewMapWithOptions creates a new Map.
+//
+// Pinned maps are re-used if they exist, in which case Contents
+// are not written to the map.
+func NewMapWithOptions(spec *MapSpec, opts MapOptions) (*Map, error) {
+	path, err := spec.pinPath(opts.PinPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if path == "" {
+		return newMapFromSpec(spec)
+	}
+
+	m, err := loadPinnedMapForSpec(path, spec)
+	if err == nil {
+		return m, nil
+	}
+	if !os.IsNotExist(errors.Cause(err)) {
+		return nil, err
+	}
+
+	m, err = newMapFromSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		m.Close()
+		return nil, errors.Wrap(err, "can't create pin directory")
+	}
+
+	if err := m.Pin(path); err != nil {
+		m.Close()
+		return nil, errors.Wrapf(err, "can't pin map to %s", path)
+	}
+
+	return m, nil
+}
+
+// loadPinnedMapForSpec opens a pinned map and checks that it is
+// compatible with spec.
+func loadPinnedMapForSpec(path string, spec *MapSpec) (*Map, error) {
+	fd, err := bpfGetObject(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := bpfGetMapInfoByFD(fd)
+	if err != nil {
+		_ = fd.close()
+		return nil, errors.Wrapf(err, "pinned map %s", path)
+	}
+
+	want := newMapABIFromSpec(spec)
+	switch spec.Type {
+	case ArrayOfMaps, HashOfMaps:
+		want.ValueSize = 4
+	case PerfEventArray:
+		// The size of perf event arrays depends on the host, see
+		// createMap.
+		want.KeySize, want.ValueSize, want.MaxEntries = 4, 4, info.maxEntries
+	}
+
+	switch {
+	case MapType(info.mapType) != want.Type:
+		err = errors.Errorf("expected map type %s, have %s", want.Type, MapType(info.mapType))
+	case info.keySize != want.KeySize:
+		err = errors.Errorf("expected key size %d, have %d", want.KeySize, info.keySize)
+	case info.valueSize != want.ValueSize:
+		err = errors.Errorf("expected value size %d, have %d", want.ValueSize, info.valueSize)
+	case info.maxEntries != want.MaxEntries:
+		err = errors.Errorf("expected max entries %d, have %d", want.MaxEntries, info.maxEntries)
+	case info.flags != spec.Flags:
+		err = errors.Errorf("expected flags %d, have %d", spec.Flags, info.flags)
+	}
+	if err != nil {
+		_ = fd.close()
+		return nil, errors.Wrapf(err, "pinned map %s is incompatible", path)
+	}
+
+	return newMap(fd, want)
+}
+
+func newMapFromSpec(spec *MapSpec) (*Map, error) {
 	if spec.Type != ArrayOfMaps && spec.Type != HashOfMaps {
 		return createMap(spec, nil)
 	}
@@ -86,11 +244,11 @@ func createMap(spec *MapSpec, inner *bpfFD) (*Map, error) {
 		cpy.ValueSize = 4
 
 	case PerfEventArray:
-		if spec.KeySize != 0 {
-			return nil, errors.Errorf("KeySize must be zero for perf event array")
+		if spec.KeySize != 0 && spec.KeySize != 4 {
+			return nil, errors.Errorf("KeySize must be zero or four for perf event array")
 		}
-		if spec.ValueSize != 0 {
-			return nil, errors.Errorf("ValueSize must be zero for perf event array")
+		if spec.ValueSize != 0 && spec.ValueSize != 4 {
+			return nil, errors.Errorf("ValueSize must be zero or four for perf event array")
 		}
 		if spec.MaxEntries != 0 {
 			return nil, errors.Errorf("MaxEntries must be zero for perf event array")
@@ -126,7 +284,7 @@ func createMap(spec *MapSpec, inner *bpfFD) (*Map, error) {
 		return nil, errors.Wrap(err, "map create")
 	}
 
-	if haveObjName.Result() {
+	if haveObjName.Result() && (!strings.ContainsRune(spec.Name, '.') || haveObjNameDot.Result()) {
 		attr.mapName = name
 	}
 
@@ -135,7 +293,24 @@ func createMap(spec *MapSpec, inner *bpfFD) (*Map, error) {
 		return nil, errors.Wrap(err, "map create")
 	}
 
-	return newMap(fd, newMapABIFromSpec(&cpy))
+	m, err := newMap(fd, newMapABIFromSpec(&cpy))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.populate(spec.Contents); err != nil {
+		m.Close()
+		return nil, errors.Wrap(err, "map create: can't set initial contents")
+	}
+
+	if spec.Freeze {
+		if err := m.Freeze(); err != nil {
+			m.Close()
+			return nil, errors.Wrap(err, "map create")
+		}
+	}
+
+	return m, nil
 }
 
 func newMap(fd *bpfFD, abi *MapABI) (*Map, error) {
@@ -351,6 +526,23 @@ func (m *Map) Iterate() *MapIterator {
 	return newMapIterator(m)
 }
 
+// Freeze prevents a map from being modified from user space.
+//
+// It doesn't affect modifications from eBPF programs.
+// Requires at least Linux 5.2.
+func (m *Map) Freeze() error {
+	return errors.Wrap(bpfMapFreeze(m.fd), "can't freeze map")
+}
+
+func (m *Map) populate(contents []MapKV) error {
+	for _, kv := range contents {
+		if err := m.Put(kv.Key, kv.Value); err != nil {
+			return errors.Wrapf(err, "key %v", kv.Key)
+		}
+	}
+	return nil
+}
+
 // Close removes a Map
 func (m *Map) Close() error {
 	if m == nil {
@@ -2,14 +2,21 @@ package ebpf
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"math"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 	"unsafe"
 
 	"github.com/newtools/ebpf/asm"
+	"github.com/newtools/ebpf/btf"
 	"golang.org/x/sys/unix"
 
 	"github.com/pkg/errors"
@@ -51,6 +58,10 @@ type ProgramSpec struct {
 	Instructions  asm.Instructions
 	License       string
 	KernelVersion uint32
+
+	// BTF contains the type information of the ELF the program was
+	// loaded from, or nil if there is none.
+	BTF *btf.Spec
 }
 
 // Copy returns a copy of the spec.
@@ -65,6 +76,88 @@ func (ps *ProgramSpec) Copy() *ProgramSpec {
 	return &cpy
 }
 
+// Check performs a static analysis of the program before it is
+// loaded, and catches some mistakes that the verifier would reject.
+//
+// Pointers stored in the context are derived from Type.
+func (ps *ProgramSpec) Check() (*asm.CheckResult, error) {
+	return ps.Instructions.Check(asm.CheckOptions{
+		ContextPointers: contextPointers(ps.Type),
+	})
+}
+
+// Tag calculates the tag the kernel assigns to the program once it
+// is loaded, using h as the hash.
+//
+// Use it together with Program.Tag to find out whether a loaded program
+// matches the spec. References to maps must have been rewritten, use
+// CollectionSpec.ProgramTag for programs which are part of a collection.
+// TagHash returns the hash used by the current kernel.
+func (ps *ProgramSpec) Tag(h hash.Hash) (string, error) {
+	return ps.Instructions.Tag(nativeEndian, h)
+}
+
+// TagHash returns the hash the kernel uses to calculate program tags:
+// SHA-1, or SHA-256 as of Linux 6.18.
+//
+// The first call loads a small program into the kernel to find out,
+// and falls back to SHA-1 if that isn't possible.
+func TagHash() hash.Hash {
+	if haveSHA256Tags.Result() {
+		return sha256.New()
+	}
+	return sha1.New()
+}
+
+var haveSHA256Tags = featureTest{
+	Fn: func() bool {
+		insns := asm.Instructions{
+			asm.Mov.Imm(asm.R0, 0),
+			asm.Return(),
+		}
+
+		prog, err := NewProgram(&ProgramSpec{
+			Type:         SocketFilter,
+			Instructions: insns,
+			License:      "MIT",
+		})
+		if err != nil {
+			return false
+		}
+		defer prog.Close()
+
+		have, err := prog.Tag()
+		if err != nil {
+			return false
+		}
+
+		want, err := insns.Tag(nativeEndian, sha256.New())
+		return err == nil && have == want
+	},
+}
+
+// contextPointers returns the offsets of packet pointers
+// in the context of a program type.
+func contextPointers(typ ProgType) map[int16]asm.ValueKind {
+	switch typ {
+	case XDP:
+		// struct xdp_md
+		return map[int16]asm.ValueKind{
+			0: asm.PointerToPacket,
+			4: asm.PointerToPacketEnd,
+			8: asm.PointerToPacket,
+		}
+	case SchedCLS, SchedACT, CGroupSKB, LWTIn, LWTOut, LWTXmit, LWTSeg6Local, SkSKB:
+		// struct __sk_buff
+		return map[int16]asm.ValueKind{
+			76: asm.PointerToPacket,
+			80: asm.PointerToPacketEnd,
+		}
+	default:
+		return nil
+	}
+}
+
 // Program represents BPF program loaded into the kernel.
 //
 // It is not safe to close a Program which is used by other goroutines.
@@ -91,10 +184,19 @@ func NewProgram(spec *ProgramSpec) (*Program, error) {
 // Loading a program for the first time will perform
 // feature detection by loading small, temporary programs.
 func NewProgramWithOptions(spec *ProgramSpec, opts ProgramOptions) (*Program, error) {
-	attr, err := convertProgramSpec(spec, haveObjName.Result())
+	includeName := haveObjName.Result() && (!strings.ContainsRune(spec.Name, '.') || haveObjNameDot.Result())
+	attr, err := convertProgramSpec(spec, includeName)
+	if err != nil {
+		return nil, err
+	}
+
+	btfFD, err := loadProgramBTF(spec, attr)
 	if err != nil {
 		return nil, err
 	}
+	if btfFD != nil {
+		defer btfFD.close()
+	}
 
 	logSize := DefaultVerifierLogSize
 	if opts.LogSize > 0 {
@@ -133,7 +235,142 @@ func NewProgramWithOptions(spec *ProgramSpec, opts ProgramOptions) (*Program, er
 		logs += "\n(truncated...)"
 	}
 
-	return nil, &loadError{err, logs}
+	if btfFD != nil && errors.Cause(err) == unix.EINVAL && btfInfoRejected.MatchString(logs) {
+		// The kernel doesn't understand the func or line info. Retry
+		// without it, but keep the log of the first attempt if the
+		// program is invalid regardless.
+		withoutBTF := *attr
+		withoutBTF.progBTFFd = 0
+		withoutBTF.funcInfoRecSize, withoutBTF.funcInfo, withoutBTF.funcInfoCnt = 0, syscallPtr{}, 0
+		withoutBTF.lineInfoRecSize, withoutBTF.lineInfo, withoutBTF.lineInfoCnt = 0, syscallPtr{}, 0
+		withoutBTF.logLevel, withoutBTF.logSize, withoutBTF.logBuf = 0, 0, syscallPtr{}
+
+		var retryLog []byte
+		if opts.LogLevel > 0 {
+			retryLog = make([]byte, logSize)
+			withoutBTF.logLevel = opts.LogLevel
+			withoutBTF.logSize = uint32(len(retryLog))
+			withoutBTF.logBuf = newPtr(unsafe.Pointer(&retryLog[0]))
+		}
+
+		if fd, err := bpfProgLoad(&withoutBTF); err == nil {
+			prog := newProgram(fd, spec.Name, &ProgramABI{spec.Type})
+			prog.VerifierLog = convertCString(retryLog)
+			return prog, nil
+		}
+	}
+
+	return nil, &loadError{err, logs, failedInstructionSource(spec.Instructions, logs)}
+}
+
+// loadProgramBTF loads the BTF of a program into the kernel, and adds
+// func and line info to attr. This allows the verifier to refer to the
+// source code of the program.
+//
+// Returns nil if the program doesn't have BTF, or if the kernel doesn't
+// accept it, since the information is optional. BTF which doesn't
+// describe all functions of the program is an error though, since it
+// usually means that the program was changed after it was loaded.
+func loadProgramBTF(spec *ProgramSpec, attr *bpfProgLoadAttr) (*bpfFD, error) {
+	if spec.BTF == nil {
+		return nil, nil
+	}
+
+	info, err := spec.BTF.ProgramInfo(spec.Instructions, nativeEndian)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't generate BTF")
+	}
+
+	if len(info.BTF) == 0 {
+		return nil, errors.New("can't generate BTF: empty BTF")
+	}
+
+	fd, err := bpfBTFLoad(&bpfBTFLoadAttr{
+		btf:     newPtr(unsafe.Pointer(&info.BTF[0])),
+		btfSize: uint32(len(info.BTF)),
+	})
+	if err != nil {
+		// The kernel doesn't support BTF or some of the types in it.
+		return nil, nil
+	}
+
+	value, err := fd.value()
+	if err != nil {
+		return nil, err
+	}
+
+	attr.progBTFFd = value
+
+	if len(info.FuncInfo) > 0 {
+		attr.funcInfoRecSize = btf.FuncInfoSize
+		attr.funcInfo = newPtr(unsafe.Pointer(&info.FuncInfo[0]))
+		attr.funcInfoCnt = uint32(len(info.FuncInfo) / btf.FuncInfoSize)
+	}
+
+	if len(info.LineInfo) > 0 {
+		attr.lineInfoRecSize = btf.LineInfoSize
+		attr.lineInfo = newPtr(unsafe.Pointer(&info.LineInfo[0]))
+		attr.lineInfoCnt = uint32(len(info.LineInfo) / btf.LineInfoSize)
+	}
+
+	return fd, nil
+}
+
+// btfInfoRejected matches the verifier messages about invalid func or
+// line info, like "invalid func info rec size 8".
+//
+// This is a fragile way to decide whether to retry without BTF, since
+// the kernel doesn't return a distinct error. If the wording changes,
+// programs which the kernel only rejects because of their func or line
+// info fail to load instead of loading without them.
+var btfInfoRejected = regexp.MustCompile(`(func|line)[_ ]info`)
+
+// verifierInstruction matches the instructions printed by the verifier,
+// like "12: (85) call bpf_map_lookup_elem#1".
+var verifierInstruction = regexp.MustCompile(`^(\d+): \(`)
+
+// failedInstructionSource returns the source line of the instruction
+// that the verifier rejected, which is the last one in the log.
+//
+// Returns nil if the instruction or its source is unknown.
+func failedInstructionSource(insns asm.Instructions, log string) *asm.SourceLine {
+	lines := strings.Split(log, "\n")
+
+	offset := -1
+	for i := len(lines) - 1; i >= 0 && offset == -1; i-- {
+		match := verifierInstruction.FindStringSubmatch(lines[i])
+		if match == nil {
+			continue
+		}
+
+		var err error
+		offset, err = strconv.Atoi(match[1])
+		if err != nil {
+			return nil
+		}
+	}
+
+	if offset == -1 {
+		return nil
+	}
+
+	loadImmDW := asm.LoadImmOp(asm.DWord)
+	for _, ins := range insns {
+		if offset == 0 {
+			return ins.Source
+		}
+
+		offset--
+		if ins.OpCode == loadImmDW {
+			offset--
+		}
+
+		if offset < 0 {
+			return nil
+		}
+	}
+
+	return nil
 }
 
 func newProgram(fd *bpfFD, name string, abi *ProgramABI) *Program {
@@ -208,6 +445,19 @@ func (bpf *Program) FD() int {
 	return int(fd)
 }
 
+// Tag returns the tag assigned to the program by the kernel, which is
+// derived from its instructions.
+//
+// This function requires at least Linux 4.13.
+func (bpf *Program) Tag() (string, error) {
+	info, err := bpfGetProgInfoByFD(bpf.fd)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(info.tag[:]), nil
+}
+
 // Clone creates a duplicate of the Program.
 //
 // Closing the duplicate does not affect the original, and vice versa.
@@ -436,13 +686,20 @@ func SanitizeName(name string, replacement rune) string {
 type loadError struct {
 	cause       error
 	verifierLog string
+	// The line of source code the verifier rejected, if known.
+	source *asm.SourceLine
 }
 
 func (le *loadError) Error() string {
+	msg := "failed to load program"
+	if le.source != nil {
+		msg += " at " + le.source.String()
+	}
+
 	if le.verifierLog == "" {
-		return fmt.Sprintf("failed to load program: %s", le.cause)
+		return fmt.Sprintf("%s: %s", msg, le.cause)
 	}
-	return fmt.Sprintf("failed to load program: %s: %s", le.cause, le.verifierLog)
+	return fmt.Sprintf("%s: %s: %s", msg, le.cause, le.verifierLog)
 }
 
 func (le *loadError) Cause() error {
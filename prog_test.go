@@ -41,7 +41,12 @@ func TestProgramRun(t *testing.T) {
 
 	t.Log(ins)
 
-	prog, err := NewProgram(&ProgramSpec{"test", XDP, AttachNone, ins, "MIT", 0})
+	prog, err := NewProgram(&ProgramSpec{
+		Name:         "test",
+		Type:         XDP,
+		Instructions: ins,
+		License:      "MIT",
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -167,27 +172,35 @@ func TestProgramVerifierOutput(t *testing.T) {
 }
 
 func TestProgramName(t *testing.T) {
-	prog, err := NewProgram(&ProgramSpec{
-		Name: "test",
-		Type: SocketFilter,
-		Instructions: asm.Instructions{
-			asm.LoadImm(asm.R0, 0, asm.DWord),
-			asm.Return(),
-		},
-		License: "MIT",
-	})
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer prog.Close()
+	for _, name := range []string{"test", "test.1"} {
+		prog, err := NewProgram(&ProgramSpec{
+			Name: name,
+			Type: SocketFilter,
+			Instructions: asm.Instructions{
+				asm.LoadImm(asm.R0, 0, asm.DWord),
+				asm.Return(),
+			},
+			License: "MIT",
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		defer prog.Close()
 
-	info, err := bpfGetProgInfoByFD(prog.fd)
-	if err != nil {
-		t.Fatal(err)
-	}
+		info, err := bpfGetProgInfoByFD(prog.fd)
+		if err != nil {
+			t.Fatal(err)
+		}
 
-	if name := convertCString(info.name[:]); name != "test" {
-		t.Errorf("Name is not test, got '%s'", name)
+		want := name
+		if strings.ContainsRune(name, '.') && !haveObjNameDot.Result() {
+			// Older kernels don't allow dots in names.
+			want = ""
+		}
+
+		if have := convertCString(info.name[:]); have != want {
+			t.Errorf("Name is not %s, got '%s'", want, have)
+		}
 	}
 }
 
@@ -332,3 +345,36 @@ func ExampleProgram_unmarshalFromMap() {
 		panic(err)
 	}
 }
+
+func TestProgramTag(t *testing.T) {
+	spec, err := LoadCollectionSpec("testdata/loader-clang-8.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := make(map[string]string)
+	for name := range spec.Programs {
+		tag, err := spec.ProgramTag(name, TagHash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[name] = tag
+	}
+
+	coll, err := NewCollection(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coll.Close()
+
+	for name, prog := range coll.Programs {
+		have, err := prog.Tag()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if have != want[name] {
+			t.Errorf("%s: kernel tag %s doesn't match calculated tag %s", name, have, want[name])
+		}
+	}
+}
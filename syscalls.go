@@ -91,6 +91,8 @@ func invalidBPFObjNameChar(char rune) bool {
 	case char >= '0' && char <= '9':
 		fallthrough
 	case char == '_':
+		fallthrough
+	case char == '.':
 		return false
 	default:
 		return true
@@ -116,6 +118,10 @@ type bpfMapOpAttr struct {
 	flags   uint64
 }
 
+type bpfMapFreezeAttr struct {
+	mapFd uint32
+}
+
 type bpfMapInfo struct {
 	mapType    uint32
 	id         uint32
@@ -145,6 +151,21 @@ type bpfProgLoadAttr struct {
 	progName           bpfObjName // since 4.15 067cae47771c
 	progIfIndex        uint32     // since 4.15 1f6f4cb7ba21
 	expectedAttachType AttachType // since 4.17 5e43f899b03a
+	progBTFFd          uint32     // since 5.0  838e96904ff3
+	funcInfoRecSize    uint32     // since 5.0  838e96904ff3
+	funcInfo           syscallPtr
+	funcInfoCnt        uint32
+	lineInfoRecSize    uint32 // since 5.0  c454a46b5efd
+	lineInfo           syscallPtr
+	lineInfoCnt        uint32
+}
+
+type bpfBTFLoadAttr struct {
+	btf         syscallPtr
+	logBuf      syscallPtr
+	btfSize     uint32
+	btfLogSize  uint32
+	btfLogLevel uint32
 }
 
 type bpfProgInfo struct {
@@ -205,6 +226,15 @@ func bpfProgLoad(attr *bpfProgLoadAttr) (*bpfFD, error) {
 	}
 }
 
+func bpfBTFLoad(attr *bpfBTFLoadAttr) (*bpfFD, error) {
+	fd, err := bpfCall(_BTFLoad, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	if err != nil {
+		return nil, err
+	}
+
+	return newBPFFD(uint32(fd)), nil
+}
+
 func bpfMapCreate(attr *bpfMapCreateAttr) (*bpfFD, error) {
 	fd, err := bpfCall(_MapCreate, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
 	if err != nil {
@@ -274,6 +304,19 @@ func bpfMapGetNextKey(m *bpfFD, key, nextKeyOut syscallPtr) error {
 	return err
 }
 
+func bpfMapFreeze(m *bpfFD) error {
+	fd, err := m.value()
+	if err != nil {
+		return err
+	}
+
+	attr := bpfMapFreezeAttr{
+		mapFd: fd,
+	}
+	_, err = bpfCall(_MapFreeze, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	return err
+}
+
 const bpfFSType = 0xcafe4a11
 
 func bpfPinObject(fileName string, fd *bpfFD) error {
@@ -363,6 +406,36 @@ var haveObjName = featureTest{
 	},
 }
 
+var haveObjNameDot = featureTest{
+	Fn: func() bool {
+		if !haveObjName.Result() {
+			return false
+		}
+
+		name, err := newBPFObjName(".test")
+		if err != nil {
+			return false
+		}
+
+		attr := bpfMapCreateAttr{
+			mapType:    Array,
+			keySize:    4,
+			valueSize:  4,
+			maxEntries: 1,
+			mapName:    name,
+		}
+
+		// Dots are allowed in names since 5.2 3e0ddc4f3ff1
+		fd, err := bpfMapCreate(&attr)
+		if err != nil {
+			return false
+		}
+
+		_ = fd.close()
+		return true
+	},
+}
+
 func bpfGetMapFDByID(id uint32) (*bpfFD, error) {
 	// available from 4.13
 	attr := bpfGetFDByIDAttr{
@@ -9,6 +9,7 @@ func TestObjName(t *testing.T) {
 		"test":                         true,
 		"":                             true,
 		"a-b":                          false,
+		".rodata":                      true,
 		"yeah so":                      false,
 		"more_than_16_characters_long": true,
 	} {
@@ -0,0 +1,143 @@
+; This file excercises BTF map definitions in the .maps section.
+; It corresponds to the following C, with debug info trimmed down to
+; what BTF needs:
+;
+;   #define __uint(name, val) int (*name)[val]
+;   #define __type(name, val) typeof(val) *name
+;   #define __array(name, val) typeof(val) *name[]
+;
+;   char __license[] __section("license") = "MIT";
+;
+;   struct {
+;   	__uint(type, BPF_MAP_TYPE_HASH);
+;   	__type(key, uint32_t);
+;   	__type(value, uint64_t);
+;   	__uint(max_entries, 1);
+;   	__uint(map_flags, BPF_F_NO_PREALLOC);
+;   } hash_map __section(".maps");
+;
+;   struct {
+;   	__uint(type, BPF_MAP_TYPE_ARRAY);
+;   	__uint(key_size, 4);
+;   	__uint(value_size, 2);
+;   	__uint(max_entries, 2);
+;   	__uint(pinning, LIBBPF_PIN_BY_NAME);
+;   } array_map __section(".maps");
+;
+;   struct {
+;   	__uint(type, BPF_MAP_TYPE_ARRAY_OF_MAPS);
+;   	__type(key, uint32_t);
+;   	__uint(max_entries, 2);
+;   	__array(values, struct {
+;   		__uint(type, BPF_MAP_TYPE_HASH);
+;   		__type(key, uint32_t);
+;   		__type(value, uint32_t);
+;   		__uint(max_entries, 1);
+;   	});
+;   } array_of_hash_map __section(".maps");
+;
+;   __section("xdp") int xdp_prog() {
+;   	uint32_t key = 0;
+;   	map_lookup_elem(&hash_map, &key);
+;   	map_lookup_elem(&array_map, &key);
+;   	map_lookup_elem(&array_of_hash_map, &key);
+;   	return 0;
+;   }
+
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n32:64-S128"
+target triple = "bpf"
+
+%struct.hash_map = type { [1 x i32]*, i32*, i64*, [1 x i32]*, [1 x i32]* }
+%struct.array_map = type { [2 x i32]*, [4 x i32]*, [2 x i32]*, [2 x i32]*, [1 x i32]* }
+%struct.array_of_hash_map = type { [12 x i32]*, i32*, [2 x i32]*, [0 x %struct.inner_map*] }
+%struct.inner_map = type { [1 x i32]*, i32*, i32*, [1 x i32]* }
+
+@__license = dso_local global [4 x i8] c"MIT\00", section "license", align 1
+@hash_map = dso_local global %struct.hash_map zeroinitializer, section ".maps", align 8, !dbg !0
+@array_map = dso_local global %struct.array_map zeroinitializer, section ".maps", align 8, !dbg !30
+@array_of_hash_map = dso_local global %struct.array_of_hash_map zeroinitializer, section ".maps", align 8, !dbg !50
+
+define dso_local i32 @xdp_prog() section "xdp" !dbg !90 {
+  %key = alloca i32, align 4
+  store i32 0, i32* %key, align 4
+  %1 = bitcast i32* %key to i8*
+  %2 = call i8* inttoptr (i64 1 to i8* (i8*, i8*)*)(i8* bitcast (%struct.hash_map* @hash_map to i8*), i8* %1), !dbg !94
+  %3 = call i8* inttoptr (i64 1 to i8* (i8*, i8*)*)(i8* bitcast (%struct.array_map* @array_map to i8*), i8* %1), !dbg !94
+  %4 = call i8* inttoptr (i64 1 to i8* (i8*, i8*)*)(i8* bitcast (%struct.array_of_hash_map* @array_of_hash_map to i8*), i8* %1), !dbg !94
+  ret i32 0, !dbg !94
+}
+
+!llvm.dbg.cu = !{!2}
+!llvm.module.flags = !{!80, !81}
+
+!0 = !DIGlobalVariableExpression(var: !1, expr: !DIExpression())
+!1 = distinct !DIGlobalVariable(name: "hash_map", scope: !2, file: !3, line: 11, type: !5, isLocal: false, isDefinition: true)
+!2 = distinct !DICompileUnit(language: DW_LANG_C99, file: !3, producer: "handwritten", isOptimized: true, runtimeVersion: 0, emissionKind: FullDebug, globals: !4)
+!3 = !DIFile(filename: "btf_map.c", directory: "testdata")
+!4 = !{!0, !30, !50}
+
+; struct { type; key; value; max_entries; map_flags; } hash_map
+!5 = distinct !DICompositeType(tag: DW_TAG_structure_type, file: !3, line: 11, size: 320, elements: !6)
+!6 = !{!7, !12, !15, !17, !18}
+!7 = !DIDerivedType(tag: DW_TAG_member, name: "type", scope: !5, file: !3, line: 12, baseType: !8, size: 64)
+!8 = !DIDerivedType(tag: DW_TAG_pointer_type, baseType: !9, size: 64)
+!9 = !DICompositeType(tag: DW_TAG_array_type, baseType: !10, size: 32, elements: !11)
+!10 = !DIBasicType(name: "int", size: 32, encoding: DW_ATE_signed)
+!11 = !{!DISubrange(count: 1)}
+!12 = !DIDerivedType(tag: DW_TAG_member, name: "key", scope: !5, file: !3, line: 13, baseType: !13, size: 64, offset: 64)
+!13 = !DIDerivedType(tag: DW_TAG_pointer_type, baseType: !14, size: 64)
+!14 = !DIDerivedType(tag: DW_TAG_typedef, name: "uint32_t", file: !3, line: 3, baseType: !19)
+!15 = !DIDerivedType(tag: DW_TAG_member, name: "value", scope: !5, file: !3, line: 14, baseType: !16, size: 64, offset: 128)
+!16 = !DIDerivedType(tag: DW_TAG_pointer_type, baseType: !20, size: 64)
+!17 = !DIDerivedType(tag: DW_TAG_member, name: "max_entries", scope: !5, file: !3, line: 15, baseType: !8, size: 64, offset: 192)
+!18 = !DIDerivedType(tag: DW_TAG_member, name: "map_flags", scope: !5, file: !3, line: 16, baseType: !8, size: 64, offset: 256)
+!19 = !DIBasicType(name: "unsigned int", size: 32, encoding: DW_ATE_unsigned)
+!20 = !DIDerivedType(tag: DW_TAG_typedef, name: "uint64_t", file: !3, line: 4, baseType: !21)
+!21 = !DIBasicType(name: "unsigned long", size: 64, encoding: DW_ATE_unsigned)
+
+; struct { type; key_size; value_size; max_entries; pinning; } array_map
+!30 = !DIGlobalVariableExpression(var: !31, expr: !DIExpression())
+!31 = distinct !DIGlobalVariable(name: "array_map", scope: !2, file: !3, line: 19, type: !32, isLocal: false, isDefinition: true)
+!32 = distinct !DICompositeType(tag: DW_TAG_structure_type, file: !3, line: 19, size: 320, elements: !33)
+!33 = !{!34, !37, !40, !41, !42}
+!34 = !DIDerivedType(tag: DW_TAG_member, name: "type", scope: !32, file: !3, line: 20, baseType: !35, size: 64)
+!35 = !DIDerivedType(tag: DW_TAG_pointer_type, baseType: !36, size: 64)
+!36 = !DICompositeType(tag: DW_TAG_array_type, baseType: !10, size: 64, elements: !43)
+!37 = !DIDerivedType(tag: DW_TAG_member, name: "key_size", scope: !32, file: !3, line: 21, baseType: !38, size: 64, offset: 64)
+!38 = !DIDerivedType(tag: DW_TAG_pointer_type, baseType: !39, size: 64)
+!39 = !DICompositeType(tag: DW_TAG_array_type, baseType: !10, size: 128, elements: !44)
+!40 = !DIDerivedType(tag: DW_TAG_member, name: "value_size", scope: !32, file: !3, line: 22, baseType: !35, size: 64, offset: 128)
+!41 = !DIDerivedType(tag: DW_TAG_member, name: "max_entries", scope: !32, file: !3, line: 23, baseType: !35, size: 64, offset: 192)
+!42 = !DIDerivedType(tag: DW_TAG_member, name: "pinning", scope: !32, file: !3, line: 24, baseType: !8, size: 64, offset: 256)
+!43 = !{!DISubrange(count: 2)}
+!44 = !{!DISubrange(count: 4)}
+
+; struct { type; key; max_entries; values[]; } array_of_hash_map
+!50 = !DIGlobalVariableExpression(var: !51, expr: !DIExpression())
+!51 = distinct !DIGlobalVariable(name: "array_of_hash_map", scope: !2, file: !3, line: 27, type: !52, isLocal: false, isDefinition: true)
+!52 = distinct !DICompositeType(tag: DW_TAG_structure_type, file: !3, line: 27, size: 192, elements: !53)
+!53 = !{!54, !57, !58, !59}
+!54 = !DIDerivedType(tag: DW_TAG_member, name: "type", scope: !52, file: !3, line: 28, baseType: !55, size: 64)
+!55 = !DIDerivedType(tag: DW_TAG_pointer_type, baseType: !56, size: 64)
+!56 = !DICompositeType(tag: DW_TAG_array_type, baseType: !10, size: 384, elements: !63)
+!57 = !DIDerivedType(tag: DW_TAG_member, name: "key", scope: !52, file: !3, line: 29, baseType: !13, size: 64, offset: 64)
+!58 = !DIDerivedType(tag: DW_TAG_member, name: "max_entries", scope: !52, file: !3, line: 30, baseType: !35, size: 64, offset: 128)
+!59 = !DIDerivedType(tag: DW_TAG_member, name: "values", scope: !52, file: !3, line: 31, baseType: !60, offset: 192)
+!60 = !DICompositeType(tag: DW_TAG_array_type, baseType: !61, elements: !64)
+!61 = !DIDerivedType(tag: DW_TAG_pointer_type, baseType: !62, size: 64)
+!62 = distinct !DICompositeType(tag: DW_TAG_structure_type, file: !3, line: 31, size: 256, elements: !65)
+!63 = !{!DISubrange(count: 12)}
+!64 = !{!DISubrange(count: -1)}
+!65 = !{!66, !67, !68, !69}
+!66 = !DIDerivedType(tag: DW_TAG_member, name: "type", scope: !62, file: !3, line: 32, baseType: !8, size: 64)
+!67 = !DIDerivedType(tag: DW_TAG_member, name: "key", scope: !62, file: !3, line: 33, baseType: !13, size: 64, offset: 64)
+!68 = !DIDerivedType(tag: DW_TAG_member, name: "value", scope: !62, file: !3, line: 34, baseType: !13, size: 64, offset: 128)
+!69 = !DIDerivedType(tag: DW_TAG_member, name: "max_entries", scope: !62, file: !3, line: 35, baseType: !8, size: 64, offset: 192)
+
+!80 = !{i32 7, !"Dwarf Version", i32 4}
+!81 = !{i32 2, !"Debug Info Version", i32 3}
+
+!90 = distinct !DISubprogram(name: "xdp_prog", scope: !3, file: !3, line: 39, type: !91, scopeLine: 39, flags: DIFlagAllCallsDescribed, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!91 = !DISubroutineType(types: !92)
+!92 = !{!10}
+!94 = !DILocation(line: 41, column: 2, scope: !90)
@@ -0,0 +1,238 @@
+; This file excercises CO-RE relocations. It is not a valid BPF program.
+; It corresponds to the following C, with debug info trimmed down to
+; what BTF needs. Each function returns the result of a relocation.
+;
+;   struct s {
+;   	int a;
+;   	unsigned char b;
+;   	unsigned int c:4, d:4;
+;   	int gone;
+;   };
+;
+;   struct missing {
+;   	int x;
+;   };
+;
+;   enum e { ONE = 1, TWO, THREE };
+;
+;   char __license[] __section("license") = "MIT";
+;
+;   __section("socket/field_offset") int field_offset(struct s *p) {
+;   	return __builtin_preserve_field_info(p->a, BPF_FIELD_BYTE_OFFSET);
+;   }
+;
+;   __section("socket/field_size") int field_size(struct s *p) {
+;   	return __builtin_preserve_field_info(p->b, BPF_FIELD_BYTE_SIZE);
+;   }
+;
+;   __section("socket/field_exists") int field_exists(struct s *p) {
+;   	return __builtin_preserve_field_info(p->a, BPF_FIELD_EXISTS) |
+;   	       __builtin_preserve_field_info(p->gone, BPF_FIELD_EXISTS) << 1;
+;   }
+;
+;   __section("socket/field_signed") int field_signed(struct s *p) {
+;   	return __builtin_preserve_field_info(p->a, BPF_FIELD_SIGNED);
+;   }
+;
+;   __section("socket/bitfield") int bitfield(struct s *p) {
+;   	return __builtin_preserve_field_info(p->d, BPF_FIELD_LSHIFT_U64) << 8 |
+;   	       __builtin_preserve_field_info(p->d, BPF_FIELD_RSHIFT_U64);
+;   }
+;
+;   __section("socket/type_id") int type_id() {
+;   	return __builtin_btf_type_id(*(struct s *)0, BPF_TYPE_ID_TARGET);
+;   }
+;
+;   __section("socket/type_size") int type_size() {
+;   	return __builtin_preserve_type_info(*(struct s *)0, BPF_TYPE_SIZE);
+;   }
+;
+;   __section("socket/type_exists") int type_exists() {
+;   	return __builtin_preserve_type_info(*(struct s *)0, BPF_TYPE_EXISTS) |
+;   	       __builtin_preserve_type_info(*(struct missing *)0, BPF_TYPE_EXISTS) << 1;
+;   }
+;
+;   __section("socket/enum_value") int enum_value() {
+;   	return __builtin_preserve_enum_value(*(enum e *)ONE, BPF_ENUMVAL_VALUE);
+;   }
+;
+;   __section("socket/enum_exists") int enum_exists() {
+;   	return __builtin_preserve_enum_value(*(enum e *)ONE, BPF_ENUMVAL_EXISTS) |
+;   	       __builtin_preserve_enum_value(*(enum e *)THREE, BPF_ENUMVAL_EXISTS) << 1;
+;   }
+;
+;   __section("socket/load") int load(struct s *p) {
+;   	return p->b;
+;   }
+;
+;   __section("socket/poison") int poison(struct s *p) {
+;   	return __builtin_preserve_field_info(p->gone, BPF_FIELD_BYTE_OFFSET);
+;   }
+
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n32:64-S128"
+target triple = "bpf"
+
+%struct.s = type { i32, i8, i8, i32 }
+
+@__license = dso_local global [4 x i8] c"MIT\00", section "license", align 1
+@.str.one = private unnamed_addr constant [6 x i8] c"ONE:1\00", align 1
+@.str.three = private unnamed_addr constant [8 x i8] c"THREE:3\00", align 1
+
+define dso_local i32 @field_offset(i8* %ctx) section "socket/field_offset" !dbg !100 {
+  %p0 = bitcast i8* %ctx to %struct.s*
+  %g0 = call i8* @llvm.preserve.struct.access.index.p0i8.p0s_struct.ss(%struct.s* elementtype(%struct.s) %p0, i32 0, i32 0), !dbg !101, !llvm.preserve.access.index !5
+  %v0 = call i32 @llvm.bpf.preserve.field.info.p0i8(i8* %g0, i64 0), !dbg !101
+  ret i32 %v0, !dbg !101
+}
+
+define dso_local i32 @field_size(i8* %ctx) section "socket/field_size" !dbg !102 {
+  %p0 = bitcast i8* %ctx to %struct.s*
+  %g0 = call i8* @llvm.preserve.struct.access.index.p0i8.p0s_struct.ss(%struct.s* elementtype(%struct.s) %p0, i32 1, i32 1), !dbg !103, !llvm.preserve.access.index !5
+  %v0 = call i32 @llvm.bpf.preserve.field.info.p0i8(i8* %g0, i64 1), !dbg !103
+  ret i32 %v0, !dbg !103
+}
+
+define dso_local i32 @field_exists(i8* %ctx) section "socket/field_exists" !dbg !104 {
+  %p0 = bitcast i8* %ctx to %struct.s*
+  %g0 = call i8* @llvm.preserve.struct.access.index.p0i8.p0s_struct.ss(%struct.s* elementtype(%struct.s) %p0, i32 0, i32 0), !dbg !105, !llvm.preserve.access.index !5
+  %v0 = call i32 @llvm.bpf.preserve.field.info.p0i8(i8* %g0, i64 2), !dbg !105
+  %p1 = bitcast i8* %ctx to %struct.s*
+  %g1 = call i8* @llvm.preserve.struct.access.index.p0i8.p0s_struct.ss(%struct.s* elementtype(%struct.s) %p1, i32 3, i32 4), !dbg !105, !llvm.preserve.access.index !5
+  %v1 = call i32 @llvm.bpf.preserve.field.info.p0i8(i8* %g1, i64 2), !dbg !105
+  %sh = shl i32 %v1, 1
+  %r = or i32 %sh, %v0
+  ret i32 %r, !dbg !105
+}
+
+define dso_local i32 @field_signed(i8* %ctx) section "socket/field_signed" !dbg !106 {
+  %p0 = bitcast i8* %ctx to %struct.s*
+  %g0 = call i8* @llvm.preserve.struct.access.index.p0i8.p0s_struct.ss(%struct.s* elementtype(%struct.s) %p0, i32 0, i32 0), !dbg !107, !llvm.preserve.access.index !5
+  %v0 = call i32 @llvm.bpf.preserve.field.info.p0i8(i8* %g0, i64 3), !dbg !107
+  ret i32 %v0, !dbg !107
+}
+
+define dso_local i32 @bitfield(i8* %ctx) section "socket/bitfield" !dbg !108 {
+  %p0 = bitcast i8* %ctx to %struct.s*
+  %g0 = call i8* @llvm.preserve.struct.access.index.p0i8.p0s_struct.ss(%struct.s* elementtype(%struct.s) %p0, i32 2, i32 3), !dbg !109, !llvm.preserve.access.index !5
+  %v0 = call i32 @llvm.bpf.preserve.field.info.p0i8(i8* %g0, i64 4), !dbg !109
+  %p1 = bitcast i8* %ctx to %struct.s*
+  %g1 = call i8* @llvm.preserve.struct.access.index.p0i8.p0s_struct.ss(%struct.s* elementtype(%struct.s) %p1, i32 2, i32 3), !dbg !109, !llvm.preserve.access.index !5
+  %v1 = call i32 @llvm.bpf.preserve.field.info.p0i8(i8* %g1, i64 5), !dbg !109
+  %sh = shl i32 %v0, 8
+  %r = or i32 %sh, %v1
+  ret i32 %r, !dbg !109
+}
+
+define dso_local i32 @type_id(i8* %ctx) section "socket/type_id" !dbg !110 {
+  %t0 = call i64 @llvm.bpf.btf.type.id(i32 100, i64 1), !dbg !111, !llvm.preserve.access.index !5
+  %v0 = trunc i64 %t0 to i32
+  ret i32 %v0, !dbg !111
+}
+
+define dso_local i32 @type_size(i8* %ctx) section "socket/type_size" !dbg !112 {
+  %v0 = call i32 @llvm.bpf.preserve.type.info(i32 1, i64 1), !dbg !113, !llvm.preserve.access.index !5
+  ret i32 %v0, !dbg !113
+}
+
+define dso_local i32 @type_exists(i8* %ctx) section "socket/type_exists" !dbg !114 {
+  %v0 = call i32 @llvm.bpf.preserve.type.info(i32 2, i64 0), !dbg !115, !llvm.preserve.access.index !5
+  %v1 = call i32 @llvm.bpf.preserve.type.info(i32 3, i64 0), !dbg !115, !llvm.preserve.access.index !20
+  %sh = shl i32 %v1, 1
+  %r = or i32 %sh, %v0
+  ret i32 %r, !dbg !115
+}
+
+define dso_local i32 @enum_value(i8* %ctx) section "socket/enum_value" !dbg !116 {
+  %e0 = call i64 @llvm.bpf.preserve.enum.value(i32 4, i8* getelementptr inbounds ([6 x i8], [6 x i8]* @.str.one, i64 0, i64 0), i64 1), !dbg !117, !llvm.preserve.access.index !30
+  %v0 = trunc i64 %e0 to i32
+  ret i32 %v0, !dbg !117
+}
+
+define dso_local i32 @enum_exists(i8* %ctx) section "socket/enum_exists" !dbg !118 {
+  %e0 = call i64 @llvm.bpf.preserve.enum.value(i32 5, i8* getelementptr inbounds ([6 x i8], [6 x i8]* @.str.one, i64 0, i64 0), i64 0), !dbg !119, !llvm.preserve.access.index !30
+  %v0 = trunc i64 %e0 to i32
+  %e1 = call i64 @llvm.bpf.preserve.enum.value(i32 6, i8* getelementptr inbounds ([8 x i8], [8 x i8]* @.str.three, i64 0, i64 0), i64 0), !dbg !119, !llvm.preserve.access.index !30
+  %v1 = trunc i64 %e1 to i32
+  %sh = shl i32 %v1, 1
+  %r = or i32 %sh, %v0
+  ret i32 %r, !dbg !119
+}
+
+define dso_local i32 @load(i8* %ctx) section "socket/load" !dbg !120 {
+  %p0 = bitcast i8* %ctx to %struct.s*
+  %g0 = call i8* @llvm.preserve.struct.access.index.p0i8.p0s_struct.ss(%struct.s* elementtype(%struct.s) %p0, i32 1, i32 1), !dbg !121, !llvm.preserve.access.index !5
+  %b0 = load i8, i8* %g0, align 4, !dbg !121
+  %v0 = zext i8 %b0 to i32
+  ret i32 %v0, !dbg !121
+}
+
+define dso_local i32 @poison(i8* %ctx) section "socket/poison" !dbg !122 {
+  %p0 = bitcast i8* %ctx to %struct.s*
+  %g0 = call i8* @llvm.preserve.struct.access.index.p0i8.p0s_struct.ss(%struct.s* elementtype(%struct.s) %p0, i32 3, i32 4), !dbg !123, !llvm.preserve.access.index !5
+  %v0 = call i32 @llvm.bpf.preserve.field.info.p0i8(i8* %g0, i64 0), !dbg !123
+  ret i32 %v0, !dbg !123
+}
+
+declare i8* @llvm.preserve.struct.access.index.p0i8.p0s_struct.ss(%struct.s*, i32, i32)
+declare i32 @llvm.bpf.preserve.field.info.p0i8(i8*, i64)
+declare i32 @llvm.bpf.preserve.type.info(i32, i64)
+declare i64 @llvm.bpf.preserve.enum.value(i32, i8*, i64)
+declare i64 @llvm.bpf.btf.type.id(i32, i64)
+
+!llvm.dbg.cu = !{!2}
+!llvm.module.flags = !{!80, !81}
+
+!2 = distinct !DICompileUnit(language: DW_LANG_C99, file: !3, producer: "handwritten", isOptimized: true, runtimeVersion: 0, emissionKind: FullDebug)
+!3 = !DIFile(filename: "core.c", directory: "testdata")
+
+!5 = distinct !DICompositeType(tag: DW_TAG_structure_type, name: "s", file: !3, line: 1, size: 96, elements: !6)
+!6 = !{!7, !8, !9, !10, !11}
+!7 = !DIDerivedType(tag: DW_TAG_member, name: "a", scope: !5, file: !3, line: 2, baseType: !12, size: 32)
+!8 = !DIDerivedType(tag: DW_TAG_member, name: "b", scope: !5, file: !3, line: 3, baseType: !13, size: 8, offset: 32)
+!9 = !DIDerivedType(tag: DW_TAG_member, name: "c", scope: !5, file: !3, line: 4, baseType: !14, size: 4, offset: 40, flags: DIFlagBitField, extraData: i64 40)
+!10 = !DIDerivedType(tag: DW_TAG_member, name: "d", scope: !5, file: !3, line: 4, baseType: !14, size: 4, offset: 44, flags: DIFlagBitField, extraData: i64 40)
+!11 = !DIDerivedType(tag: DW_TAG_member, name: "gone", scope: !5, file: !3, line: 5, baseType: !12, size: 32, offset: 64)
+!12 = !DIBasicType(name: "int", size: 32, encoding: DW_ATE_signed)
+!13 = !DIBasicType(name: "unsigned char", size: 8, encoding: DW_ATE_unsigned_char)
+!14 = !DIBasicType(name: "unsigned int", size: 32, encoding: DW_ATE_unsigned)
+
+!20 = distinct !DICompositeType(tag: DW_TAG_structure_type, name: "missing", file: !3, line: 8, size: 32, elements: !21)
+!21 = !{!22}
+!22 = !DIDerivedType(tag: DW_TAG_member, name: "x", scope: !20, file: !3, line: 9, baseType: !12, size: 32)
+
+!30 = distinct !DICompositeType(tag: DW_TAG_enumeration_type, name: "e", file: !3, line: 12, baseType: !14, size: 32, elements: !31)
+!31 = !{!32, !33, !34}
+!32 = !DIEnumerator(name: "ONE", value: 1, isUnsigned: true)
+!33 = !DIEnumerator(name: "TWO", value: 2, isUnsigned: true)
+!34 = !DIEnumerator(name: "THREE", value: 3, isUnsigned: true)
+
+!40 = !DISubroutineType(types: !41)
+!41 = !{!12}
+
+!80 = !{i32 7, !"Dwarf Version", i32 4}
+!81 = !{i32 2, !"Debug Info Version", i32 3}
+
+!101 = !DILocation(line: 21, column: 2, scope: !100)
+!100 = distinct !DISubprogram(name: "field_offset", scope: !3, file: !3, line: 20, type: !40, scopeLine: 20, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!103 = !DILocation(line: 25, column: 2, scope: !102)
+!102 = distinct !DISubprogram(name: "field_size", scope: !3, file: !3, line: 24, type: !40, scopeLine: 24, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!105 = !DILocation(line: 29, column: 2, scope: !104)
+!104 = distinct !DISubprogram(name: "field_exists", scope: !3, file: !3, line: 28, type: !40, scopeLine: 28, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!107 = !DILocation(line: 34, column: 2, scope: !106)
+!106 = distinct !DISubprogram(name: "field_signed", scope: !3, file: !3, line: 33, type: !40, scopeLine: 33, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!109 = !DILocation(line: 38, column: 2, scope: !108)
+!108 = distinct !DISubprogram(name: "bitfield", scope: !3, file: !3, line: 37, type: !40, scopeLine: 37, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!111 = !DILocation(line: 43, column: 2, scope: !110)
+!110 = distinct !DISubprogram(name: "type_id", scope: !3, file: !3, line: 42, type: !40, scopeLine: 42, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!113 = !DILocation(line: 47, column: 2, scope: !112)
+!112 = distinct !DISubprogram(name: "type_size", scope: !3, file: !3, line: 46, type: !40, scopeLine: 46, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!115 = !DILocation(line: 51, column: 2, scope: !114)
+!114 = distinct !DISubprogram(name: "type_exists", scope: !3, file: !3, line: 50, type: !40, scopeLine: 50, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!117 = !DILocation(line: 56, column: 2, scope: !116)
+!116 = distinct !DISubprogram(name: "enum_value", scope: !3, file: !3, line: 55, type: !40, scopeLine: 55, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!119 = !DILocation(line: 60, column: 2, scope: !118)
+!118 = distinct !DISubprogram(name: "enum_exists", scope: !3, file: !3, line: 59, type: !40, scopeLine: 59, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!121 = !DILocation(line: 65, column: 2, scope: !120)
+!120 = distinct !DISubprogram(name: "load", scope: !3, file: !3, line: 64, type: !40, scopeLine: 64, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!123 = !DILocation(line: 69, column: 2, scope: !122)
+!122 = distinct !DISubprogram(name: "poison", scope: !3, file: !3, line: 68, type: !40, scopeLine: 68, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
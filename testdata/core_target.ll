@@ -0,0 +1,53 @@
+; This file provides the target BTF for core.ll, with a different
+; layout for the types used by CO-RE relocations. It corresponds to
+; the following C:
+;
+;   struct s {
+;   	long pad;
+;   	unsigned int a;
+;   	unsigned long b;
+;   	unsigned int c:4, pad2:7, d:6;
+;   };
+;
+;   enum e { ZERO, ONE = 10, TWO };
+;
+;   struct s s;
+;   enum e e;
+
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n32:64-S128"
+target triple = "bpf"
+
+@s = dso_local global [32 x i8] zeroinitializer, align 8, !dbg !0
+@e = dso_local global i32 0, align 4, !dbg !30
+
+!llvm.dbg.cu = !{!2}
+!llvm.module.flags = !{!80, !81}
+
+!0 = !DIGlobalVariableExpression(var: !1, expr: !DIExpression())
+!1 = distinct !DIGlobalVariable(name: "s", scope: !2, file: !3, line: 15, type: !5, isLocal: false, isDefinition: true)
+!2 = distinct !DICompileUnit(language: DW_LANG_C99, file: !3, producer: "handwritten", isOptimized: true, runtimeVersion: 0, emissionKind: FullDebug, globals: !4)
+!3 = !DIFile(filename: "core_target.c", directory: "testdata")
+!4 = !{!0, !30}
+
+!5 = distinct !DICompositeType(tag: DW_TAG_structure_type, name: "s", file: !3, line: 1, size: 256, elements: !6)
+!6 = !{!7, !8, !9, !10, !11, !12}
+!7 = !DIDerivedType(tag: DW_TAG_member, name: "pad", scope: !5, file: !3, line: 2, baseType: !13, size: 64)
+!8 = !DIDerivedType(tag: DW_TAG_member, name: "a", scope: !5, file: !3, line: 3, baseType: !14, size: 32, offset: 64)
+!9 = !DIDerivedType(tag: DW_TAG_member, name: "b", scope: !5, file: !3, line: 4, baseType: !15, size: 64, offset: 128)
+!10 = !DIDerivedType(tag: DW_TAG_member, name: "c", scope: !5, file: !3, line: 5, baseType: !14, size: 4, offset: 192, flags: DIFlagBitField, extraData: i64 192)
+!11 = !DIDerivedType(tag: DW_TAG_member, name: "pad2", scope: !5, file: !3, line: 5, baseType: !14, size: 7, offset: 196, flags: DIFlagBitField, extraData: i64 192)
+!12 = !DIDerivedType(tag: DW_TAG_member, name: "d", scope: !5, file: !3, line: 5, baseType: !14, size: 6, offset: 203, flags: DIFlagBitField, extraData: i64 192)
+!13 = !DIBasicType(name: "long", size: 64, encoding: DW_ATE_signed)
+!14 = !DIBasicType(name: "unsigned int", size: 32, encoding: DW_ATE_unsigned)
+!15 = !DIBasicType(name: "unsigned long", size: 64, encoding: DW_ATE_unsigned)
+
+!30 = !DIGlobalVariableExpression(var: !31, expr: !DIExpression())
+!31 = distinct !DIGlobalVariable(name: "e", scope: !2, file: !3, line: 16, type: !32, isLocal: false, isDefinition: true)
+!32 = distinct !DICompositeType(tag: DW_TAG_enumeration_type, name: "e", file: !3, line: 12, baseType: !14, size: 32, elements: !33)
+!33 = !{!34, !35, !36}
+!34 = !DIEnumerator(name: "ZERO", value: 0, isUnsigned: true)
+!35 = !DIEnumerator(name: "ONE", value: 10, isUnsigned: true)
+!36 = !DIEnumerator(name: "TWO", value: 11, isUnsigned: true)
+
+!80 = !{i32 7, !"Dwarf Version", i32 4}
+!81 = !{i32 2, !"Debug Info Version", i32 3}
@@ -0,0 +1,77 @@
+; This file excercises global variables, which are placed into the
+; .data, .rodata and .bss sections. It corresponds to the following C:
+;
+;   char __license[] __section("license") = "MIT";
+;
+;   static volatile const uint64_t magic = 7;
+;   static volatile const uint32_t arg = 1;
+;   volatile uint32_t counter = 5;
+;   volatile uint32_t total;
+;
+;   __section("socket") int global_data() {
+;   	total += counter;
+;   	return magic + arg + total + "hello"[1];
+;   }
+
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n32:64-S128"
+target triple = "bpf"
+
+@__license = dso_local global [4 x i8] c"MIT\00", section "license", align 1
+@magic = internal constant i64 7, align 8, !dbg !0
+@arg = internal constant i32 1, align 4, !dbg !10
+@counter = dso_local global i32 5, align 4, !dbg !20
+@total = dso_local global i32 0, align 4, !dbg !30
+@.str = private unnamed_addr constant [6 x i8] c"hello\00", align 1
+
+define dso_local i32 @global_data() section "socket" !dbg !90 {
+  %1 = load volatile i32, i32* @counter, align 4, !dbg !94
+  %2 = load volatile i32, i32* @total, align 4, !dbg !94
+  %3 = add i32 %2, %1, !dbg !94
+  store volatile i32 %3, i32* @total, align 4, !dbg !94
+  %4 = load volatile i64, i64* @magic, align 8, !dbg !95
+  %5 = load volatile i32, i32* @arg, align 4, !dbg !95
+  %6 = load volatile i32, i32* @total, align 4, !dbg !95
+  %7 = load volatile i8, i8* getelementptr inbounds ([6 x i8], [6 x i8]* @.str, i64 0, i64 1), align 1, !dbg !95
+  %8 = trunc i64 %4 to i32, !dbg !95
+  %9 = add i32 %8, %5, !dbg !95
+  %10 = add i32 %9, %6, !dbg !95
+  %11 = sext i8 %7 to i32, !dbg !95
+  %12 = add i32 %10, %11, !dbg !95
+  ret i32 %12, !dbg !95
+}
+
+!llvm.dbg.cu = !{!2}
+!llvm.module.flags = !{!80, !81}
+
+!0 = !DIGlobalVariableExpression(var: !1, expr: !DIExpression())
+!1 = distinct !DIGlobalVariable(name: "magic", scope: !2, file: !3, line: 3, type: !5, isLocal: true, isDefinition: true)
+!2 = distinct !DICompileUnit(language: DW_LANG_C99, file: !3, producer: "handwritten", isOptimized: true, runtimeVersion: 0, emissionKind: FullDebug, globals: !4)
+!3 = !DIFile(filename: "global_data.c", directory: "testdata")
+!4 = !{!0, !10, !20, !30}
+!5 = !DIDerivedType(tag: DW_TAG_const_type, baseType: !6)
+!6 = !DIDerivedType(tag: DW_TAG_volatile_type, baseType: !7)
+!7 = !DIDerivedType(tag: DW_TAG_typedef, name: "uint64_t", file: !3, line: 1, baseType: !8)
+!8 = !DIBasicType(name: "unsigned long", size: 64, encoding: DW_ATE_unsigned)
+
+!10 = !DIGlobalVariableExpression(var: !11, expr: !DIExpression())
+!11 = distinct !DIGlobalVariable(name: "arg", scope: !2, file: !3, line: 4, type: !12, isLocal: true, isDefinition: true)
+!12 = !DIDerivedType(tag: DW_TAG_const_type, baseType: !13)
+!13 = !DIDerivedType(tag: DW_TAG_volatile_type, baseType: !14)
+!14 = !DIDerivedType(tag: DW_TAG_typedef, name: "uint32_t", file: !3, line: 2, baseType: !15)
+!15 = !DIBasicType(name: "unsigned int", size: 32, encoding: DW_ATE_unsigned)
+
+!20 = !DIGlobalVariableExpression(var: !21, expr: !DIExpression())
+!21 = distinct !DIGlobalVariable(name: "counter", scope: !2, file: !3, line: 5, type: !13, isLocal: false, isDefinition: true)
+
+!30 = !DIGlobalVariableExpression(var: !31, expr: !DIExpression())
+!31 = distinct !DIGlobalVariable(name: "total", scope: !2, file: !3, line: 6, type: !13, isLocal: false, isDefinition: true)
+
+!80 = !{i32 7, !"Dwarf Version", i32 4}
+!81 = !{i32 2, !"Debug Info Version", i32 3}
+
+!90 = distinct !DISubprogram(name: "global_data", scope: !3, file: !3, line: 11, type: !91, scopeLine: 11, flags: DIFlagAllCallsDescribed, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!91 = !DISubroutineType(types: !92)
+!92 = !{!93}
+!93 = !DIBasicType(name: "int", size: 32, encoding: DW_ATE_signed)
+!94 = !DILocation(line: 12, column: 8, scope: !90)
+!95 = !DILocation(line: 13, column: 2, scope: !90)
@@ -0,0 +1,55 @@
+; This file excercises map definitions in the format used by iproute2,
+; including pinning and maps of maps. It corresponds to the following C:
+;
+;   char __license[] __section("license") = "MIT";
+;
+;   struct bpf_elf_map inner_map __section("maps") = {
+;   	.type = BPF_MAP_TYPE_ARRAY, .size_key = 4, .size_value = 4, .max_elem = 1,
+;   	.id = 1, .pinning = PIN_GLOBAL_NS, .inner_idx = 0,
+;   };
+;   struct bpf_elf_map outer_map __section("maps") = {
+;   	.type = BPF_MAP_TYPE_ARRAY_OF_MAPS, .size_key = 4, .size_value = 4, .max_elem = 1,
+;   	.pinning = PIN_OBJECT_NS, .inner_id = 1, .inner_idx = -1,
+;   };
+;
+;   __section("socket") int iproute2() {
+;   	uint32_t key = 0;
+;   	void *inner = map_lookup_elem(&outer_map, &key);
+;   	if (!inner)
+;   		return -1;
+;   	uint32_t *value = map_lookup_elem(inner, &key);
+;   	if (!value)
+;   		return -1;
+;   	return *value;
+;   }
+
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n32:64-S128"
+target triple = "bpf"
+
+%struct.bpf_elf_map = type { i32, i32, i32, i32, i32, i32, i32, i32, i32 }
+
+@__license = dso_local global [4 x i8] c"MIT\00", section "license", align 1
+@inner_map = dso_local global %struct.bpf_elf_map { i32 2, i32 4, i32 4, i32 1, i32 0, i32 1, i32 2, i32 0, i32 0 }, section "maps", align 4
+@outer_map = dso_local global %struct.bpf_elf_map { i32 12, i32 4, i32 4, i32 1, i32 0, i32 0, i32 1, i32 1, i32 -1 }, section "maps", align 4
+
+define dso_local i32 @iproute2() section "socket" {
+  %key = alloca i32, align 4
+  store i32 0, i32* %key, align 4
+  %k = bitcast i32* %key to i8*
+  %inner = call i8* inttoptr (i64 1 to i8* (i8*, i8*)*)(i8* bitcast (%struct.bpf_elf_map* @outer_map to i8*), i8* %k)
+  %no_inner = icmp eq i8* %inner, null
+  br i1 %no_inner, label %fail, label %lookup
+
+lookup:
+  %value = call i8* inttoptr (i64 1 to i8* (i8*, i8*)*)(i8* %inner, i8* %k)
+  %no_value = icmp eq i8* %value, null
+  br i1 %no_value, label %fail, label %done
+
+done:
+  %ptr = bitcast i8* %value to i32*
+  %ret = load i32, i32* %ptr, align 4
+  ret i32 %ret
+
+fail:
+  ret i32 -1
+}
@@ -0,0 +1,38 @@
+/* Instructions introduced by -mcpu=v4, which LLVM only emits
+ * starting with version 17. They are spelled out as raw bytes so
+ * that older assemblers can build this file.
+ */
+	.section	xdp,"ax",@progbits
+	.globl	isa_v4
+	.type	isa_v4,@function
+isa_v4:
+	/* r2 = -84; r2 s/= 2 */
+	.byte	0xb7, 0x02, 0x00, 0x00, 0xac, 0xff, 0xff, 0xff
+	.byte	0x37, 0x02, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00
+	/* r3 = -85; r3 s%= 43 */
+	.byte	0xb7, 0x03, 0x00, 0x00, 0xab, 0xff, 0xff, 0xff
+	.byte	0x97, 0x03, 0x01, 0x00, 0x2b, 0x00, 0x00, 0x00
+	/* *(u16 *)(r10 - 2) = -2; r4 = *(s16 *)(r10 - 2) */
+	.byte	0x6a, 0x0a, 0xfe, 0xff, 0xfe, 0xff, 0xff, 0xff
+	.byte	0x89, 0xa4, 0xfe, 0xff, 0x00, 0x00, 0x00, 0x00
+	/* r5 = (s8)r4; r5 = bswap16 r5 */
+	.byte	0xbf, 0x45, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00
+	.byte	0xd7, 0x05, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00
+	/* if r3 != -42 goto +1; gotol +2; r0 = 0; exit */
+	.byte	0x55, 0x03, 0x01, 0x00, 0xd6, 0xff, 0xff, 0xff
+	.byte	0x06, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00
+	.byte	0xb7, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00
+	.byte	0x95, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00
+	/* r0 = r2 + r3 + r4 + r5 */
+	.byte	0xbf, 0x20, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00
+	.byte	0x0f, 0x30, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00
+	.byte	0x0f, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00
+	.byte	0x0f, 0x50, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00
+	/* exit */
+	.byte	0x95, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00
+	.size	isa_v4, .-isa_v4
+
+	.section	license,"aw",@progbits
+	.globl	__license
+__license:
+	.asciz	"MIT"
@@ -0,0 +1,131 @@
+; This file excercises extern variables in the .kconfig and .ksyms
+; sections. It corresponds to the following C:
+;
+;   enum libbpf_tristate { TRI_NO = 0, TRI_YES = 1, TRI_MODULE = 2 };
+;
+;   char __license[] __section("license") = "MIT";
+;
+;   extern unsigned int LINUX_KERNEL_VERSION __kconfig;
+;   extern unsigned int CONFIG_HZ __kconfig;
+;   extern bool CONFIG_BPF __kconfig;
+;   extern enum libbpf_tristate CONFIG_TRISTATE __kconfig;
+;   extern char CONFIG_DEFAULT_HOSTNAME[8] __kconfig;
+;   extern unsigned int CONFIG_MISSING __kconfig __weak;
+;   extern const void _text __ksym;
+;
+;   __section("socket/kernel_version") int kernel_version() { return LINUX_KERNEL_VERSION; }
+;   __section("socket/hz") int hz() { return CONFIG_HZ; }
+;   __section("socket/bool") int bool() { return CONFIG_BPF; }
+;   __section("socket/tristate") int tristate() { return CONFIG_TRISTATE; }
+;   __section("socket/string") int string() { return CONFIG_DEFAULT_HOSTNAME[1]; }
+;   __section("socket/missing") int missing() { return CONFIG_MISSING; }
+;   __section("socket/ksym") int ksym() { return (unsigned long)&_text; }
+
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n32:64-S128"
+target triple = "bpf"
+
+@__license = dso_local global [4 x i8] c"MIT\00", section "license", align 1
+@LINUX_KERNEL_VERSION = external dso_local global i32, section ".kconfig", align 4, !dbg !0
+@CONFIG_HZ = external dso_local global i32, section ".kconfig", align 4, !dbg !10
+@CONFIG_BPF = external dso_local global i8, section ".kconfig", align 1, !dbg !20
+@CONFIG_TRISTATE = external dso_local global i32, section ".kconfig", align 4, !dbg !30
+@CONFIG_DEFAULT_HOSTNAME = external dso_local global [8 x i8], section ".kconfig", align 1, !dbg !40
+@CONFIG_MISSING = extern_weak dso_local global i32, section ".kconfig", align 4, !dbg !50
+@_text = external dso_local global i8, section ".ksyms", align 1, !dbg !60
+
+define dso_local i32 @kernel_version() section "socket/kernel_version" !dbg !100 {
+  %1 = load volatile i32, i32* @LINUX_KERNEL_VERSION, align 4, !dbg !200
+  ret i32 %1, !dbg !200
+}
+
+define dso_local i32 @hz() section "socket/hz" !dbg !101 {
+  %1 = load volatile i32, i32* @CONFIG_HZ, align 4, !dbg !201
+  ret i32 %1, !dbg !201
+}
+
+define dso_local i32 @bool() section "socket/bool" !dbg !102 {
+  %1 = load volatile i8, i8* @CONFIG_BPF, align 1, !dbg !202
+  %2 = zext i8 %1 to i32, !dbg !202
+  ret i32 %2, !dbg !202
+}
+
+define dso_local i32 @tristate() section "socket/tristate" !dbg !103 {
+  %1 = load volatile i32, i32* @CONFIG_TRISTATE, align 4, !dbg !203
+  ret i32 %1, !dbg !203
+}
+
+define dso_local i32 @string() section "socket/string" !dbg !104 {
+  %1 = load volatile i8, i8* getelementptr ([8 x i8], [8 x i8]* @CONFIG_DEFAULT_HOSTNAME, i64 0, i64 1), align 1, !dbg !204
+  %2 = sext i8 %1 to i32, !dbg !204
+  ret i32 %2, !dbg !204
+}
+
+define dso_local i32 @missing() section "socket/missing" !dbg !105 {
+  %1 = load volatile i32, i32* @CONFIG_MISSING, align 4, !dbg !205
+  ret i32 %1, !dbg !205
+}
+
+define dso_local i32 @ksym() section "socket/ksym" !dbg !106 {
+  %1 = ptrtoint i8* @_text to i64, !dbg !206
+  %2 = trunc i64 %1 to i32, !dbg !206
+  ret i32 %2, !dbg !206
+}
+
+!llvm.dbg.cu = !{!2}
+!llvm.module.flags = !{!80, !81}
+
+!0 = !DIGlobalVariableExpression(var: !1, expr: !DIExpression())
+!1 = distinct !DIGlobalVariable(name: "LINUX_KERNEL_VERSION", scope: !2, file: !3, line: 8, type: !5, isLocal: false, isDefinition: false)
+!2 = distinct !DICompileUnit(language: DW_LANG_C99, file: !3, producer: "handwritten", isOptimized: true, runtimeVersion: 0, emissionKind: FullDebug, globals: !4)
+!3 = !DIFile(filename: "kconfig.c", directory: "testdata")
+!4 = !{!0, !10, !20, !30, !40, !50, !60}
+!5 = !DIBasicType(name: "unsigned int", size: 32, encoding: DW_ATE_unsigned)
+
+!10 = !DIGlobalVariableExpression(var: !11, expr: !DIExpression())
+!11 = distinct !DIGlobalVariable(name: "CONFIG_HZ", scope: !2, file: !3, line: 9, type: !5, isLocal: false, isDefinition: false)
+
+!20 = !DIGlobalVariableExpression(var: !21, expr: !DIExpression())
+!21 = distinct !DIGlobalVariable(name: "CONFIG_BPF", scope: !2, file: !3, line: 10, type: !22, isLocal: false, isDefinition: false)
+!22 = !DIBasicType(name: "_Bool", size: 8, encoding: DW_ATE_boolean)
+
+!30 = !DIGlobalVariableExpression(var: !31, expr: !DIExpression())
+!31 = distinct !DIGlobalVariable(name: "CONFIG_TRISTATE", scope: !2, file: !3, line: 11, type: !32, isLocal: false, isDefinition: false)
+!32 = distinct !DICompositeType(tag: DW_TAG_enumeration_type, name: "libbpf_tristate", file: !3, line: 1, baseType: !5, size: 32, elements: !33)
+!33 = !{!34, !35, !36}
+!34 = !DIEnumerator(name: "TRI_NO", value: 0, isUnsigned: true)
+!35 = !DIEnumerator(name: "TRI_YES", value: 1, isUnsigned: true)
+!36 = !DIEnumerator(name: "TRI_MODULE", value: 2, isUnsigned: true)
+
+!40 = !DIGlobalVariableExpression(var: !41, expr: !DIExpression())
+!41 = distinct !DIGlobalVariable(name: "CONFIG_DEFAULT_HOSTNAME", scope: !2, file: !3, line: 12, type: !42, isLocal: false, isDefinition: false)
+!42 = !DICompositeType(tag: DW_TAG_array_type, baseType: !43, size: 64, elements: !44)
+!43 = !DIBasicType(name: "char", size: 8, encoding: DW_ATE_signed_char)
+!44 = !{!DISubrange(count: 8)}
+
+!50 = !DIGlobalVariableExpression(var: !51, expr: !DIExpression())
+!51 = distinct !DIGlobalVariable(name: "CONFIG_MISSING", scope: !2, file: !3, line: 13, type: !5, isLocal: false, isDefinition: false)
+
+!60 = !DIGlobalVariableExpression(var: !61, expr: !DIExpression())
+!61 = distinct !DIGlobalVariable(name: "_text", scope: !2, file: !3, line: 14, type: !62, isLocal: false, isDefinition: false)
+!62 = !DIDerivedType(tag: DW_TAG_const_type, baseType: null)
+
+!80 = !{i32 7, !"Dwarf Version", i32 4}
+!81 = !{i32 2, !"Debug Info Version", i32 3}
+
+!90 = !DISubroutineType(types: !91)
+!91 = !{!92}
+!92 = !DIBasicType(name: "int", size: 32, encoding: DW_ATE_signed)
+!100 = distinct !DISubprogram(name: "kernel_version", scope: !3, file: !3, line: 16, type: !90, scopeLine: 16, flags: DIFlagAllCallsDescribed, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!101 = distinct !DISubprogram(name: "hz", scope: !3, file: !3, line: 17, type: !90, scopeLine: 17, flags: DIFlagAllCallsDescribed, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!102 = distinct !DISubprogram(name: "bool", scope: !3, file: !3, line: 18, type: !90, scopeLine: 18, flags: DIFlagAllCallsDescribed, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!103 = distinct !DISubprogram(name: "tristate", scope: !3, file: !3, line: 19, type: !90, scopeLine: 19, flags: DIFlagAllCallsDescribed, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!104 = distinct !DISubprogram(name: "string", scope: !3, file: !3, line: 20, type: !90, scopeLine: 20, flags: DIFlagAllCallsDescribed, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!105 = distinct !DISubprogram(name: "missing", scope: !3, file: !3, line: 21, type: !90, scopeLine: 21, flags: DIFlagAllCallsDescribed, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!106 = distinct !DISubprogram(name: "ksym", scope: !3, file: !3, line: 22, type: !90, scopeLine: 22, flags: DIFlagAllCallsDescribed, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!200 = !DILocation(line: 16, column: 2, scope: !100)
+!201 = !DILocation(line: 17, column: 2, scope: !101)
+!202 = !DILocation(line: 18, column: 2, scope: !102)
+!203 = !DILocation(line: 19, column: 2, scope: !103)
+!204 = !DILocation(line: 20, column: 2, scope: !104)
+!205 = !DILocation(line: 21, column: 2, scope: !105)
+!206 = !DILocation(line: 22, column: 2, scope: !106)
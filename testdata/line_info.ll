@@ -0,0 +1,102 @@
+; This file contains line and function info, and embeds the source it
+; was compiled from so that the line info includes the text of each line.
+; invalid_ctx is rejected by the verifier. It corresponds to the following C:
+;
+;   #include "common.h"
+;
+;   struct __sk_buff {
+;   	uint32_t len;
+;   };
+;
+;   static __attribute__((noinline)) int add(int a, int b)
+;   {
+;   	return a + b;
+;   }
+;
+;   __section("socket") int line_info(struct __sk_buff *skb)
+;   {
+;   	return add(skb->len, 28);
+;   }
+;
+;   __section("socket/invalid") int invalid_ctx(struct __sk_buff *skb)
+;   {
+;   	return *(int *)((char *)skb + 1000);
+;   }
+;
+;   char __license[] __section("license") = "MIT";
+
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n32:64-S128"
+target triple = "bpf"
+
+%struct.__sk_buff = type { i32 }
+
+@__license = dso_local global [4 x i8] c"MIT\00", section "license", align 1
+@llvm.used = appending global [3 x i8*] [i8* getelementptr inbounds ([4 x i8], [4 x i8]* @__license, i32 0, i32 0), i8* bitcast (i32 (%struct.__sk_buff*)* @line_info to i8*), i8* bitcast (i32 (%struct.__sk_buff*)* @invalid_ctx to i8*)], section "llvm.metadata"
+
+define internal i32 @add(i32 %a, i32 %b) noinline !dbg !20 {
+  %1 = add nsw i32 %a, %b, !dbg !25
+  ret i32 %1, !dbg !26
+}
+
+define dso_local i32 @line_info(%struct.__sk_buff* %skb) section "socket" !dbg !30 {
+  %1 = getelementptr inbounds %struct.__sk_buff, %struct.__sk_buff* %skb, i64 0, i32 0, !dbg !34
+  %2 = load i32, i32* %1, align 4, !dbg !34
+  %3 = call i32 @add(i32 %2, i32 28), !dbg !35
+  ret i32 %3, !dbg !36
+}
+
+define dso_local i32 @invalid_ctx(%struct.__sk_buff* %skb) section "socket/invalid" !dbg !40 {
+  %1 = bitcast %struct.__sk_buff* %skb to i8*, !dbg !43
+  %2 = getelementptr inbounds i8, i8* %1, i64 1000, !dbg !43
+  %3 = bitcast i8* %2 to i32*, !dbg !43
+  %4 = load i32, i32* %3, align 4, !dbg !43
+  ret i32 %4, !dbg !44
+}
+
+!llvm.dbg.cu = !{!2}
+!llvm.module.flags = !{!80, !81}
+
+!0 = !DIGlobalVariableExpression(var: !1, expr: !DIExpression())
+!1 = distinct !DIGlobalVariable(name: "__license", scope: !2, file: !3, line: 22, type: !5, isLocal: false, isDefinition: true)
+!2 = distinct !DICompileUnit(language: DW_LANG_C99, file: !3, producer: "handwritten", isOptimized: true, runtimeVersion: 0, emissionKind: FullDebug, globals: !4)
+!3 = !DIFile(filename: "line_info.c", directory: "testdata", source: "#include \22common.h\22\0A\0Astruct __sk_buff {\0A\09uint32_t len;\0A};\0A\0Astatic __attribute__((noinline)) int add(int a, int b)\0A{\0A\09return a + b;\0A}\0A\0A__section(\22socket\22) int line_info(struct __sk_buff *skb)\0A{\0A\09return add(skb->len, 28);\0A}\0A\0A__section(\22socket/invalid\22) int invalid_ctx(struct __sk_buff *skb)\0A{\0A\09return *(int *)((char *)skb + 1000);\0A}\0A\0Achar __license[] __section(\22license\22) = \22MIT\22;\0A")
+!4 = !{!0}
+!5 = !DICompositeType(tag: DW_TAG_array_type, baseType: !6, size: 32, elements: !7)
+!6 = !DIBasicType(name: "char", size: 8, encoding: DW_ATE_signed_char)
+!7 = !{!8}
+!8 = !DISubrange(count: 4)
+
+!10 = !DIBasicType(name: "int", size: 32, encoding: DW_ATE_signed)
+!11 = !DIDerivedType(tag: DW_TAG_pointer_type, baseType: !12, size: 64)
+!12 = distinct !DICompositeType(tag: DW_TAG_structure_type, name: "__sk_buff", file: !3, line: 3, size: 32, elements: !13)
+!13 = !{!14}
+!14 = !DIDerivedType(tag: DW_TAG_member, name: "len", scope: !12, file: !3, line: 4, baseType: !15, size: 32)
+!15 = !DIDerivedType(tag: DW_TAG_typedef, name: "uint32_t", file: !3, line: 3, baseType: !16)
+!16 = !DIBasicType(name: "unsigned int", size: 32, encoding: DW_ATE_unsigned)
+
+!20 = distinct !DISubprogram(name: "add", scope: !3, file: !3, line: 7, type: !21, scopeLine: 8, flags: DIFlagPrototyped | DIFlagAllCallsDescribed, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition | DISPFlagOptimized, unit: !2, retainedNodes: !23)
+!21 = !DISubroutineType(types: !22)
+!22 = !{!10, !10, !10}
+!23 = !{!24, !27}
+!24 = !DILocalVariable(name: "a", arg: 1, scope: !20, file: !3, line: 7, type: !10)
+!27 = !DILocalVariable(name: "b", arg: 2, scope: !20, file: !3, line: 7, type: !10)
+!25 = !DILocation(line: 9, column: 11, scope: !20)
+!26 = !DILocation(line: 9, column: 2, scope: !20)
+
+!30 = distinct !DISubprogram(name: "line_info", scope: !3, file: !3, line: 12, type: !31, scopeLine: 13, flags: DIFlagPrototyped | DIFlagAllCallsDescribed, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2, retainedNodes: !33)
+!31 = !DISubroutineType(types: !32)
+!32 = !{!10, !11}
+!33 = !{!37}
+!37 = !DILocalVariable(name: "skb", arg: 1, scope: !30, file: !3, line: 12, type: !11)
+!34 = !DILocation(line: 14, column: 18, scope: !30)
+!35 = !DILocation(line: 14, column: 9, scope: !30)
+!36 = !DILocation(line: 14, column: 2, scope: !30)
+
+!40 = distinct !DISubprogram(name: "invalid_ctx", scope: !3, file: !3, line: 17, type: !31, scopeLine: 18, flags: DIFlagPrototyped | DIFlagAllCallsDescribed, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2, retainedNodes: !41)
+!41 = !{!42}
+!42 = !DILocalVariable(name: "skb", arg: 1, scope: !40, file: !3, line: 17, type: !11)
+!43 = !DILocation(line: 19, column: 9, scope: !40)
+!44 = !DILocation(line: 19, column: 2, scope: !40)
+
+!80 = !{i32 7, !"Dwarf Version", i32 5}
+!81 = !{i32 2, !"Debug Info Version", i32 3}
@@ -0,0 +1,55 @@
+; This file is linked with link_b.ll. It calls a function and defines a
+; map which are used by the other object. It corresponds to the
+; following C:
+;
+;   char __license[] __section("license") = "MIT";
+;
+;   struct bpf_map_def shared_map __section("maps") = {
+;   	.type = BPF_MAP_TYPE_ARRAY, .key_size = 4, .value_size = 4, .max_entries = 1,
+;   };
+;
+;   volatile int a_value = 20;
+;
+;   extern int ext_func(void);
+;
+;   __weak __noinline int weak_fn() { return 100; }
+;   static __noinline int scale(int x) { return x > 100 ? 0 : x * 2; }
+;
+;   __section("socket") int linked() { return scale(a_value) + ext_func() + weak_fn(); }
+
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n32:64-S128"
+target triple = "bpf"
+
+%struct.bpf_map_def = type { i32, i32, i32, i32, i32 }
+
+@__license = dso_local global [4 x i8] c"MIT\00", section "license", align 1
+@shared_map = dso_local global %struct.bpf_map_def { i32 2, i32 4, i32 4, i32 1, i32 0 }, section "maps", align 4
+@a_value = dso_local global i32 20, align 4
+
+declare i32 @ext_func()
+
+define weak dso_local i32 @weak_fn() noinline {
+  ret i32 100
+}
+
+define internal i32 @scale(i32 %x) noinline {
+  %big = icmp ugt i32 %x, 100
+  br i1 %big, label %zero, label %double
+
+zero:
+  ret i32 0
+
+double:
+  %1 = shl i32 %x, 1
+  ret i32 %1
+}
+
+define dso_local i32 @linked() section "socket" {
+  %v = load volatile i32, i32* @a_value, align 4
+  %1 = call i32 @scale(i32 %v)
+  %2 = call i32 @ext_func()
+  %3 = call i32 @weak_fn()
+  %4 = add i32 %1, %2
+  %5 = add i32 %4, %3
+  ret i32 %5
+}
@@ -0,0 +1,59 @@
+; This file is linked with link_a.ll. It defines a function which is
+; used by the other object, and refers to a map defined there. It
+; corresponds to the following C:
+;
+;   char __license[] __section("license") = "MIT";
+;
+;   extern struct bpf_map_def shared_map;
+;
+;   volatile int b_value = 2;
+;
+;   static __noinline int scale(int x) { return x > 100 ? 0 : x * 3; }
+;
+;   __noinline int ext_func() { return scale(b_value); }
+;   __noinline int weak_fn() { return 1; }
+;
+;   __section("socket/b") int linked_b() {
+;   	uint32_t key = 0;
+;   	map_lookup_elem(&shared_map, &key);
+;   	return 0;
+;   }
+
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n32:64-S128"
+target triple = "bpf"
+
+%struct.bpf_map_def = type { i32, i32, i32, i32, i32 }
+
+@__license = dso_local global [4 x i8] c"MIT\00", section "license", align 1
+@shared_map = external dso_local global %struct.bpf_map_def, align 4
+@b_value = dso_local global i32 2, align 4
+
+define internal i32 @scale(i32 %x) noinline {
+  %big = icmp ugt i32 %x, 100
+  br i1 %big, label %zero, label %triple
+
+zero:
+  ret i32 0
+
+triple:
+  %1 = mul i32 %x, 3
+  ret i32 %1
+}
+
+define dso_local i32 @ext_func() noinline {
+  %v = load volatile i32, i32* @b_value, align 4
+  %1 = call i32 @scale(i32 %v)
+  ret i32 %1
+}
+
+define dso_local i32 @weak_fn() noinline {
+  ret i32 1
+}
+
+define dso_local i32 @linked_b() section "socket/b" {
+  %key = alloca i32, align 4
+  store i32 0, i32* %key, align 4
+  %k = bitcast i32* %key to i8*
+  %1 = call i8* inttoptr (i64 1 to i8* (i8*, i8*)*)(i8* bitcast (%struct.bpf_map_def* @shared_map to i8*), i8* %k)
+  ret i32 0
+}
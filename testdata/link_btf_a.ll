@@ -0,0 +1,89 @@
+; This file is linked with link_btf_b.ll, and contains BTF. Both objects
+; define a static map and a static function called helper, and btf_a
+; calls a function of the other object. It corresponds to the following C:
+;
+;   char __license[] __section("license") = "MIT";
+;
+;   static struct bpf_map_def counters __section("maps") = {
+;   	.type = BPF_MAP_TYPE_ARRAY, .key_size = 4, .value_size = 4, .max_entries = 1,
+;   };
+;
+;   extern int b_value(int x);
+;
+;   static __noinline int helper(int x) { return x + 1; }
+;
+;   __section("socket") int btf_a(void *ctx)
+;   {
+;   	uint32_t key = 0, *value = map_lookup_elem(&counters, &key);
+;   	if (value)
+;   		*value = 1;
+;   	return helper(b_value(1));
+;   }
+
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n32:64-S128"
+target triple = "bpf"
+
+%struct.bpf_map_def = type { i32, i32, i32, i32, i32 }
+
+@__license = dso_local global [4 x i8] c"MIT\00", section "license", align 1
+@counters = internal global %struct.bpf_map_def { i32 2, i32 4, i32 4, i32 1, i32 0 }, section "maps", align 4
+@llvm.used = appending global [2 x i8*] [i8* getelementptr inbounds ([4 x i8], [4 x i8]* @__license, i32 0, i32 0), i8* bitcast (i32 (i8*)* @btf_a to i8*)], section "llvm.metadata"
+
+declare i32 @b_value(i32)
+
+define internal i32 @helper(i32 %x) noinline !dbg !20 {
+  %1 = add nsw i32 %x, 1, !dbg !22
+  ret i32 %1, !dbg !23
+}
+
+define dso_local i32 @btf_a(i8* %ctx) section "socket" !dbg !30 {
+  %key = alloca i32, align 4
+  store i32 0, i32* %key, align 4, !dbg !33
+  %k = bitcast i32* %key to i8*, !dbg !34
+  %value = call i8* inttoptr (i64 1 to i8* (i8*, i8*)*)(i8* bitcast (%struct.bpf_map_def* @counters to i8*), i8* %k), !dbg !34
+  %null = icmp eq i8* %value, null, !dbg !35
+  br i1 %null, label %done, label %set, !dbg !35
+
+set:
+  %p = bitcast i8* %value to i32*, !dbg !36
+  store i32 1, i32* %p, align 4, !dbg !36
+  br label %done, !dbg !36
+
+done:
+  %b = call i32 @b_value(i32 1), !dbg !37
+  %r = call i32 @helper(i32 %b), !dbg !38
+  ret i32 %r, !dbg !39
+}
+
+!llvm.dbg.cu = !{!2}
+!llvm.module.flags = !{!80, !81}
+
+!2 = distinct !DICompileUnit(language: DW_LANG_C99, file: !3, producer: "handwritten", isOptimized: true, runtimeVersion: 0, emissionKind: FullDebug)
+!3 = !DIFile(filename: "link_btf_a.c", directory: "testdata", source: "char __license[] __section(\22license\22) = \22MIT\22;\0A\0Astatic struct bpf_map_def counters __section(\22maps\22) = {\0A\09.type = BPF_MAP_TYPE_ARRAY, .key_size = 4, .value_size = 4, .max_entries = 1,\0A};\0A\0Aextern int b_value(int x);\0A\0Astatic __noinline int helper(int x) { return x + 1; }\0A\0A__section(\22socket\22) int btf_a(void *ctx)\0A{\0A\09uint32_t key = 0, *value = map_lookup_elem(&counters, &key);\0A\09if (value)\0A\09\09*value = 1;\0A\09return helper(b_value(1));\0A}\0A")
+
+!10 = !DIBasicType(name: "int", size: 32, encoding: DW_ATE_signed)
+!11 = !DIDerivedType(tag: DW_TAG_pointer_type, baseType: null, size: 64)
+!12 = !DISubroutineType(types: !13)
+!13 = !{!10, !10}
+!14 = !DISubroutineType(types: !15)
+!15 = !{!10, !11}
+
+!20 = distinct !DISubprogram(name: "helper", scope: !3, file: !3, line: 9, type: !12, scopeLine: 9, flags: DIFlagPrototyped | DIFlagAllCallsDescribed, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition | DISPFlagOptimized, unit: !2, retainedNodes: !21)
+!21 = !{!24}
+!24 = !DILocalVariable(name: "x", arg: 1, scope: !20, file: !3, line: 9, type: !10)
+!22 = !DILocation(line: 9, column: 48, scope: !20)
+!23 = !DILocation(line: 9, column: 39, scope: !20)
+
+!30 = distinct !DISubprogram(name: "btf_a", scope: !3, file: !3, line: 11, type: !14, scopeLine: 12, flags: DIFlagPrototyped | DIFlagAllCallsDescribed, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2, retainedNodes: !31)
+!31 = !{!32}
+!32 = !DILocalVariable(name: "ctx", arg: 1, scope: !30, file: !3, line: 11, type: !11)
+!33 = !DILocation(line: 13, column: 11, scope: !30)
+!34 = !DILocation(line: 13, column: 29, scope: !30)
+!35 = !DILocation(line: 14, column: 6, scope: !30)
+!36 = !DILocation(line: 15, column: 10, scope: !30)
+!37 = !DILocation(line: 16, column: 16, scope: !30)
+!38 = !DILocation(line: 16, column: 9, scope: !30)
+!39 = !DILocation(line: 16, column: 2, scope: !30)
+
+!80 = !{i32 7, !"Dwarf Version", i32 5}
+!81 = !{i32 2, !"Debug Info Version", i32 3}
@@ -0,0 +1,42 @@
+; This file is linked with link_rodata_a.ll, to check that constants in
+; .rodata can be rewritten after the sections are concatenated. It
+; corresponds to the following C:
+;
+;   char __license[] __section("license") = "MIT";
+;
+;   volatile const uint32_t b_const = 2;
+;
+;   __section("socket/b") int rodata_b() { return b_const; }
+
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n32:64-S128"
+target triple = "bpf"
+
+@__license = dso_local global [4 x i8] c"MIT\00", section "license", align 1
+@b_const = dso_local constant i32 2, align 4, !dbg !0
+
+define dso_local i32 @rodata_b() section "socket/b" !dbg !20 {
+  %1 = load volatile i32, i32* @b_const, align 4, !dbg !24
+  ret i32 %1, !dbg !24
+}
+
+!llvm.dbg.cu = !{!2}
+!llvm.module.flags = !{!10, !11}
+
+!0 = !DIGlobalVariableExpression(var: !1, expr: !DIExpression())
+!1 = distinct !DIGlobalVariable(name: "b_const", scope: !2, file: !3, line: 3, type: !5, isLocal: false, isDefinition: true)
+!2 = distinct !DICompileUnit(language: DW_LANG_C99, file: !3, producer: "handwritten", isOptimized: true, runtimeVersion: 0, emissionKind: FullDebug, globals: !4)
+!3 = !DIFile(filename: "link_rodata_b.c", directory: "testdata")
+!4 = !{!0}
+!5 = !DIDerivedType(tag: DW_TAG_const_type, baseType: !6)
+!6 = !DIDerivedType(tag: DW_TAG_volatile_type, baseType: !7)
+!7 = !DIDerivedType(tag: DW_TAG_typedef, name: "uint32_t", file: !3, line: 1, baseType: !8)
+!8 = !DIBasicType(name: "unsigned int", size: 32, encoding: DW_ATE_unsigned)
+
+!10 = !{i32 7, !"Dwarf Version", i32 4}
+!11 = !{i32 2, !"Debug Info Version", i32 3}
+
+!20 = distinct !DISubprogram(name: "rodata_b", scope: !3, file: !3, line: 5, type: !21, scopeLine: 5, flags: DIFlagAllCallsDescribed, spFlags: DISPFlagDefinition | DISPFlagOptimized, unit: !2)
+!21 = !DISubroutineType(types: !22)
+!22 = !{!23}
+!23 = !DIBasicType(name: "int", size: 32, encoding: DW_ATE_signed)
+!24 = !DILocation(line: 5, column: 2, scope: !20)
@@ -0,0 +1,51 @@
+; This file excercises multiple programs per section and linking of
+; individual functions. It corresponds to the following C:
+;
+;   char __license[] __section("license") = "MIT";
+;
+;   static __noinline int sub(int x) { return x - 1; }
+;
+;   __noinline int lib_double(int x) { return x * 2; }
+;   __noinline int lib_add(int x) { return lib_double(x) + 1; }
+;   __noinline int unused(int x) { return x; }
+;
+;   __section("socket") int first() { return lib_add(20); }
+;   __section("socket") int second() { volatile int x = 43; return sub(x); }
+
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n32:64-S128"
+target triple = "bpf"
+
+@__license = dso_local global [4 x i8] c"MIT\00", section "license", align 1
+
+define internal i32 @sub(i32 %x) noinline section "socket" {
+  %1 = sub i32 %x, 1
+  ret i32 %1
+}
+
+define dso_local i32 @lib_double(i32 %x) noinline {
+  %1 = shl i32 %x, 1
+  ret i32 %1
+}
+
+define dso_local i32 @lib_add(i32 %x) noinline {
+  %1 = call i32 @lib_double(i32 %x)
+  %2 = add i32 %1, 1
+  ret i32 %2
+}
+
+define dso_local i32 @unused(i32 %x) noinline {
+  ret i32 %x
+}
+
+define dso_local i32 @first() section "socket" {
+  %1 = call i32 @lib_add(i32 20)
+  ret i32 %1
+}
+
+define dso_local i32 @second() section "socket" {
+  %x = alloca i32, align 4
+  store volatile i32 43, i32* %x, align 4
+  %1 = load volatile i32, i32* %x, align 4
+  %2 = call i32 @sub(i32 %1)
+  ret i32 %2
+}
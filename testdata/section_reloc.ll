@@ -0,0 +1,64 @@
+; This file excercises relocations against section symbols, which LLVM
+; emits for references to static maps and functions. It corresponds to
+; the following C:
+;
+;   char __license[] __section("license") = "MIT";
+;
+;   static struct bpf_map_def first_map __section("maps") = {
+;   	.type = BPF_MAP_TYPE_ARRAY, .key_size = 4, .value_size = 4, .max_entries = 1,
+;   };
+;   static struct bpf_map_def second_map __section("maps") = {
+;   	.type = BPF_MAP_TYPE_ARRAY, .key_size = 4, .value_size = 4, .max_entries = 1,
+;   };
+;
+;   __noinline int other(int x) { return x; }
+;   static __noinline int add(int x) { return x + 42; }
+;
+;   __section("socket") int section_reloc() {
+;   	uint32_t key = 0;
+;   	uint32_t *first = map_lookup_elem(&first_map, &key);
+;   	volatile uint32_t *second = map_lookup_elem(&second_map, &key);
+;   	if (!first || !second)
+;   		return 0;
+;   	return add(*second);
+;   }
+
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n32:64-S128"
+target triple = "bpf"
+
+%struct.bpf_map_def = type { i32, i32, i32, i32, i32 }
+
+@__license = dso_local global [4 x i8] c"MIT\00", section "license", align 1
+@first_map = internal global %struct.bpf_map_def { i32 2, i32 4, i32 4, i32 1, i32 0 }, section "maps", align 4
+@second_map = internal global %struct.bpf_map_def { i32 2, i32 4, i32 4, i32 1, i32 0 }, section "maps", align 4
+@llvm.used = appending global [2 x i8*] [i8* bitcast (%struct.bpf_map_def* @first_map to i8*), i8* bitcast (%struct.bpf_map_def* @second_map to i8*)], section "llvm.metadata"
+
+define dso_local i32 @other(i32 %x) noinline {
+  ret i32 %x
+}
+
+define internal i32 @add(i32 %x) noinline {
+  %1 = add i32 %x, 42
+  ret i32 %1
+}
+
+define dso_local i32 @section_reloc() section "socket" {
+  %key = alloca i32, align 4
+  store i32 0, i32* %key, align 4
+  %k = bitcast i32* %key to i8*
+  %first = call i8* inttoptr (i64 1 to i8* (i8*, i8*)*)(i8* bitcast (%struct.bpf_map_def* @first_map to i8*), i8* %k)
+  %second = call i8* inttoptr (i64 1 to i8* (i8*, i8*)*)(i8* bitcast (%struct.bpf_map_def* @second_map to i8*), i8* %k)
+  %1 = icmp eq i8* %first, null
+  %2 = icmp eq i8* %second, null
+  %3 = or i1 %1, %2
+  br i1 %3, label %exit, label %found
+
+found:
+  %4 = bitcast i8* %second to i32*
+  %5 = load volatile i32, i32* %4, align 4
+  %6 = call i32 @add(i32 %5)
+  ret i32 %6
+
+exit:
+  ret i32 0
+}
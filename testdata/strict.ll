@@ -0,0 +1,41 @@
+; This file excercises the parts of an ELF which are ignored by the
+; loader. It corresponds to the following C:
+;
+;   char __license[] __section("license") = "MIT";
+;
+;   struct bpf_map_def unused_map __section("maps") = {
+;   	.type = BPF_MAP_TYPE_ARRAY, .key_size = 4, .value_size = 4, .max_entries = 1,
+;   };
+;
+;   uint32_t counter;
+;   uint32_t *counter_ptr = &counter;
+;
+;   extern uint32_t missing;
+;
+;   __section("sokcet") int typo() {
+;   	return 0;
+;   }
+;
+;   __section("socket") int valid() {
+;   	return missing;
+;   }
+
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n32:64-S128"
+target triple = "bpf"
+
+%struct.bpf_map_def = type { i32, i32, i32, i32, i32 }
+
+@__license = dso_local global [4 x i8] c"MIT\00", section "license", align 1
+@unused_map = dso_local global %struct.bpf_map_def { i32 2, i32 4, i32 4, i32 1, i32 0 }, section "maps", align 4
+@counter = dso_local global i32 0, align 4
+@counter_ptr = dso_local global i32* @counter, align 8
+@missing = external dso_local global i32, align 4
+
+define dso_local i32 @typo() section "sokcet" {
+  ret i32 0
+}
+
+define dso_local i32 @valid() section "socket" {
+  %ret = load i32, i32* @missing, align 4
+  ret i32 %ret
+}
@@ -1,6 +1,6 @@
 package ebpf
 
-//go:generate stringer -output types_string.go -type=MapType,ProgType
+//go:generate stringer -output types_string.go -type=MapType,ProgType,PinType
 
 // MapType indicates the type map structure
 // that will be initialized in the kernel.
@@ -84,6 +84,13 @@ const (
 	_ProgGetFDByID
 	_MapGetFDByID
 	_ObjGetInfoByFD
+	_ProgQuery
+	_RawTracepointOpen
+	_BTFLoad
+	_BTFGetFDByID
+	_TaskFDQuery
+	_MapLookupAndDeleteElem
+	_MapFreeze
 )
 
 const (
@@ -199,6 +206,20 @@ const (
 	RawTracepointWritable
 	// CGroupSockopt program
 	CGroupSockopt
+	// Tracing program, attached to BTF described kernel functions
+	Tracing
+	// StructOps program
+	StructOps
+	// Extension program, replaces a function of another program
+	Extension
+	// LSM program
+	LSM
+	// SkLookup program
+	SkLookup
+	// Syscall program
+	Syscall
+	// Netfilter program
+	Netfilter
 )
 
 // AttachType of the eBPF program, needed to differentiate allowed context accesses in
@@ -233,4 +254,56 @@ const (
 	AttachCGroupUDP6Recvmsg
 	AttachCGroupGetsockopt
 	AttachCGroupSetsockopt
+	AttachTraceRawTp
+	AttachTraceFEntry
+	AttachTraceFExit
+	AttachModifyReturn
+	AttachLSMMac
+	AttachTraceIter
+	AttachCGroupInet4GetPeername
+	AttachCGroupInet6GetPeername
+	AttachCGroupInet4GetSockname
+	AttachCGroupInet6GetSockname
+	AttachXDPDevMap
+	AttachCGroupInetSockRelease
+	AttachXDPCPUMap
+	AttachSkLookup
+	AttachXDP
+	AttachSkSKBVerdict
+	AttachSkReuseportSelect
+	AttachSkReuseportSelectOrMigrate
+	AttachPerfEvent
+	AttachTraceKprobeMulti
+	AttachLSMCGroup
+	AttachStructOps
+	AttachNetfilter
+	AttachTCXIngress
+	AttachTCXEgress
+	AttachTraceUprobeMulti
+	AttachCGroupUnixConnect
+	AttachCGroupUnixSendmsg
+	AttachCGroupUnixRecvmsg
+	AttachCGroupUnixGetpeername
+	AttachCGroupUnixGetsockname
+	AttachNetkitPrimary
+	AttachNetkitPeer
+)
+
+// PinType determines whether a map is pinned into a BPFFS.
+type PinType int
+
+// Valid pin types.
+//
+// PinNone and PinByName mirror enum libbpf_pin_type, the remaining
+// types are used by iproute2.
+const (
+	PinNone PinType = iota
+	// Pin an object by using its name as the filename.
+	PinByName
+	// Pin an object in a directory private to the ELF it was loaded
+	// from, like tc does for PIN_OBJECT_NS.
+	PinObjectNS
+	// Pin an object in a directory shared by all ELFs, like tc does
+	// for PIN_GLOBAL_NS.
+	PinGlobalNS
 )
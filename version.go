@@ -0,0 +1,202 @@
+package ebpf
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// MagicKernelVersion in the version section of an ELF is replaced with
+// the version of the running kernel when loading it.
+//
+// Kprobes require the version of the running kernel on older kernels,
+// which makes it impossible to share ELFs between kernels otherwise.
+const MagicKernelVersion = 0xFFFFFFFE
+
+// kernelRelease returns the release of the running kernel,
+// like 5.2.0-1-amd64.
+func kernelRelease() (string, error) {
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err != nil {
+		return "", errors.Wrap(err, "uname failed")
+	}
+
+	release := uname.Release[:]
+	if i := bytes.IndexByte(release, 0); i != -1 {
+		release = release[:i]
+	}
+
+	return string(release), nil
+}
+
+// kernelVersion returns the version of the running kernel, encoded
+// like LINUX_VERSION_CODE.
+//
+// Some distributions, like Ubuntu, report a sublevel in uname which
+// doesn't match LINUX_VERSION_CODE. The version is therefore read from
+// the vDSO if possible, and derived from uname otherwise.
+func kernelVersion() (uint32, error) {
+	if version, err := vdsoVersion(); err == nil {
+		return version, nil
+	}
+
+	release, err := kernelRelease()
+	if err != nil {
+		return 0, err
+	}
+
+	return parseKernelVersion(release)
+}
+
+// Auxiliary vector entry which contains the address of the vDSO,
+// see getauxval(3).
+const atSysinfoEHDR = 33
+
+// vdsoVersion returns LINUX_VERSION_CODE from the "Linux" note of the
+// vDSO mapped into the current process.
+func vdsoVersion() (uint32, error) {
+	auxv, err := os.Open("/proc/self/auxv")
+	if err != nil {
+		return 0, err
+	}
+	defer auxv.Close()
+
+	addr, err := vdsoAddress(auxv)
+	if err != nil {
+		return 0, err
+	}
+
+	mem, err := os.Open("/proc/self/mem")
+	if err != nil {
+		return 0, err
+	}
+	defer mem.Close()
+
+	// The vDSO has no fixed size, but is always a valid ELF.
+	vdso, err := elf.NewFile(io.NewSectionReader(mem, int64(addr), math.MaxInt64-int64(addr)))
+	if err != nil {
+		return 0, errors.Wrap(err, "can't parse vDSO")
+	}
+
+	for _, sec := range vdso.Sections {
+		if sec.Type != elf.SHT_NOTE {
+			continue
+		}
+
+		version, err := linuxVersionNote(sec.Open(), vdso.ByteOrder)
+		if err == nil {
+			return version, nil
+		}
+	}
+
+	return 0, errors.New("vDSO has no version note")
+}
+
+// vdsoAddress finds AT_SYSINFO_EHDR in the auxiliary vector.
+func vdsoAddress(auxv io.Reader) (uint64, error) {
+	wordSize := int(unsafe.Sizeof(uintptr(0)))
+	entry := make([]byte, 2*wordSize)
+
+	word := func(buf []byte) uint64 {
+		if wordSize == 4 {
+			return uint64(nativeEndian.Uint32(buf))
+		}
+		return nativeEndian.Uint64(buf)
+	}
+
+	for {
+		if _, err := io.ReadFull(auxv, entry); err != nil {
+			return 0, errors.Wrap(err, "no vDSO in auxiliary vector")
+		}
+
+		tag, value := word(entry[:wordSize]), word(entry[wordSize:])
+		if tag == atSysinfoEHDR {
+			if value == 0 || value > math.MaxInt64 {
+				return 0, errors.Errorf("invalid vDSO address %#x", value)
+			}
+			return value, nil
+		}
+	}
+}
+
+// linuxVersionNote decodes the ELF note which contains the kernel
+// version, see include/linux/elfnote.h.
+func linuxVersionNote(r io.Reader, bo binary.ByteOrder) (uint32, error) {
+	var header struct {
+		NameSize uint32
+		DescSize uint32
+		Type     uint32
+	}
+
+	for {
+		if err := binary.Read(r, bo, &header); err != nil {
+			return 0, err
+		}
+
+		if header.NameSize > 256 || header.DescSize > 4096 {
+			return 0, errors.New("note is too large")
+		}
+
+		// Name and description are padded to four bytes.
+		name := make([]byte, (header.NameSize+3)&^3)
+		desc := make([]byte, (header.DescSize+3)&^3)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return 0, err
+		}
+		if _, err := io.ReadFull(r, desc); err != nil {
+			return 0, err
+		}
+
+		if header.Type != 0 || header.DescSize != 4 || string(bytes.TrimRight(name, "\x00")) != "Linux" {
+			continue
+		}
+
+		return bo.Uint32(desc), nil
+	}
+}
+
+// parseKernelVersion encodes a kernel release like KERNEL_VERSION(a, b, c).
+//
+// The sublevel is clamped to 255, the same as the kernel does since
+// Linux 4.9.256.
+func parseKernelVersion(release string) (uint32, error) {
+	// Strip suffixes like -1-amd64 or +.
+	if i := strings.IndexFunc(release, func(r rune) bool {
+		return r != '.' && (r < '0' || r > '9')
+	}); i != -1 {
+		release = release[:i]
+	}
+
+	parts := strings.SplitN(release, ".", 3)
+	if len(parts) < 2 {
+		return 0, errors.Errorf("invalid kernel release %q", release)
+	}
+
+	var version [3]uint64
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return 0, errors.Errorf("invalid kernel release %q", release)
+		}
+		version[i] = n
+	}
+
+	if version[0] > 255 || version[1] > 255 {
+		return 0, errors.Errorf("kernel release %q is out of range", release)
+	}
+
+	if version[2] > 255 {
+		version[2] = 255
+	}
+
+	return uint32(version[0]<<16 | version[1]<<8 | version[2]), nil
+}
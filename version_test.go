@@ -0,0 +1,89 @@
+package ebpf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseKernelVersion(t *testing.T) {
+	for release, want := range map[string]uint32{
+		"4.19.0-5-amd64":  0x041300,
+		"5.2.0":           0x050200,
+		"6.18.44-fc-v130": 0x06122c,
+		"4.9.300":         0x0409ff,
+		"5.4":             0x050400,
+		"5.10.0+":         0x050a00,
+	} {
+		have, err := parseKernelVersion(release)
+		if err != nil {
+			t.Errorf("%s: %s", release, err)
+			continue
+		}
+
+		if have != want {
+			t.Errorf("%s: expected %#x, got %#x", release, want, have)
+		}
+	}
+
+	for _, release := range []string{"", "5", "foo", "256.0.0"} {
+		if _, err := parseKernelVersion(release); err == nil {
+			t.Errorf("%q: expected an error", release)
+		}
+	}
+}
+
+func TestLinuxVersionNote(t *testing.T) {
+	var buf bytes.Buffer
+	for _, note := range []struct {
+		name string
+		typ  uint32
+		desc []byte
+	}{
+		{"GNU", 0, []byte{1, 2, 3, 4}},
+		{"Linux", 1, []byte{1, 2, 3, 4}},
+		{"Linux", 0, []byte{0x2c, 0x12, 0x06, 0x00}},
+	} {
+		name := make([]byte, (len(note.name)+1+3)&^3)
+		copy(name, note.name)
+
+		binary.Write(&buf, binary.LittleEndian, []uint32{uint32(len(note.name) + 1), uint32(len(note.desc)), note.typ})
+		buf.Write(name)
+		buf.Write(note.desc)
+	}
+
+	version, err := linuxVersionNote(&buf, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != 0x06122c {
+		t.Errorf("Expected version 0x06122c, got %#x", version)
+	}
+
+	if _, err := linuxVersionNote(bytes.NewReader(nil), binary.LittleEndian); err == nil {
+		t.Error("Missing note doesn't return an error")
+	}
+}
+
+func TestVDSOVersion(t *testing.T) {
+	version, err := vdsoVersion()
+	if err != nil {
+		t.Skip("Can't read version from vDSO:", err)
+	}
+
+	release, err := kernelRelease()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := parseKernelVersion(release)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The sublevel reported by uname may differ.
+	if version>>8 != want>>8 {
+		t.Errorf("vDSO reports version %#x, uname %#x", version, want)
+	}
+}
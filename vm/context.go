@@ -0,0 +1,82 @@
+package vm
+
+import (
+	"github.com/newtools/ebpf"
+)
+
+// Offsets into struct __sk_buff.
+const (
+	skbLen      = 0
+	skbProtocol = 16
+	skbData     = 76
+	skbDataEnd  = 80
+	skbSize     = 192
+)
+
+// Offsets into struct xdp_md.
+const (
+	xdpData     = 0
+	xdpDataEnd  = 4
+	xdpDataMeta = 8
+	xdpSize     = 24
+)
+
+type contextKind int
+
+const (
+	rawContext contextKind = iota
+	skbContext
+	xdpContext
+)
+
+func contextKindOf(typ ebpf.ProgType) contextKind {
+	switch typ {
+	case ebpf.SocketFilter, ebpf.SchedCLS, ebpf.SchedACT, ebpf.CGroupSKB,
+		ebpf.LWTIn, ebpf.LWTOut, ebpf.LWTXmit, ebpf.LWTSeg6Local, ebpf.SkSKB:
+		return skbContext
+	case ebpf.XDP:
+		return xdpContext
+	default:
+		return rawContext
+	}
+}
+
+// newContext sets up the program context for a given input.
+//
+// Packet based programs receive a context pointing at in, all other
+// programs receive in as their context.
+func (vm *Machine) newContext(kind contextKind, in []byte) uint64 {
+	if kind == rawContext {
+		return vm.mem.add(&region{data: in})
+	}
+
+	data := vm.mem.add(&region{data: in})
+	dataEnd := data + uint64(len(in))
+	vm.packet = in
+
+	if kind == xdpContext {
+		return vm.mem.add(&region{
+			data: make([]byte, xdpSize),
+			pointers: map[int]uint64{
+				xdpData:     data,
+				xdpDataEnd:  dataEnd,
+				xdpDataMeta: data,
+			},
+		})
+	}
+
+	ctx := make([]byte, skbSize)
+	nativeEndian.PutUint32(ctx[skbLen:], uint32(len(in)))
+	if len(in) >= 14 {
+		// skb->protocol is the big endian EtherType.
+		nativeEndian.PutUint32(ctx[skbProtocol:], uint32(nativeEndian.Uint16(in[12:14])))
+	}
+
+	return vm.mem.add(&region{
+		data: ctx,
+		pointers: map[int]uint64{
+			skbData:    data,
+			skbDataEnd: dataEnd,
+		},
+	})
+}
@@ -0,0 +1,7 @@
+// Package vm executes eBPF programs in user space.
+//
+// The interpreter is meant for testing program logic on machines
+// where loading programs into the kernel isn't possible, for example
+// due to missing privileges. It does not implement the verifier:
+// programs which run fine here may still be rejected by the kernel.
+package vm
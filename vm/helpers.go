@@ -0,0 +1,111 @@
+package vm
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/newtools/ebpf/asm"
+
+	"golang.org/x/sys/unix"
+)
+
+// Helper implements an eBPF helper function.
+//
+// Arguments are passed in r1 to r5, the return value is stored in r0.
+// Returning an error aborts the program.
+type Helper func(m *Machine, r1, r2, r3, r4, r5 uint64) (uint64, error)
+
+// DefaultHelpers returns the helpers available to a Program
+// unless overridden.
+//
+// Callers may modify the returned map.
+func DefaultHelpers() map[asm.BuiltinFunc]Helper {
+	return map[asm.BuiltinFunc]Helper{
+		asm.MapLookupElement:  mapLookupElement,
+		asm.MapUpdateElement:  mapUpdateElement,
+		asm.MapDeleteElement:  mapDeleteElement,
+		asm.KtimeGetNS:        ktimeGetNS,
+		asm.GetPRandomu32:     getPRandomu32,
+		asm.GetSMPProcessorID: getSMPProcessorID,
+	}
+}
+
+// errno converts an error returned by a Map into a helper
+// return value.
+func errno(err error) (uint64, error) {
+	if err == nil {
+		return 0, nil
+	}
+
+	if e, ok := err.(unix.Errno); ok {
+		return uint64(-int64(e)), nil
+	}
+
+	return 0, err
+}
+
+func mapLookupElement(vm *Machine, mapPtr, keyPtr, _, _, _ uint64) (uint64, error) {
+	m, err := vm.Map(mapPtr)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := vm.Memory(keyPtr, int(m.spec.KeySize))
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := m.lookup(key)
+	if err != nil || value == nil {
+		return 0, err
+	}
+
+	return vm.Pointer(value), nil
+}
+
+func mapUpdateElement(vm *Machine, mapPtr, keyPtr, valuePtr, flags, _ uint64) (uint64, error) {
+	m, err := vm.Map(mapPtr)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := vm.Memory(keyPtr, int(m.spec.KeySize))
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := vm.Memory(valuePtr, int(m.spec.ValueSize))
+	if err != nil {
+		return 0, err
+	}
+
+	return errno(m.Update(key, value, flags))
+}
+
+func mapDeleteElement(vm *Machine, mapPtr, keyPtr, _, _, _ uint64) (uint64, error) {
+	m, err := vm.Map(mapPtr)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := vm.Memory(keyPtr, int(m.spec.KeySize))
+	if err != nil {
+		return 0, err
+	}
+
+	return errno(m.Delete(key))
+}
+
+var bootTime = time.Now()
+
+func ktimeGetNS(*Machine, uint64, uint64, uint64, uint64, uint64) (uint64, error) {
+	return uint64(time.Since(bootTime)), nil
+}
+
+func getPRandomu32(*Machine, uint64, uint64, uint64, uint64, uint64) (uint64, error) {
+	return uint64(rand.Uint32()), nil
+}
+
+func getSMPProcessorID(*Machine, uint64, uint64, uint64, uint64, uint64) (uint64, error) {
+	return 0, nil
+}
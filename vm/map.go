@@ -0,0 +1,163 @@
+package vm
+
+import (
+	"github.com/newtools/ebpf"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Flags accepted by Map.Update, equivalent to BPF_ANY, BPF_NOEXIST
+// and BPF_EXIST.
+const (
+	UpdateAny uint64 = iota
+	UpdateNoExist
+	UpdateExist
+)
+
+// Map is an in-memory eBPF map.
+//
+// Hash and array maps are supported. Per-CPU maps behave as if
+// there was a single CPU.
+type Map struct {
+	spec  ebpf.MapSpec
+	hash  map[string][]byte
+	array [][]byte
+}
+
+// NewMap creates a new in-memory Map.
+func NewMap(spec *ebpf.MapSpec) (*Map, error) {
+	if spec.KeySize == 0 || spec.ValueSize == 0 {
+		return nil, errors.Errorf("%s: key and value size must be non-zero", spec.Type)
+	}
+
+	m := &Map{spec: *spec}
+	m.spec.InnerMap = nil
+
+	switch spec.Type {
+	case ebpf.Hash, ebpf.PerCPUHash, ebpf.LRUHash, ebpf.LRUCPUHash:
+		m.hash = make(map[string][]byte)
+
+	case ebpf.Array, ebpf.PerCPUArray:
+		if spec.KeySize != 4 {
+			return nil, errors.Errorf("%s: key size must be 4", spec.Type)
+		}
+
+		m.array = make([][]byte, spec.MaxEntries)
+		for i := range m.array {
+			m.array[i] = make([]byte, spec.ValueSize)
+		}
+
+	default:
+		return nil, errors.Errorf("map type %s is not supported", spec.Type)
+	}
+
+	return m, nil
+}
+
+// Spec returns the specification of the map.
+func (m *Map) Spec() *ebpf.MapSpec {
+	return m.spec.Copy()
+}
+
+// Lookup returns a copy of the value stored under key, or nil.
+func (m *Map) Lookup(key []byte) ([]byte, error) {
+	value, err := m.lookup(key)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	return append([]byte(nil), value...), nil
+}
+
+// lookup returns the value associated with key.
+//
+// The returned slice aliases the map contents.
+func (m *Map) lookup(key []byte) ([]byte, error) {
+	if len(key) != int(m.spec.KeySize) {
+		return nil, errors.Errorf("expected key size %d, got %d", m.spec.KeySize, len(key))
+	}
+
+	if m.array != nil {
+		idx := nativeEndian.Uint32(key)
+		if idx >= uint32(len(m.array)) {
+			return nil, nil
+		}
+		return m.array[idx], nil
+	}
+
+	return m.hash[string(key)], nil
+}
+
+// Update stores value under key.
+//
+// flags is one of UpdateAny, UpdateNoExist or UpdateExist.
+func (m *Map) Update(key, value []byte, flags uint64) error {
+	if len(value) != int(m.spec.ValueSize) {
+		return errors.Errorf("expected value size %d, got %d", m.spec.ValueSize, len(value))
+	}
+
+	if flags > UpdateExist {
+		return unix.EINVAL
+	}
+
+	existing, err := m.lookup(key)
+	if err != nil {
+		return err
+	}
+
+	if m.array != nil {
+		if existing == nil {
+			return unix.E2BIG
+		}
+		if flags == UpdateNoExist {
+			return unix.EEXIST
+		}
+		copy(existing, value)
+		return nil
+	}
+
+	switch {
+	case existing != nil && flags == UpdateNoExist:
+		return unix.EEXIST
+	case existing == nil && flags == UpdateExist:
+		return unix.ENOENT
+	case existing != nil:
+		// Update in place, so that pointers held by a
+		// running program observe the change.
+		copy(existing, value)
+		return nil
+	case len(m.hash) >= int(m.spec.MaxEntries):
+		return unix.E2BIG
+	}
+
+	m.hash[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+// Delete removes key from the map.
+func (m *Map) Delete(key []byte) error {
+	if m.array != nil {
+		return unix.EINVAL
+	}
+
+	existing, err := m.lookup(key)
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		return unix.ENOENT
+	}
+
+	delete(m.hash, string(key))
+	return nil
+}
+
+// Len returns the number of entries in the map.
+func (m *Map) Len() int {
+	if m.array != nil {
+		return len(m.array)
+	}
+	return len(m.hash)
+}
@@ -0,0 +1,177 @@
+package vm
+
+import (
+	"encoding/binary"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+var nativeEndian binary.ByteOrder
+
+func init() {
+	if isBigEndian() {
+		nativeEndian = binary.BigEndian
+	} else {
+		nativeEndian = binary.LittleEndian
+	}
+}
+
+func isBigEndian() (ret bool) {
+	i := int(0x1)
+	bs := (*[int(unsafe.Sizeof(i))]byte)(unsafe.Pointer(&i))
+	return bs[0] == 0
+}
+
+// Addresses are made up of a region number in the upper 32 bits,
+// and an offset into the region in the lower 32 bits. Region 0 is
+// never allocated, so that NULL pointers are invalid.
+const regionShift = 32
+
+type region struct {
+	data []byte
+	// Non-nil if the region is a pointer to a map.
+	m *Map
+	// Offsets into data which hold a pointer when loaded as a word.
+	// Used to model context fields like xdp_md.data.
+	pointers map[int]uint64
+}
+
+type memory struct {
+	// Freed regions are nil, so that their addresses stay invalid.
+	regions []*region
+	// Regions created for byte slices, keyed by their first element.
+	slices map[*byte]uint64
+}
+
+func (mem *memory) add(r *region) uint64 {
+	mem.regions = append(mem.regions, r)
+	return uint64(len(mem.regions)) << regionShift
+}
+
+// pointer returns the address of buf, allocating a region
+// if necessary.
+func (mem *memory) pointer(buf []byte) uint64 {
+	if len(buf) == 0 {
+		return mem.add(&region{})
+	}
+
+	if mem.slices == nil {
+		mem.slices = make(map[*byte]uint64)
+	}
+
+	if addr, ok := mem.slices[&buf[0]]; ok {
+		if r := mem.regions[addr>>regionShift-1]; r != nil && len(r.data) == len(buf) {
+			return addr
+		}
+	}
+
+	addr := mem.add(&region{data: buf})
+	mem.slices[&buf[0]] = addr
+	return addr
+}
+
+// free releases the region containing addr. Later accesses to it fail.
+func (mem *memory) free(addr uint64) {
+	if n := addr >> regionShift; n > 0 && n <= uint64(len(mem.regions)) {
+		mem.regions[n-1] = nil
+	}
+}
+
+func (mem *memory) region(addr uint64) (*region, int, error) {
+	n := addr >> regionShift
+	if n == 0 || n > uint64(len(mem.regions)) {
+		return nil, 0, errors.Errorf("invalid pointer %#x", addr)
+	}
+
+	r := mem.regions[n-1]
+	if r == nil {
+		return nil, 0, errors.Errorf("access to freed memory at %#x", addr)
+	}
+	return r, int(uint32(addr)), nil
+}
+
+// slice returns size bytes of memory at addr.
+//
+// The returned slice aliases the underlying memory.
+func (mem *memory) slice(addr uint64, size int) ([]byte, error) {
+	r, off, err := mem.region(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.m != nil {
+		return nil, errors.Errorf("access to map pointer %#x", addr)
+	}
+
+	if size < 0 || off+size > len(r.data) {
+		return nil, errors.Errorf("out of bounds access to %#x, size %d", addr, size)
+	}
+
+	return r.data[off : off+size], nil
+}
+
+func (mem *memory) load(addr uint64, size int) (uint64, error) {
+	r, off, err := mem.region(addr)
+	if err != nil {
+		return 0, err
+	}
+
+	if ptr, ok := r.pointers[off]; ok && size == 4 {
+		return ptr, nil
+	}
+
+	buf, err := mem.slice(addr, size)
+	if err != nil {
+		return 0, err
+	}
+
+	return loadNative(buf), nil
+}
+
+func (mem *memory) store(addr uint64, size int, value uint64) error {
+	r, off, err := mem.region(addr)
+	if err != nil {
+		return err
+	}
+
+	for ptrOff := range r.pointers {
+		if off < ptrOff+4 && ptrOff < off+size {
+			return errors.Errorf("write to read-only field at %#x", addr)
+		}
+	}
+
+	buf, err := mem.slice(addr, size)
+	if err != nil {
+		return err
+	}
+
+	storeNative(buf, value)
+	return nil
+}
+
+func loadNative(buf []byte) uint64 {
+	switch len(buf) {
+	case 1:
+		return uint64(buf[0])
+	case 2:
+		return uint64(nativeEndian.Uint16(buf))
+	case 4:
+		return uint64(nativeEndian.Uint32(buf))
+	default:
+		return nativeEndian.Uint64(buf)
+	}
+}
+
+func storeNative(buf []byte, value uint64) {
+	switch len(buf) {
+	case 1:
+		buf[0] = byte(value)
+	case 2:
+		nativeEndian.PutUint16(buf, uint16(value))
+	case 4:
+		nativeEndian.PutUint32(buf, uint32(value))
+	default:
+		nativeEndian.PutUint64(buf, value)
+	}
+}
@@ -0,0 +1,609 @@
+package vm
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/newtools/ebpf"
+	"github.com/newtools/ebpf/asm"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// StackSize is the size of the stack available to each function.
+	StackSize = 512
+	// Maximum depth of bpf-to-bpf calls.
+	maxCallDepth = 8
+	// Number of instructions a single run may execute.
+	maxInstructions = 1000000
+)
+
+// Program is an eBPF program which can be executed in user space.
+type Program struct {
+	// Helpers available to the program. Defaults to DefaultHelpers.
+	Helpers map[asm.BuiltinFunc]Helper
+
+	name  string
+	kind  contextKind
+	insns asm.Instructions
+	// Index of the target instruction for jumps and bpf-to-bpf calls.
+	targets []int
+	// Maps referenced by 64 bit loads.
+	maps map[int]*Map
+}
+
+// NewProgram prepares a ProgramSpec for execution.
+//
+// References in the program are resolved against maps. Symbols
+// which aren't maps are treated as constants, as set by
+// Editor.RewriteConstant.
+func NewProgram(spec *ebpf.ProgramSpec, maps map[string]*Map) (*Program, error) {
+	insns := spec.Instructions
+	if len(insns) == 0 {
+		return nil, errors.New("Instructions cannot be empty")
+	}
+
+	targets, err := insns.Targets()
+	if err != nil {
+		return nil, errors.Wrapf(err, "program %s", spec.Name)
+	}
+
+	refs := make(map[int]*Map)
+	for i, ins := range insns {
+		if ins.OpCode != asm.LoadImmOp(asm.DWord) {
+			continue
+		}
+
+		if m := maps[ins.Reference]; ins.Reference != "" && m != nil {
+			refs[i] = m
+			continue
+		}
+
+		if ins.Src == asm.R1 {
+			return nil, errors.Errorf("program %s: instruction %d: unknown map %s", spec.Name, i, ins.Reference)
+		}
+	}
+
+	return &Program{
+		Helpers: DefaultHelpers(),
+		name:    spec.Name,
+		kind:    contextKindOf(spec.Type),
+		insns:   insns,
+		targets: targets,
+		maps:    refs,
+	}, nil
+}
+
+// Test runs the program with the given input and returns the value
+// returned by the program and the (potentially modified) input.
+//
+// Programs operating on packets, like SocketFilter and XDP, receive
+// in as the packet. All other programs receive in as their context.
+func (p *Program) Test(in []byte) (uint32, []byte, error) {
+	vm := &Machine{prog: p}
+	data := append([]byte(nil), in...)
+
+	ret, err := vm.run(vm.newContext(p.kind, data))
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "program %s", p.name)
+	}
+
+	return uint32(ret), data, nil
+}
+
+// Machine is the state of a running Program.
+type Machine struct {
+	prog   *Program
+	mem    memory
+	regs   [asm.R10 + 1]uint64
+	frames []frame
+	packet []byte
+}
+
+type frame struct {
+	returnTo int
+	saved    [4]uint64
+	fp       uint64
+	// The stack of the callee, which is freed when it returns.
+	stack uint64
+}
+
+// Memory returns size bytes of memory at addr.
+//
+// The returned slice aliases the memory of the program.
+func (vm *Machine) Memory(addr uint64, size int) ([]byte, error) {
+	return vm.mem.slice(addr, size)
+}
+
+// Pointer returns an address at which the program can access buf.
+func (vm *Machine) Pointer(buf []byte) uint64 {
+	return vm.mem.pointer(buf)
+}
+
+// Map returns the Map an address refers to.
+func (vm *Machine) Map(addr uint64) (*Map, error) {
+	r, off, err := vm.mem.region(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.m == nil || off != 0 {
+		return nil, errors.Errorf("%#x is not a map", addr)
+	}
+
+	return r.m, nil
+}
+
+func (vm *Machine) run(ctx uint64) (uint64, error) {
+	var (
+		insns = vm.prog.insns
+		regs  = &vm.regs
+		pc    = 0
+	)
+
+	regs[asm.R1] = ctx
+	regs[asm.R10] = vm.mem.add(&region{data: make([]byte, StackSize)}) + StackSize
+
+	mapPtrs := make(map[*Map]uint64)
+	for executed := 0; ; executed++ {
+		if executed >= maxInstructions {
+			return 0, errors.Errorf("exceeded limit of %d instructions", maxInstructions)
+		}
+
+		if pc < 0 || pc >= len(insns) {
+			return 0, errors.Errorf("instruction %d: out of bounds", pc)
+		}
+
+		ins := &insns[pc]
+		op := ins.OpCode
+		next := pc + 1
+
+		var err error
+		switch op.Class() {
+		case asm.ALUClass, asm.ALU64Class:
+			err = vm.alu(ins)
+
+		case asm.JumpClass, asm.Jump32Class:
+			switch jop := op.JumpOp(); {
+			case jop == asm.Exit:
+				if len(vm.frames) == 0 {
+					return regs[asm.R0], nil
+				}
+
+				f := vm.frames[len(vm.frames)-1]
+				vm.frames = vm.frames[:len(vm.frames)-1]
+
+				// Pointers into the stack of the callee are invalid
+				// once it returns.
+				vm.mem.free(f.stack)
+				copy(regs[asm.R6:asm.R10], f.saved[:])
+				regs[asm.R10] = f.fp
+				next = f.returnTo
+
+			case jop == asm.Call && ins.Src == asm.R1:
+				if len(vm.frames) >= maxCallDepth {
+					return 0, errors.Errorf("instruction %d: exceeded call depth of %d", pc, maxCallDepth)
+				}
+
+				f := frame{returnTo: pc + 1, fp: regs[asm.R10]}
+				copy(f.saved[:], regs[asm.R6:asm.R10])
+				f.stack = vm.mem.add(&region{data: make([]byte, StackSize)})
+				vm.frames = append(vm.frames, f)
+				regs[asm.R10] = f.stack + StackSize
+				next = vm.prog.targets[pc]
+
+			case jop == asm.Call:
+				fn := asm.BuiltinFunc(ins.Constant)
+				helper := vm.prog.Helpers[fn]
+				if helper == nil {
+					return 0, errors.Errorf("instruction %d: helper %s is not implemented", pc, fn)
+				}
+
+				regs[asm.R0], err = helper(vm, regs[asm.R1], regs[asm.R2], regs[asm.R3], regs[asm.R4], regs[asm.R5])
+				err = errors.Wrapf(err, "helper %s", fn)
+
+			default:
+				var taken bool
+				taken, err = vm.compare(ins)
+				if taken {
+					next = vm.prog.targets[pc]
+				}
+			}
+
+		case asm.LdClass:
+			switch op.Mode() {
+			case asm.ImmMode:
+				if op.Size() != asm.DWord {
+					err = errors.Errorf("unsupported load size %s", op.Size())
+					break
+				}
+
+				if m := vm.prog.maps[pc]; m != nil {
+					if _, ok := mapPtrs[m]; !ok {
+						mapPtrs[m] = vm.mem.add(&region{m: m})
+					}
+					regs[ins.Dst] = mapPtrs[m]
+				} else {
+					regs[ins.Dst] = uint64(ins.Constant)
+				}
+
+			case asm.AbsMode, asm.IndMode:
+				var ok bool
+				ok, err = vm.loadPacket(ins)
+				if err == nil && !ok {
+					// Out of bounds packet access terminates the program.
+					return 0, nil
+				}
+
+			default:
+				err = errors.Errorf("unsupported mode %s", op.Mode())
+			}
+
+		case asm.LdXClass:
+			if op.Mode() != asm.MemMode && op.Mode() != asm.MemSXMode {
+				err = errors.Errorf("unsupported mode %s", op.Mode())
+				break
+			}
+
+			size := op.Size().Sizeof()
+			regs[ins.Dst], err = vm.mem.load(regs[ins.Src]+uint64(int64(ins.Offset)), size)
+			if op.Mode() == asm.MemSXMode {
+				regs[ins.Dst] = signExtend(regs[ins.Dst], size)
+			}
+
+		case asm.StClass, asm.StXClass:
+			err = vm.store(ins)
+
+		default:
+			err = errors.Errorf("unsupported class %s", op.Class())
+		}
+
+		if err != nil {
+			return 0, errors.Wrapf(err, "instruction %d (%v)", pc, *ins)
+		}
+
+		pc = next
+	}
+}
+
+func (vm *Machine) alu(ins *asm.Instruction) error {
+	var (
+		op    = ins.OpCode
+		regs  = &vm.regs
+		is32  = op.Class() == asm.ALUClass
+		dst   = regs[ins.Dst]
+		src   uint64
+		value uint64
+	)
+
+	if op.Source() == asm.RegSource {
+		src = regs[ins.Src]
+	} else {
+		src = uint64(ins.Constant)
+	}
+
+	if is32 {
+		dst = uint64(uint32(dst))
+		src = uint64(uint32(src))
+	}
+
+	shiftMask := uint64(63)
+	if is32 {
+		shiftMask = 31
+	}
+
+	switch aop := op.ALUOp(); aop {
+	case asm.Add:
+		value = dst + src
+	case asm.Sub:
+		value = dst - src
+	case asm.Mul:
+		value = dst * src
+	case asm.Div:
+		if ins.IsSigned() {
+			value = signedDivMod(aop, dst, src, is32)
+		} else if src != 0 {
+			value = dst / src
+		}
+	case asm.Or:
+		value = dst | src
+	case asm.And:
+		value = dst & src
+	case asm.LSh:
+		value = dst << (src & shiftMask)
+	case asm.RSh:
+		value = dst >> (src & shiftMask)
+	case asm.Neg:
+		value = -dst
+	case asm.Mod:
+		value = dst
+		if ins.IsSigned() {
+			value = signedDivMod(aop, dst, src, is32)
+		} else if src != 0 {
+			value = dst % src
+		}
+	case asm.Xor:
+		value = dst ^ src
+	case asm.Mov:
+		value = src
+		if size := ins.SignExtension(); size != asm.InvalidSize {
+			value = signExtend(src, size.Sizeof())
+		}
+	case asm.ArSh:
+		if is32 {
+			value = uint64(uint32(int32(dst) >> (src & shiftMask)))
+		} else {
+			value = uint64(int64(dst) >> (src & shiftMask))
+		}
+	case asm.Swap:
+		endian := op.Endianness()
+		if !is32 {
+			// BSwap always reverses the byte order.
+			endian = asm.BE
+			if nativeEndian == binary.BigEndian {
+				endian = asm.LE
+			}
+		}
+
+		var err error
+		value, err = swap(regs[ins.Dst], endian, ins.Constant)
+		if err != nil {
+			return err
+		}
+		is32 = false
+	default:
+		return errors.Errorf("unsupported ALU operation %s", aop)
+	}
+
+	if is32 {
+		value = uint64(uint32(value))
+	}
+
+	regs[ins.Dst] = value
+	return nil
+}
+
+func signExtend(value uint64, size int) uint64 {
+	shift := uint(64 - size*8)
+	return uint64(int64(value<<shift) >> shift)
+}
+
+// signedDivMod implements signed division and modulo, depending on op.
+// Like their unsigned counterparts they don't fault on division by zero.
+func signedDivMod(op asm.ALUOp, dst, src uint64, is32 bool) uint64 {
+	a, b := int64(dst), int64(src)
+	if is32 {
+		a, b = int64(int32(dst)), int64(int32(src))
+	}
+
+	switch {
+	case b == 0 && op == asm.Div:
+		return 0
+	case b == 0:
+		return dst
+	case b == -1:
+		// Avoid overflow of the most negative value.
+		if op == asm.Div {
+			return uint64(-a)
+		}
+		return 0
+	case op == asm.Div:
+		return uint64(a / b)
+	default:
+		return uint64(a % b)
+	}
+}
+
+func swap(value uint64, endian asm.Endianness, width int64) (uint64, error) {
+	var order binary.ByteOrder = binary.LittleEndian
+	if endian == asm.BE {
+		order = binary.BigEndian
+	}
+
+	buf := make([]byte, 8)
+	switch width {
+	case 16:
+		nativeEndian.PutUint16(buf, uint16(value))
+		return uint64(order.Uint16(buf)), nil
+	case 32:
+		nativeEndian.PutUint32(buf, uint32(value))
+		return uint64(order.Uint32(buf)), nil
+	case 64:
+		nativeEndian.PutUint64(buf, value)
+		return order.Uint64(buf), nil
+	default:
+		return 0, errors.Errorf("invalid swap width %d", width)
+	}
+}
+
+func (vm *Machine) compare(ins *asm.Instruction) (bool, error) {
+	var (
+		op  = ins.OpCode
+		dst = vm.regs[ins.Dst]
+		src uint64
+	)
+
+	if op.Source() == asm.RegSource {
+		src = vm.regs[ins.Src]
+	} else {
+		src = uint64(ins.Constant)
+	}
+
+	sdst, ssrc := int64(dst), int64(src)
+	if op.Class() == asm.Jump32Class {
+		dst, src = uint64(uint32(dst)), uint64(uint32(src))
+		sdst, ssrc = int64(int32(dst)), int64(int32(src))
+	}
+
+	switch op.JumpOp() {
+	case asm.Ja:
+		return true, nil
+	case asm.JEq:
+		return dst == src, nil
+	case asm.JGT:
+		return dst > src, nil
+	case asm.JGE:
+		return dst >= src, nil
+	case asm.JSet:
+		return dst&src != 0, nil
+	case asm.JNE:
+		return dst != src, nil
+	case asm.JSGT:
+		return sdst > ssrc, nil
+	case asm.JSGE:
+		return sdst >= ssrc, nil
+	case asm.JLT:
+		return dst < src, nil
+	case asm.JLE:
+		return dst <= src, nil
+	case asm.JSLT:
+		return sdst < ssrc, nil
+	case asm.JSLE:
+		return sdst <= ssrc, nil
+	default:
+		return false, errors.Errorf("unsupported jump operation %s", op.JumpOp())
+	}
+}
+
+func (vm *Machine) store(ins *asm.Instruction) error {
+	var (
+		op   = ins.OpCode
+		addr = vm.regs[ins.Dst] + uint64(int64(ins.Offset))
+		size = op.Size().Sizeof()
+	)
+
+	var value uint64
+	if op.Class() == asm.StXClass {
+		value = vm.regs[ins.Src]
+	} else {
+		value = uint64(ins.Constant)
+	}
+
+	switch op.Mode() {
+	case asm.MemMode:
+		return vm.mem.store(addr, size, value)
+
+	case asm.XAddMode:
+		return vm.atomic(ins, addr, value)
+
+	default:
+		return errors.Errorf("unsupported mode %s", op.Mode())
+	}
+}
+
+func (vm *Machine) atomic(ins *asm.Instruction, addr, value uint64) error {
+	size := ins.OpCode.Size().Sizeof()
+	if size != 4 && size != 8 {
+		return errors.Errorf("unsupported atomic size %s", ins.OpCode.Size())
+	}
+
+	old, err := vm.mem.load(addr, size)
+	if err != nil {
+		return err
+	}
+
+	aop := ins.AtomicOp()
+	if size == 4 {
+		value = uint64(uint32(value))
+	}
+
+	var result uint64
+	switch aop {
+	case asm.AddAtomic, asm.FetchAdd:
+		result = old + value
+	case asm.OrAtomic, asm.FetchOr:
+		result = old | value
+	case asm.AndAtomic, asm.FetchAnd:
+		result = old & value
+	case asm.XorAtomic, asm.FetchXor:
+		result = old ^ value
+	case asm.Xchg:
+		result = value
+	case asm.CmpXchg:
+		expected := vm.regs[asm.R0]
+		if size == 4 {
+			expected = uint64(uint32(expected))
+		}
+
+		result = old
+		if old == expected {
+			result = value
+		}
+
+		// The previous value is returned in r0 instead of src.
+		vm.regs[asm.R0] = old
+		return vm.mem.store(addr, size, result)
+	default:
+		return errors.Errorf("unsupported atomic operation %s", aop)
+	}
+
+	if aop.Fetch() {
+		vm.regs[ins.Src] = old
+	}
+	return vm.mem.store(addr, size, result)
+}
+
+// loadPacket implements the legacy LdAbs and LdInd instructions.
+//
+// Returns false if the access is out of bounds.
+func (vm *Machine) loadPacket(ins *asm.Instruction) (bool, error) {
+	if vm.prog.kind != skbContext {
+		return false, errors.New("packet access requires a socket buffer")
+	}
+
+	offset := int64(int32(ins.Constant))
+	if ins.OpCode.Mode() == asm.IndMode {
+		offset += int64(int32(vm.regs[ins.Src]))
+	}
+
+	size := ins.OpCode.Size().Sizeof()
+	if size < 0 || size > 4 {
+		return false, errors.Errorf("unsupported load size %s", ins.OpCode.Size())
+	}
+
+	if offset < 0 || offset > math.MaxInt32 || int(offset)+size > len(vm.packet) {
+		return false, nil
+	}
+
+	buf := vm.packet[offset : int(offset)+size]
+	switch size {
+	case 1:
+		vm.regs[asm.R0] = uint64(buf[0])
+	case 2:
+		vm.regs[asm.R0] = uint64(binary.BigEndian.Uint16(buf))
+	default:
+		vm.regs[asm.R0] = uint64(binary.BigEndian.Uint32(buf))
+	}
+
+	return true, nil
+}
+
+// Collection is a set of Programs and Maps.
+type Collection struct {
+	Programs map[string]*Program
+	Maps     map[string]*Map
+}
+
+// NewCollection creates all maps and programs in spec.
+func NewCollection(spec *ebpf.CollectionSpec) (*Collection, error) {
+	maps := make(map[string]*Map)
+	for name, mapSpec := range spec.Maps {
+		m, err := NewMap(mapSpec)
+		if err != nil {
+			return nil, errors.Wrapf(err, "map %s", name)
+		}
+		maps[name] = m
+	}
+
+	progs := make(map[string]*Program)
+	for name, progSpec := range spec.Programs {
+		prog, err := NewProgram(progSpec, maps)
+		if err != nil {
+			return nil, err
+		}
+		progs[name] = prog
+	}
+
+	return &Collection{progs, maps}, nil
+}
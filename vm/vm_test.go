@@ -0,0 +1,416 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/newtools/ebpf"
+	"github.com/newtools/ebpf/asm"
+)
+
+func mustNewProgram(t *testing.T, typ ebpf.ProgType, insns asm.Instructions, maps map[string]*Map) *Program {
+	t.Helper()
+
+	prog, err := NewProgram(&ebpf.ProgramSpec{
+		Name:         "test",
+		Type:         typ,
+		Instructions: insns,
+		License:      "MIT",
+	}, maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prog
+}
+
+func TestALU(t *testing.T) {
+	testcases := []struct {
+		name  string
+		insns asm.Instructions
+		want  uint64
+	}{
+		{"Add", asm.Instructions{asm.Mov.Imm(asm.R0, 40), asm.Add.Imm(asm.R0, 2)}, 42},
+		{"Sub", asm.Instructions{asm.Mov.Imm(asm.R0, 1), asm.Sub.Imm(asm.R0, 2)}, math.MaxUint64},
+		{"Sub32", asm.Instructions{asm.Mov.Imm(asm.R0, 1), asm.Sub.Imm32(asm.R0, 2)}, math.MaxUint32},
+		{"Mul", asm.Instructions{asm.Mov.Imm(asm.R0, 6), asm.Mov.Imm(asm.R1, 7), asm.Mul.Reg(asm.R0, asm.R1)}, 42},
+		{"Div", asm.Instructions{asm.Mov.Imm(asm.R0, 85), asm.Div.Imm(asm.R0, 2)}, 42},
+		{"DivZero", asm.Instructions{asm.Mov.Imm(asm.R0, 85), asm.Mov.Imm(asm.R1, 0), asm.Div.Reg(asm.R0, asm.R1)}, 0},
+		{"Mod", asm.Instructions{asm.Mov.Imm(asm.R0, 85), asm.Mod.Imm(asm.R0, 43)}, 42},
+		{"ModZero", asm.Instructions{asm.Mov.Imm(asm.R0, 42), asm.Mov.Imm(asm.R1, 0), asm.Mod.Reg(asm.R0, asm.R1)}, 42},
+		{"Neg", asm.Instructions{asm.Mov.Imm(asm.R0, -42), asm.Neg.Imm(asm.R0, 0)}, 42},
+		{"LSh", asm.Instructions{asm.Mov.Imm(asm.R0, 21), asm.LSh.Imm(asm.R0, 1)}, 42},
+		{"RSh", asm.Instructions{asm.Mov.Imm(asm.R0, -1), asm.RSh.Imm(asm.R0, 63)}, 1},
+		{"ArSh", asm.Instructions{asm.Mov.Imm(asm.R0, -84), asm.ArSh.Imm(asm.R0, 1)}, uint64(math.MaxUint64 - 41)},
+		{"ArSh32", asm.Instructions{asm.Mov.Imm(asm.R0, -84), asm.ArSh.Imm32(asm.R0, 1)}, math.MaxUint32 - 41},
+		{"Xor", asm.Instructions{asm.Mov.Imm(asm.R0, 0x2f), asm.Xor.Imm(asm.R0, 0x05)}, 42},
+		{"Mov32", asm.Instructions{asm.LoadImm(asm.R0, math.MaxInt64, asm.DWord), asm.Mov.Reg32(asm.R0, asm.R0)}, math.MaxUint32},
+		{"SwapBE", asm.Instructions{asm.Mov.Imm(asm.R0, 0x1234), asm.HostTo(asm.BE, asm.R0, asm.Half)}, uint64(htons(0x1234))},
+		{"BSwap", asm.Instructions{asm.Mov.Imm(asm.R0, 0x1234), asm.BSwap(asm.R0, asm.Half)}, 0x3412},
+		{"SDiv", asm.Instructions{asm.Mov.Imm(asm.R0, -84), asm.Div.Imm(asm.R0, 2).Signed()}, uint64(math.MaxUint64 - 41)},
+		{"SDiv32", asm.Instructions{asm.Mov.Imm(asm.R0, -84), asm.Div.Imm32(asm.R0, -2).Signed()}, 42},
+		{"SDivZero", asm.Instructions{asm.Mov.Imm(asm.R0, -84), asm.Div.Imm(asm.R0, 0).Signed()}, 0},
+		{"SDivOverflow", asm.Instructions{asm.LoadImm(asm.R0, math.MinInt64, asm.DWord), asm.Div.Imm(asm.R0, -1).Signed()}, 1 << 63},
+		{"SMod", asm.Instructions{asm.Mov.Imm(asm.R0, -85), asm.Mod.Imm(asm.R0, 43).Signed()}, uint64(math.MaxUint64 - 41)},
+		{"SModZero", asm.Instructions{asm.Mov.Imm(asm.R0, -42), asm.Mod.Imm32(asm.R0, 0).Signed()}, math.MaxUint32 - 41},
+		{"MovSXB", asm.Instructions{asm.Mov.Imm(asm.R1, 0xfe), asm.MovSX(asm.R0, asm.R1, asm.Byte)}, math.MaxUint64 - 1},
+		{"MovSXH32", asm.Instructions{asm.Mov.Imm(asm.R1, 0xfffe), asm.MovSX32(asm.R0, asm.R1, asm.Half)}, math.MaxUint32 - 1},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			insns := append(tc.insns, asm.Return())
+			prog := mustNewProgram(t, ebpf.Kprobe, insns, nil)
+
+			vm := &Machine{prog: prog}
+			ret, err := vm.run(vm.newContext(prog.kind, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ret != tc.want {
+				t.Errorf("Expected %#x, got %#x", tc.want, ret)
+			}
+		})
+	}
+}
+
+func htons(v uint16) uint16 {
+	buf := make([]byte, 2)
+	binary.BigEndian.PutUint16(buf, v)
+	return nativeEndian.Uint16(buf)
+}
+
+func TestJumpsAndCalls(t *testing.T) {
+	insns := asm.Instructions{
+		asm.Mov.Imm(asm.R6, 0),
+		asm.Mov.Imm(asm.R1, 5).Sym("loop"),
+		asm.Call.Label("double"),
+		asm.Add.Reg(asm.R6, asm.R0),
+		asm.JLT.Imm(asm.R6, 30, "loop"),
+		asm.Mov.Reg(asm.R0, asm.R6),
+		asm.Return(),
+
+		asm.StoreMem(asm.RFP, -8, asm.R1, asm.DWord).Sym("double"),
+		asm.LoadMem(asm.R0, asm.RFP, -8, asm.DWord),
+		asm.Add.Reg(asm.R0, asm.R1),
+		asm.Return(),
+	}
+
+	prog := mustNewProgram(t, ebpf.Kprobe, insns, nil)
+	ret, _, err := prog.Test(make([]byte, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ret != 30 {
+		t.Error("Expected 30, got", ret)
+	}
+}
+
+func TestJump32(t *testing.T) {
+	// Only the lower 32 bit of r1 are compared.
+	insns := asm.Instructions{
+		asm.LoadImm(asm.R1, 1<<32|5, asm.DWord),
+		asm.Mov.Imm(asm.R0, 0),
+		asm.JEq.Imm(asm.R1, 5, "exit"),
+		asm.Mov.Imm(asm.R0, 1),
+		asm.JSLT.Imm32(asm.R1, 0, "exit"),
+		asm.JEq.Imm32(asm.R1, 5, "match"),
+		asm.Return().Sym("exit"),
+		asm.Mov.Imm(asm.R0, 2).Sym("match"),
+		asm.Return(),
+	}
+
+	prog := mustNewProgram(t, ebpf.Kprobe, insns, nil)
+	ret, _, err := prog.Test(make([]byte, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ret != 2 {
+		t.Error("Expected 2, got", ret)
+	}
+}
+
+func TestAtomics(t *testing.T) {
+	insns := asm.Instructions{
+		asm.StoreImm(asm.RFP, -8, 40, asm.DWord),
+		asm.Mov.Reg(asm.R1, asm.RFP),
+		asm.Add.Imm(asm.R1, -8),
+		// r2 = fetch_add(*r1, 2), *r1 is 42
+		asm.Mov.Imm(asm.R2, 2),
+		asm.FetchAdd.Mem(asm.R1, asm.R2, asm.DWord),
+		// Fails, since *r1 isn't 40 anymore
+		asm.Mov.Reg(asm.R0, asm.R2),
+		asm.Mov.Imm(asm.R3, 1),
+		asm.CmpXchg.Mem(asm.R1, asm.R3, asm.DWord),
+		// Succeeds, r0 holds the current value
+		asm.CmpXchg.Mem(asm.R1, asm.R3, asm.DWord),
+		// r0 = old value * 100 + new value
+		asm.Mul.Imm(asm.R0, 100),
+		asm.LoadMem(asm.R4, asm.R1, 0, asm.DWord),
+		asm.Add.Reg(asm.R0, asm.R4),
+		// Check the fetched value
+		asm.JEq.Imm(asm.R2, 40, "exit"),
+		asm.Mov.Imm(asm.R0, -1),
+		asm.Return().Sym("exit"),
+	}
+
+	prog := mustNewProgram(t, ebpf.Kprobe, insns, nil)
+	ret, _, err := prog.Test(make([]byte, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ret != 4201 {
+		t.Error("Expected 4201, got", ret)
+	}
+}
+
+func TestLoadMemSX(t *testing.T) {
+	insns := asm.Instructions{
+		asm.StoreImm(asm.RFP, -2, -42, asm.Half),
+		asm.LoadMemSX(asm.R0, asm.RFP, -2, asm.Half),
+		asm.LongJump("exit"),
+		asm.Mov.Imm(asm.R0, 0),
+		asm.Return().Sym("exit"),
+	}
+
+	prog := mustNewProgram(t, ebpf.Kprobe, insns, nil)
+	vm := &Machine{prog: prog}
+	ret, err := vm.run(vm.newContext(prog.kind, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if int64(ret) != -42 {
+		t.Error("Expected -42, got", int64(ret))
+	}
+}
+
+func TestStackBounds(t *testing.T) {
+	insns := asm.Instructions{
+		asm.StoreImm(asm.RFP, -(StackSize + 8), 0, asm.DWord),
+		asm.Mov.Imm(asm.R0, 0),
+		asm.Return(),
+	}
+
+	prog := mustNewProgram(t, ebpf.Kprobe, insns, nil)
+	if _, _, err := prog.Test(make([]byte, 8)); err == nil {
+		t.Error("Out of bounds stack access doesn't return an error")
+	}
+}
+
+func TestCalleeStack(t *testing.T) {
+	insns := asm.Instructions{
+		asm.Mov.Imm(asm.R6, 0),
+		asm.Call.Label("stack").Sym("loop"),
+		asm.Add.Imm(asm.R6, 1),
+		asm.JLT.Imm(asm.R6, 1000, "loop"),
+		asm.Mov.Imm(asm.R0, 0),
+		asm.Return(),
+
+		asm.Mov.Reg(asm.R0, asm.RFP).Sym("stack"),
+		asm.Add.Imm(asm.R0, -8),
+		asm.StoreImm(asm.R0, 0, 1, asm.DWord),
+		asm.Return(),
+	}
+
+	prog := mustNewProgram(t, ebpf.Kprobe, insns, nil)
+	vm := &Machine{prog: prog}
+	if _, err := vm.run(vm.newContext(prog.kind, make([]byte, 8))); err != nil {
+		t.Fatal(err)
+	}
+
+	var live int
+	for _, r := range vm.mem.regions {
+		if r != nil && len(r.data) == StackSize {
+			live++
+		}
+	}
+	if live != 1 {
+		t.Error("Expected only the stack of the program, got", live)
+	}
+
+	// Dereference the pointer into the stack of the callee.
+	insns = append(insns[:0:0], insns...)
+	insns[4] = asm.LoadMem(asm.R0, asm.R0, 0, asm.DWord)
+
+	prog = mustNewProgram(t, ebpf.Kprobe, insns, nil)
+	if _, _, err := prog.Test(make([]byte, 8)); err == nil {
+		t.Error("Access to the stack of a returned function doesn't return an error")
+	}
+}
+
+func TestXDP(t *testing.T) {
+	// Swap the first two bytes of the packet, if it's long enough.
+	insns := asm.Instructions{
+		asm.LoadMem(asm.R2, asm.R1, 0, asm.Word),
+		asm.LoadMem(asm.R3, asm.R1, 4, asm.Word),
+		asm.Mov.Reg(asm.R4, asm.R2),
+		asm.Add.Imm(asm.R4, 2),
+		asm.Mov.Imm(asm.R0, 1),
+		asm.JGT.Reg(asm.R4, asm.R3, "exit"),
+		asm.LoadMem(asm.R4, asm.R2, 0, asm.Byte),
+		asm.LoadMem(asm.R5, asm.R2, 1, asm.Byte),
+		asm.StoreMem(asm.R2, 0, asm.R5, asm.Byte),
+		asm.StoreMem(asm.R2, 1, asm.R4, asm.Byte),
+		asm.Mov.Imm(asm.R0, 2),
+		asm.Return().Sym("exit"),
+	}
+
+	prog := mustNewProgram(t, ebpf.XDP, insns, nil)
+
+	ret, out, err := prog.Test([]byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret != 2 {
+		t.Error("Expected return value 2, got", ret)
+	}
+	if !bytes.Equal(out, []byte{2, 1, 3}) {
+		t.Errorf("Packet wasn't modified: %v", out)
+	}
+
+	ret, _, err = prog.Test([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret != 1 {
+		t.Error("Expected return value 1 for short packet, got", ret)
+	}
+}
+
+func TestSocketFilterLoadAbs(t *testing.T) {
+	insns := asm.Instructions{
+		asm.Mov.Reg(asm.R6, asm.R1),
+		asm.LoadAbs(12, asm.Half),
+		asm.Return(),
+	}
+
+	prog := mustNewProgram(t, ebpf.SocketFilter, insns, nil)
+
+	pkt := make([]byte, 14)
+	pkt[12], pkt[13] = 0x08, 0x00
+	ret, _, err := prog.Test(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret != 0x0800 {
+		t.Errorf("Expected EtherType 0x800, got %#x", ret)
+	}
+
+	// Out of bounds loads terminate the program with 0
+	ret, _, err = prog.Test(pkt[:12])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret != 0 {
+		t.Error("Expected 0 for out of bounds load, got", ret)
+	}
+}
+
+func TestMapHelpers(t *testing.T) {
+	counters, err := NewMap(&ebpf.MapSpec{
+		Type:       ebpf.Hash,
+		KeySize:    4,
+		ValueSize:  8,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Increment the counter for key 1 and store the current time.
+	insns := asm.Instructions{
+		asm.StoreImm(asm.RFP, -4, 1, asm.Word),
+		asm.LoadImm(asm.R1, 0, asm.DWord),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -4),
+		asm.MapLookupElement.Call(),
+		asm.JEq.Imm(asm.R0, 0, "init"),
+		asm.Mov.Imm(asm.R1, 1),
+		asm.XAdd(asm.R0, asm.R1, asm.DWord),
+		asm.Ja.Label("exit"),
+
+		asm.KtimeGetNS.Call().Sym("init"),
+		asm.StoreMem(asm.RFP, -16, asm.R0, asm.DWord),
+		asm.LoadImm(asm.R1, 0, asm.DWord),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -4),
+		asm.Mov.Reg(asm.R3, asm.RFP),
+		asm.Add.Imm(asm.R3, -16),
+		asm.Mov.Imm(asm.R4, 0),
+		asm.MapUpdateElement.Call(),
+
+		asm.Return().Sym("exit"),
+	}
+	insns[1].Reference = "counters"
+	insns[11].Reference = "counters"
+
+	prog := mustNewProgram(t, ebpf.Kprobe, insns, map[string]*Map{"counters": counters})
+	prog.Helpers[asm.KtimeGetNS] = func(*Machine, uint64, uint64, uint64, uint64, uint64) (uint64, error) {
+		return 40, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := prog.Test(make([]byte, 8)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key := make([]byte, 4)
+	nativeEndian.PutUint32(key, 1)
+	value, err := counters.Lookup(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value == nil {
+		t.Fatal("Program didn't create the value")
+	}
+
+	if n := nativeEndian.Uint64(value); n != 42 {
+		t.Error("Expected counter to be 42, got", n)
+	}
+}
+
+func TestMap(t *testing.T) {
+	m, err := NewMap(&ebpf.MapSpec{
+		Type:       ebpf.Array,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := make([]byte, 4)
+	nativeEndian.PutUint32(key, 2)
+	if err := m.Update(key, make([]byte, 4), UpdateAny); err == nil {
+		t.Error("Update with out of bounds key doesn't fail")
+	}
+
+	nativeEndian.PutUint32(key, 1)
+	if err := m.Update(key, []byte{1, 2, 3, 4}, UpdateNoExist); err == nil {
+		t.Error("UpdateNoExist doesn't fail for array")
+	}
+	if err := m.Update(key, []byte{1, 2, 3, 4}, UpdateAny); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := m.Lookup(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(value, []byte{1, 2, 3, 4}) {
+		t.Error("Lookup returns wrong value:", value)
+	}
+
+	if _, err := NewMap(&ebpf.MapSpec{Type: ebpf.StackTrace, KeySize: 4, ValueSize: 4}); err == nil {
+		t.Error("NewMap accepts unsupported map type")
+	}
+}